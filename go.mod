@@ -1,5 +1,9 @@
 module github.com/remyoudompheng/go-misc
 
-go 1.12
+go 1.23
 
-require golang.org/x/tools v0.0.0-20190228203856-589c23e65e65
+require (
+	golang.org/x/net v0.0.0-20190213061140-3a22650c66bd
+	golang.org/x/text v0.3.0
+	golang.org/x/tools v0.0.0-20190228203856-589c23e65e65
+)
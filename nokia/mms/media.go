@@ -0,0 +1,182 @@
+package mms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+	"time"
+)
+
+// Metadata of voice notes and videos: AMR files (RFC 4867,
+// section 5) and 3GP files (ISO/IEC 14496-12 boxes).
+
+// MediaInfo is the metadata of an audio or video file.
+type MediaInfo struct {
+	Video    bool
+	Duration time.Duration
+	Codecs   []string  // AMR, AMR-WB, H.263, H.264, MPEG-4, AAC
+	Created  time.Time // zero if unknown
+}
+
+// String formats the duration and kind of the media,
+// as "0:42 voice message" or "1:05 video".
+func (m MediaInfo) String() string {
+	kind := "voice message"
+	if m.Video {
+		kind = "video"
+	}
+	d := m.Duration.Round(time.Second)
+	h, min, sec := int(d/time.Hour), int(d/time.Minute)%60, int(d/time.Second)%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d %s", h, min, sec, kind)
+	}
+	return fmt.Sprintf("%d:%02d %s", min, sec, kind)
+}
+
+// ErrUnknownMedia is returned for data that is not AMR or 3GP.
+var ErrUnknownMedia = errors.New("mms: unknown media format")
+
+// ParseMedia reads the metadata of an AMR or 3GP file.
+func ParseMedia(data []byte) (MediaInfo, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("#!AMR\n")):
+		return parseAMR(data[6:], amrFrameSizes[:], "AMR")
+	case bytes.HasPrefix(data, []byte("#!AMR-WB\n")):
+		return parseAMR(data[9:], amrWBFrameSizes[:], "AMR-WB")
+	case len(data) >= 8 && string(data[4:8]) == "ftyp":
+		return parse3GP(data)
+	}
+	return MediaInfo{}, ErrUnknownMedia
+}
+
+// Speech frame sizes, without the frame header, by frame type.
+var (
+	amrFrameSizes   = [16]int{12, 13, 15, 17, 19, 20, 26, 31, 5, 6, 5, 5}
+	amrWBFrameSizes = [16]int{17, 23, 32, 36, 40, 46, 50, 58, 60, 5}
+)
+
+// amrFrame is the duration of AMR frames.
+const amrFrame = 20 * time.Millisecond
+
+func parseAMR(data []byte, sizes []int, codec string) (MediaInfo, error) {
+	n := 0
+	for len(data) > 0 {
+		size := 1 + sizes[data[0]>>3&0xf]
+		if size > len(data) {
+			break // truncated frame
+		}
+		data = data[size:]
+		n++
+	}
+	return MediaInfo{Duration: time.Duration(n) * amrFrame, Codecs: []string{codec}}, nil
+}
+
+// sampleCodecs names the sample entries of 3GP tracks.
+var sampleCodecs = map[string]string{
+	"samr": "AMR",
+	"sawb": "AMR-WB",
+	"s263": "H.263",
+	"avc1": "H.264",
+	"mp4v": "MPEG-4",
+	"mp4a": "AAC",
+}
+
+// mp4Epoch is the origin of timestamps of ISO media files.
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func parse3GP(data []byte) (info MediaInfo, err error) {
+	moov := findBox(data, "moov")
+	if moov == nil {
+		return info, errors.New("mms: no moov box in 3GP file")
+	}
+	mvhd := findBox(moov, "mvhd")
+	be := binary.BigEndian
+	switch {
+	case len(mvhd) >= 20 && mvhd[0] == 0:
+		info.Created = boxTime(uint64(be.Uint32(mvhd[4:])))
+		info.Duration = boxDuration(uint64(be.Uint32(mvhd[16:])), be.Uint32(mvhd[12:]))
+	case len(mvhd) >= 32 && mvhd[0] == 1:
+		info.Created = boxTime(be.Uint64(mvhd[4:]))
+		info.Duration = boxDuration(be.Uint64(mvhd[24:]), be.Uint32(mvhd[20:]))
+	default:
+		return info, errors.New("mms: invalid mvhd box in 3GP file")
+	}
+	for trak := range boxes(moov) {
+		if trak.typ != "trak" {
+			continue
+		}
+		mdia := findBox(trak.data, "mdia")
+		if hdlr := findBox(mdia, "hdlr"); len(hdlr) >= 12 && string(hdlr[8:12]) == "vide" {
+			info.Video = true
+		}
+		stsd := findBox(findBox(findBox(mdia, "minf"), "stbl"), "stsd")
+		if len(stsd) < 16 {
+			continue
+		}
+		// Version, flags, entry count, then the first entry.
+		typ := string(stsd[12:16])
+		if c, ok := sampleCodecs[typ]; ok {
+			typ = c
+		}
+		info.Codecs = append(info.Codecs, strings.TrimSpace(typ))
+	}
+	return info, nil
+}
+
+func boxTime(secs uint64) time.Time {
+	if secs == 0 {
+		return time.Time{}
+	}
+	return mp4Epoch.Add(time.Duration(secs) * time.Second)
+}
+
+func boxDuration(d uint64, timescale uint32) time.Duration {
+	if timescale == 0 {
+		return 0
+	}
+	return time.Duration(d) * time.Second / time.Duration(timescale)
+}
+
+type box struct {
+	typ  string
+	data []byte // contents, after the header
+}
+
+// boxes iterates over the boxes of data.
+func boxes(data []byte) iter.Seq[box] {
+	return func(yield func(box) bool) {
+		for len(data) >= 8 {
+			size, hdr := uint64(binary.BigEndian.Uint32(data)), uint64(8)
+			switch size {
+			case 0:
+				size = uint64(len(data))
+			case 1:
+				if len(data) < 16 {
+					return
+				}
+				size, hdr = binary.BigEndian.Uint64(data[8:]), 16
+			}
+			if size < hdr || size > uint64(len(data)) {
+				return
+			}
+			if !yield(box{typ: string(data[4:8]), data: data[hdr:size]}) {
+				return
+			}
+			data = data[size:]
+		}
+	}
+}
+
+// findBox returns the contents of the first box of data
+// with the given type, or nil.
+func findBox(data []byte, typ string) []byte {
+	for b := range boxes(data) {
+		if b.typ == typ {
+			return b.data
+		}
+	}
+	return nil
+}
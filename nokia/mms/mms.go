@@ -7,6 +7,9 @@ package mms
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -36,6 +39,30 @@ const (
 	HdrSubject
 	HdrTo
 	HdrTransactionID
+
+	// MMS 1.1
+	HdrRetrieveStatus // 25
+	HdrRetrieveText
+	HdrReadStatus
+)
+
+// Values of the Message-Type header, as decoded in MMS.Header.
+const (
+	MSendReq = iota
+	MSendConf
+	MNotificationInd
+	MNotifyRespInd
+	MRetrieveConf
+	MAcknowledgeInd
+	MDeliveryInd
+	MReadRecInd  // read report, sent by the recipient
+	MReadOrigInd // read report, as received by the originator
+)
+
+// Values of the Read-Status header.
+const (
+	StatusRead = iota
+	StatusDeletedUnread
 )
 
 var headerNames = [...]string{
@@ -63,6 +90,9 @@ var headerNames = [...]string{
 	HdrSubject:          "Subject",
 	HdrTo:               "To",
 	HdrTransactionID:    "Transaction-Id",
+	HdrRetrieveStatus:   "Retrieve-Status",
+	HdrRetrieveText:     "Retrieve-Text",
+	HdrReadStatus:       "Read-Status",
 }
 
 const (
@@ -102,6 +132,9 @@ var headerTypes = [...]int{
 	HdrSubject:          hdrEncodedString,
 	HdrTo:               hdrEncodedString,
 	HdrTransactionID:    hdrEncodedString,
+	HdrRetrieveStatus:   hdrEnum,
+	HdrRetrieveText:     hdrEncodedString,
+	HdrReadStatus:       hdrEnum,
 }
 
 type ByteReader interface {
@@ -112,12 +145,29 @@ type ByteReader interface {
 
 type MMS struct {
 	Header map[string]string
+	Parts  []Part
 }
 
+// MessageType returns the value of the Message-Type header,
+// such as MRetrieveConf, or -1 if it is missing.
+func (m MMS) MessageType() int {
+	t, err := strconv.Atoi(m.Header["Message-Type"])
+	if err != nil {
+		return -1
+	}
+	return t
+}
+
+// ReadMMS decodes a MMS PDU. Content-Type is the last header
+// and is followed by the message body.
 func ReadMMS(r ByteReader) (mms MMS, err error) {
 	// Read headers.
 	for {
 		b, err := r.ReadByte()
+		if err == io.EOF && mms.Header != nil {
+			// headers only (e.g. notifications).
+			return mms, nil
+		}
 		if b <= 0x80 || b >= byte(0x80+len(headerTypes)) {
 			return mms, fmt.Errorf("invalid header ID: %x", b)
 		}
@@ -130,8 +180,26 @@ func ReadMMS(r ByteReader) (mms MMS, err error) {
 			value = fmt.Sprint(b - 0x80)
 		case hdrEncodedString:
 			value, err = r.ReadString(0)
-			value = value[:len(value)-1]
+			value = strings.TrimSuffix(value, "\x00")
 		case hdrContentType:
+			var params map[string]string
+			value, params, err = readContentType(r)
+			if err != nil {
+				return mms, err
+			}
+			if mms.Header == nil {
+				mms.Header = make(map[string]string)
+			}
+			mms.Header[key] = value
+			if strings.Contains(value, "multipart") {
+				mms.Parts, err = readMultipart(r)
+				return mms, err
+			}
+			// single part body.
+			p := Part{ContentType: value, Params: params}
+			p.Data, err = ioutil.ReadAll(r)
+			mms.Parts = []Part{p}
+			return mms, err
 		case hdrLongInt, hdrUnixTime:
 			// big-endian, variable length.
 			b, err = r.ReadByte()
@@ -151,9 +219,20 @@ func ReadMMS(r ByteReader) (mms MMS, err error) {
 			}
 		case hdrTime:
 			b, err = r.ReadByte() // length.
-			var buf [8]byte
-			_, err = io.ReadFull(r, buf[:b])
+			if err != nil {
+				return mms, err
+			}
+			if b < 2 || b > 10 {
+				return mms, fmt.Errorf("invalid time length %d", b)
+			}
+			var buf [10]byte
+			if _, err = io.ReadFull(r, buf[:b]); err != nil {
+				return mms, err
+			}
 			// buf[0] is type, buf[1] is int-length.
+			if int(buf[1]) > int(b)-2 {
+				return mms, fmt.Errorf("invalid time length %d", buf[1])
+			}
 			var n uint64
 			for _, c := range buf[2 : 2+buf[1]] {
 				n = (n << 8) | uint64(c)
@@ -168,14 +247,22 @@ func ReadMMS(r ByteReader) (mms MMS, err error) {
 			}
 		case hdrAddress:
 			b, err = r.ReadByte() // length
+			if err != nil {
+				return mms, err
+			}
+			if b == 0 {
+				return mms, fmt.Errorf("empty address")
+			}
 			s := make([]byte, b)
-			_, err = io.ReadFull(r, s)
+			if _, err = io.ReadFull(r, s); err != nil {
+				return mms, err
+			}
 			switch s[0] { // type
 			case 0x80:
-				value = string(s[1:])
+				value = strings.TrimSuffix(string(s[1:]), "\x00")
 			case 0x81:
 				// FIXME.
-				value = string(s[1:])
+				value = strings.TrimSuffix(string(s[1:]), "\x00")
 			default:
 				return mms, fmt.Errorf("invalid type for address: 0x%x", s[0])
 			}
@@ -187,7 +274,6 @@ func ReadMMS(r ByteReader) (mms MMS, err error) {
 		if mms.Header == nil {
 			mms.Header = make(map[string]string)
 		}
-		print(key, ": ", value, "\n")
 		mms.Header[key] = value
 		if err != nil {
 			return mms, err
@@ -0,0 +1,141 @@
+package mms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadMultipart(t *testing.T) {
+	pdu := []byte{
+		0x8c, 0x84, // m-retrieve-conf
+		0x8d, 0x90, // version 1.0
+		0x84, 0xa3, // Content-Type: application/vnd.wap.multipart.mixed
+		2, // 2 parts
+		// text/plain; Content-Location: hello.txt
+		12, 5, 0x83, 0x8e, 'h', 'e', 'l', 'l', 'o', '.', 't', 'x', 't', 0,
+		'H', 'e', 'l', 'l', 'o',
+		// image/jpeg; name=pic.jpg
+		11, 4, 0x0a, 0x9e, 0x85, 'p', 'i', 'c', '.', 'j', 'p', 'g', 0,
+		0xff, 0xd8, 0xff, 0xd9,
+	}
+	m, err := ReadMMS(bytes.NewBuffer(pdu))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := m.Header["Content-Type"]; ct != "application/vnd.wap.multipart.mixed" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	if len(m.Parts) != 2 {
+		t.Fatalf("got %d parts, expected 2", len(m.Parts))
+	}
+	p1, p2 := m.Parts[0], m.Parts[1]
+	if p1.ContentType != "text/plain" || p1.Filename() != "hello.txt" || string(p1.Data) != "Hello" {
+		t.Errorf("bad first part: %+v", p1)
+	}
+	if p2.ContentType != "image/jpeg" || p2.Filename() != "pic.jpg" || len(p2.Data) != 4 {
+		t.Errorf("bad second part: %+v", p2)
+	}
+}
+
+func TestReadReport(t *testing.T) {
+	pdu := []byte{
+		0x8c, 0x88, // m-read-orig-ind
+		0x8d, 0x91, // version 1.1
+		0x8b, 'i', 'd', '1', 0, // Message-ID
+		0x89, 7, 0x80, '+', '3', '3', '6', '1', 0, // From
+		0x85, 4, 0x4d, 0x1e, 0x6e, 0x80, // Date
+		0x9b, 0x80, // Read-Status: Read
+	}
+	m, err := ReadMMS(bytes.NewBuffer(pdu))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.MessageType() != MReadOrigInd {
+		t.Errorf("got message type %d", m.MessageType())
+	}
+	want := map[string]string{
+		"Message-Type": "8",
+		"MMS-Version":  "17",
+		"Message-ID":   "id1",
+		"From":         "+3361",
+		"Read-Status":  "0",
+	}
+	for k, v := range want {
+		if m.Header[k] != v {
+			t.Errorf("%s: got %q, want %q", k, m.Header[k], v)
+		}
+	}
+	if d, err := time.Parse(time.RFC1123Z, m.Header["Date"]); err != nil || d.Unix() != 1293840000 {
+		t.Errorf("got Date %q", m.Header["Date"])
+	}
+}
+
+func TestSniffType(t *testing.T) {
+	for _, tt := range []struct {
+		ctype string
+		data  string
+		want  string
+	}{
+		{"", "\xff\xd8\xff\xe0\x00\x10JFIF", "image/jpeg"},
+		{"application/octet-stream", "GIF89a\x01\x00", "image/gif"},
+		{"application/x-wsp-5a", "#!AMR\n\x3c", "audio/amr"},
+		{"", "\x00\x00\x00\x14ftyp3gp4\x00\x00\x02\x00", "video/3gpp"},
+		{"*/*", "MThd\x00\x00\x00\x06", "audio/midi"},
+		{"", "unknown", ""},
+		{"application/octet-stream", "unknown", "application/octet-stream"},
+		// Declared types are trusted.
+		{"image/png", "\xff\xd8\xff", "image/png"},
+	} {
+		p := Part{ContentType: tt.ctype, Data: []byte(tt.data)}
+		if got := p.MediaType(); got != tt.want {
+			t.Errorf("%q, %q: got %q, want %q", tt.ctype, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestParseMedia(t *testing.T) {
+	// 3 frames of 12.2 kbit/s, one of silence.
+	amr := []byte("#!AMR\n")
+	for _, ft := range []byte{7, 7, 7, 8} {
+		amr = append(amr, ft<<3|4)
+		amr = append(amr, make([]byte, amrFrameSizes[ft])...)
+	}
+	info, err := ParseMedia(amr)
+	if err != nil || info.Duration != 80*time.Millisecond || info.Video || info.Codecs[0] != "AMR" {
+		t.Errorf("AMR: got %+v, %v", info, err)
+	}
+
+	mkbox := func(typ string, data ...[]byte) []byte {
+		b := bytes.Join(data, nil)
+		return append(append(binary.BigEndian.AppendUint32(nil, uint32(8+len(b))), typ...), b...)
+	}
+	created := time.Date(2008, 5, 1, 12, 0, 0, 0, time.UTC)
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[4:], uint32(created.Sub(mp4Epoch)/time.Second))
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 42500)
+	trak := func(handler, codec string) []byte {
+		hdlr := append(make([]byte, 8), handler...)
+		stsd := append(make([]byte, 8), mkbox(codec, make([]byte, 20))...)
+		return mkbox("trak", mkbox("mdia", mkbox("hdlr", hdlr),
+			mkbox("minf", mkbox("stbl", mkbox("stsd", stsd)))))
+	}
+	gp := append(mkbox("ftyp", []byte("3gp4\x00\x00\x02\x003gp4")),
+		mkbox("moov", mkbox("mvhd", mvhd), trak("vide", "s263"), trak("soun", "samr"))...)
+	info, err = ParseMedia(gp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Created.Equal(created) || strings.Join(info.Codecs, ",") != "H.263,AMR" {
+		t.Errorf("3GP: got %+v", info)
+	}
+	if s := info.String(); s != "0:43 video" {
+		t.Errorf("got %q", s)
+	}
+	if _, err := ParseMedia([]byte("GIF89a")); err != ErrUnknownMedia {
+		t.Errorf("got error %v", err)
+	}
+}
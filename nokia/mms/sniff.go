@@ -0,0 +1,72 @@
+package mms
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Content sniffing, for parts sent without a useful content type.
+
+// signatures are the magic numbers of media found in MMS.
+var signatures = []struct {
+	magic string
+	typ   string
+}{
+	{"\xff\xd8\xff", "image/jpeg"},
+	{"GIF87a", "image/gif"},
+	{"GIF89a", "image/gif"},
+	{"\x89PNG\r\n\x1a\n", "image/png"},
+	{"BM", "image/bmp"},
+	{"#!AMR\n", "audio/amr"},
+	{"#!AMR-WB\n", "audio/amr-wb"},
+	{"MThd", "audio/midi"},
+	{"BEGIN:VCARD", "text/x-vCard"},
+	{"BEGIN:VCALENDAR", "text/x-vCalendar"},
+	{"<smil", "application/smil"},
+}
+
+// ftypBrands maps brands of ISO media files (3GP, MP4)
+// to media types, by prefix.
+var ftypBrands = []struct {
+	brand string
+	typ   string
+}{
+	{"3gp", "video/3gpp"},
+	{"3g2", "video/3gpp2"},
+	{"M4A", "audio/mp4"},
+	{"mp4", "video/mp4"},
+	{"isom", "video/mp4"},
+}
+
+// SniffType returns the media type of data guessed from its first
+// bytes, or the empty string if it is not recognized.
+func SniffType(data []byte) string {
+	for _, s := range signatures {
+		if bytes.HasPrefix(data, []byte(s.magic)) {
+			return s.typ
+		}
+	}
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" {
+		for _, b := range ftypBrands {
+			if strings.HasPrefix(string(data[8:12]), b.brand) {
+				return b.typ
+			}
+		}
+	}
+	return ""
+}
+
+// MediaType returns the content type of the part, sniffed from
+// its data if the declared type is missing or not specific.
+func (p Part) MediaType() string {
+	switch {
+	case p.ContentType == "", p.ContentType == "*/*",
+		p.ContentType == "application/*",
+		p.ContentType == "application/octet-stream",
+		strings.HasPrefix(p.ContentType, "application/x-wsp-"):
+		if t := SniffType(p.Data); t != "" {
+			return t
+		}
+	}
+	return p.ContentType
+}
@@ -0,0 +1,369 @@
+package mms
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Decoding of WSP content types and multipart bodies.
+// See WAP-230-WSP, sections 8.4.2.24 and 8.5.
+
+// A Part is an entry of a multipart MMS body.
+type Part struct {
+	ContentType string
+	Params      map[string]string // Content-Type parameters (name, charset...)
+	Headers     map[string]string // Content-Location, Content-ID...
+	Data        []byte
+}
+
+// Filename returns the name of the part as indicated in its headers.
+func (p Part) Filename() string {
+	for _, s := range []string{
+		p.Params["name"],
+		p.Params["filename"],
+		p.Headers["Content-Location"],
+	} {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// Well-known media types: WAP-230-WSP, Appendix A, table 40.
+var contentTypes = [...]string{
+	0x00: "*/*",
+	0x01: "text/*",
+	0x02: "text/html",
+	0x03: "text/plain",
+	0x04: "text/x-hdml",
+	0x05: "text/x-ttml",
+	0x06: "text/x-vCalendar",
+	0x07: "text/x-vCard",
+	0x08: "text/vnd.wap.wml",
+	0x09: "text/vnd.wap.wmlscript",
+	0x0A: "text/vnd.wap.wta-event",
+	0x0B: "multipart/*",
+	0x0C: "multipart/mixed",
+	0x0D: "multipart/form-data",
+	0x0E: "multipart/byterantes",
+	0x0F: "multipart/alternative",
+	0x10: "application/*",
+	0x11: "application/java-vm",
+	0x12: "application/x-www-form-urlencoded",
+	0x13: "application/x-hdmlc",
+	0x14: "application/vnd.wap.wmlc",
+	0x15: "application/vnd.wap.wmlscriptc",
+	0x16: "application/vnd.wap.wta-eventc",
+	0x17: "application/vnd.wap.uaprof",
+	0x18: "application/vnd.wap.wtls-ca-certificate",
+	0x19: "application/vnd.wap.wtls-user-certificate",
+	0x1A: "application/x-x509-ca-cert",
+	0x1B: "application/x-x509-user-cert",
+	0x1C: "image/*",
+	0x1D: "image/gif",
+	0x1E: "image/jpeg",
+	0x1F: "image/tiff",
+	0x20: "image/png",
+	0x21: "image/vnd.wap.wbmp",
+	0x22: "application/vnd.wap.multipart.*",
+	0x23: "application/vnd.wap.multipart.mixed",
+	0x24: "application/vnd.wap.multipart.form-data",
+	0x25: "application/vnd.wap.multipart.byteranges",
+	0x26: "application/vnd.wap.multipart.alternative",
+	0x27: "application/xml",
+	0x28: "text/xml",
+	0x29: "application/vnd.wap.wbxml",
+	0x2A: "application/x-x968-cross-cert",
+	0x2B: "application/x-x968-ca-cert",
+	0x2C: "application/x-x968-user-cert",
+	0x2D: "text/vnd.wap.si",
+	0x2E: "application/vnd.wap.sic",
+	0x2F: "text/vnd.wap.sl",
+	0x30: "application/vnd.wap.slc",
+	0x31: "text/vnd.wap.co",
+	0x32: "application/vnd.wap.coc",
+	0x33: "application/vnd.wap.multipart.related",
+	0x34: "application/vnd.wap.sia",
+	0x35: "text/vnd.wap.connectivity-xml",
+	0x36: "application/vnd.wap.connectivity-wbxml",
+	0x37: "application/pkcs7-mime",
+	0x38: "application/vnd.wap.hashed-certificate",
+	0x39: "application/vnd.wap.signed-certificate",
+	0x3A: "application/vnd.wap.cert-response",
+	0x3B: "application/xhtml+xml",
+	0x3C: "application/wml+xml",
+	0x3D: "text/css",
+	0x3E: "application/vnd.wap.mms-message",
+}
+
+// Well-known parameters: WAP-230-WSP, table 38.
+var paramNames = map[byte]string{
+	0x01: "charset",
+	0x02: "level",
+	0x03: "type",
+	0x05: "name",
+	0x06: "filename",
+	0x09: "type",
+	0x0A: "start",
+	0x0B: "start-info",
+	0x17: "name",
+	0x18: "filename",
+	0x19: "start",
+	0x1A: "start-info",
+}
+
+// Well-known charsets (IANA MIBenum).
+var charsets = map[int]string{
+	3:    "us-ascii",
+	4:    "iso-8859-1",
+	106:  "utf-8",
+	1000: "iso-10646-ucs-2",
+	1015: "utf-16",
+}
+
+// Well-known header fields for parts: WAP-230-WSP, table 39.
+var partHeaderNames = map[byte]string{
+	0x0E: "Content-Location",
+	0x2E: "Content-Disposition",
+	0x40: "Content-ID",
+	0x45: "Content-Disposition",
+}
+
+func mediaType(code int) string {
+	if code < len(contentTypes) && contentTypes[code] != "" {
+		return contentTypes[code]
+	}
+	return fmt.Sprintf("application/x-wsp-%02x", code)
+}
+
+func readUintvar(r io.ByteReader) (uint64, error) {
+	var n uint64
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		n = n<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			return n, nil
+		}
+	}
+	return n, fmt.Errorf("uintvar too long")
+}
+
+// readValueLength reads a Value-length whose first byte is b.
+func readValueLength(r io.ByteReader, b byte) (int, error) {
+	if b < 31 {
+		return int(b), nil
+	}
+	n, err := readUintvar(r)
+	return int(n), err
+}
+
+// readText reads a NUL-terminated Text-string, given its first byte.
+func readText(r ByteReader, first byte) (string, error) {
+	if first == 0 {
+		return "", nil
+	}
+	s, err := r.ReadString(0)
+	s = strings.TrimSuffix(s, "\x00")
+	if first == 0x7f || first == '"' {
+		// quote characters.
+		return s, err
+	}
+	return string(first) + s, err
+}
+
+// readInteger reads an Integer-value given its first byte.
+func readInteger(r io.ByteReader, first byte) (int, error) {
+	if first >= 0x80 {
+		return int(first & 0x7f), nil
+	}
+	if first > 8 {
+		return 0, fmt.Errorf("integer too large")
+	}
+	n := 0
+	for i := 0; i < int(first); i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		n = n<<8 | int(b)
+	}
+	return n, nil
+}
+
+// readContentType reads a Content-type-value.
+func readContentType(r ByteReader) (ctype string, params map[string]string, err error) {
+	b, err := r.ReadByte()
+	switch {
+	case err != nil:
+		return "", nil, err
+	case b >= 0x80:
+		// Constrained-media: well-known type.
+		return mediaType(int(b & 0x7f)), nil, nil
+	case b >= 32:
+		// Constrained-media: extension media.
+		ctype, err = readText(r, b)
+		return ctype, nil, err
+	}
+	// Content-general-form: Value-length Media-type *(Parameter)
+	length, err := readValueLength(r, b)
+	if err != nil {
+		return "", nil, err
+	}
+	data := make([]byte, length)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return "", nil, err
+	}
+	buf := bytes.NewBuffer(data)
+	b, err = buf.ReadByte()
+	switch {
+	case err != nil:
+		return "", nil, err
+	case b >= 32 && b < 0x80:
+		ctype, err = readText(buf, b)
+	default:
+		var code int
+		code, err = readInteger(buf, b)
+		ctype = mediaType(code)
+	}
+	if err != nil {
+		return ctype, nil, err
+	}
+	params = make(map[string]string)
+	for buf.Len() > 0 {
+		if err = readParam(buf, params); err != nil {
+			return ctype, params, err
+		}
+	}
+	return ctype, params, nil
+}
+
+func readParam(buf *bytes.Buffer, params map[string]string) error {
+	b, _ := buf.ReadByte()
+	var name string
+	if b >= 0x80 {
+		code := b & 0x7f
+		name = paramNames[code]
+		if name == "" {
+			name = strconv.Itoa(int(code))
+		}
+		if name == "charset" {
+			b, _ = buf.ReadByte()
+			n, err := readInteger(buf, b)
+			if err != nil {
+				return err
+			}
+			if cs, ok := charsets[n]; ok {
+				params[name] = cs
+			} else {
+				params[name] = strconv.Itoa(n)
+			}
+			return nil
+		}
+	} else {
+		// Untyped parameter.
+		var err error
+		name, err = readText(buf, b)
+		if err != nil {
+			return err
+		}
+	}
+	value, err := readValue(buf)
+	params[name] = value
+	return err
+}
+
+// readValue reads a generic header or parameter value,
+// returning its textual representation if any.
+func readValue(buf *bytes.Buffer) (string, error) {
+	b, err := buf.ReadByte()
+	switch {
+	case err != nil:
+		return "", err
+	case b >= 0x80:
+		// short-integer
+		return strconv.Itoa(int(b & 0x7f)), nil
+	case b <= 31:
+		length, err := readValueLength(buf, b)
+		if err != nil {
+			return "", err
+		}
+		if length > buf.Len() {
+			return "", io.ErrUnexpectedEOF
+		}
+		buf.Next(length)
+		return "", nil
+	default:
+		return readText(buf, b)
+	}
+}
+
+// readMultipart reads a multipart body (WAP-230-WSP section 8.5).
+func readMultipart(r ByteReader) ([]Part, error) {
+	n, err := readUintvar(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > 1000 {
+		return nil, fmt.Errorf("too many parts (%d)", n)
+	}
+	parts := make([]Part, 0, n)
+	for i := 0; i < int(n); i++ {
+		hlen, err := readUintvar(r)
+		if err != nil {
+			return parts, err
+		}
+		dlen, err := readUintvar(r)
+		if err != nil {
+			return parts, err
+		}
+		if hlen > 1<<16 || dlen > 1<<26 {
+			return parts, fmt.Errorf("invalid part size %d+%d", hlen, dlen)
+		}
+		hdr := make([]byte, hlen)
+		if _, err = io.ReadFull(r, hdr); err != nil {
+			return parts, err
+		}
+		buf := bytes.NewBuffer(hdr)
+		var p Part
+		p.ContentType, p.Params, err = readContentType(buf)
+		if err != nil {
+			return parts, err
+		}
+		p.Headers = make(map[string]string)
+		for buf.Len() > 0 {
+			b, _ := buf.ReadByte()
+			var key, value string
+			if b >= 0x80 {
+				key = partHeaderNames[b&0x7f]
+				if key == "" {
+					key = fmt.Sprintf("X-Wsp-%02x", b&0x7f)
+				}
+				value, err = readValue(buf)
+			} else {
+				// Application-header: Token-text Application-specific-value
+				key, err = readText(buf, b)
+				if err == nil {
+					b, _ = buf.ReadByte()
+					value, err = readText(buf, b)
+				}
+			}
+			if err != nil {
+				return parts, err
+			}
+			p.Headers[key] = value
+		}
+		p.Data = make([]byte, dlen)
+		if _, err = io.ReadFull(r, p.Data); err != nil {
+			return parts, err
+		}
+		parts = append(parts, p)
+	}
+	return parts, nil
+}
@@ -0,0 +1,399 @@
+package nbf
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"mime/quotedprintable"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf/gsm7"
+)
+
+// Anonymize writes a copy of the archive to w where phone numbers,
+// names and message texts are replaced by deterministic pseudonyms
+// of the same length, preserving the binary structure of entries.
+// Identical values map to identical pseudonyms for a given key.
+// Entry names of messages are rebuilt from the pseudonymized
+// addresses, with valid checksums.
+//
+// Text messages, contacts, calendars and folders are copied. MMS, media files and
+// undecodable messages, which cannot be anonymized, are dropped
+// and logged.
+func (r *Reader) Anonymize(w io.Writer, key string) error {
+	return r.AnonymizeContext(context.Background(), w, key)
+}
+
+// AnonymizeContext is like Anonymize, but stops when ctx is done,
+// returning the error of ctx. The output is then incomplete.
+func (r *Reader) AnonymizeContext(ctx context.Context, w io.Writer, key string) error {
+	a := anonymizer{key: []byte(key)}
+	zw := zip.NewWriter(w)
+	for f := range r.files() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if f.Mode().IsDir() {
+			// Directories keep empty folders, see Folders.
+			if _, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Modified: f.Modified}); err != nil {
+				return err
+			}
+			continue
+		}
+		name, ext := f.Name, path.Ext(f.Name)
+		info, infoErr := ParseFilename(path.Base(name))
+		isMessage := strings.HasPrefix(name, "predefmessages/")
+		switch {
+		case isMessage && infoErr == nil && info.Flags&FLAGS_MMS != 0:
+			log.Printf("dropping %s: MMS are not anonymized", name)
+			continue
+		case isMessage && infoErr != nil:
+			log.Printf("dropping %s: %s", name, infoErr)
+			continue
+		case !isMessage && !strings.EqualFold(ext, ".vcf") && !strings.EqualFold(ext, ".vcs"):
+			log.Printf("dropping %s: media files are not anonymized", name)
+			continue
+		}
+		blob, err := readEntry(f, r.Password)
+		if err != nil {
+			return err
+		}
+		if isMessage {
+			addr, err := a.message(blob)
+			if err != nil {
+				log.Printf("dropping %s: %s", name, err)
+				continue
+			}
+			// The peer of the name is the end of the address,
+			// or zeros for alphanumeric addresses.
+			if n := len(strings.TrimLeft(info.Peer, "0")); n > 0 {
+				info.Peer = addr[max(len(addr)-n, 0):]
+			}
+			name = path.Join(path.Dir(name), info.Filename())
+		} else if strings.EqualFold(ext, ".vcs") {
+			blob = a.vcalendar(blob)
+		} else {
+			blob = a.vcard(blob)
+		}
+		hdr := &zip.FileHeader{Name: name, Method: entryMethod(f), Modified: f.Modified}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(blob); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+type anonymizer struct {
+	key []byte
+}
+
+func (a anonymizer) rand(kind, s string) *rand.Rand {
+	mac := hmac.New(sha256.New, a.key)
+	io.WriteString(mac, kind)
+	mac.Write([]byte{0})
+	io.WriteString(mac, s)
+	seed := mac.Sum(nil)
+	return rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(seed))))
+}
+
+// text replaces letters and digits of s, preserving case and length.
+func (a anonymizer) text(s string) string {
+	rng := a.rand("text", s)
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsUpper(r):
+			return 'A' + rune(rng.Intn(26))
+		case unicode.IsLetter(r):
+			return 'a' + rune(rng.Intn(26))
+		case unicode.IsDigit(r):
+			return '0' + rune(rng.Intn(10))
+		}
+		return r
+	}, s)
+}
+
+// number replaces digits of a phone number, keeping the first two
+// (usually a country or area code). The result only depends on
+// the digits of s.
+func (a anonymizer) number(s string) string {
+	digits := strings.Map(func(r rune) rune {
+		if '0' <= r && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	rng := a.rand("number", digits)
+	n := 0
+	return strings.Map(func(r rune) rune {
+		if '0' <= r && r <= '9' {
+			n++
+			if n > 2 {
+				return '0' + rune(rng.Intn(10))
+			}
+		}
+		return r
+	}, s)
+}
+
+// septets anonymizes GSM 7-bit text in place. Letters of the
+// default alphabet and of the extension table are replaced by
+// ASCII letters of the same case, and digits by digits.
+func (a anonymizer) septets(s []byte) {
+	rng := a.rand("text", string(s))
+	pseudonym := func(r rune) (byte, bool) {
+		switch {
+		case unicode.IsUpper(r):
+			return 'A' + byte(rng.Intn(26)), true
+		case unicode.IsLetter(r):
+			return 'a' + byte(rng.Intn(26)), true
+		case unicode.IsDigit(r):
+			return '0' + byte(rng.Intn(10)), true
+		}
+		return 0, false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == gsm7.Escape && i+1 < len(s) {
+			// The escape and the extension letter are replaced
+			// by 2 letters, keeping the length.
+			r := gsm7.DefaultExtension[s[i+1]&0x7f]
+			if c, ok := pseudonym(r); ok {
+				s[i] = c
+				s[i+1], _ = pseudonym(r)
+			}
+			i++
+			continue
+		}
+		if c, ok := pseudonym(gsm7.DefaultAlphabet[s[i]&0x7f]); ok {
+			s[i] = c
+		}
+	}
+}
+
+// utf16 anonymizes UTF-16BE text in place.
+func (a anonymizer) utf16(b []byte, number bool) {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+	for len(units) > 0 && units[len(units)-1] == 0 {
+		units = units[:len(units)-1]
+	}
+	s := string(utf16.Decode(units))
+	if number {
+		s = a.number(s)
+	} else {
+		s = a.text(s)
+	}
+	repl := utf16.Encode([]rune(s))
+	for i := range units {
+		if i < len(repl) {
+			binary.BigEndian.PutUint16(b[2*i:], repl[i])
+		}
+	}
+}
+
+// message anonymizes a message body in place, returning
+// the new address of the PDU.
+func (a anonymizer) message(s []byte) (addr string, err error) {
+	if _, err := ParseEntry(s); err != nil {
+		return "", err
+	}
+	if err := a.messageBody(s); err != nil {
+		return "", err
+	}
+	m, err := ParseEntry(s)
+	if err != nil {
+		return "", err
+	}
+	switch msg := m.Msg.(type) {
+	case Deliver:
+		addr = msg.FromAddr
+	case Submit:
+		addr = msg.ToAddr
+	}
+	return addr, nil
+}
+
+func (a anonymizer) messageBody(s []byte) error {
+	l := layoutOf(s)
+	end := l.PeerOffset
+	for end+1 < l.PDUOffset && s[end]|s[end+1] != 0 {
+		end += 2
+	}
+	a.utf16(s[l.PeerOffset:end], false)
+
+	pdu := s[l.PDUOffset:]
+	var off int
+	switch pdu[0] & 3 {
+	case 0: // SMS-DELIVER: address at offset 1
+		off = 1
+	case 1, 2: // SMS-SUBMIT, SMS-STATUS-REPORT: address at offset 2
+		off = 2
+	}
+	addrLen, toa := int(pdu[off]), pdu[off+1]
+	addr := pdu[off+2 : off+2+(addrLen+1)/2]
+	if (toa>>4)&7 == 5 {
+		// alphanumeric
+		septets := gsm7.Unpack(addr)
+		a.septets(septets)
+		copy(addr, gsm7.Pack(septets))
+	} else {
+		// Only digits are replaced: other semi-octets (*, #, a-c)
+		// are kept.
+		num, ok := encodeBCD(a.number(decodeBCD(addr)[:addrLen]))
+		if !ok || len(num) != len(addr) {
+			return fmt.Errorf("%w: invalid address", ErrCorrupt)
+		}
+		copy(addr, num)
+	}
+	off += 2 + len(addr)
+	if pdu[0]&3 == 2 {
+		off += 7 + 7 + 1 // SCTS, DT, ST
+	} else {
+		udhi := pdu[0]&0x40 != 0
+		coding := DecodeDCS(pdu[off+1])
+		if pdu[0]&3 == 0 {
+			off += 2 + 7 // PID, DCS, SCTS
+		} else {
+			off += 2 + vpSize[pdu[0]>>3&3] // PID, DCS, VP
+		}
+		udl := int(pdu[off])
+		ud := pdu[off+1:]
+		switch {
+		case coding.Compressed:
+			off += 1 + udl
+		case coding.Alphabet == UCS2:
+			skip := 0
+			if udhi {
+				skip = int(ud[0]) + 1
+			}
+			a.utf16(ud[skip:udl], false)
+			off += 1 + udl
+		case coding.Alphabet == Data8:
+			off += 1 + udl
+		default: // GSM 7-bit
+			packed := ud[:(udl*7+7)/8]
+			septets := gsm7.Unpack(packed)[:udl]
+			skip := 0
+			if udhi {
+				skip = (8*(int(ud[0])+1) + 6) / 7
+			}
+			a.septets(septets[skip:])
+			copy(packed, gsm7.Pack(septets))
+			off += 1 + len(packed)
+		}
+	}
+
+	// trailing text and peers
+	rest := pdu[off:]
+	if len(rest) < 72 {
+		return nil
+	}
+	rest = rest[65:]
+	length := int(binary.BigEndian.Uint16(rest[4:6]))
+	rest = rest[6:]
+	if length > len(rest) {
+		return nil
+	}
+	a.utf16(rest[:length], false)
+	data := rest[length:]
+	for idx := 0; ; idx++ {
+		i := bytes.Index(data, []byte{4, 0, 1, byte(idx), 0x2b})
+		if i < 0 || i+7 > len(data) {
+			break
+		}
+		data = data[i+5:]
+		n := int(binary.BigEndian.Uint16(data))
+		if 2+n > len(data) {
+			break
+		}
+		a.utf16(data[2:2+n], true)
+		data = data[2+n:]
+		if i := bytes.IndexByte(data, 0x2c); i >= 0 && i+3 <= len(data) {
+			data = data[i+1:]
+			n := int(binary.BigEndian.Uint16(data))
+			if 2+n > len(data) {
+				break
+			}
+			a.utf16(data[2:2+n], false)
+			data = data[2+n:]
+		}
+	}
+	return nil
+}
+
+// vcard anonymizes vCard files, keeping only identity and
+// telephony properties.
+func (a anonymizer) vcard(data []byte) []byte {
+	buf := new(bytes.Buffer)
+	for _, line := range unfoldVCard(data) {
+		idx := strings.IndexByte(line, ':')
+		if idx < 0 {
+			continue
+		}
+		params := strings.Split(line[:idx], ";")
+		prop, value := strings.ToUpper(params[0]), line[idx+1:]
+		var kept []string
+		for _, p := range params[1:] {
+			if strings.Contains(strings.ToUpper(p), "QUOTED-PRINTABLE") {
+				b, err := ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(value)))
+				if err == nil {
+					value = string(b)
+				}
+				continue
+			}
+			kept = append(kept, p)
+		}
+		switch prop {
+		case "BEGIN", "END", "VERSION":
+		case "TEL":
+			value = a.number(value)
+		case "N", "FN", "EMAIL", "NOTE", "ADR", "ORG", "TITLE", "URL":
+			value = a.text(value)
+		default:
+			continue
+		}
+		buf.WriteString(strings.Join(append([]string{params[0]}, kept...), ";"))
+		buf.WriteString(":" + value + "\r\n")
+	}
+	return buf.Bytes()
+}
+
+// vcalendar anonymizes vCalendar files, keeping dates,
+// recurrence rules and alarms.
+func (a anonymizer) vcalendar(data []byte) []byte {
+	buf := new(bytes.Buffer)
+	for _, line := range unfoldVCard(data) {
+		prop, _, value, ok := parseProperty(line)
+		if !ok {
+			continue
+		}
+		switch prop {
+		case "BEGIN", "END", "VERSION", "DTSTART", "DTEND", "DUE", "RRULE",
+			"AALARM", "DALARM", "CATEGORIES", "STATUS", "PRIORITY", "COMPLETED",
+			"LAST-MODIFIED", "X-EPOCAGENDAENTRYTYPE":
+		case "SUMMARY", "DESCRIPTION", "LOCATION":
+			prop += ";CHARSET=UTF-8"
+			value = a.text(value)
+		default:
+			continue
+		}
+		buf.WriteString(prop + ":" + value + "\r\n")
+	}
+	return buf.Bytes()
+}
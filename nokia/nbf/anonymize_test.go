@@ -0,0 +1,177 @@
+package nbf
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf/gsm7"
+)
+
+// sampleWith writes a copy of testdata/sample.nbf with additional
+// entries to a temporary file and returns its name.
+func sampleWith(t *testing.T, extra map[string]string) string {
+	z, err := zip.OpenReader("testdata/sample.nbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range z.File {
+		rd, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw, err := w.Create(f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(fw, rd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, data := range extra {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "sample.nbf")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestAnonymize(t *testing.T) {
+	r, err := OpenFile(sampleWith(t, map[string]string{
+		"predefcontacts/1.vcf":             "BEGIN:VCARD\r\nVERSION:2.1\r\nN:Dupont;Jean\r\nTEL;CELL:+33612345678\r\nEND:VCARD\r\n",
+		"predefgallery/predefphotos/1.jpg": "\xff\xd8\xff\xd9",
+		"predefmessages/7/":                "",
+		"predefcalendar/1.vcs": "BEGIN:VCALENDAR\r\nVERSION:1.0\r\nBEGIN:VEVENT\r\n" +
+			"SUMMARY;ENCODING=QUOTED-PRINTABLE:D=C3=A9ntist\r\nLOCATION:Rue de la Paix\r\n" +
+			"DTSTART:20100104T090000Z\r\nRRULE:W1 MO #0\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var buf bytes.Buffer
+	if err := r.Anonymize(&buf, "key"); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "anonymized.nbf")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := OpenFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	if problems, err := out.Verify(); err != nil || len(problems) > 0 {
+		t.Errorf("anonymized archive: got problems %v, %v", problems, err)
+	}
+	out.Mode = Strict
+	inbox, err := out.Inbox()
+	if err != nil || len(inbox) != 2 {
+		t.Fatalf("got inbox %v, %v", inbox, err)
+	}
+	outbox, err := out.Outbox()
+	if err != nil || len(outbox) != 1 {
+		t.Fatalf("got outbox %v, %v", outbox, err)
+	}
+	for i, m := range append(inbox, outbox...) {
+		if m.Text == "" || strings.Contains(m.Text, "Hello") || strings.Contains(m.Text, "Bob") {
+			t.Errorf("message %d: text %q is not anonymized", i, m.Text)
+		}
+	}
+	// The same number has the same pseudonym everywhere.
+	if p := inbox[0].Peer; p == "+33612345678" || len(p) != len("+33612345678") || inbox[1].Peer != p {
+		t.Errorf("got peers %q, %q", p, inbox[1].Peer)
+	}
+	for _, f := range out.z.File {
+		if !strings.HasPrefix(f.Name, "predefmessages/") || f.Mode().IsDir() {
+			continue
+		}
+		info, err := ParseFilename(filepath.Base(f.Name))
+		if err != nil {
+			t.Errorf("bad entry name %s: %s", f.Name, err)
+		} else if info.Flags&FLAGS_MMS != 0 {
+			t.Errorf("MMS %s was copied", f.Name)
+		}
+	}
+	if folders := out.Folders(); len(folders) == 0 || folders[len(folders)-1].ID != 7 {
+		t.Errorf("empty folder was dropped: got %+v", folders)
+	}
+	cal, err := out.Calendar()
+	if err != nil || len(cal) != 1 {
+		t.Fatalf("got calendar %+v, %v", cal, err)
+	}
+	if e := cal[0]; e.Summary == "Déntist" || len([]rune(e.Summary)) != len("Dentist") ||
+		strings.Contains(e.Location, "Paix") || !e.Start.Equal(time.Date(2010, 1, 4, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("got calendar entry %+v", e)
+	}
+	contacts, err := out.Contacts()
+	if err != nil || len(contacts) != 1 {
+		t.Fatalf("got contacts %+v, %v", contacts, err)
+	}
+	if c := contacts[0]; strings.Contains(c.Name, "Dupont") || c.Phones[0].Number != inbox[0].Peer {
+		t.Errorf("got contact %+v", c)
+	}
+}
+
+func TestAnonymizeSeptets(t *testing.T) {
+	const text = "Élève à Ñandü: ΔΦ, Straße 42 {x}"
+	septets, err := gsm7.Default.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := anonymizer{key: []byte("key")}
+	out := append([]byte(nil), septets...)
+	a.septets(out)
+	b, err := gsm7.Default.NewDecoder().Bytes(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	if []rune(got)[0] == 'É' || len([]rune(got)) != len([]rune(text)) {
+		t.Fatalf("got %q from %q", got, text)
+	}
+	for i, r := range []rune(text) {
+		g := []rune(got)[i]
+		switch {
+		case unicode.IsUpper(r):
+			if g < 'A' || g > 'Z' {
+				t.Errorf("%q replaced by %q", r, g)
+			}
+		case unicode.IsLetter(r):
+			if g < 'a' || g > 'z' {
+				t.Errorf("%q replaced by %q", r, g)
+			}
+		case unicode.IsDigit(r):
+			if g < '0' || g > '9' {
+				t.Errorf("%q replaced by %q", r, g)
+			}
+		case g != r:
+			t.Errorf("%q replaced by %q", r, g)
+		}
+	}
+	again := append([]byte(nil), septets...)
+	a.septets(again)
+	if !bytes.Equal(again, out) {
+		t.Errorf("pseudonyms are not deterministic: %q, %q", out, again)
+	}
+}
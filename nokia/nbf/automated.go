@@ -0,0 +1,67 @@
+package nbf
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A Sender classifies the sender of a received message.
+type Sender int
+
+const (
+	Person       Sender = iota // a phone number, presumably a person
+	ShortCode                  // a number of at most 6 digits
+	Alphanumeric               // a name, used by companies
+	Notification               // a text matching NotificationPatterns
+)
+
+func (s Sender) String() string {
+	switch s {
+	case Person:
+		return "person"
+	case ShortCode:
+		return "shortcode"
+	case Alphanumeric:
+		return "alphanumeric"
+	case Notification:
+		return "notification"
+	}
+	return "unknown"
+}
+
+// NotificationPatterns match texts of automated messages sent
+// from ordinary numbers: one-time codes, delivery notices,
+// opt-out instructions. Users may add patterns.
+var NotificationPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(code|otp|pin|password|mot de passe|passwort|código|codice)\b\D{0,30}\d{4,8}\b`),
+	regexp.MustCompile(`(?i)\b\d{4,8}\b\D{0,30}\b(is your|est votre|ist ihr) `),
+	regexp.MustCompile(`(?i)\b(do not reply|no-?reply|ne pas répondre|nicht antworten|no responda)\b`),
+	regexp.MustCompile(`(?i)\b(stop|stop sms)( to| au| an)? \+?\d{3,6}\b`),
+	regexp.MustCompile(`(?i)\b(you have|vous avez) \d+ (new )?(voice ?mail|messages? vocaux?|nouveaux? messages?)`),
+}
+
+// Classify classifies the sender of m. Sent messages and drafts
+// are classified as Person.
+func Classify(m SMS) Sender {
+	if m.Type != 0 {
+		return Person
+	}
+	peer := normalizePeer(m.Peer)
+	switch {
+	case m.TOA.TON() == TONAlphanumeric,
+		peer != "" && strings.Trim(peer, "+0123456789") != "":
+		return Alphanumeric
+	case peer != "" && !strings.HasPrefix(peer, "+") && len(peer) <= 6:
+		return ShortCode
+	}
+	for _, re := range NotificationPatterns {
+		if re.MatchString(m.Text) {
+			return Notification
+		}
+	}
+	return Person
+}
+
+// Automated reports whether m was sent by a machine rather
+// than a person, according to Classify.
+func (m SMS) Automated() bool { return Classify(m) != Person }
@@ -0,0 +1,48 @@
+package nbf
+
+import (
+	"archive/zip"
+	"sync"
+)
+
+// An entryCache keeps decoded message entries if Reader.Cache
+// is set. It is dropped when the decoding options of the Reader
+// change.
+type entryCache struct {
+	mu      sync.Mutex
+	opts    decodeOptions // see decodeOptions.cacheKey
+	entries map[*zip.File]decoded
+}
+
+func (c *entryCache) get(f *zip.File, opts decodeOptions) (decoded, bool) {
+	if !opts.cache {
+		return decoded{}, false
+	}
+	if opts.logger != nil {
+		return decoded{}, false // trace decoding
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil || c.opts != opts.cacheKey() {
+		return decoded{}, false
+	}
+	d, ok := c.entries[f]
+	return d, ok
+}
+
+func (c *entryCache) put(f *zip.File, opts decodeOptions, d decoded) {
+	if !opts.cache {
+		return
+	}
+	if opts.keepRaw {
+		return // raw bodies would double memory usage
+	}
+	key := opts.cacheKey()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil || c.opts != key {
+		c.opts = key
+		c.entries = make(map[*zip.File]decoded)
+	}
+	c.entries[f] = d
+}
@@ -0,0 +1,48 @@
+package nbf
+
+import (
+	"testing"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf/gsm7"
+)
+
+func TestCacheKey(t *testing.T) {
+	r := &Reader{Cache: true, Charset: &gsm7.Encoding{}, InvalidSeptets: gsm7.Fail}
+	c := new(entryCache)
+	c.put(nil, r.decodeOptions(), decoded{sms: SMS{Text: "cached"}})
+	if d, ok := c.get(nil, r.decodeOptions()); !ok || d.sms.Text != "cached" {
+		t.Errorf("cache miss with unchanged options")
+	}
+	r.InvalidSeptets = gsm7.Replace
+	if _, ok := c.get(nil, r.decodeOptions()); ok {
+		t.Errorf("cache hit after changing InvalidSeptets")
+	}
+	r.InvalidSeptets, r.Charset = gsm7.Fail, &gsm7.Encoding{}
+	if _, ok := c.get(nil, r.decodeOptions()); ok {
+		t.Errorf("cache hit after changing Charset")
+	}
+}
+
+func TestCacheDisabled(t *testing.T) {
+	r, err := OpenFile("testdata/sample.nbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := r.Inbox(); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(r.cache.entries); n != 0 {
+			t.Fatalf("scan %d: %d entries cached without Cache", i, n)
+		}
+	}
+	r.Cache = true
+	inbox, err := r.Inbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.cache.entries); n < len(inbox) {
+		t.Errorf("%d entries cached for %d messages", n, len(inbox))
+	}
+}
@@ -0,0 +1,175 @@
+package nbf
+
+import (
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A CalendarEntry is an event or to-do item, stored as a
+// vCalendar 1.0 file in NBF archives.
+type CalendarEntry struct {
+	NBFFile string
+	Stamp   time.Time // of the last modification
+	UID     string    // empty if not given
+	Todo    bool      // a to-do item rather than an event
+
+	Summary     string
+	Description string
+	Location    string
+	Categories  []string // MEETING, PHONE CALL, ANNIVERSARY...
+
+	// Times without time zone are in time.Local, times
+	// in UTC are in time.UTC. End is the due date of to-do
+	// items, and may be zero.
+	Start, End time.Time
+	AllDay     bool // Start and End are dates
+
+	Rule  string    // vCalendar 1.0 recurrence rule, such as "W1 MO #0"
+	Alarm time.Time // zero if none
+
+	Completed bool // to-do items
+	Priority  int  // 1 (highest) to 9, 0 if unknown
+}
+
+// Calendar returns all events and to-do items
+// found in the archive.
+func (r *Reader) Calendar() (entries []CalendarEntry, err error) {
+	for f := range r.files() {
+		if f.Mode().IsDir() || !strings.EqualFold(path.Ext(f.Name), ".vcs") {
+			continue
+		}
+		data, err := readEntry(f, r.Password)
+		if err != nil {
+			log.Printf("cannot read %s: %s", f.Name, err)
+			continue
+		}
+		list := parseVCalendar(data)
+		for i := range list {
+			list[i].NBFFile = f.Name
+			if list[i].Stamp.IsZero() {
+				list[i].Stamp = f.Modified
+			}
+		}
+		entries = append(entries, list...)
+	}
+	return entries, nil
+}
+
+// parseVCalendar decodes the events and to-do items
+// of a vCalendar 1.0 file.
+func parseVCalendar(data []byte) (entries []CalendarEntry) {
+	var e *CalendarEntry
+	var entryType string
+	for _, line := range unfoldVCard(data) {
+		name, _, value, ok := parseProperty(line)
+		if !ok {
+			continue
+		}
+		switch name {
+		case "BEGIN":
+			switch strings.ToUpper(value) {
+			case "VEVENT":
+				e, entryType = new(CalendarEntry), ""
+			case "VTODO":
+				e, entryType = &CalendarEntry{Todo: true}, ""
+			}
+			continue
+		case "END":
+			if e != nil && (strings.EqualFold(value, "VEVENT") || strings.EqualFold(value, "VTODO")) {
+				e.AllDay = isAllDay(*e, entryType)
+				entries = append(entries, *e)
+				e = nil
+			}
+			continue
+		}
+		if e == nil {
+			continue
+		}
+		switch name {
+		case "UID":
+			e.UID = value
+		case "SUMMARY":
+			e.Summary = value
+		case "DESCRIPTION":
+			e.Description = value
+		case "LOCATION":
+			e.Location = value
+		case "CATEGORIES":
+			for _, c := range strings.Split(value, ";") {
+				if c = strings.TrimSpace(c); c != "" {
+					e.Categories = append(e.Categories, strings.ToUpper(c))
+				}
+			}
+		case "DTSTART":
+			e.Start = ParseVCalTime(value)
+		case "DTEND", "DUE":
+			e.End = ParseVCalTime(value)
+		case "LAST-MODIFIED":
+			e.Stamp = ParseVCalTime(value)
+		case "RRULE":
+			e.Rule = strings.TrimSpace(value)
+		case "AALARM", "DALARM":
+			// Run time;snooze time;repeat count;sound or text.
+			if t := ParseVCalTime(strings.Split(value, ";")[0]); e.Alarm.IsZero() {
+				e.Alarm = t
+			}
+		case "STATUS":
+			e.Completed = e.Completed || strings.EqualFold(value, "COMPLETED")
+		case "COMPLETED":
+			e.Completed = true
+		case "PRIORITY":
+			e.Priority, _ = strconv.Atoi(value)
+		case "X-EPOCAGENDAENTRYTYPE":
+			entryType = strings.ToUpper(value)
+		}
+	}
+	return entries
+}
+
+// ParseVCalTime parses a vCalendar date or date-time, such as
+// 20100102T150405Z, in time.Local if it has no time zone. It
+// returns a zero time for invalid values.
+func ParseVCalTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if len(s) != len(layout) {
+			continue
+		}
+		loc := time.Local
+		if strings.HasSuffix(layout, "Z") {
+			loc = time.UTC
+		}
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// isAllDay reports whether e spans whole days. Nokia phones
+// store anniversaries and day notes with times at midnight,
+// ending at midnight or 23:59, or without end.
+func isAllDay(e CalendarEntry, entryType string) bool {
+	switch entryType {
+	case "ANNIVERSARY", "EVENT":
+		return true
+	}
+	for _, c := range e.Categories {
+		if c == "ANNIVERSARY" || c == "SPECIAL OCCASION" {
+			return true
+		}
+	}
+	if e.Todo || e.Start.IsZero() || !isMidnight(e.Start) {
+		return false
+	}
+	h, m, _ := e.End.Clock()
+	return e.End.IsZero() || !e.End.After(e.Start) || isMidnight(e.End) || h == 23 && m == 59
+}
+
+func isMidnight(t time.Time) bool {
+	h, m, s := t.Clock()
+	return h == 0 && m == 0 && s == 0
+}
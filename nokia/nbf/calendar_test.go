@@ -0,0 +1,51 @@
+package nbf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseVCalendar(t *testing.T) {
+	const cal = "BEGIN:VCALENDAR\r\nVERSION:1.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:1\r\n" +
+		"SUMMARY;CHARSET=UTF-8;ENCODING=QUOTED-PRINTABLE:R=C3=A9union\r\n" +
+		"DTSTART:20100104T090000Z\r\n" +
+		"DTEND:20100104T100000Z\r\n" +
+		"RRULE:W1 MO #10\r\n" +
+		"AALARM:20100104T085000Z;;;\r\n" +
+		"CATEGORIES:MEETING\r\n" +
+		"X-EPOCAGENDAENTRYTYPE:APPOINTMENT\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"SUMMARY:Anniversaire\r\n" +
+		"DTSTART:20100315T000000\r\n" +
+		"DTEND:20100315T000000\r\n" +
+		"RRULE:YD1 #0\r\n" +
+		"X-EPOCAGENDAENTRYTYPE:ANNIVERSARY\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"SUMMARY:Courses\r\n" +
+		"DUE:20100105T000000\r\n" +
+		"STATUS:COMPLETED\r\n" +
+		"PRIORITY:2\r\n" +
+		"END:VTODO\r\n" +
+		"END:VCALENDAR\r\n"
+	entries := parseVCalendar([]byte(cal))
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, expected 3", len(entries))
+	}
+	e := entries[0]
+	start := time.Date(2010, 1, 4, 9, 0, 0, 0, time.UTC)
+	if e.Summary != "Réunion" || !e.Start.Equal(start) || e.Start.Location() != time.UTC ||
+		e.End.Sub(e.Start) != time.Hour || e.AllDay || e.Rule != "W1 MO #10" ||
+		e.Start.Sub(e.Alarm) != 10*time.Minute || len(e.Categories) != 1 {
+		t.Errorf("bad event %+v", e)
+	}
+	if e := entries[1]; !e.AllDay || e.Start.Location() != time.Local || e.Start.Day() != 15 {
+		t.Errorf("bad anniversary %+v", e)
+	}
+	if e := entries[2]; !e.Todo || !e.Completed || e.Priority != 2 || e.End.Day() != 5 || e.AllDay {
+		t.Errorf("bad to-do item %+v", e)
+	}
+}
@@ -0,0 +1,151 @@
+package nbf
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"log"
+	"mime/quotedprintable"
+	"path"
+	"strings"
+)
+
+// A Contact is a phonebook entry, stored as a vCard 2.1 file
+// in NBF archives.
+type Contact struct {
+	NBFFile string
+
+	Name   string // formatted name
+	Family string
+	Given  string
+	Phones []Phone
+	Emails []string
+	Note   string
+}
+
+type Phone struct {
+	Types  []string // CELL, HOME, WORK, PREF...
+	Number string
+}
+
+// Contacts returns all contacts found in the archive.
+func (r *Reader) Contacts() (contacts []Contact, err error) {
+	for f := range r.files() {
+		if f.Mode().IsDir() || !strings.EqualFold(path.Ext(f.Name), ".vcf") {
+			continue
+		}
+		data, err := readEntry(f, r.Password)
+		if err != nil {
+			log.Printf("cannot read %s: %s", f.Name, err)
+			continue
+		}
+		cards := parseVCards(data)
+		for i := range cards {
+			cards[i].NBFFile = f.Name
+		}
+		contacts = append(contacts, cards...)
+	}
+	return contacts, nil
+}
+
+// parseVCards decodes the vCard 2.1 entries in data.
+func parseVCards(data []byte) (cards []Contact) {
+	var c *Contact
+	for _, line := range unfoldVCard(data) {
+		name, params, value, ok := parseProperty(line)
+		if !ok {
+			continue
+		}
+		switch name {
+		case "BEGIN":
+			c = new(Contact)
+			continue
+		case "END":
+			if c != nil {
+				if c.Name == "" {
+					c.Name = strings.TrimSpace(c.Given + " " + c.Family)
+				}
+				cards = append(cards, *c)
+			}
+			c = nil
+			continue
+		}
+		if c == nil {
+			continue
+		}
+		switch name {
+		case "FN":
+			c.Name = value
+		case "N":
+			fields := strings.Split(value, ";")
+			c.Family = fields[0]
+			if len(fields) > 1 {
+				c.Given = fields[1]
+			}
+		case "TEL":
+			var types []string
+			for _, p := range params {
+				p = strings.ToUpper(p)
+				if strings.HasPrefix(p, "TYPE=") {
+					types = append(types, strings.Split(p[5:], ",")...)
+				} else if !strings.Contains(p, "=") {
+					types = append(types, p)
+				}
+			}
+			c.Phones = append(c.Phones, Phone{Types: types, Number: value})
+		case "EMAIL":
+			c.Emails = append(c.Emails, value)
+		case "NOTE":
+			c.Note = value
+		}
+	}
+	return cards
+}
+
+// parseProperty splits a vCard or vCalendar line into the upper
+// case property name, without group, its parameters and its value,
+// decoding quoted-printable values.
+func parseProperty(line string) (name string, params []string, value string, ok bool) {
+	idx := strings.IndexByte(line, ':')
+	if idx < 0 {
+		return "", nil, "", false
+	}
+	params = strings.Split(line[:idx], ";")
+	name, value = strings.ToUpper(params[0]), line[idx+1:]
+	params = params[1:]
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:] // strip group
+	}
+	for _, p := range params {
+		if strings.EqualFold(p, "ENCODING=QUOTED-PRINTABLE") || strings.EqualFold(p, "QUOTED-PRINTABLE") {
+			b, err := ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(value)))
+			if err == nil {
+				value = string(b)
+			}
+		}
+	}
+	return name, params, value, true
+}
+
+// unfoldVCard splits data into logical lines, joining
+// folded lines and quoted-printable soft line breaks.
+func unfoldVCard(data []byte) (lines []string) {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	// Embedded photos may be longer than the default limit
+	// of 64 KB, and no line is longer than data.
+	s.Buffer(nil, len(data)+1)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		n := len(lines)
+		switch {
+		case n > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")):
+			lines[n-1] += line[1:]
+		case n > 0 && strings.HasSuffix(lines[n-1], "=") &&
+			strings.Contains(strings.ToUpper(lines[n-1]), "QUOTED-PRINTABLE"):
+			lines[n-1] = lines[n-1][:len(lines[n-1])-1] + line
+		case line != "":
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
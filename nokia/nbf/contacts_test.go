@@ -0,0 +1,49 @@
+package nbf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseVCards(t *testing.T) {
+	const card = "BEGIN:VCARD\r\nVERSION:2.1\r\n" +
+		"N;CHARSET=UTF-8;ENCODING=QUOTED-PRINTABLE:Dupont;Ren=C3=\r\n=A9\r\n" +
+		"TEL;CELL;PREF:+33612345678\r\n" +
+		"TEL;TYPE=HOME:0145678900\r\n" +
+		"EMAIL;INTERNET:rene@example.com\r\n" +
+		"END:VCARD\r\n"
+	cards := parseVCards([]byte(card))
+	if len(cards) != 1 {
+		t.Fatalf("got %d cards, expected 1", len(cards))
+	}
+	c := cards[0]
+	if c.Name != "René Dupont" {
+		t.Errorf("got name %q, expected %q", c.Name, "René Dupont")
+	}
+	if len(c.Phones) != 2 {
+		t.Fatalf("got %d phones, expected 2", len(c.Phones))
+	}
+	if p := c.Phones[0]; p.Number != "+33612345678" || len(p.Types) != 2 || p.Types[0] != "CELL" {
+		t.Errorf("bad phone %+v", p)
+	}
+	if p := c.Phones[1]; p.Number != "0145678900" || len(p.Types) != 1 || p.Types[0] != "HOME" {
+		t.Errorf("bad phone %+v", p)
+	}
+	if len(c.Emails) != 1 || c.Emails[0] != "rene@example.com" {
+		t.Errorf("bad emails %q", c.Emails)
+	}
+}
+
+func TestParseVCardsLongLine(t *testing.T) {
+	card := "BEGIN:VCARD\r\nVERSION:2.1\r\nN:Dupont;Jean\r\n" +
+		"PHOTO;ENCODING=BASE64;TYPE=JPEG:" + strings.Repeat("A", 100<<10) + "\r\n" +
+		"TEL;CELL:+33612345678\r\n" +
+		"END:VCARD\r\n"
+	cards := parseVCards([]byte(card))
+	if len(cards) != 1 {
+		t.Fatalf("got %d cards, expected 1", len(cards))
+	}
+	if c := cards[0]; c.Name != "Jean Dupont" || len(c.Phones) != 1 || c.Phones[0].Number != "+33612345678" {
+		t.Errorf("bad card %+v", c)
+	}
+}
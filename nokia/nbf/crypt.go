@@ -0,0 +1,288 @@
+package nbf
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Encrypted archives.
+//
+// Some backup tools wrap archives in password-protected zips,
+// using the traditional PKWARE encryption (ZipCrypto) or the
+// WinZip AES encryption. Entries are decrypted using
+// Reader.Password.
+
+// ErrPassword is returned when reading encrypted entries
+// without the right password.
+var ErrPassword = errors.New("nbf: wrong or missing password for encrypted entry")
+
+// Encrypted reports whether some entries of the archive
+// are encrypted.
+func (r *Reader) Encrypted() bool {
+	for _, f := range r.z.File {
+		if f.Flags&flagEncrypted != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	flagEncrypted  = 0x1
+	flagDescriptor = 0x8 // sizes and CRC follow the data
+
+	methodAES  = 99
+	extraAES   = 0x9901
+	aesMACSize = 10
+)
+
+// openEntry returns a reader of entry f, decrypting it
+// with password if needed.
+func openEntry(f *zip.File, password string) (io.ReadCloser, error) {
+	if f.Flags&flagEncrypted == 0 {
+		return f.Open()
+	}
+	data, err := readEntry(f, password)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// readEntry returns the contents of entry f, decrypting it
+// with password if needed.
+func readEntry(f *zip.File, password string) ([]byte, error) {
+	if f.Flags&flagEncrypted == 0 {
+		fr, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer fr.Close()
+		return readAll(fr, min(f.UncompressedSize64, maxMessageEntry))
+	}
+	if password == "" {
+		return nil, ErrPassword
+	}
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, f.CompressedSize64)
+	if _, err := io.ReadFull(raw, data); err != nil {
+		return nil, err
+	}
+	method, checkCRC := f.Method, true
+	if f.Method == methodAES {
+		var version uint16
+		version, method, data, err = decryptAES(f, data, []byte(password))
+		// AE-2 does not store CRCs.
+		checkCRC = version == 1
+	} else {
+		data, err = decryptZipCrypto(f, data, []byte(password))
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch method {
+	case zip.Store:
+	case zip.Deflate:
+		fr := flate.NewReader(bytes.NewReader(data))
+		data, err = io.ReadAll(fr)
+		fr.Close()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, zip.ErrAlgorithm
+	}
+	if checkCRC && crc32.ChecksumIEEE(data) != f.CRC32 {
+		return nil, zip.ErrChecksum
+	}
+	return data, nil
+}
+
+// readAll is io.ReadAll with a buffer sized for the expected size
+// of the data. Reading continues until EOF, where the zip reader
+// checks the CRC.
+func readAll(r io.Reader, size uint64) ([]byte, error) {
+	b := make([]byte, 0, size+1)
+	for {
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if err == io.EOF {
+			return b, nil
+		}
+		if err != nil {
+			return b, err
+		}
+		if len(b) == cap(b) {
+			b = append(b, 0)[:len(b)]
+		}
+	}
+}
+
+// entryMethod returns the compression method of f,
+// which is stored elsewhere for AES encrypted entries.
+func entryMethod(f *zip.File) uint16 {
+	if f.Method == methodAES {
+		if ext := findExtra(f.Extra, extraAES); len(ext) >= 7 {
+			return binary.LittleEndian.Uint16(ext[5:])
+		}
+	}
+	return f.Method
+}
+
+func findExtra(extra []byte, id uint16) []byte {
+	for len(extra) >= 4 {
+		tag := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		if tag == id {
+			return extra[:size]
+		}
+		extra = extra[size:]
+	}
+	return nil
+}
+
+// zipCryptoKeys are the keys of the traditional PKWARE encryption.
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password []byte) *zipCryptoKeys {
+	k := &zipCryptoKeys{305419896, 591751049, 878082192}
+	for _, b := range password {
+		k.update(b)
+	}
+	return k
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32.IEEETable[byte(k[0])^b] ^ (k[0] >> 8)
+	k[1] = (k[1]+k[0]&0xff)*134775813 + 1
+	k[2] = crc32.IEEETable[byte(k[2])^byte(k[1]>>24)] ^ (k[2] >> 8)
+}
+
+func (k *zipCryptoKeys) stream() byte {
+	t := k[2] | 2
+	return byte((t * (t ^ 1)) >> 8)
+}
+
+func (k *zipCryptoKeys) decrypt(data []byte) {
+	for i, c := range data {
+		p := c ^ k.stream()
+		k.update(p)
+		data[i] = p
+	}
+}
+
+func (k *zipCryptoKeys) encrypt(data []byte) {
+	for i, p := range data {
+		data[i] = p ^ k.stream()
+		k.update(p)
+	}
+}
+
+func decryptZipCrypto(f *zip.File, data, password []byte) ([]byte, error) {
+	if len(data) < 12 {
+		return nil, zip.ErrFormat
+	}
+	k := newZipCryptoKeys(password)
+	k.decrypt(data)
+	// The last byte of the header checks the password.
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&flagDescriptor != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if data[11] != check {
+		return nil, ErrPassword
+	}
+	return data[12:], nil
+}
+
+// decryptAES decrypts an entry encrypted with WinZip AES, returning
+// the AE-x version and the compression method of the plaintext.
+func decryptAES(f *zip.File, data, password []byte) (version, method uint16, plain []byte, err error) {
+	ext := findExtra(f.Extra, extraAES)
+	if len(ext) < 7 || string(ext[2:4]) != "AE" {
+		return 0, 0, nil, fmt.Errorf("nbf: %s: invalid AES extra field", f.Name)
+	}
+	version = binary.LittleEndian.Uint16(ext)
+	strength := int(ext[4]) // 1, 2, 3 for AES-128, 192, 256
+	method = binary.LittleEndian.Uint16(ext[5:])
+	if strength < 1 || strength > 3 {
+		return 0, 0, nil, fmt.Errorf("nbf: %s: invalid AES strength %d", f.Name, strength)
+	}
+	keyLen, saltLen := 8+8*strength, 4+4*strength
+	if len(data) < saltLen+2+aesMACSize {
+		return 0, 0, nil, zip.ErrFormat
+	}
+	salt, verifier := data[:saltLen], data[saltLen:saltLen+2]
+	text, mac := data[saltLen+2:len(data)-aesMACSize], data[len(data)-aesMACSize:]
+
+	keys := pbkdf2(password, salt, 1000, 2*keyLen+2, sha1.New)
+	if subtle.ConstantTimeCompare(keys[2*keyLen:], verifier) != 1 {
+		return 0, 0, nil, ErrPassword
+	}
+	h := hmac.New(sha1.New, keys[keyLen:2*keyLen])
+	h.Write(text)
+	if !hmac.Equal(h.Sum(nil)[:aesMACSize], mac) {
+		return 0, 0, nil, zip.ErrChecksum
+	}
+	block, err := aes.NewCipher(keys[:keyLen])
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	winzipCTR(block.Encrypt, text)
+	return version, method, text, nil
+}
+
+// winzipCTR applies the counter mode of WinZip AES, where
+// the counter is a little-endian integer starting at 1.
+func winzipCTR(encrypt func(dst, src []byte), data []byte) {
+	var ctr, stream [16]byte
+	for i := 0; i < len(data); i += 16 {
+		for j := range ctr {
+			ctr[j]++
+			if ctr[j] != 0 {
+				break
+			}
+		}
+		encrypt(stream[:], ctr[:])
+		subtle.XORBytes(data[i:], data[i:], stream[:])
+	}
+}
+
+// pbkdf2 derives a key of length n from password (RFC 8018).
+func pbkdf2(password, salt []byte, iter, n int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	var key []byte
+	for block := uint32(1); len(key) < n; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			subtle.XORBytes(t, t, u)
+		}
+		key = append(key, t...)
+	}
+	return key[:n]
+}
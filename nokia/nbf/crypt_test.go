@@ -0,0 +1,85 @@
+package nbf
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+func TestEncryptedEntries(t *testing.T) {
+	const password = "secret"
+	plain := []byte("predefmessages contents, predefmessages contents")
+	crc := crc32.ChecksumIEEE(plain)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(hdr *zip.FileHeader, raw []byte) {
+		hdr.Flags |= flagEncrypted
+		hdr.CRC32 = crc
+		hdr.CompressedSize64 = uint64(len(raw))
+		hdr.UncompressedSize64 = uint64(len(plain))
+		w, err := zw.CreateRaw(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(raw)
+	}
+
+	// ZipCrypto, stored.
+	header := append(make([]byte, 11), byte(crc>>24))
+	raw := append(header, plain...)
+	newZipCryptoKeys([]byte(password)).encrypt(raw)
+	add(&zip.FileHeader{Name: "zipcrypto", Method: zip.Store}, raw)
+
+	// AES-256 (AE-1), stored.
+	salt := []byte("0123456789abcdef")
+	keys := pbkdf2([]byte(password), salt, 1000, 66, sha1.New)
+	text := append([]byte(nil), plain...)
+	block, _ := aes.NewCipher(keys[:32])
+	winzipCTR(block.Encrypt, text)
+	mac := hmac.New(sha1.New, keys[32:64])
+	mac.Write(text)
+	raw = append(append(append(salt, keys[64:]...), text...), mac.Sum(nil)[:aesMACSize]...)
+	extra := binary.LittleEndian.AppendUint16(nil, extraAES)
+	extra = append(extra, 7, 0, 1, 0, 'A', 'E', 3, 0, 0)
+	add(&zip.FileHeader{Name: "aes", Method: methodAES, Extra: extra}, raw)
+	zw.Close()
+
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Reader{z: z}
+	if !r.Encrypted() {
+		t.Errorf("archive is not reported as encrypted")
+	}
+	for _, f := range z.File {
+		if entryMethod(f) != zip.Store {
+			t.Errorf("%s: got method %d", f.Name, entryMethod(f))
+		}
+		data, err := readEntry(f, password)
+		if err != nil || !bytes.Equal(data, plain) {
+			t.Errorf("%s: got %q, %v", f.Name, data, err)
+		}
+		for _, pw := range []string{"", "wrong"} {
+			if _, err := readEntry(f, pw); !errors.Is(err, ErrPassword) {
+				t.Errorf("%s: password %q: got error %v", f.Name, pw, err)
+			}
+		}
+	}
+}
+
+func TestPBKDF2(t *testing.T) {
+	// RFC 6070 test vector.
+	key := pbkdf2([]byte("password"), []byte("salt"), 4096, 20, sha1.New)
+	if got := hex.EncodeToString(key); got != "4b007901b765489abead49d926f721d065a429c1" {
+		t.Errorf("got %s", got)
+	}
+}
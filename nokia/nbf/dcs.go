@@ -0,0 +1,113 @@
+package nbf
+
+import "fmt"
+
+// An Alphabet is the character set of user data.
+type Alphabet int
+
+const (
+	GSM7  Alphabet = iota // GSM default alphabet, packed septets
+	Data8                 // 8-bit data
+	UCS2                  // UCS-2 (UTF-16BE) text
+)
+
+func (a Alphabet) String() string {
+	switch a {
+	case Data8:
+		return "8-bit"
+	case UCS2:
+		return "UCS-2"
+	}
+	return "GSM-7"
+}
+
+// A MessageClass is the class of a message. Class 0 messages
+// are displayed immediately and not stored (flash messages).
+// The zero value means that the message has no class.
+type MessageClass int
+
+const (
+	NoClass MessageClass = iota
+	Class0
+	Class1 // ME specific
+	Class2 // SIM specific
+	Class3 // TE specific
+)
+
+func (c MessageClass) String() string {
+	if c == NoClass {
+		return "none"
+	}
+	return fmt.Sprintf("class %d", c-Class0)
+}
+
+// An IndicationType is the kind of a message waiting indication.
+type IndicationType int
+
+const (
+	VoicemailWaiting IndicationType = iota
+	FaxWaiting
+	EmailWaiting
+	OtherWaiting
+)
+
+// A Voicemail is a voicemail waiting indication, sent by the
+// network using a message waiting coding scheme or a special
+// message indication in the user data header.
+type Voicemail struct {
+	Active bool `json:"active"`          // messages are waiting
+	Count  int  `json:"count,omitempty"` // number of waiting messages, or 0 if unknown
+}
+
+// A Coding is a decoded data coding scheme (GSM 03.38 section 4).
+type Coding struct {
+	Alphabet   Alphabet
+	Compressed bool
+	Class      MessageClass
+	AutoDelete bool // message marked for automatic deletion
+
+	// Message waiting indication groups.
+	Waiting    bool // the scheme carries an indication
+	Active     bool // indication is set, as opposed to cleared
+	Indication IndicationType
+	Discard    bool // message may be discarded once the indication is updated
+}
+
+// DecodeDCS decodes a data coding scheme octet. Reserved
+// codings are decoded as the GSM default alphabet.
+func DecodeDCS(dcs byte) Coding {
+	var c Coding
+	switch group := dcs >> 4; {
+	case group < 8:
+		// 00xx general data coding, 01xx automatic deletion.
+		c.AutoDelete = group&4 != 0
+		c.Compressed = dcs&0x20 != 0
+		if dcs&0x10 != 0 {
+			c.Class = Class0 + MessageClass(dcs&3)
+		}
+		switch dcs >> 2 & 3 {
+		case 1:
+			c.Alphabet = Data8
+		case 2:
+			c.Alphabet = UCS2
+		}
+	case group >= 0xc && group <= 0xe:
+		c.Waiting = true
+		c.Discard = group == 0xc
+		if group == 0xe {
+			c.Alphabet = UCS2
+		}
+		c.Active = dcs&8 != 0
+		c.Indication = IndicationType(dcs & 3)
+	case group == 0xf:
+		if dcs&4 != 0 {
+			c.Alphabet = Data8
+		}
+		c.Class = Class0 + MessageClass(dcs&3)
+	}
+	return c
+}
+
+// Flash reports whether c is the coding of flash messages,
+// which are class 0 messages.
+func (c Coding) Flash() bool { return c.Class == Class0 }
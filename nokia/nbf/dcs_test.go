@@ -0,0 +1,28 @@
+package nbf
+
+import "testing"
+
+func TestDecodeDCS(t *testing.T) {
+	for _, c := range []struct {
+		dcs  byte
+		want Coding
+	}{
+		{0x00, Coding{Alphabet: GSM7}},
+		{0x04, Coding{Alphabet: Data8}},
+		{0x08, Coding{Alphabet: UCS2}},
+		{0x10, Coding{Alphabet: GSM7, Class: Class0}},
+		{0x26, Coding{Alphabet: Data8, Compressed: true}},
+		{0x49, Coding{Alphabet: UCS2, AutoDelete: true}},
+		{0x0c, Coding{Alphabet: GSM7}}, // reserved alphabet
+		{0x80, Coding{Alphabet: GSM7}}, // reserved group
+		{0xc8, Coding{Waiting: true, Active: true, Discard: true}},
+		{0xd0, Coding{Waiting: true}},
+		{0xea, Coding{Alphabet: UCS2, Waiting: true, Active: true, Indication: EmailWaiting}},
+		{0xf0, Coding{Alphabet: GSM7, Class: Class0}},
+		{0xf6, Coding{Alphabet: Data8, Class: Class2}},
+	} {
+		if got := DecodeDCS(c.dcs); got != c.want {
+			t.Errorf("DecodeDCS(0x%02x) = %+v, expected %+v", c.dcs, got, c.want)
+		}
+	}
+}
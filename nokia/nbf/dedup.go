@@ -0,0 +1,41 @@
+package nbf
+
+import (
+	"sort"
+	"time"
+)
+
+// DedupWindow is the maximal time difference between two messages
+// with identical peer and contents considered as duplicates by Dedup.
+var DedupWindow = 2 * time.Minute
+
+// Dedup returns msgs, sorted by date, without duplicate messages:
+// messages with the same ID, or with the same direction, peer and
+// contents and timestamps less than DedupWindow apart. The earliest
+// message of each group of duplicates is kept.
+func Dedup(msgs []SMS) []SMS {
+	sorted := make([]SMS, len(msgs))
+	copy(sorted, msgs)
+	sort.Stable(smsByDate(sorted))
+
+	type key struct {
+		Type int
+		Peer string
+		Text string
+		Data string
+	}
+	ids := make(map[string]bool)
+	kept := make(map[key]time.Time) // timestamp of last kept message
+	out := sorted[:0]
+	for _, m := range sorted {
+		id := m.ID()
+		k := key{m.Type, normalizePeer(ThreadPeer(m)), m.Text, string(m.Data)}
+		if t, ok := kept[k]; ids[id] || ok && m.When.Sub(t) < DedupWindow {
+			continue
+		}
+		ids[id] = true
+		kept[k] = m.When
+		out = append(out, m)
+	}
+	return out
+}
@@ -0,0 +1,86 @@
+package nbf
+
+import (
+	"maps"
+	"sync"
+)
+
+// An EventKind is a kind of diagnostic event.
+type EventKind int
+
+const (
+	EntrySkipped     EventKind = iota // an entry could not be decoded
+	UnknownIE                         // an information element of the user data header was ignored
+	ChecksumMismatch                  // an entry name or zip checksum is wrong
+	CharsetFallback                   // text was decoded with a replacement character set
+)
+
+var eventNames = [...]string{
+	EntrySkipped:     "entry skipped",
+	UnknownIE:        "unknown IE",
+	ChecksumMismatch: "checksum mismatch",
+	CharsetFallback:  "charset fallback",
+}
+
+func (k EventKind) String() string {
+	if k >= 0 && int(k) < len(eventNames) {
+		return eventNames[k]
+	}
+	return "unknown event"
+}
+
+// An Event reports an anomaly of an archive entry, which did not
+// prevent decoding other entries.
+type Event struct {
+	Kind   EventKind
+	Entry  string // entry name
+	Detail string
+}
+
+// Diagnostics collects events of archive scans, to report the
+// quality of decoded data. The zero value counts events; it is
+// safe for concurrent use. Events of messages are reported in
+// archive order, each time the messages are scanned.
+type Diagnostics struct {
+	// Handler, if not nil, is called for each event.
+	Handler func(Event)
+
+	mu     sync.Mutex
+	counts map[EventKind]int
+}
+
+func (d *Diagnostics) report(e Event) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	if d.counts == nil {
+		d.counts = make(map[EventKind]int)
+	}
+	d.counts[e.Kind]++
+	d.mu.Unlock()
+	if d.Handler != nil {
+		d.Handler(e)
+	}
+}
+
+// Count returns the number of events of kind k.
+func (d *Diagnostics) Count(k EventKind) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.counts[k]
+}
+
+// Counts returns the number of events by kind.
+func (d *Diagnostics) Counts() map[EventKind]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return maps.Clone(d.counts)
+}
+
+// Reset clears event counts.
+func (d *Diagnostics) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.counts = nil
+}
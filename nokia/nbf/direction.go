@@ -0,0 +1,85 @@
+package nbf
+
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Standard folders of message entries (predefmessages/N).
+// Folders created by the user follow them, see Reader.Folders.
+const (
+	FolderInbox     = 1
+	FolderPending   = 2 // messages waiting to be sent
+	FolderOutbox    = 3 // sent messages
+	FolderArchive   = 4
+	FolderDrafts    = 5
+	FolderTemplates = 6
+)
+
+// A Direction tells whether a message was received or sent.
+type Direction int
+
+const (
+	Unknown  Direction = iota
+	Received           // SMS-DELIVER
+	Sent               // SMS-SUBMIT in the outbox
+	Draft              // SMS-SUBMIT in another folder
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Received:
+		return "received"
+	case Sent:
+		return "sent"
+	case Draft:
+		return "draft"
+	}
+	return "unknown"
+}
+
+func (d Direction) GoString() string {
+	switch d {
+	case Unknown:
+		return "nbf.Unknown"
+	case Received:
+		return "nbf.Received"
+	case Sent:
+		return "nbf.Sent"
+	case Draft:
+		return "nbf.Draft"
+	}
+	return "nbf.Direction(" + strconv.Itoa(int(d)) + ")"
+}
+
+// DirectionOf returns the direction of a message stored in
+// folder, with the given PDU. If pdu is nil, the direction
+// is guessed from the folder alone.
+func DirectionOf(folder int, pdu PDU) Direction {
+	switch pdu.(type) {
+	case Deliver:
+		return Received
+	case Submit:
+		if folder == FolderOutbox {
+			return Sent
+		}
+		return Draft
+	}
+	switch folder {
+	case FolderInbox:
+		return Received
+	case FolderOutbox:
+		return Sent
+	}
+	return Unknown
+}
+
+// entryFolder returns N for entry names predefmessages/N/...
+func entryFolder(name string) (folder int, ok bool) {
+	if !strings.HasPrefix(name, "predefmessages/") {
+		return 0, false
+	}
+	folder, err := strconv.Atoi(strings.TrimPrefix(path.Dir(name), "predefmessages/"))
+	return folder, err == nil
+}
@@ -0,0 +1,288 @@
+package nbf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf/gsm7"
+)
+
+// Encoding of message entries, the inverse of ParseEntry.
+
+// EncodeSMS returns the body of an archive entry holding m,
+// in S40Layout as described above ParseEntry. Received messages
+// are encoded as SMS-DELIVER, sent messages as SMS-SUBMIT with
+// the first reference number of m.MR.
+// Texts are encoded using the GSM default alphabet if possible,
+// UCS-2 otherwise, and must fit in a single message. The message
+// class of m.Coding and the flags of m are kept, other coding
+// fields are ignored.
+func EncodeSMS(m SMS) ([]byte, error) {
+	return encodeSMS(m, nil)
+}
+
+// EncodePart is like EncodeSMS, for part i (starting from 1) of
+// n of a concatenated message with reference number ref.
+// The text of m is the text of the part.
+func EncodePart(m SMS, ref, i, n int) ([]byte, error) {
+	return encodeSMS(m, concatUDH(ref, i, n))
+}
+
+// concatUDH returns the information element of part i of n of
+// a concatenated message.
+func concatUDH(ref, i, n int) []byte {
+	if ref > 0xff {
+		return []byte{8, 4, byte(ref >> 8), byte(ref), byte(n), byte(i)}
+	}
+	return []byte{0, 3, byte(ref), byte(n), byte(i)}
+}
+
+func encodeSMS(m SMS, udh []byte) ([]byte, error) {
+	if m.Port != 0 {
+		// 16-bit application port addressing.
+		udh = append(udh, 5, 4, byte(m.Port>>8), byte(m.Port), 0, 0)
+	}
+	var dcs byte
+	var ud []byte
+	var udl int
+	_, gsm := encodeGSM(m.Text, nil)
+	switch {
+	case m.Data != nil:
+		dcs = 4
+		ud = append(udhBytes(udh), m.Data...)
+		udl = len(ud)
+	case gsm:
+		ud, udl = encodeText(udh, m.Text, GSM7, nil)
+	default:
+		dcs = 8
+		ud, udl = encodeText(udh, m.Text, UCS2, nil)
+	}
+	if c := m.Coding.Class; c != NoClass {
+		dcs |= 0x10 | byte(c-Class0)
+	}
+	if len(ud) > 140 {
+		return nil, fmt.Errorf("message too long (%d bytes of user data)", len(ud))
+	}
+
+	var pdu []byte
+	first := byte(0)
+	if udh != nil {
+		first |= 0x40 // TP-UDHI
+	}
+	if m.ReplyPath {
+		first |= 0x80
+	}
+	if m.StatusReport {
+		first |= 0x20
+	}
+	if m.RejectDuplicates && m.Type != 0 {
+		first |= 0x04
+	}
+	switch m.Type {
+	case 0:
+		// SMS-DELIVER, no more messages to send.
+		pdu = append(pdu, first|0x04)
+		pdu = append(pdu, encodeAddress(m.Peer)...)
+		pdu = append(pdu, byte(m.PID), dcs)
+		pdu = append(pdu, encodeDateTime(m.When)...)
+	default:
+		// SMS-SUBMIT.
+		to := m.Peer
+		if len(m.Peers) > 0 {
+			to, _ = splitPeer(m.Peers[0])
+		}
+		// Phones use a relative validity period, by default
+		// the maximum one.
+		vp := byte(0xff)
+		if !m.Expires.IsZero() {
+			vp = encodeValidity(m.Expires.Sub(m.When))
+		}
+		mr := byte(0)
+		if len(m.MR) > 0 {
+			mr = byte(m.MR[0])
+		}
+		pdu = append(pdu, first|0x11, mr)
+		pdu = append(pdu, encodeAddress(to)...)
+		pdu = append(pdu, byte(m.PID), dcs, vp)
+	}
+	pdu = append(pdu, byte(udl))
+	pdu = append(pdu, ud...)
+	return encodeEntry(m, pdu), nil
+}
+
+// EncodeReport returns the body of an archive entry holding the
+// status report r, in S40Layout.
+func EncodeReport(r Report) []byte {
+	first := byte(0x02) // SMS-STATUS-REPORT
+	if !r.MoreMsg {
+		first |= 0x04
+	}
+	if r.Qualifier {
+		first |= 0x20
+	}
+	pdu := []byte{first, r.RefID}
+	pdu = append(pdu, encodeAddress(r.RecipAddr)...)
+	pdu = append(pdu, encodeDateTime(r.SMSCStamp)...)
+	pdu = append(pdu, encodeDateTime(r.Discharge)...)
+	pdu = append(pdu, r.Status)
+	return encodeEntry(SMS{Peer: r.RecipAddr}, pdu)
+}
+
+// encodeEntry returns the body of an entry holding pdu, with
+// the peer, text, SMS center and peers of m.
+func encodeEntry(m SMS, pdu []byte) []byte {
+	l := S40Layout
+	body := make([]byte, l.PDUOffset, 0x200)
+	name := utf16.Encode([]rune(m.Peer))
+	if max := (l.PDUOffset-l.PeerOffset)/2 - 1; len(name) > max {
+		name = name[:max]
+	}
+	for i, u := range name {
+		binary.BigEndian.PutUint16(body[l.PeerOffset+2*i:], u)
+	}
+	body = append(body, pdu...)
+
+	// Trailer: unknown bytes, text, SMS center, peers.
+	body = append(body, make([]byte, 65)...)
+	text := utf16String(m.Text)
+	body = append(body, 0, 1, 0, 3, byte(len(text)>>8), byte(len(text)))
+	body = append(body, text...)
+	smsc := append([]byte(m.SMSC), 0)
+	body = append(body, 2, byte(len(smsc)>>8), byte(len(smsc)))
+	body = append(body, smsc...)
+	for i, p := range m.Peers {
+		number, name := splitPeer(p)
+		num, nam := utf16String(number), utf16String(name)
+		body = append(body, 4, 0, 1, byte(i), 0x2b, byte(len(num)>>8), byte(len(num)))
+		body = append(body, num...)
+		body = append(body, 0x2c, byte(len(nam)>>8), byte(len(nam)))
+		body = append(body, nam...)
+	}
+	body = append(body, make([]byte, 23)...)
+	binary.BigEndian.PutUint32(body[8:], uint32(len(body)))
+	return body
+}
+
+// splitPeer splits an entry of SMS.Peers formatted
+// as "number <name>".
+func splitPeer(p string) (number, name string) {
+	if idx := strings.Index(p, " <"); idx >= 0 && strings.HasSuffix(p, ">") {
+		return p[:idx], p[idx+2 : len(p)-1]
+	}
+	return p, ""
+}
+
+// encodeText encodes text after a user data header, using
+// charset (see encodeGSM) or UCS-2, and returns the user data
+// and its length.
+func encodeText(udh []byte, text string, a Alphabet, charset *gsm7.Encoding) (ud []byte, udl int) {
+	if a == GSM7 {
+		septets, _ := encodeGSM(text, charset)
+		return packUserData(udh, septets)
+	}
+	ud = udhBytes(udh)
+	for _, u := range utf16.Encode([]rune(text)) {
+		ud = append(ud, byte(u>>8), byte(u))
+	}
+	return ud, len(ud)
+}
+
+func udhBytes(udh []byte) []byte {
+	if udh == nil {
+		return nil
+	}
+	return append([]byte{byte(len(udh))}, udh...)
+}
+
+// packUserData packs septets after a user data header,
+// inserting fill bits so that the text starts on a septet boundary.
+// Spare bits of the last octet are filled with a CR, which is not
+// counted in udl.
+func packUserData(udh []byte, septets []byte) (ud []byte, udl int) {
+	h := udhBytes(udh)
+	n := (8*len(h) + 6) / 7
+	ud = gsm7.Pack(gsm7.Pad(append(make([]byte, n), septets...)))
+	copy(ud, h)
+	return ud, n + len(septets)
+}
+
+// utf16String encodes s as NUL-terminated UTF-16BE.
+func utf16String(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s + "\x00")) {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return b
+}
+
+// encodeGSM encodes s to septets of charset, or of the GSM
+// default alphabet if charset is nil, reporting whether all
+// characters could be encoded.
+func encodeGSM(s string, charset *gsm7.Encoding) (septets []byte, ok bool) {
+	enc := gsm7.Default
+	if charset != nil {
+		enc = *charset
+	}
+	septets, err := enc.NewEncoder().Bytes([]byte(s))
+	return septets, err == nil
+}
+
+// encodeAddress encodes a phone number or an alphanumeric
+// address (GSM 03.40 section 9.1.2.5).
+func encodeAddress(addr string) []byte {
+	digits := strings.TrimPrefix(addr, "+")
+	if addr == "" || strings.Trim(digits, "0123456789") != "" {
+		// alphanumeric
+		septets, _ := encodeGSM(addr, nil)
+		packed := gsm7.Pack(septets)
+		return append([]byte{byte((len(septets)*7 + 3) / 4), 0xd0}, packed...)
+	}
+	toa := byte(0x81)
+	if digits != addr {
+		toa = 0x91 // international
+	}
+	bcd, _ := encodeBCD(digits)
+	return append([]byte{byte(len(digits)), toa}, bcd...)
+}
+
+// encodeValidity encodes d as a relative validity period,
+// rounding up (GSM 03.40 section 9.2.3.12.1).
+func encodeValidity(d time.Duration) byte {
+	const day = 24 * time.Hour
+	ceil := func(d, unit time.Duration) int { return int((d + unit - 1) / unit) }
+	switch {
+	case d <= 5*time.Minute:
+		return 0
+	case d <= 12*time.Hour:
+		return byte(ceil(d, 5*time.Minute) - 1)
+	case d <= day:
+		return byte(143 + ceil(d-12*time.Hour, 30*time.Minute))
+	case d <= 30*day:
+		return byte(166 + ceil(d, day))
+	case d <= 63*7*day:
+		return byte(192 + ceil(d, 7*day))
+	}
+	return 0xff
+}
+
+// encodeDateTime encodes t as a service centre time stamp
+// (GSM 03.40 section 9.2.3.11).
+func encodeDateTime(t time.Time) []byte {
+	_, offset := t.Zone()
+	quarters := offset / 900
+	if quarters < 0 {
+		quarters = -quarters
+	}
+	b := make([]byte, 7)
+	for i, v := range []int{t.Year() % 100, int(t.Month()), t.Day(),
+		t.Hour(), t.Minute(), t.Second(), quarters} {
+		b[i] = byte(v%10<<4 | v/10)
+	}
+	if offset < 0 {
+		b[6] |= 0x08 // sign bit
+	}
+	return b
+}
@@ -0,0 +1,300 @@
+package nbf
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf/gsm7"
+)
+
+func TestEncodeSMS(t *testing.T) {
+	when := time.Date(2011, 2, 13, 12, 34, 56, 0, time.FixedZone("", 3600))
+	for _, m := range []SMS{
+		{Type: 0, Peer: "+33612345678", When: when, Text: "Hello {world} €5", SMSC: "+33609001390"},
+		{Type: 0, Peer: "GOOGLE", When: when, Text: "Code: 1234"},
+		{Type: 0, Peer: "0612345678", When: when, Text: "Привет"},
+		{Type: 0, Peer: "+33612345678", When: when, Port: PortPicture, Data: []byte{0x30, 0, 1, 2}},
+		{Type: 1, Peer: "Bob", Peers: []string{"+33612345678 <Bob>"}, Text: "Thanks a lot"},
+		{Type: 0, Peer: "+33612345678", When: when, PID: PIDType0},
+		{Type: 0, Peer: "+33612345678", When: when, Text: "Code 1234", Coding: Coding{Class: Class0}},
+		{Type: 0, Peer: "+33612345678", When: when, Text: "Reply", ReplyPath: true, StatusReport: true},
+		{Type: 1, Peer: "Bob", Peers: []string{"+33612345678 <Bob>"}, Text: "Report",
+			StatusReport: true, RejectDuplicates: true},
+		{Type: 1, Peer: "Bob", Peers: []string{"+33612345678 <Bob>"}, Text: "Valid", When: when, Expires: when.Add(48 * time.Hour)},
+	} {
+		body, err := EncodeSMS(m)
+		if err != nil {
+			t.Errorf("encode %+v: %s", m, err)
+			continue
+		}
+		raw, err := ParseEntry(body)
+		if err != nil {
+			t.Errorf("parse %+v: %s", m, err)
+			continue
+		}
+		var got SMS
+		var ud UserData
+		switch msg := raw.Msg.(type) {
+		case Deliver:
+			got = SMS{Type: 0, Peer: msg.FromAddr, When: msg.SMSCStamp, Text: msg.Text(), PID: msg.Protocol, Coding: msg.Coding,
+				ReplyPath: msg.ReplyPath, StatusReport: msg.StatusReport}
+			ud = msg.UserData
+		case Submit:
+			got = SMS{Type: 1, Peer: raw.Peer, Peers: raw.Peers, Text: msg.Text(), PID: msg.Protocol, Coding: msg.Coding,
+				ReplyPath: msg.ReplyPath, StatusReport: msg.StatusReport, RejectDuplicates: msg.RejectDuplicates}
+			if !m.Expires.IsZero() {
+				got.When, got.Expires = m.When, m.When.Add(msg.Validity)
+			}
+			ud = msg.UserData
+		}
+		got.Port = ud.Port
+		got.SMSC = raw.SMSC
+		if ud.Binary {
+			got.Data = ud.RawData
+		}
+		if got.Type != m.Type || got.Peer != m.Peer || got.Text != m.Text ||
+			got.Port != m.Port || !bytes.Equal(got.Data, m.Data) || !got.When.Equal(m.When) ||
+			got.PID != m.PID || got.Flash() != m.Flash() || got.ReplyPath != m.ReplyPath ||
+			got.StatusReport != m.StatusReport || got.RejectDuplicates != m.RejectDuplicates ||
+			!got.Expires.Equal(m.Expires) || got.SMSC != m.SMSC {
+			t.Errorf("got %+v, expected %+v", got, m)
+		}
+		if len(m.Peers) > 0 && (len(got.Peers) != 1 || got.Peers[0] != m.Peers[0]) {
+			t.Errorf("got peers %q, expected %q", got.Peers, m.Peers)
+		}
+	}
+}
+
+func TestParseCorrupt(t *testing.T) {
+	for _, m := range []SMS{
+		{Type: 0, Peer: "+33612345678", Text: "Hello", When: time.Now()},
+		{Type: 1, Peer: "Bob", Peers: []string{"+33612345678 <Bob>"},
+			Text: "Thanks a lot", Port: PortPicture},
+	} {
+		body, err := EncodeSMS(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Truncated entries and corrupted bytes must not crash the parser.
+		for n := range body {
+			ParseEntry(body[:n])
+		}
+		for i := 0xb0; i < len(body); i++ {
+			for _, b := range []byte{0x00, 0x03, 0x44, 0x7f, 0xff} {
+				c := append([]byte(nil), body...)
+				c[i] = b
+				ParseEntry(c)
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	body, err := EncodeSMS(SMS{Peer: "+33612345678", Text: "Hello", When: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mms := append(make([]byte, 0xb0), 0x8c, 0x84)
+	for _, c := range []struct {
+		data []byte
+		err  error
+	}{
+		{body[:0xb8], ErrTruncated},
+		{body[:0x40], ErrTruncated},
+		{mms, ErrUnsupportedPDU},
+	} {
+		_, err := ParseEntry(c.data)
+		if !errors.Is(err, c.err) {
+			t.Errorf("got error %v, expected %v", err, c.err)
+		}
+		var e *EntryError
+		if !errors.As(err, &e) || e.Offset < 0 {
+			t.Errorf("error %v has no offset", err)
+		}
+	}
+	if _, err := ParseFilename("0000186F3C52A89B"); !errors.Is(err, ErrBadFilename) {
+		t.Errorf("got error %v, expected %v", err, ErrBadFilename)
+	}
+}
+
+func TestRegisterLayout(t *testing.T) {
+	body, err := EncodeSMS(SMS{Peer: "+33612345678", Text: "Hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := layoutOf(body); l != S40Layout {
+		t.Errorf("got layout %s, expected S40", l.Name)
+	}
+
+	// Same entry behind a 16-byte header.
+	shifted := append([]byte("TESTLAYOUT\x00\x00\x00\x00\x00\x00"), body...)
+	custom := &Layout{Name: "test", PeerOffset: 0x5e + 16, PDUOffset: 0xb0 + 16,
+		Match: func(b []byte) bool { return bytes.HasPrefix(b, []byte("TESTLAYOUT")) }}
+	saved := layouts
+	defer func() { layouts = saved }()
+	registerLayout(custom)
+	raw, err := ParseEntry(shifted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.Layout != custom {
+		t.Errorf("got layout %s, expected %s", raw.Layout.Name, custom.Name)
+	}
+	msg, ok := raw.Msg.(Deliver)
+	if !ok || msg.FromAddr != "+33612345678" || msg.Text() != "Hello" {
+		t.Errorf("got %+v", raw.Msg)
+	}
+	if raw, err := ParseEntry(body); err != nil || raw.Layout != S40Layout {
+		t.Errorf("unshifted entry does not use S40Layout")
+	}
+}
+
+func TestVoicemail(t *testing.T) {
+	// Special message indication: voicemail, 3 messages.
+	body, err := encodeSMS(SMS{Peer: "+33612345678", Text: "3 new messages", When: time.Now()}, []byte{1, 2, 0, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ParseEntry(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := raw.Msg.(Deliver)
+	if v := msg.Voicemail; v == nil || !v.Active || v.Count != 3 {
+		t.Errorf("got indication %+v, expected 3 active", v)
+	}
+	if s := msg.Text(); s != "3 new messages" {
+		t.Errorf("got text %q", s)
+	}
+}
+
+func TestCRPadding(t *testing.T) {
+	for _, text := range []string{"1234567", "12345678", "Hello\r", "1234567\r"} {
+		body, err := EncodeSMS(SMS{Peer: "+33612345678", Text: text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := ParseEntry(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := e.Msg.Text(); s != text {
+			t.Errorf("got %q, expected %q", s, text)
+		}
+	}
+	// 7 septets followed by a padding CR, not counted
+	// in the user data length.
+	ud := gsm7.Pack([]byte("1234567\r"))
+	pdu := append([]byte{0x04, 0x02, 0x81, 0x21, 0, 0, 0x01, 0x01, 0x01, 0, 0, 0, 0, 7}, ud...)
+	msg, _, err := parseDeliver(pdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := msg.Text(); s != "1234567" {
+		t.Errorf("got %q, expected padding to be ignored", s)
+	}
+}
+
+func TestSegment(t *testing.T) {
+	a := func(n int, s string) string { return strings.Repeat(s, n) }
+	for _, c := range []struct {
+		text  string
+		opts  SegmentOptions
+		alpha Alphabet
+		parts []string
+	}{
+		{"Hello", SegmentOptions{}, GSM7, []string{"Hello"}},
+		{a(160, "a"), SegmentOptions{}, GSM7, []string{a(160, "a")}},
+		{a(161, "a"), SegmentOptions{}, GSM7, []string{a(153, "a"), "aaaaaaaa"}},
+		{a(161, "a"), SegmentOptions{Ref: 300}, GSM7, []string{a(152, "a"), a(9, "a")}},
+		{a(152, "a") + "€b" + a(10, "c"), SegmentOptions{}, GSM7, []string{a(152, "a"), "€b" + a(10, "c")}},
+		{"Hello", SegmentOptions{UCS2: true}, UCS2, []string{"Hello"}},
+		{a(66, "☺") + "😀" + a(4, "☺"), SegmentOptions{}, UCS2, []string{a(66, "☺"), "😀" + a(4, "☺")}},
+	} {
+		parts, err := Segment(c.text, c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var texts []string
+		for _, p := range parts {
+			texts = append(texts, p.Text)
+			if p.Alphabet != c.alpha {
+				t.Errorf("%q: got alphabet %s, expected %s", c.text, p.Alphabet, c.alpha)
+			}
+			if len(p.UserData) > 140 {
+				t.Errorf("%q: part %q has %d bytes of user data", c.text, p.Text, len(p.UserData))
+			}
+		}
+		if strings.Join(texts, "|") != strings.Join(c.parts, "|") {
+			t.Errorf("%q: got parts %q, expected %q", c.text, texts, c.parts)
+		}
+	}
+
+	// Decode the parts of a concatenated message.
+	parts, _ := Segment(a(200, "x"), SegmentOptions{Ref: 42})
+	for i, p := range parts {
+		ud, _, err := parseUserData(append([]byte{byte(p.UDL)}, p.UserData...), Coding{}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ud.Concat || ud.Ref != 42 || ud.Part != i+1 || ud.NParts != 2 || ud.text(false) != p.Text {
+			t.Errorf("part %d: got %+v", i+1, ud)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	for _, c := range []struct {
+		text string
+		want Length
+	}{
+		{"", Length{GSM7, 0, 1, 160}},
+		{"Hello {you}", Length{GSM7, 13, 1, 147}},
+		{strings.Repeat("a", 200), Length{GSM7, 200, 2, 106}},
+		{"Привет", Length{UCS2, 6, 1, 64}},
+		{strings.Repeat("😀", 40), Length{UCS2, 80, 2, 53}},
+	} {
+		if got := Count(c.text); got != c.want {
+			t.Errorf("Count(%q) = %+v, expected %+v", c.text, got, c.want)
+		}
+	}
+}
+
+func TestSegmentTransliterate(t *testing.T) {
+	parts, err := Segment("C’est l’été", SegmentOptions{Transliterate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 1 || parts[0].Alphabet != GSM7 || parts[0].Text != "C'est l'été" {
+		t.Errorf("got %+v", parts)
+	}
+}
+
+func TestClone(t *testing.T) {
+	body, err := EncodeSMS(SMS{Type: 1, Peer: "Bob", Peers: []string{"+33612345678 <Bob>"}, Text: "Привет"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := ParseEntry(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := e.Clone()
+	ud := e.Msg.(Submit).UserData
+	// UCS-2 user data aliases the body.
+	ud.RawData[0] ^= 0xff
+	if e.Msg.Text() == "Привет" {
+		t.Errorf("user data does not alias the entry body")
+	}
+	if c.Msg.Text() != "Привет" || c.Peers[0] != e.Peers[0] {
+		t.Errorf("clone modified: %q", c.Msg.Text())
+	}
+	for i, sp := range c.Unknown {
+		if len(sp.Data) > 0 && &sp.Data[0] == &e.Unknown[i].Data[0] {
+			t.Errorf("span %d of clone aliases the entry body", i)
+		}
+	}
+}
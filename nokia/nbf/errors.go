@@ -0,0 +1,46 @@
+package nbf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned while decoding archive entries. They are usually
+// wrapped in an *EntryError and can be tested using errors.Is.
+var (
+	ErrTruncated      = errors.New("truncated data")
+	ErrBadFilename    = errors.New("invalid entry name")
+	ErrUnsupportedPDU = errors.New("unsupported PDU")
+	ErrCorrupt        = errors.New("corrupt data")
+	ErrNameMismatch   = errors.New("entry name does not match body")
+)
+
+// An EntryError describes an error decoding an archive entry.
+type EntryError struct {
+	Entry  string // base name of the entry, if known
+	Offset int    // offset of the faulty data in the entry, or -1
+	Err    error
+}
+
+func (e *EntryError) Error() string {
+	s := e.Err.Error()
+	if e.Offset >= 0 {
+		s = fmt.Sprintf("offset 0x%x: %s", e.Offset, s)
+	}
+	if e.Entry != "" {
+		s = e.Entry + ": " + s
+	}
+	return s
+}
+
+func (e *EntryError) Unwrap() error { return e.Err }
+
+// entryError wraps err with the entry name.
+func entryError(entry string, err error) error {
+	var e *EntryError
+	if errors.As(err, &e) && e.Entry == "" {
+		e.Entry = entry
+		return e
+	}
+	return &EntryError{Entry: entry, Offset: -1, Err: err}
+}
@@ -0,0 +1,286 @@
+package nbf
+
+import (
+	"flag"
+	"fmt"
+	"iter"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// A Filter selects messages. The nil Filter selects all messages.
+type Filter func(SMS) bool
+
+// Since selects messages dated t or later.
+func Since(t time.Time) Filter {
+	return func(m SMS) bool { return !m.When.Before(t) }
+}
+
+// Until selects messages dated before t.
+func Until(t time.Time) Filter {
+	return func(m SMS) bool { return m.When.Before(t) }
+}
+
+// InFolder selects messages of the given folders.
+func InFolder(folders ...int) Filter {
+	return func(m SMS) bool {
+		for _, f := range folders {
+			if m.Folder == f {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// WithDirection selects messages with one of the given directions.
+func WithDirection(dirs ...Direction) Filter {
+	return func(m SMS) bool {
+		for _, d := range dirs {
+			if m.Direction == d {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// WithPeer selects messages exchanged with one of peers: the
+// sender of received messages, a recipient of sent messages.
+// Phone numbers are compared ignoring punctuation and the country
+// prefix, names ignoring case. Peers may be patterns with the syntax
+// of path.Match, such as "+3361*" or "*bank*", matched against
+// normalized numbers and lower case names.
+func WithPeer(peers ...string) Filter {
+	return func(m SMS) bool {
+		for _, number := range messagePeers(m) {
+			for _, p := range peers {
+				if peerMatches(p, number) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// WithContact selects messages exchanged with one of the
+// numbers of c.
+func WithContact(c Contact) Filter {
+	var numbers []string
+	for _, p := range c.Phones {
+		numbers = append(numbers, p.Number)
+	}
+	if len(numbers) == 0 {
+		return func(SMS) bool { return false }
+	}
+	return WithPeer(numbers...)
+}
+
+// messagePeers returns the numbers and names of the peers of m.
+func messagePeers(m SMS) []string {
+	peers := []string{m.Peer}
+	if m.Type != 0 {
+		for _, p := range m.Peers {
+			number, name := splitPeer(p)
+			peers = append(peers, number)
+			if name != "" {
+				peers = append(peers, name)
+			}
+		}
+	}
+	return peers
+}
+
+func peerMatches(pattern, peer string) bool {
+	if peer == "" {
+		return false
+	}
+	if strings.ContainsAny(pattern, "*?[") {
+		for _, s := range []string{normalizePeer(peer), strings.ToLower(peer)} {
+			if ok, _ := path.Match(strings.ToLower(pattern), s); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if isNumber(pattern) && isNumber(peer) {
+		return numberKey(pattern) == numberKey(peer)
+	}
+	return strings.EqualFold(norm.NFC.String(pattern), norm.NFC.String(peer))
+}
+
+// isNumber reports whether s is a phone number, possibly with
+// punctuation.
+func isNumber(s string) bool {
+	n := strings.TrimPrefix(normalizePeer(s), "+")
+	return n != "" && strings.Trim(n, "0123456789") == ""
+}
+
+// All selects messages selected by all filters.
+// Nil filters are ignored.
+func All(filters ...Filter) Filter {
+	var fs []Filter
+	for _, f := range filters {
+		if f != nil {
+			fs = append(fs, f)
+		}
+	}
+	switch len(fs) {
+	case 0:
+		return nil
+	case 1:
+		return fs[0]
+	}
+	return func(m SMS) bool {
+		for _, f := range fs {
+			if !f(m) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Any selects messages selected by one of filters.
+func Any(filters ...Filter) Filter {
+	return func(m SMS) bool {
+		for _, f := range filters {
+			if f == nil || f(m) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not selects messages not selected by f.
+func Not(f Filter) Filter {
+	return func(m SMS) bool { return f != nil && !f(m) }
+}
+
+// Match reports whether f selects m.
+func (f Filter) Match(m SMS) bool { return f == nil || f(m) }
+
+// Slice returns the messages of msgs selected by f, in a new slice
+// unless f is nil.
+func (f Filter) Slice(msgs []SMS) []SMS {
+	if f == nil {
+		return msgs
+	}
+	var out []SMS
+	for _, m := range msgs {
+		if f(m) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Seq filters an iterator such as Reader.Messages.
+// Errors are passed through.
+func (f Filter) Seq(seq iter.Seq2[SMS, error]) iter.Seq2[SMS, error] {
+	if f == nil {
+		return seq
+	}
+	return func(yield func(SMS, error) bool) {
+		for m, err := range seq {
+			if err == nil && !f(m) {
+				continue
+			}
+			if !yield(m, err) {
+				return
+			}
+		}
+	}
+}
+
+// FilterFlags are command-line flags defining a Filter, so that
+// programs select messages consistently.
+type FilterFlags struct {
+	Since, Until string // see ParseTime
+	Folder       int
+	Direction    string // as printed by Direction.String
+	Peer         string // see WithPeer
+	Location     *time.Location
+}
+
+// Register defines flags -since, -until, -folder, -direction
+// and -peer in fs.
+func (ff *FilterFlags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&ff.Since, "since", "", "select messages dated on or after this date (2006-01-02 15:04, or a prefix)")
+	fs.StringVar(&ff.Until, "until", "", "select messages dated before this date (2006-01-02 15:04, or a prefix)")
+	fs.IntVar(&ff.Folder, "folder", 0, "select messages of folder predefmessages/N")
+	fs.StringVar(&ff.Direction, "direction", "", "select received, sent, draft or unknown messages")
+	fs.StringVar(&ff.Peer, "peer", "", "select messages exchanged with this number or name (may be a pattern like +3361*)")
+}
+
+// Filter returns the filter defined by the flags.
+func (ff *FilterFlags) Filter() (Filter, error) {
+	loc := ff.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	var filters []Filter
+	if ff.Since != "" {
+		t, err := ParseTime(ff.Since, loc)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, Since(t))
+	}
+	if ff.Until != "" {
+		t, err := ParseTime(ff.Until, loc)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, Until(t))
+	}
+	if ff.Folder != 0 {
+		filters = append(filters, InFolder(ff.Folder))
+	}
+	if ff.Direction != "" {
+		d, err := ParseDirection(ff.Direction)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, WithDirection(d))
+	}
+	if ff.Peer != "" {
+		if _, err := path.Match(ff.Peer, ""); err != nil {
+			return nil, fmt.Errorf("invalid peer pattern %q: %s", ff.Peer, err)
+		}
+		filters = append(filters, WithPeer(ff.Peer))
+	}
+	return All(filters...), nil
+}
+
+// ParseDirection is the inverse of Direction.String.
+func ParseDirection(s string) (Direction, error) {
+	for _, d := range []Direction{Unknown, Received, Sent, Draft} {
+		if strings.EqualFold(s, d.String()) {
+			return d, nil
+		}
+	}
+	return Unknown, fmt.Errorf("invalid direction %q", s)
+}
+
+// ParseTime parses a date in loc, formatted as RFC 3339 or as
+// "2006-01-02 15:04:05", possibly truncated after the year, month,
+// day, hour or minute.
+func ParseTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	const layout = "2006-01-02 15:04:05"
+	for _, n := range []int{len("2006"), len("2006-01"), len("2006-01-02"),
+		len("2006-01-02 15"), len("2006-01-02 15:04"), len(layout)} {
+		if len(s) == n {
+			return time.ParseInLocation(layout[:n], s, loc)
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
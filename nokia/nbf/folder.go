@@ -0,0 +1,90 @@
+package nbf
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A Folder is a message folder of the archive, predefmessages/N.
+type Folder struct {
+	ID      int
+	Name    string // see FolderName
+	User    bool   // created by the user
+	Entries int    // number of message entries
+}
+
+var folderNames = map[int]string{
+	FolderInbox:     "Inbox",
+	FolderPending:   "Outbox",
+	FolderOutbox:    "Sent items",
+	FolderArchive:   "Archive",
+	FolderDrafts:    "Drafts",
+	FolderTemplates: "Templates",
+}
+
+// FolderName returns the name of standard folder id, as shown
+// by phones, or "Folder N" for other folders. Archives do not
+// hold the names given by users to their folders.
+func FolderName(id int) string {
+	if name, ok := folderNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("Folder %d", id)
+}
+
+// Folders returns the message folders of the archive, sorted
+// by ID, including empty folders having a directory entry
+// predefmessages/N/.
+func (r *Reader) Folders() []Folder {
+	folders := make(map[int]*Folder)
+	get := func(id int) *Folder {
+		f := folders[id]
+		if f == nil {
+			_, std := folderNames[id]
+			f = &Folder{ID: id, Name: FolderName(id), User: !std}
+			folders[id] = f
+		}
+		return f
+	}
+	for _, zf := range r.z.File {
+		if zf.Mode().IsDir() {
+			if id, ok := entryFolder(strings.TrimSuffix(zf.Name, "/") + "/x"); ok {
+				get(id)
+			}
+			continue
+		}
+		if id, ok := entryFolder(zf.Name); ok {
+			get(id).Entries++
+		}
+	}
+	list := make([]Folder, 0, len(folders))
+	for _, f := range folders {
+		list = append(list, *f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// FolderMessages returns the text messages of folder id, sorted
+// by date (see ByDate). Sent messages of FolderOutbox are matched
+// with their status reports, as by Outbox.
+func (r *Reader) FolderMessages(id int) ([]SMS, error) {
+	return r.FolderMessagesContext(context.Background(), id)
+}
+
+// FolderMessagesContext is like FolderMessages, but stops when
+// ctx is done.
+func (r *Reader) FolderMessagesContext(ctx context.Context, id int) ([]SMS, error) {
+	switch id {
+	case FolderInbox:
+		return r.InboxContext(ctx)
+	case FolderOutbox:
+		return r.OutboxContext(ctx)
+	}
+	if err := r.checkStore(); err != nil {
+		return nil, err
+	}
+	return r.collectSMS(r.messages(ctx, fmt.Sprintf("predefmessages/%d/", id)), 0)
+}
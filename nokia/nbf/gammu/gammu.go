@@ -0,0 +1,127 @@
+// Package gammu compares the decoding of message entries with
+// a reference implementation, such as the one of libgammu, to
+// validate the decoder of package nbf on real archives.
+//
+// The libgammu decoder, Decode, requires cgo and is only built
+// with the gammu build tag:
+//
+//	go build -tags gammu ./nokia/nbftool
+//
+// Other decoders, such as wrappers of external tools, can be
+// passed to Compare.
+package gammu
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+// A Message holds the fields of a SMS PDU compared between
+// decoders.
+type Message struct {
+	Submit bool      // SMS-SUBMIT rather than SMS-DELIVER
+	Number string    // sender or recipient
+	Text   string    // empty for 8-bit data
+	SCTS   time.Time // service centre time stamp, of SMS-DELIVER
+	MR     int       // message reference, of SMS-SUBMIT
+
+	// Concatenated messages.
+	Ref, Part, NParts int
+}
+
+// A Decoder decodes a SMS PDU without SMSC address. Bytes
+// following the PDU are ignored.
+type Decoder func(pdu []byte) (Message, error)
+
+// A Mismatch is a field decoded differently by nbf and
+// by a reference decoder.
+type Mismatch struct {
+	Entry string // entry name
+	Field string
+	NBF   string // value decoded by nbf
+	Ref   string // value decoded by the reference decoder
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s: %s: nbf %s, reference %s", m.Entry, m.Field, m.NBF, m.Ref)
+}
+
+// Compare decodes the message entries of r with nbf and decode,
+// returning the fields which differ. Entries which nbf cannot
+// decode are skipped: they are reported by Reader.Verify.
+// Compare sets r.KeepRaw.
+func Compare(ctx context.Context, r *nbf.Reader, decode Decoder) ([]Mismatch, error) {
+	r.KeepRaw = true
+	var diffs []Mismatch
+	for m, err := range r.MessagesContext(ctx) {
+		if err != nil {
+			if ctx.Err() != nil {
+				return diffs, err
+			}
+			continue
+		}
+		for _, raw := range m.Raw {
+			e, err := nbf.ParseEntry(raw.Body)
+			if err != nil {
+				continue
+			}
+			got, err := decode(raw.Body[e.Layout.PDUOffset:])
+			if err != nil {
+				diffs = append(diffs, Mismatch{Entry: raw.Name, Field: "PDU", NBF: "decoded", Ref: err.Error()})
+				continue
+			}
+			diffs = append(diffs, diff(raw.Name, fromEntry(e), got)...)
+		}
+	}
+	return diffs, nil
+}
+
+// fromEntry returns the compared fields of an entry
+// decoded by nbf.
+func fromEntry(e nbf.Entry) Message {
+	var m Message
+	var ud nbf.UserData
+	switch msg := e.Msg.(type) {
+	case nbf.Deliver:
+		m.Number, m.SCTS = msg.FromAddr, msg.SMSCStamp
+		ud = msg.UserData
+	case nbf.Submit:
+		m.Submit, m.Number, m.MR = true, msg.ToAddr, int(msg.RefID)
+		ud = msg.UserData
+	}
+	m.Text = e.Msg.Text()
+	if ud.Concat {
+		m.Ref, m.Part, m.NParts = ud.Ref, ud.Part, ud.NParts
+	}
+	return m
+}
+
+// diff returns the fields of want and got which differ.
+func diff(entry string, want, got Message) []Mismatch {
+	var diffs []Mismatch
+	check := func(field string, a, b any) {
+		if a != b {
+			diffs = append(diffs, Mismatch{Entry: entry, Field: field,
+				NBF: fmt.Sprintf("%q", fmt.Sprint(a)), Ref: fmt.Sprintf("%q", fmt.Sprint(b))})
+		}
+	}
+	check("Submit", want.Submit, got.Submit)
+	if want.Submit != got.Submit {
+		// Other fields are meaningless.
+		return diffs
+	}
+	check("Number", want.Number, got.Number)
+	check("Text", want.Text, got.Text)
+	if want.Submit {
+		check("MR", want.MR, got.MR)
+	} else if !want.SCTS.Equal(got.SCTS) {
+		check("SCTS", want.SCTS.Format(time.RFC3339), got.SCTS.Format(time.RFC3339))
+	}
+	check("Ref", want.Ref, got.Ref)
+	check("Part", want.Part, got.Part)
+	check("NParts", want.NParts, got.NParts)
+	return diffs
+}
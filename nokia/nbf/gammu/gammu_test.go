@@ -0,0 +1,70 @@
+package gammu
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/nbf/nbftest"
+)
+
+var testArchive = nbftest.Archive{
+	Messages: []nbftest.Message{
+		{Peer: "+33612345678", Text: "Hello there"},
+		{Peer: "+33612345678", When: nbftest.Epoch.Add(time.Hour),
+			Parts: []string{"This message is ", "split in ", "three parts"}},
+		{Sent: true, Peer: "+33612345678", Name: "Bob", When: nbftest.Epoch.Add(2 * time.Hour),
+			Text: "Thanks, Bob ☺"},
+	},
+}
+
+// nbfDecoder decodes PDUs with nbf, as a reference decoder
+// agreeing with it.
+func nbfDecoder(pdu []byte) (Message, error) {
+	body := append(make([]byte, nbf.S40Layout.PDUOffset), pdu...)
+	e, err := nbf.ParseEntry(body)
+	if err != nil {
+		return Message{}, err
+	}
+	return fromEntry(e), nil
+}
+
+func TestCompare(t *testing.T) {
+	r, err := testArchive.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := Compare(context.Background(), r, nbfDecoder)
+	if err != nil || len(diffs) != 0 {
+		t.Fatalf("got %v, %v", diffs, err)
+	}
+
+	// A decoder disagreeing on the text of concatenated parts
+	// and failing on sent messages.
+	diffs, err = Compare(context.Background(), r, func(pdu []byte) (Message, error) {
+		m, err := nbfDecoder(pdu)
+		if m.Submit {
+			return m, errors.New("unsupported")
+		}
+		if m.NParts > 0 {
+			m.Text += "!"
+		}
+		return m, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make(map[string]int)
+	for _, d := range diffs {
+		fields[d.Field]++
+	}
+	if len(diffs) != 4 || fields["Text"] != 3 || fields["PDU"] != 1 {
+		t.Errorf("got mismatches %v", diffs)
+	}
+	d := diffs[len(diffs)-1]
+	if want := d.Entry + ": PDU: nbf decoded, reference unsupported"; d.String() != want {
+		t.Errorf("got %q, want %q", d.String(), want)
+	}
+}
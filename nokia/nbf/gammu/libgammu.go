@@ -0,0 +1,69 @@
+//go:build gammu
+
+package gammu
+
+/*
+#cgo pkg-config: gammu
+#include <stdlib.h>
+#include <gammu.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf16"
+	"unsafe"
+)
+
+// Decode decodes pdu using GSM_DecodePDUFrame of libgammu.
+func Decode(pdu []byte) (Message, error) {
+	if len(pdu) == 0 {
+		return Message{}, fmt.Errorf("gammu: empty PDU")
+	}
+	var sms C.GSM_SMSMessage
+	var pos C.size_t
+	buf := C.CBytes(pdu)
+	defer C.free(buf)
+	if e := C.GSM_DecodePDUFrame(C.GSM_GetGlobalDebug(), &sms,
+		(*C.uchar)(buf), C.size_t(len(pdu)), &pos, C.FALSE); e != C.ERR_NONE {
+		return Message{}, fmt.Errorf("gammu: %s", C.GoString(C.GSM_ErrorString(e)))
+	}
+	m := Message{
+		Submit: sms.PDU == C.SMS_Submit,
+		Number: unicodeString(sms.Number[:]),
+		MR:     int(sms.MessageReference),
+	}
+	if sms.Coding != C.SMS_Coding_8bit {
+		m.Text = unicodeString(sms.Text[:])
+	}
+	if sms.PDU == C.SMS_Deliver {
+		dt := sms.DateTime
+		m.SCTS = time.Date(int(dt.Year), time.Month(dt.Month), int(dt.Day),
+			int(dt.Hour), int(dt.Minute), int(dt.Second), 0,
+			time.FixedZone("", int(dt.Timezone)))
+	}
+	if udh := sms.UDH; udh.AllParts > 0 {
+		m.Part, m.NParts = int(udh.PartNumber), int(udh.AllParts)
+		m.Ref = int(udh.ID8bit)
+		if udh.ID16bit >= 0 {
+			m.Ref = int(udh.ID16bit)
+		}
+	}
+	return m, nil
+}
+
+// unicodeString decodes a NUL-terminated UTF-16BE string,
+// the representation of text in libgammu.
+func unicodeString(b []C.uchar) string {
+	s := unsafe.Slice((*byte)(unsafe.Pointer(&b[0])), len(b))
+	var u []uint16
+	for i := 0; i+1 < len(s); i += 2 {
+		c := uint16(s[i])<<8 | uint16(s[i+1])
+		if c == 0 {
+			break
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,96 @@
+package gsm7
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+)
+
+// Emoticons maps common emoji to text smileys, and drops emoji
+// variation selectors. It can be used as a transliteration table
+// (see TransliteratingEmoji), or merged into another one.
+var Emoticons = map[rune]string{
+	'\ufe0e': "", '\ufe0f': "", // variation selectors
+	'☺': ":-)", '🙂': ":-)", '😊': ":-)", '😃': ":-D", '😀': ":-D",
+	'😄': ":-D", '😁': ":-D", '😂': ":'-D", '😉': ";-)", '🙁': ":-(",
+	'☹': ":-(", '😞': ":-(", '😢': ":'(", '😭': ":'(", '😛': ":-P",
+	'😜': ";-P", '😮': ":-O", '😲': ":-O", '😘': ":-*", '😗': ":-*",
+	'😎': "B-)", '😐': ":-|", '😕': ":-/", '😠': ">:-(", '😡': ">:-(",
+	'❤': "<3", '💔': "</3", '👍': "(y)", '👎': "(n)",
+}
+
+// TransliteratingEmoji is like Transliterating, also replacing
+// emoji by smileys.
+var TransliteratingEmoji encoding.Encoding = Encoding{Transliterate: mergeMaps(Transliterations, Emoticons)}
+
+func mergeMaps(maps ...map[rune]string) map[rune]string {
+	m := make(map[rune]string)
+	for _, mm := range maps {
+		for k, v := range mm {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// smileys maps text smileys to emoji, longest first.
+var smileys = func() []struct{ text, emoji string } {
+	m := map[string]string{
+		":-)": "🙂", ":)": "🙂", ":-D": "😀", ":D": "😀", ";-)": "😉", ";)": "😉",
+		":-(": "🙁", ":(": "🙁", ":'(": "😢", ":'-(": "😢", ":-P": "😛", ":P": "😛",
+		":-p": "😛", ":p": "😛", ":-O": "😮", ":-o": "😮", ":-*": "😘", ":*": "😘",
+		"B-)": "😎", ":-|": "😐", ":-/": "😕", ">:-(": "😠", "<3": "❤", "</3": "💔",
+		"(y)": "👍", "(n)": "👎", ":'-D": "😂",
+	}
+	var s []struct{ text, emoji string }
+	for t, e := range m {
+		s = append(s, struct{ text, emoji string }{t, e})
+	}
+	sort.Slice(s, func(i, j int) bool {
+		if len(s[i].text) != len(s[j].text) {
+			return len(s[i].text) > len(s[j].text)
+		}
+		return s[i].text < s[j].text
+	})
+	return s
+}()
+
+// Emojify replaces text smileys of text by emoji, for display.
+// Smileys are only replaced when they are separate words,
+// possibly followed by punctuation.
+func Emojify(text string) string {
+	var b strings.Builder
+	atStart := true
+	for i := 0; i < len(text); {
+		if atStart {
+			if n, emoji := matchSmiley(text[i:]); n > 0 {
+				b.WriteString(emoji)
+				i += n
+				atStart = false
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		b.WriteString(text[i : i+size])
+		atStart = unicode.IsSpace(r)
+		i += size
+	}
+	return b.String()
+}
+
+func matchSmiley(s string) (n int, emoji string) {
+	for _, sm := range smileys {
+		if !strings.HasPrefix(s, sm.text) {
+			continue
+		}
+		rest := s[len(sm.text):]
+		r, _ := utf8.DecodeRuneInString(rest)
+		if rest == "" || unicode.IsSpace(r) || strings.ContainsRune(".,;!?", r) {
+			return len(sm.text), sm.emoji
+		}
+	}
+	return 0, ""
+}
@@ -0,0 +1,406 @@
+// Package gsm7 implements the GSM 7-bit default alphabet and its
+// extension table (GSM 03.38), used by text messages.
+//
+// Encodings convert between UTF-8 and unpacked septets, one per
+// byte. Pack and Unpack convert between unpacked septets and the
+// packed form of message user data.
+package gsm7
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Escape is the septet introducing a character of the
+// single shift (extension) table.
+const Escape = 0x1b
+
+// A Table maps septets to runes. Zero entries are undefined.
+type Table [128]rune
+
+// DefaultAlphabet is the GSM 7-bit default alphabet.
+var DefaultAlphabet = Table{
+	// 0x00
+	'@', '£', '$', '¥', 'è', 'é', 'ù', 'ì',
+	'ò', 'Ç', '\n', 'Ø', 'ø', '\r', 'Å', 'å',
+	// 0x10
+	'Δ', '_', 'Φ', 'Γ', 'Λ', 'Ω', 'Π', 'Ψ',
+	'Σ', 'Θ', 'Ξ', 0 /* ESC */, 'Æ', 'æ', 'ß', 'É',
+	// 0x20
+	' ', '!', '"', '#', '¤', '%', '&', '\'',
+	'(', ')', '*', '+', ',', '-', '.', '/',
+	// 0x30
+	'0', '1', '2', '3', '4', '5', '6', '7',
+	'8', '9', ':', ';', '<', '=', '>', '?',
+	// 0x40
+	'¡', 'A', 'B', 'C', 'D', 'E', 'F', 'G',
+	'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O',
+	// 0x50
+	'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W',
+	'X', 'Y', 'Z', 'Ä', 'Ö', 'Ñ', 'Ü', '§',
+	// 0x60
+	'¿', 'a', 'b', 'c', 'd', 'e', 'f', 'g',
+	'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o',
+	// 0x70
+	'p', 'q', 'r', 's', 't', 'u', 'v', 'w',
+	'x', 'y', 'z', 'ä', 'ö', 'ñ', 'ü', 'à',
+}
+
+// DefaultExtension is the extension table of the default alphabet.
+var DefaultExtension = Table{
+	0x0a: '\f',
+	0x14: '^',
+	0x28: '{', 0x29: '}', 0x2f: '\\',
+	0x3c: '[', 0x3d: '~', 0x3e: ']',
+	0x40: '|',
+	0x65: '€',
+}
+
+// ErrUnsupported is returned by encoders for characters
+// which are not in the tables of the encoding.
+var ErrUnsupported = errors.New("gsm7: character not in alphabet")
+
+// ErrInvalid is returned by decoders for undefined septets
+// if the policy of the encoding is Fail.
+var ErrInvalid = errors.New("gsm7: invalid septet")
+
+// A Policy selects the handling of undefined septets by decoders:
+// septets missing from the tables, bytes above 0x7f and
+// a final Escape.
+type Policy int
+
+const (
+	Replace Policy = iota // decode as U+FFFD
+	Skip                  // ignore
+	Fail                  // fail with ErrInvalid
+)
+
+// An Encoding is a GSM 7-bit character set, made of a locking
+// shift table and a single shift table, selected by Escape.
+// It implements encoding.Encoding of golang.org/x/text.
+type Encoding struct {
+	Locking *Table // nil means DefaultAlphabet
+	Single  *Table // nil means DefaultExtension
+	Invalid Policy // handling of undefined septets
+
+	// Transliterate, if not nil, is used by encoders to replace
+	// characters missing from the tables. Characters missing from
+	// Transliterate are replaced by their canonical decomposition
+	// without combining marks, if possible.
+	Transliterate map[rune]string
+
+	overrides []Override // see With
+}
+
+// Default is the default alphabet with its extension table.
+var Default encoding.Encoding = Encoding{}
+
+// Transliterating is the default alphabet, transliterating
+// other characters using Transliterations.
+var Transliterating encoding.Encoding = Encoding{Transliterate: Transliterations}
+
+// Transliterations maps characters missing from the default
+// alphabet to close equivalents. Users may add entries, before
+// encoders are used.
+var Transliterations = map[rune]string{
+	// Punctuation
+	'‘': "'", '’': "'", '‚': "'", '′': "'",
+	'“': "\"", '”': "\"", '„': "\"", '«': "\"", '»': "\"", '″': "\"",
+	'‐': "-", '‑': "-", '–': "-", '—': "-", '−': "-",
+	'…': "...", '•': "*", '·': ".",
+	'\u00a0': " ", '\u2009': " ", '\u202f': " ", '\t': " ",
+	'`': "'", '´': "'",
+	// Letters whose decomposition is not in the alphabet.
+	'ç': "Ç", 'œ': "oe", 'Œ': "OE", 'ł': "l", 'Ł': "L",
+	'đ': "d", 'Đ': "D", 'ı': "i", 'þ': "th", 'Þ': "Th",
+	'ð': "d", 'Ð': "D",
+	// Symbols
+	'™': "TM", '©': "(c)", '®': "(R)", '×': "x", '÷': "/",
+	'°': "o",
+}
+
+func (e Encoding) tables() (locking, single *Table) {
+	locking, single = e.Locking, e.Single
+	if locking == nil {
+		locking = &DefaultAlphabet
+	}
+	if single == nil {
+		single = &DefaultExtension
+	}
+	return
+}
+
+// NewDecoder returns a decoder of unpacked septets. Following
+// GSM 03.38, an escaped septet which is not in the single shift
+// table decodes as the character of the locking shift table.
+// Other undefined septets are handled according to e.Invalid.
+func (e Encoding) NewDecoder() *encoding.Decoder {
+	locking, single := e.tables()
+	return &encoding.Decoder{Transformer: &decoder{locking: locking, single: single, invalid: e.Invalid}}
+}
+
+// NewEncoder returns an encoder to unpacked septets. It fails
+// with ErrUnsupported for characters not in the tables, which
+// could not be transliterated.
+func (e Encoding) NewEncoder() *encoding.Encoder {
+	locking, single := e.tables()
+	enc := defaultEncoder
+	if locking != &DefaultAlphabet || single != &DefaultExtension {
+		enc = newEncoder(locking, single)
+		for _, o := range e.overrides {
+			delete(enc.septets, o.Rune)
+			delete(enc.escaped, o.Rune)
+			if o.Escaped {
+				enc.escaped[o.Rune] = o.Septet & 0x7f
+			} else {
+				enc.septets[o.Rune] = o.Septet & 0x7f
+			}
+		}
+	}
+	if e.Transliterate != nil {
+		c := *enc
+		c.translit = e.Transliterate
+		enc = &c
+	}
+	return &encoding.Encoder{Transformer: enc}
+}
+
+// AppendDecode appends the UTF-8 decoding of septets to dst,
+// as the decoders of e would, without allocating a decoder.
+// On error, dst is returned unchanged.
+func (e Encoding) AppendDecode(dst, septets []byte) ([]byte, error) {
+	locking, single := e.tables()
+	d := decoder{locking: locking, single: single, invalid: e.Invalid}
+	n := len(dst)
+	dst = slices.Grow(dst, utf8.UTFMax*len(septets))
+	nDst, _, err := d.Transform(dst[n:n+utf8.UTFMax*len(septets)], septets, true)
+	if err != nil {
+		return dst[:n], err
+	}
+	return dst[:n+nDst], nil
+}
+
+type decoder struct {
+	transform.NopResetter
+	locking, single *Table
+	invalid         Policy
+}
+
+func (d *decoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		c, size := src[nSrc], 1
+		var r rune
+		switch {
+		case c >= 0x80:
+		case c != Escape:
+			r = d.locking[c]
+		case nSrc+1 == len(src):
+			if !atEOF {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+		default:
+			c, size = src[nSrc+1], 2
+			if c < 0x80 {
+				r = d.single[c]
+				if r == 0 {
+					r = d.locking[c]
+				}
+			}
+		}
+		if r == 0 {
+			switch d.invalid {
+			case Skip:
+				nSrc += size
+				continue
+			case Fail:
+				return nDst, nSrc, ErrInvalid
+			}
+			r = utf8.RuneError
+		}
+		if nDst+utf8.RuneLen(r) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += utf8.EncodeRune(dst[nDst:], r)
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
+
+type encoder struct {
+	transform.NopResetter
+	septets  map[rune]byte // locking shift table
+	escaped  map[rune]byte // single shift table
+	translit map[rune]string
+}
+
+var defaultEncoder = newEncoder(&DefaultAlphabet, &DefaultExtension)
+
+func newEncoder(locking, single *Table) *encoder {
+	e := &encoder{septets: make(map[rune]byte), escaped: make(map[rune]byte)}
+	for i := len(single) - 1; i >= 0; i-- {
+		if r := single[i]; r != 0 {
+			e.escaped[r] = byte(i)
+		}
+	}
+	for i := len(locking) - 1; i >= 0; i-- {
+		if r := locking[i]; r != 0 {
+			e.septets[r] = byte(i)
+			delete(e.escaped, r)
+		}
+	}
+	return e
+}
+
+// encode appends the septets encoding r to b.
+func (e *encoder) encode(b []byte, r rune) ([]byte, bool) {
+	if c, ok := e.septets[r]; ok {
+		return append(b, c), true
+	}
+	if c, ok := e.escaped[r]; ok {
+		return append(b, Escape, c), true
+	}
+	return b, false
+}
+
+// transliterate appends the septets encoding a replacement
+// of r to b: its transliteration, which may be empty, or its
+// decomposition without combining marks.
+func (e *encoder) transliterate(b []byte, r rune) ([]byte, bool) {
+	repl, ok := e.translit[r]
+	if !ok {
+		repl = strings.Map(func(r rune) rune {
+			if unicode.Is(unicode.Mn, r) {
+				return -1
+			}
+			return r
+		}, norm.NFD.String(string(r)))
+		if repl == "" || repl == string(r) {
+			return b, false
+		}
+	}
+	n := len(b)
+	for _, r := range repl {
+		if b, ok = e.encode(b, r); !ok {
+			return b[:n], false
+		}
+	}
+	return b, true
+}
+
+func (e *encoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	var buf [16]byte
+	for nSrc < len(src) {
+		r, size := utf8.DecodeRune(src[nSrc:])
+		if r == utf8.RuneError && size == 1 {
+			if !atEOF && !utf8.FullRune(src[nSrc:]) {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			return nDst, nSrc, encoding.ErrInvalidUTF8
+		}
+		septets, ok := e.encode(buf[:0], r)
+		if !ok && e.translit != nil {
+			septets, ok = e.transliterate(buf[:0], r)
+		}
+		if !ok {
+			return nDst, nSrc, ErrUnsupported
+		}
+		if nDst+len(septets) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], septets)
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
+
+// CR is the carriage return septet, used for padding.
+const CR = 0x0d
+
+// Pad returns septets followed by a CR if they would end with
+// 7 spare bits once packed, so that receivers do not decode the
+// zero bits as '@' (GSM 03.38 section 6.1.2.3.1).
+func Pad(septets []byte) []byte {
+	if len(septets)%8 == 7 {
+		return append(septets[:len(septets):len(septets)], CR)
+	}
+	return septets
+}
+
+// TrimPadding removes the final CR of septets ending on an octet
+// boundary, which is padding following GSM 03.38 section 6.1.2.3.1.
+// It only applies to data whose length is given in octets, such as
+// USSD strings and cell broadcast pages: the length of SMS user
+// data counts septets, which excludes the padding.
+func TrimPadding(septets []byte) []byte {
+	if n := len(septets); n > 0 && n%8 == 0 && septets[n-1] == CR {
+		return septets[:n-1]
+	}
+	return septets
+}
+
+// Unpack unpacks septets packed in octets, least significant
+// bits first (GSM 03.38 section 6.1.2.1). Trailing bits forming
+// an incomplete septet are ignored.
+func Unpack(packed []byte) []byte {
+	return AppendUnpack(make([]byte, 0, len(packed)*8/7), packed)
+}
+
+// septetShifts are the positions of the 8 septets of a 56-bit word.
+var septetShifts = [8]uint{0, 7, 14, 21, 28, 35, 42, 49}
+
+// AppendUnpack appends the septets of packed to dst, see Unpack.
+func AppendUnpack(dst, packed []byte) []byte {
+	dst = slices.Grow(dst, len(packed)*8/7)
+	// Every 7 octets hold 8 septets.
+	for len(packed) >= 7 {
+		w := uint64(binary.LittleEndian.Uint32(packed)) |
+			uint64(binary.LittleEndian.Uint16(packed[4:]))<<32 |
+			uint64(packed[6])<<48
+		for _, s := range septetShifts {
+			dst = append(dst, byte(w>>s)&0x7f)
+		}
+		packed = packed[7:]
+	}
+	// each byte may contain a part of septet i in lower bits
+	// and septet i+1 in higher bits.
+	buf := uint16(0)
+	buflen := uint(0)
+	for _, b := range packed {
+		buf |= uint16(b) << buflen
+		buflen += 8
+		for buflen >= 7 {
+			dst = append(dst, byte(buf&0x7f))
+			buflen -= 7
+			buf >>= 7
+		}
+	}
+	return dst
+}
+
+// Pack is the inverse of Unpack.
+func Pack(septets []byte) []byte {
+	buf := uint16(0)
+	buflen := uint(0)
+	out := make([]byte, 0, (len(septets)*7+7)/8)
+	for _, c := range septets {
+		buf |= uint16(c&0x7f) << buflen
+		buflen += 7
+		if buflen >= 8 {
+			out = append(out, byte(buf))
+			buflen -= 8
+			buf >>= 8
+		}
+	}
+	if buflen > 0 {
+		out = append(out, byte(buf))
+	}
+	return out
+}
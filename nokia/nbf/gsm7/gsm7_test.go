@@ -0,0 +1,215 @@
+package gsm7
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncoding(t *testing.T) {
+	for _, c := range []struct {
+		text    string
+		septets []byte
+	}{
+		{"Hello", []byte{0x48, 0x65, 0x6c, 0x6c, 0x6f}},
+		{"@£$", []byte{0x00, 0x01, 0x02}},
+		{`\o/ 5€`, []byte{0x1b, 0x2f, 0x6f, 0x2f, 0x20, 0x35, 0x1b, 0x65}},
+	} {
+		s, err := Default.NewEncoder().Bytes([]byte(c.text))
+		if err != nil || !bytes.Equal(s, c.septets) {
+			t.Errorf("encode %q: got %x, %v, expected %x", c.text, s, err, c.septets)
+		}
+		text, err := Default.NewDecoder().String(string(c.septets))
+		if err != nil || text != c.text {
+			t.Errorf("decode %x: got %q, %v, expected %q", c.septets, text, err, c.text)
+		}
+		b, err := Encoding{}.AppendDecode([]byte("> "), c.septets)
+		if err != nil || string(b) != "> "+c.text {
+			t.Errorf("AppendDecode %x: got %q, %v", c.septets, b, err)
+		}
+	}
+
+	if _, err := Default.NewEncoder().String("☺"); err != ErrUnsupported {
+		t.Errorf("got error %v, expected ErrUnsupported", err)
+	}
+	// Escaped septets missing from the extension table
+	// decode using the default alphabet.
+	if s, _ := Default.NewDecoder().String("\x1bA"); s != "A" {
+		t.Errorf("got %q, expected \"A\"", s)
+	}
+
+	// Custom tables.
+	locking := DefaultAlphabet
+	locking[0x60] = 'ç'
+	enc := Encoding{Locking: &locking}
+	if s, err := enc.NewEncoder().String("ç{"); err != nil || s != "\x60\x1b\x28" {
+		t.Errorf("got %q, %v", s, err)
+	}
+}
+
+func TestPack(t *testing.T) {
+	packed := []byte{0xd2, 0xf7, 0xfb, 0xfd, 0x7e, 0x83, 0xe8, 0x75, 0x90, 0xbd, 0x5c, 0xc7, 0x83,
+		0xe2, 0xf5, 0x32, 0x48, 0x7d, 0x0a, 0xc3, 0xe1, 0x65, 0x36, 0xbb, 0xfc, 0x3}
+	septets := Unpack(packed)
+	text, err := Default.NewDecoder().Bytes(septets)
+	if err != nil || string(text) != "Rooooo tu veux que j'appelle?" {
+		t.Errorf("got %q, %v", text, err)
+	}
+	if p := Pack(septets); !bytes.Equal(p, packed) {
+		t.Errorf("Pack(Unpack(%x)) = %x", packed, p)
+	}
+
+	// Lengths around word boundaries.
+	for n := 0; n <= 24; n++ {
+		septets := make([]byte, n)
+		for i := range septets {
+			septets[i] = byte(i*37+11) & 0x7f
+		}
+		packed := Pack(septets)
+		got := AppendUnpack([]byte{0xff}, packed)
+		if got[0] != 0xff || !bytes.Equal(got[1:1+n], septets) || len(got)-1 != len(packed)*8/7 {
+			t.Errorf("AppendUnpack(%x) = %x, expected %x", packed, got[1:], septets)
+		}
+	}
+}
+
+var benchPacked = Pack(bytes.Repeat([]byte("Hello world, "), 13)[:160])
+
+func BenchmarkUnpack(b *testing.B) {
+	b.SetBytes(int64(len(benchPacked)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Unpack(benchPacked)
+	}
+}
+
+func BenchmarkAppendUnpack(b *testing.B) {
+	b.SetBytes(int64(len(benchPacked)))
+	b.ReportAllocs()
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		buf = AppendUnpack(buf[:0], benchPacked)
+	}
+}
+
+func BenchmarkPack(b *testing.B) {
+	septets := Unpack(benchPacked)
+	b.SetBytes(int64(len(septets)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Pack(septets)
+	}
+}
+
+func TestPadding(t *testing.T) {
+	septets := []byte("1234567")
+	padded := Pad(septets)
+	if string(padded) != "1234567\r" || len(septets) != 7 {
+		t.Errorf("Pad(%q) = %q", septets, padded)
+	}
+	packed := Pack(padded)
+	if len(packed) != 7 || packed[6]>>1 != CR {
+		t.Errorf("bad padding in %x", packed)
+	}
+	if s := TrimPadding(Unpack(packed)); string(s) != "1234567" {
+		t.Errorf("got %q after unpacking", s)
+	}
+	// A CR not ending on an octet boundary is kept.
+	if s := TrimPadding([]byte("12345\r")); string(s) != "12345\r" {
+		t.Errorf("got %q", s)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	in := "A\x80B\x1b"
+	for _, c := range []struct {
+		policy Policy
+		out    string
+		err    error
+	}{
+		{Replace, "A�B�", nil},
+		{Skip, "AB", nil},
+		{Fail, "", ErrInvalid},
+	} {
+		out, err := Encoding{Invalid: c.policy}.NewDecoder().String(in)
+		if err != c.err || err == nil && out != c.out {
+			t.Errorf("policy %d: got %q, %v", c.policy, out, err)
+		}
+	}
+}
+
+func TestTransliterate(t *testing.T) {
+	enc := Transliterating.NewEncoder()
+	for in, out := range map[string]string{
+		"“Olá”—it’s ça…": `"Ola"-it's Ça...`,
+		"Žluťoučký kůň":  "Zlutoucky kun",
+		"Ærøskøbing":     "Ærøskøbing",
+	} {
+		septets, err := enc.String(in)
+		if err != nil {
+			t.Errorf("%q: %s", in, err)
+			continue
+		}
+		if s, _ := Default.NewDecoder().String(septets); s != out {
+			t.Errorf("got %q, expected %q", s, out)
+		}
+	}
+	if _, err := enc.String("☺"); err != ErrUnsupported {
+		t.Errorf("got error %v, expected ErrUnsupported", err)
+	}
+
+	// User-defined transliterations.
+	e := Encoding{Transliterate: map[rune]string{'☺': ":-)"}}
+	if s, err := e.NewEncoder().String("Hi ☺"); err != nil || s != "Hi :-)" {
+		t.Errorf("got %q, %v", s, err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	var r CharsetRegistry
+	// Some phones display septet 0x60 as ç.
+	r.Register("cedilla", Override{Septet: 0x60, Rune: 'ç'}, Override{Septet: 0x09, Rune: 'Ç'})
+	enc, ok := r.Lookup("cedilla")
+	if !ok {
+		t.Fatal("charset not registered")
+	}
+	if s, _ := enc.NewDecoder().String("\x09a\x60"); s != "Çaç" {
+		t.Errorf("got %q", s)
+	}
+	if s, err := enc.NewEncoder().String("ç"); err != nil || s != "\x60" {
+		t.Errorf("got %q, %v", s, err)
+	}
+	if _, err := enc.NewEncoder().String("¿"); err != ErrUnsupported {
+		t.Errorf("got %v, expected ErrUnsupported", err)
+	}
+	if _, ok := r.Lookup("other"); ok {
+		t.Errorf("found unregistered charset")
+	}
+	if names := r.Names(); len(names) != 1 || names[0] != "cedilla" {
+		t.Errorf("got names %q", names)
+	}
+	if s, _ := Default.NewDecoder().String("\x60"); s != "¿" {
+		t.Errorf("default alphabet was modified: got %q", s)
+	}
+}
+
+func TestEmoji(t *testing.T) {
+	s, err := TransliteratingEmoji.NewEncoder().String("Merci 😀 ❤️ “ok”")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := Default.NewDecoder().String(s); text != `Merci :-D <3 "ok"` {
+		t.Errorf("got %q", text)
+	}
+
+	for in, out := range map[string]string{
+		"Hello :-) see you;)": "Hello 🙂 see you;)",
+		":D <3":               "😀 ❤",
+		"ok :(, bye :'(":      "ok 🙁, bye 😢",
+		"http://x:)":          "http://x:)",
+		"(y)!":                "👍!",
+	} {
+		if s := Emojify(in); s != out {
+			t.Errorf("Emojify(%q) = %q, expected %q", in, s, out)
+		}
+	}
+}
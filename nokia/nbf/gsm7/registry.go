@@ -0,0 +1,84 @@
+package gsm7
+
+import (
+	"sort"
+	"sync"
+)
+
+// An Override maps a septet to a rune, for both decoding
+// and encoding, replacing the definition of the tables.
+type Override struct {
+	Septet  byte
+	Escaped bool // septet of the single shift table
+	Rune    rune
+}
+
+// With returns a copy of e whose tables are modified by overrides.
+// Encoders use the overridden septets even if the rune is also
+// defined elsewhere in the tables.
+func (e Encoding) With(overrides ...Override) Encoding {
+	locking, single := e.tables()
+	l, s := *locking, *single
+	for _, o := range overrides {
+		if o.Escaped {
+			s[o.Septet&0x7f] = o.Rune
+		} else {
+			l[o.Septet&0x7f] = o.Rune
+		}
+	}
+	e.Locking, e.Single = &l, &s
+	e.overrides = append(e.overrides[:len(e.overrides):len(e.overrides)], overrides...)
+	return e
+}
+
+// A CharsetRegistry is a set of named encodings, such as variants
+// of the default alphabet used by some operators or phones.
+// It is safe for concurrent use.
+type CharsetRegistry struct {
+	mu       sync.RWMutex
+	charsets map[string]Encoding
+}
+
+// Charsets is a default registry, populated by programs
+// using this package.
+var Charsets CharsetRegistry
+
+// Register registers the default alphabet, modified by
+// overrides, under name.
+func (r *CharsetRegistry) Register(name string, overrides ...Override) {
+	r.RegisterEncoding(name, Encoding{}.With(overrides...))
+}
+
+// RegisterEncoding registers e under name.
+func (r *CharsetRegistry) RegisterEncoding(name string, e Encoding) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.charsets == nil {
+		r.charsets = make(map[string]Encoding)
+	}
+	r.charsets[name] = e
+}
+
+// Lookup returns the encoding registered under name.
+// The empty name is the default alphabet.
+func (r *CharsetRegistry) Lookup(name string) (Encoding, bool) {
+	if name == "" {
+		return Encoding{}, true
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.charsets[name]
+	return e, ok
+}
+
+// Names returns the sorted names of registered encodings.
+func (r *CharsetRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var names []string
+	for name := range r.charsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
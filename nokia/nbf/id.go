@@ -0,0 +1,80 @@
+package nbf
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// ID returns a stable identifier of the message, computed from
+// its direction, peer, timestamp and contents. It does not depend
+// on the archive the message was read from, so that messages
+// can be correlated across backups and export formats.
+//
+// The timestamp is the raw timestamp of the entry name of sent
+// messages, if known, and the service centre time stamp of
+// received messages, if known, so that the identifier depends
+// neither on the time zone used to decode entry names nor on
+// Reader.TimeSource.
+func (m SMS) ID() string {
+	h := sha1.New()
+	var buf [8]byte
+	buf[0] = byte(m.Type)
+	h.Write(buf[:1])
+	for _, s := range []string{
+		normalizePeer(ThreadPeer(m)),
+		strings.Replace(m.Text, "\r\n", "\n", -1),
+		string(m.Data),
+	} {
+		binary.BigEndian.PutUint64(buf[:], uint64(len(s)))
+		h.Write(buf[:])
+		h.Write([]byte(s))
+	}
+	stamp := m.When.Unix()
+	switch {
+	case m.Type == 0 && !m.SCTS.IsZero():
+		stamp = m.SCTS.Unix()
+	case m.Type != 0 && m.RawStamp != 0:
+		stamp = int64(m.RawStamp)
+	}
+	binary.BigEndian.PutUint64(buf[:], uint64(stamp))
+	h.Write(buf[:])
+	binary.BigEndian.PutUint64(buf[:], uint64(m.Port))
+	h.Write(buf[:])
+	return fmt.Sprintf("%x", h.Sum(nil)[:12])
+}
+
+// normalizePeer strips formatting characters from phone numbers,
+// leaving other peers (names) unchanged except for case.
+func normalizePeer(peer string) string {
+	var nums []string
+	for _, p := range strings.Split(peer, ",") {
+		n := strings.Map(func(r rune) rune {
+			switch r {
+			case ' ', '-', '.', '(', ')':
+				return -1
+			}
+			return r
+		}, p)
+		if strings.HasPrefix(n, "00") {
+			n = "+" + n[2:]
+		}
+		if strings.Trim(n, "+0123456789") != "" {
+			// not a number
+			n = strings.ToLower(strings.TrimSpace(p))
+		}
+		nums = append(nums, n)
+	}
+	return strings.Join(nums, ",")
+}
+
+// numberKey returns the last 9 digits of a phone number, so that
+// national and international forms of numbers compare equal.
+func numberKey(number string) string {
+	n := strings.TrimPrefix(normalizePeer(number), "+")
+	if strings.Trim(n, "0123456789") == "" && len(n) > 9 {
+		n = n[len(n)-9:]
+	}
+	return n
+}
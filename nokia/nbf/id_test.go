@@ -0,0 +1,68 @@
+package nbf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSMS_ID(t *testing.T) {
+	when := time.Date(2012, 1, 26, 13, 1, 0, 0, time.UTC)
+	m := SMS{Type: 0, Peer: "+33 6 12 34 56 78", When: when, Text: "Hello\r\nthere"}
+	id := m.ID()
+
+	same := SMS{Type: 0, Peer: "0033612345678", When: when.Local(), Text: "Hello\nthere"}
+	if got := same.ID(); got != id {
+		t.Errorf("ID of %+v = %s, expected %s", same, got, id)
+	}
+	for _, other := range []SMS{
+		{Type: 1, Peer: m.Peer, When: when, Text: m.Text},
+		{Type: 0, Peer: "+33612345679", When: when, Text: m.Text},
+		{Type: 0, Peer: m.Peer, When: when.Add(time.Second), Text: m.Text},
+		{Type: 0, Peer: m.Peer, When: when, Text: "Hello there"},
+	} {
+		if other.ID() == id {
+			t.Errorf("ID of %+v collides with %+v", other, m)
+		}
+	}
+
+	// Sent messages are identified by the raw timestamp
+	// of their entry name.
+	sent := SMS{Type: 1, Peer: m.Peer, When: when, Text: m.Text, RawStamp: 0x3c3a6d20}
+	shifted := sent
+	shifted.When = when.Add(2 * time.Hour)
+	if sent.ID() != shifted.ID() {
+		t.Errorf("ID of sent message depends on its decoded time")
+	}
+	shifted.RawStamp++
+	if sent.ID() == shifted.ID() {
+		t.Errorf("ID of sent message does not depend on its raw timestamp")
+	}
+
+	// Received messages are identified by their service
+	// centre time stamp.
+	received := SMS{Peer: m.Peer, When: when, SCTS: when, Text: m.Text}
+	stored := received
+	stored.When = when.Add(time.Minute)
+	if received.ID() != stored.ID() {
+		t.Errorf("ID of received message depends on the time source")
+	}
+}
+
+func TestDedup(t *testing.T) {
+	when := time.Date(2012, 1, 26, 13, 1, 0, 0, time.UTC)
+	msgs := []SMS{
+		{Peer: "+33612345678", When: when.Add(30 * time.Second), Text: "hello"},
+		{Peer: "+33612345678", When: when, Text: "hello"},
+		{Peer: "+33 6 12 34 56 78", When: when, Text: "hello"},
+		{Peer: "+33612345678", When: when.Add(time.Hour), Text: "hello"},
+		{Peer: "+33612345678", When: when, Text: "bye"},
+		{Type: 1, Peer: "+33612345678", When: when, Text: "hello"},
+	}
+	out := Dedup(msgs)
+	if len(out) != 4 {
+		t.Fatalf("got %d messages, expected 4: %+v", len(out), out)
+	}
+	if !out[0].When.Equal(when) {
+		t.Errorf("earliest duplicate not kept: %+v", out[0])
+	}
+}
@@ -0,0 +1,227 @@
+package nbf
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JSON encoding of messages. Times are formatted as RFC 3339
+// strings and members with zero values are omitted.
+
+// optTime returns nil for the zero time, so that it is omitted.
+func optTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+type jsonCoding struct {
+	Alphabet   string `json:"alphabet"` // "GSM-7", "8-bit" or "UCS-2"
+	Class      *int   `json:"class,omitempty"`
+	Compressed bool   `json:"compressed,omitempty"`
+}
+
+func codingJSON(c Coding) jsonCoding {
+	j := jsonCoding{Alphabet: c.Alphabet.String(), Compressed: c.Compressed}
+	if c.Class != NoClass {
+		class := int(c.Class - Class0)
+		j.Class = &class
+	}
+	return j
+}
+
+type jsonSMS struct {
+	Direction string     `json:"direction"`
+	Folder    int        `json:"folder,omitempty"`
+	Peer      string     `json:"peer"`
+	Peers     []string   `json:"peers,omitempty"`
+	Date      *time.Time `json:"date,omitempty"`
+	Stored    *time.Time `json:"stored,omitempty"`
+	SCTS      *time.Time `json:"scts,omitempty"`
+	Expires   *time.Time `json:"expires,omitempty"`
+	Text      string     `json:"text"`
+	SMSC      string     `json:"smsc,omitempty"`
+	TOA       TOA        `json:"toa,omitempty"`
+	PID       PID        `json:"pid,omitempty"`
+	Coding    jsonCoding `json:"coding"`
+	Voicemail *Voicemail `json:"voicemail,omitempty"`
+	Port      int        `json:"port,omitempty"`
+	Data      []byte     `json:"data,omitempty"` // base64
+	Undecoded string     `json:"undecoded,omitempty"`
+	Delivery  string     `json:"delivery,omitempty"`
+	Delivered *time.Time `json:"delivered,omitempty"`
+
+	ReplyPath        bool `json:"reply_path,omitempty"`
+	StatusReport     bool `json:"status_report,omitempty"`
+	RejectDuplicates bool `json:"reject_duplicates,omitempty"`
+
+	Raw []RawEntry `json:"raw,omitempty"`
+}
+
+// MarshalJSON encodes m as a JSON object with members:
+//
+//	direction   "received", "sent", "draft" or "unknown"
+//	folder      number of the folder of the entry
+//	peer        sender or recipient
+//	peers       recipients of sent messages, as "number <name>"
+//	date        time of the message (When)
+//	stored      time of the entry name (Stamp)
+//	scts        service centre time stamp
+//	expires     end of the validity period
+//	text        decoded text
+//	smsc        SMS center number
+//	toa, pid    type of address and protocol identifier
+//	coding      {"alphabet": "GSM-7", "8-bit" or "UCS-2", "class": 0-3, "compressed"}
+//	voicemail   {"active": bool, "count": n}
+//	port        destination port
+//	data        payload of binary messages, base64 encoded
+//	undecoded   reason why the text could not be decoded
+//	delivery    "pending", "delivered" or "failed", from status reports
+//	delivered   time of delivery
+//	reply_path, status_report, reject_duplicates: PDU flags
+//	raw         archive entries, if kept
+//
+// Members other than direction, peer, text and coding are
+// omitted if empty.
+func (m SMS) MarshalJSON() ([]byte, error) {
+	delivery := ""
+	if m.DeliveryStatus != NoReport {
+		delivery = m.DeliveryStatus.String()
+	}
+	return json.Marshal(jsonSMS{
+		Direction:        m.Direction.String(),
+		Folder:           m.Folder,
+		Peer:             m.Peer,
+		Peers:            m.Peers,
+		Date:             optTime(m.When),
+		Stored:           optTime(m.Stamp),
+		SCTS:             optTime(m.SCTS),
+		Expires:          optTime(m.Expires),
+		Text:             m.Text,
+		SMSC:             m.SMSC,
+		TOA:              m.TOA,
+		PID:              m.PID,
+		Coding:           codingJSON(m.Coding),
+		Voicemail:        m.Voicemail,
+		Port:             m.Port,
+		Data:             m.Data,
+		Undecoded:        m.Undecoded,
+		Delivery:         delivery,
+		Delivered:        optTime(m.DeliveredAt),
+		ReplyPath:        m.ReplyPath,
+		StatusReport:     m.StatusReport,
+		RejectDuplicates: m.RejectDuplicates,
+		Raw:              m.Raw,
+	})
+}
+
+// jsonUserData is the user data of a PDU.
+type jsonUserData struct {
+	Text   string `json:"text"`
+	Data   []byte `json:"data,omitempty"` // binary or compressed payload
+	Ref    *int   `json:"ref,omitempty"`  // concatenated messages
+	Part   int    `json:"part,omitempty"`
+	NParts int    `json:"parts,omitempty"`
+	Port   int    `json:"port,omitempty"`
+
+	Voicemail *Voicemail `json:"voicemail,omitempty"`
+}
+
+func userDataJSON(u UserData, text string) jsonUserData {
+	j := jsonUserData{Text: text, Port: u.Port, Voicemail: u.Voicemail}
+	if u.Binary || u.Compressed {
+		j.Data = u.RawData
+	}
+	if u.Concat {
+		ref := u.Ref
+		j.Ref, j.Part, j.NParts = &ref, u.Part, u.NParts
+	}
+	return j
+}
+
+// MarshalJSON encodes msg as a JSON object with type "deliver",
+// the fields of the PDU (from, toa, pid, coding as for SMS, scts)
+// and the decoded user data (text, data, ref, part, parts, port,
+// voicemail).
+func (msg Deliver) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type         string     `json:"type"`
+		From         string     `json:"from"`
+		TOA          TOA        `json:"toa"`
+		PID          PID        `json:"pid"`
+		Coding       jsonCoding `json:"coding"`
+		SCTS         *time.Time `json:"scts,omitempty"`
+		MoreMsg      bool       `json:"more_messages,omitempty"`
+		ReplyPath    bool       `json:"reply_path,omitempty"`
+		StatusReport bool       `json:"status_report,omitempty"`
+		jsonUserData
+	}{
+		Type:         "deliver",
+		From:         msg.FromAddr,
+		TOA:          msg.FromTOA,
+		PID:          msg.Protocol,
+		Coding:       codingJSON(msg.Coding),
+		SCTS:         optTime(msg.SMSCStamp),
+		MoreMsg:      msg.MoreMsg,
+		ReplyPath:    msg.ReplyPath,
+		StatusReport: msg.StatusReport,
+		jsonUserData: userDataJSON(msg.UserData, msg.Text()),
+	})
+}
+
+// MarshalJSON encodes msg as a JSON object with type "submit",
+// the fields of the PDU (mr, to, toa, pid, coding as for SMS,
+// validity in seconds or valid_until) and the decoded user data
+// as for Deliver. The message reference is named "mr" to avoid
+// confusion with the reference of concatenated messages.
+func (msg Submit) MarshalJSON() ([]byte, error) {
+	var validity *float64
+	if msg.Validity != 0 {
+		v := msg.Validity.Seconds()
+		validity = &v
+	}
+	return json.Marshal(struct {
+		Type             string     `json:"type"`
+		MR               byte       `json:"mr"`
+		To               string     `json:"to"`
+		TOA              TOA        `json:"toa"`
+		PID              PID        `json:"pid"`
+		Coding           jsonCoding `json:"coding"`
+		Validity         *float64   `json:"validity,omitempty"`
+		ValidUntil       *time.Time `json:"valid_until,omitempty"`
+		ReplyPath        bool       `json:"reply_path,omitempty"`
+		StatusReport     bool       `json:"status_report,omitempty"`
+		RejectDuplicates bool       `json:"reject_duplicates,omitempty"`
+		jsonUserData
+	}{
+		Type:             "submit",
+		MR:               msg.RefID,
+		To:               msg.ToAddr,
+		TOA:              msg.ToTOA,
+		PID:              msg.Protocol,
+		Coding:           codingJSON(msg.Coding),
+		Validity:         validity,
+		ValidUntil:       optTime(msg.ValidUntil),
+		ReplyPath:        msg.ReplyPath,
+		StatusReport:     msg.StatusReport,
+		RejectDuplicates: msg.RejectDuplicates,
+		jsonUserData:     userDataJSON(msg.UserData, msg.Text()),
+	})
+}
+
+// MarshalText returns the entry name describing inf (see Filename).
+func (inf MessageInfo) MarshalText() ([]byte, error) {
+	return []byte(inf.Filename()), nil
+}
+
+// UnmarshalText parses an entry name using ParseFilename.
+// Fields decoded from the entry body are cleared.
+func (inf *MessageInfo) UnmarshalText(text []byte) error {
+	m, err := ParseFilename(string(text))
+	if err != nil {
+		return err
+	}
+	*inf = m
+	return nil
+}
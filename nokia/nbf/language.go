@@ -0,0 +1,121 @@
+package nbf
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Language returns the language of the text of m, as detected
+// by DetectLanguage.
+func (m SMS) Language() string {
+	if m.Binary {
+		return ""
+	}
+	return DetectLanguage(m.Text)
+}
+
+// scripts maps Unicode scripts to the language usually
+// written with them.
+var scripts = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Hangul, "ko"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+	{unicode.Thai, "th"},
+}
+
+// stopwords are frequent short words of languages
+// written in the Latin script.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "you", "is", "are", "to", "for", "it", "of", "my", "me", "what", "have", "this", "ok", "call", "see", "when", "will", "not"},
+	"fr": {"le", "la", "les", "et", "est", "je", "tu", "vous", "pas", "une", "pour", "que", "qui", "ce", "au", "avec", "bisous", "suis", "mais", "ça", "ai"},
+	"de": {"der", "die", "das", "und", "ist", "ich", "du", "nicht", "ein", "eine", "mit", "auf", "zu", "wir", "bin", "dich", "mich", "auch", "heute"},
+	"es": {"el", "los", "las", "y", "es", "yo", "tu", "que", "una", "por", "para", "con", "pero", "como", "estoy", "hola", "muy", "qué"},
+	"it": {"il", "lo", "gli", "e", "è", "io", "che", "non", "una", "per", "con", "sono", "ciao", "come", "anche", "della", "ti", "mi"},
+	"pt": {"o", "os", "as", "e", "é", "eu", "você", "que", "não", "uma", "para", "com", "um", "mas", "estou", "obrigado", "tudo"},
+	"nl": {"de", "het", "een", "en", "is", "ik", "je", "niet", "van", "dat", "met", "op", "voor", "zijn", "wij", "ook", "maar"},
+}
+
+// letters are characters mostly used by a single language.
+var letters = map[rune]string{
+	'ß': "de", 'ñ': "es", '¿': "es", '¡': "es", 'ã': "pt", 'õ': "pt",
+	'ì': "it", 'ò': "it", 'ê': "fr", 'è': "fr", 'ù': "fr", 'œ': "fr",
+	'і': "uk", 'ї': "uk", 'є': "uk", 'ґ': "uk",
+}
+
+// DetectLanguage guesses the language of text, returning its
+// ISO 639-1 code, or the empty string if it is not recognized.
+// Languages with their own script are recognized by their
+// characters, a few European languages by frequent words.
+// It is meant for short messages and is easily wrong.
+func DetectLanguage(text string) string {
+	text = strings.ToLower(text)
+	counts := make(map[string]int)
+	latin := 0
+	for _, r := range text {
+		if lang, ok := letters[r]; ok {
+			counts[lang] += 2
+		}
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, s := range scripts {
+			if unicode.Is(s.table, r) {
+				counts["script:"+s.lang]++
+				break
+			}
+		}
+	}
+	// Non-Latin scripts, if they dominate.
+	best, max := "", latin
+	for k, n := range counts {
+		if strings.HasPrefix(k, "script:") && (n > max || n == max && k < best) {
+			best, max = k, n
+		}
+	}
+	switch best {
+	case "":
+	case "script:ru":
+		if counts["uk"] > 0 {
+			return "uk"
+		}
+		return "ru"
+	case "script:zh":
+		if counts["script:ja"] > 0 {
+			return "ja" // kanji with kana
+		}
+		return "zh"
+	default:
+		return strings.TrimPrefix(best, "script:")
+	}
+
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	for _, w := range words {
+		for lang, list := range stopwords {
+			for _, s := range list {
+				if w == s {
+					counts[lang]++
+				}
+			}
+		}
+	}
+	best, max = "", 0
+	for lang := range stopwords {
+		if n := counts[lang]; n > max {
+			best, max = lang, n
+		} else if n == max {
+			best = "" // ambiguous
+		}
+	}
+	return best
+}
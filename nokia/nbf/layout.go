@@ -0,0 +1,56 @@
+package nbf
+
+// A Layout describes the position of fields in message entries.
+//
+// Only the layout of Series 40 phones is known. Other firmware
+// variants can be supported by adding their layout to the table
+// below with registerLayout.
+type Layout struct {
+	Name       string
+	PeerOffset int // NUL-terminated UTF-16BE peer name
+	PDUOffset  int // SMS or MMS PDU
+
+	// Match reports whether an entry body uses the layout.
+	// It is only called for registered layouts.
+	Match func(body []byte) bool
+}
+
+// S40Layout is the layout of Series 40 phones.
+var S40Layout = &Layout{Name: "S40", PeerOffset: 0x5e, PDUOffset: 0xb0}
+
+// layouts lists the registered layouts, tried in order before
+// S40Layout.
+var layouts []*Layout
+
+// registerLayout adds a layout to those tried by layoutOf,
+// before the previously registered ones. It must not be called
+// concurrently with archive scans.
+func registerLayout(l *Layout) {
+	layouts = append([]*Layout{l}, layouts...)
+}
+
+// layoutOf returns the first registered layout matching
+// an entry body, or S40Layout if none matches.
+func layoutOf(body []byte) *Layout {
+	for _, l := range layouts {
+		if l.Match(body) {
+			return l
+		}
+	}
+	return S40Layout
+}
+
+// peer decodes the peer name of body. It returns end < 0
+// if the name is not terminated before the PDU.
+func (l *Layout) peer(body []byte) (peer string, end int) {
+	off := l.PeerOffset
+	for ; off+1 < l.PDUOffset && off+1 < len(body); off += 2 {
+		if body[off] == 0 && body[off+1] == 0 {
+			return decodeUCS2(body[l.PeerOffset:off]), off + 2
+		}
+	}
+	if off > len(body) {
+		return "", -1
+	}
+	return decodeUCS2(body[l.PeerOffset:off]), -1
+}
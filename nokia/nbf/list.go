@@ -0,0 +1,67 @@
+package nbf
+
+import (
+	"archive/zip"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+)
+
+// A Header describes a message entry using only information
+// from the archive directory: the content fields of MessageInfo
+// are not set. The message body is read and parsed by SMS.
+type Header struct {
+	Name   string // full entry name
+	Folder int    // predefmessages/N
+	MessageInfo
+	When time.Time // from the entry name
+
+	f    *zip.File
+	opts decodeOptions
+}
+
+// IsMMS reports whether the entry holds a multimedia message.
+func (h Header) IsMMS() bool { return DecodeFlags(h.Flags).MMS }
+
+// Direction returns the direction of the message, guessed
+// from its folder since the body is not read.
+func (h Header) Direction() Direction { return DirectionOf(h.Folder, nil) }
+
+// SMS reads and decodes the message body. Parts of
+// concatenated messages are decoded individually.
+func (h Header) SMS() (SMS, error) {
+	if h.f == nil {
+		return SMS{}, fmt.Errorf("%s: no archive entry", h.Name)
+	}
+	d := decodeEntry(h.f, h.opts)
+	return d.sms, d.err
+}
+
+// List returns headers of message entries in the archive,
+// sorted by sequence number. Entries with unparseable names
+// are skipped. It does not read message bodies.
+func (r *Reader) List() ([]Header, error) {
+	var hdrs []Header
+	opts := r.decodeOptions()
+	for _, f := range r.z.File {
+		folder, ok := entryFolder(f.Name)
+		if !ok || f.Mode().IsDir() {
+			continue
+		}
+		info, err := ParseFilename(path.Base(f.Name))
+		if err != nil {
+			continue
+		}
+		hdrs = append(hdrs, Header{
+			Name:        f.Name,
+			Folder:      folder,
+			MessageInfo: info,
+			When:        opts.stamp(info.Timestamp),
+			f:           f,
+			opts:        opts,
+		})
+	}
+	sort.SliceStable(hdrs, func(i, j int) bool { return hdrs[i].Seq < hdrs[j].Seq })
+	return hdrs, nil
+}
@@ -0,0 +1,212 @@
+package nbf
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"image/png"
+	"io"
+	"iter"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/mms"
+)
+
+// A MediaFile is a file of the gallery folders, read on demand.
+type MediaFile struct {
+	NBFFile string
+	Type    string // extension, in lower case
+	Stamp   time.Time
+	Size    int64 // uncompressed
+
+	f        *zip.File
+	password string
+}
+
+// Open returns a reader of the contents of the file.
+func (m MediaFile) Open() (io.ReadCloser, error) {
+	return openEntry(m.f, m.password)
+}
+
+// GalleryFiles iterates over media files (photos, tones, videos)
+// stored in the gallery folders of the archive, without reading
+// them, so that large archives can be extracted one file
+// at a time.
+func (r *Reader) GalleryFiles() iter.Seq[MediaFile] {
+	return func(yield func(MediaFile) bool) {
+		for f := range r.files() {
+			if !strings.HasPrefix(f.Name, "predefgallery/") || f.Mode().IsDir() {
+				continue
+			}
+			if !yield(MediaFile{
+				NBFFile:  f.Name,
+				Type:     strings.ToLower(strings.TrimPrefix(path.Ext(f.Name), ".")),
+				Stamp:    f.Modified,
+				Size:     int64(f.UncompressedSize64),
+				f:        f,
+				password: r.Password,
+			}) {
+				return
+			}
+		}
+	}
+}
+
+// Gallery returns media files (photos, tones, videos) stored
+// in the gallery folders of the archive. See GalleryFiles for
+// large archives.
+func (r *Reader) Gallery() (files []Image, err error) {
+	for m := range r.GalleryFiles() {
+		data, err := readEntry(m.f, m.password)
+		if err != nil {
+			log.Printf("cannot read %s: %s", m.NBFFile, err)
+			continue
+		}
+		files = append(files, Image{
+			NBFFile: m.NBFFile,
+			Type:    m.Type,
+			Stamp:   m.Stamp,
+			Data:    data,
+		})
+	}
+	return files, nil
+}
+
+// Pictures returns the bitmaps of picture messages, as PNG images.
+func (r *Reader) Pictures() (images []Image, err error) {
+	inbox, err := r.Inbox()
+	if err != nil {
+		return nil, err
+	}
+	outbox, err := r.Outbox()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range append(inbox, outbox...) {
+		if m.Port != PortPicture {
+			continue
+		}
+		img, _, err := ParsePicture(m.Data)
+		if err != nil {
+			log.Printf("invalid picture message from %s: %s", m.Peer, err)
+			continue
+		}
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, img); err != nil {
+			return images, err
+		}
+		images = append(images, Image{
+			Type:  "png",
+			Stamp: m.When,
+			Peer:  m.Peer,
+			Data:  buf.Bytes(),
+		})
+	}
+	return images, nil
+}
+
+// A MMS is a multimedia message stored in a NBF archive.
+type MMS struct {
+	NBFFile   string
+	Stamp     time.Time
+	Peer      string
+	Direction Direction // Sent for m-send-req PDUs and the outbox
+
+	// ReadStatus and ReadAt tell whether sent messages were read,
+	// according to read reports of the inbox.
+	ReadStatus ReadStatus
+	ReadAt     time.Time
+
+	mms.MMS
+}
+
+// MMS returns decoded multimedia messages. Read reports are
+// matched to sent messages (see CorrelateReadReports) and
+// are not returned.
+func (r *Reader) MMS() (msgs []MMS, err error) {
+	return r.MMSContext(context.Background())
+}
+
+// MMSContext is like MMS, but stops when ctx is done,
+// returning the error of ctx.
+func (r *Reader) MMSContext(ctx context.Context) (msgs []MMS, err error) {
+	msgs, reports, err := r.mms(ctx)
+	if err != nil {
+		return nil, err
+	}
+	CorrelateReadReports(msgs, reports)
+	return msgs, nil
+}
+
+// ReadReports returns the MMS read reports of the archive.
+func (r *Reader) ReadReports() ([]ReadReport, error) {
+	_, reports, err := r.mms(context.Background())
+	return reports, err
+}
+
+// mms decodes MMS entries, separating read reports
+// from messages.
+func (r *Reader) mms(ctx context.Context) (msgs []MMS, reports []ReadReport, err error) {
+	for f := range r.files() {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		if !strings.HasPrefix(f.Name, "predefmessages/") || f.Mode().IsDir() {
+			continue
+		}
+		base := path.Base(f.Name)
+		info, err := ParseFilename(base)
+		if err != nil || info.Flags&FLAGS_MMS == 0 {
+			continue
+		}
+		if !info.ChecksumOK {
+			r.Diagnostics.report(Event{Kind: ChecksumMismatch, Entry: base, Detail: "filename checksum mismatch"})
+		}
+		s, err := openStream(f, r.Password)
+		if err != nil {
+			log.Printf("cannot read %s: %s", base, err)
+			r.Diagnostics.report(Event{Kind: EntrySkipped, Entry: base, Detail: err.Error()})
+			continue
+		}
+		if err := s.skipToMMS(); err != nil {
+			s.Close()
+			log.Printf("cannot read %s: %s", base, err)
+			r.Diagnostics.report(Event{Kind: EntrySkipped, Entry: base, Detail: err.Error()})
+			continue
+		}
+		m, err := mms.ReadMMS(bufio.NewReader(ctxReader{ctx, s}))
+		s.Close()
+		if cerr := ctx.Err(); cerr != nil {
+			return nil, nil, cerr
+		}
+		if err != nil {
+			log.Printf("cannot parse MMS %s: %s", base, err)
+			if len(m.Parts) == 0 {
+				r.Diagnostics.report(Event{Kind: EntrySkipped, Entry: base, Detail: err.Error()})
+				continue
+			}
+		}
+		stamp := r.decodeOptions().stamp(info.Timestamp)
+		switch m.MessageType() {
+		case mms.MReadOrigInd, mms.MReadRecInd:
+			reports = append(reports, parseReadReport(base, stamp, m))
+			continue
+		}
+		dir := Received
+		if folder, _ := entryFolder(f.Name); folder == FolderOutbox || m.MessageType() == mms.MSendReq {
+			dir = Sent
+		}
+		msgs = append(msgs, MMS{
+			NBFFile:   base,
+			Stamp:     stamp,
+			Peer:      info.Peer,
+			Direction: dir,
+			MMS:       m,
+		})
+	}
+	return msgs, reports, nil
+}
@@ -0,0 +1,103 @@
+package nbf
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// A Merger consolidates messages from several archives,
+// for example overlapping backups of the same phone.
+// Messages keep their folder and direction.
+type Merger struct {
+	msgs    []SMS
+	folders map[int]bool // including empty folders
+}
+
+// Add adds messages from a source to the merge.
+func (m *Merger) Add(msgs []SMS) {
+	for _, msg := range msgs {
+		m.addFolder(msg.Folder)
+	}
+	m.msgs = append(m.msgs, msgs...)
+}
+
+func (m *Merger) addFolder(id int) {
+	if m.folders == nil {
+		m.folders = make(map[int]bool)
+	}
+	m.folders[id] = true
+}
+
+// AddArchive adds the messages of all folders of r to the merge.
+func (m *Merger) AddArchive(r *Reader) error {
+	return m.AddArchiveContext(context.Background(), r)
+}
+
+// AddArchiveContext is like AddArchive, but stops when ctx is done.
+func (m *Merger) AddArchiveContext(ctx context.Context, r *Reader) error {
+	ids := []int{FolderInbox, FolderOutbox}
+	for _, f := range r.Folders() {
+		m.addFolder(f.ID)
+		if f.ID != FolderInbox && f.ID != FolderOutbox {
+			ids = append(ids, f.ID)
+		}
+	}
+	for _, id := range ids {
+		msgs, err := r.FolderMessagesContext(ctx, id)
+		if err != nil {
+			return err
+		}
+		m.Add(msgs)
+	}
+	return nil
+}
+
+// Messages returns the merged messages of all folders, without
+// duplicates, sorted by date. Of several copies of a message,
+// the earliest is kept.
+func (m *Merger) Messages() []SMS {
+	return Dedup(m.msgs)
+}
+
+// Folders returns the folders of the merged messages, sorted by
+// ID. Entries is the number of merged messages of each folder.
+func (m *Merger) Folders() []Folder {
+	counts := make(map[int]int)
+	for _, msg := range m.Messages() {
+		counts[msg.Folder]++
+	}
+	list := make([]Folder, 0, len(m.folders))
+	for id := range m.folders {
+		_, std := folderNames[id]
+		list = append(list, Folder{ID: id, Name: FolderName(id), User: !std, Entries: counts[id]})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// WriteJSON writes the merged messages to w as a JSON object
+// with a "folders" member, listing folders with their messages.
+func (m *Merger) WriteJSON(w io.Writer) error {
+	type folder struct {
+		Folder
+		Messages []SMS
+	}
+	folders := m.Folders()
+	index := make(map[int]int, len(folders))
+	out := make([]folder, len(folders))
+	for i, f := range folders {
+		out[i].Folder = f
+		index[f.ID] = i
+	}
+	for _, msg := range m.Messages() {
+		f := &out[index[msg.Folder]]
+		f.Messages = append(f.Messages, msg)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Folders []folder `json:"folders"`
+	}{out})
+}
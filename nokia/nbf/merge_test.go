@@ -0,0 +1,100 @@
+package nbf_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/nbf/nbftest"
+)
+
+func TestMerger(t *testing.T) {
+	var m nbf.Merger
+	for i := 0; i < 2; i++ {
+		if err := m.AddArchive(openSample(t)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msgs := m.Messages()
+	if len(msgs) != 3 {
+		t.Fatalf("got %d messages, expected 3", len(msgs))
+	}
+
+	// Of several copies, the earliest is kept.
+	early := msgs[0]
+	early.When = early.When.Add(-time.Minute)
+	other := msgs[0]
+	other.Text = "New"
+	other.When = other.When.Add(time.Hour)
+	m.Add([]nbf.SMS{other, early})
+	msgs = m.Messages()
+	if len(msgs) != 4 {
+		t.Fatalf("got %d messages, expected 4", len(msgs))
+	}
+	if !msgs[0].When.Equal(early.When) || msgs[0].Text != early.Text {
+		t.Errorf("got first message %+v, expected %+v", msgs[0], early)
+	}
+}
+
+func TestMergerFolders(t *testing.T) {
+	a := nbftest.Archive{
+		Messages: []nbftest.Message{
+			{Peer: "+33612345678", Text: "inbox"},
+			{Sent: true, Peer: "+33612345678", Text: "sent"},
+			{Sent: true, Peer: "+33612345678", Text: "draft", Folder: nbf.FolderDrafts},
+			{Peer: "+33612345678", Text: "kept", Folder: 7},
+		},
+		Folders: []int{8},
+	}
+	var m nbf.Merger
+	for i := 0; i < 2; i++ {
+		r, err := a.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.AddArchive(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	folders := m.Folders()
+	want := []nbf.Folder{
+		{ID: nbf.FolderInbox, Name: "Inbox", Entries: 1},
+		{ID: nbf.FolderOutbox, Name: "Sent items", Entries: 1},
+		{ID: nbf.FolderDrafts, Name: "Drafts", Entries: 1},
+		{ID: 7, Name: "Folder 7", User: true, Entries: 1},
+		{ID: 8, Name: "Folder 8", User: true},
+	}
+	if len(folders) != len(want) {
+		t.Fatalf("got folders %+v", folders)
+	}
+	for i := range want {
+		if folders[i] != want[i] {
+			t.Errorf("folder %d: got %+v, expected %+v", i, folders[i], want[i])
+		}
+	}
+	for _, msg := range m.Messages() {
+		if msg.Text == "draft" && (msg.Folder != nbf.FolderDrafts || msg.Direction != nbf.Draft) {
+			t.Errorf("draft has folder %d, direction %s", msg.Folder, msg.Direction)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := m.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Folders []struct {
+			ID       int
+			Messages []struct{ Text string }
+		} `json:"folders"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Folders) != 5 || out.Folders[3].ID != 7 || len(out.Folders[3].Messages) != 1 ||
+		out.Folders[3].Messages[0].Text != "kept" || len(out.Folders[4].Messages) != 0 {
+		t.Errorf("got JSON %s", buf.Bytes())
+	}
+}
@@ -4,41 +4,125 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf/gsm7"
 )
 
 // predefmessages/1: inbox
 // predefmessages/3: outbox
 
-type msgInfo struct {
-	// Filename information
+// MessageInfo is the information encoded in the name
+// of message entries. The fields after ChecksumOK are
+// set by Decode from the entry body.
+type MessageInfo struct {
 	Seq          uint32
 	Timestamp    uint32
 	MultipartSeq uint16
 	Flags        uint16
+	Reserved     uint32 // unknown, usually 0x00500000
 	PartNo       uint8
 	PartTotal    uint8
+	Pad          string // 25 digits, zero in all known archives
 	Peer         string
+	Checksum     uint32
+	ChecksumOK   bool // whether Checksum matches the rest of the name
+
+	Text     string // decoded text
+	PeerName string // peer name stored by the phone
+	PDU      PDU
+}
+
+// Decode decodes the entry body and sets the content fields of m.
+func (m *MessageInfo) Decode(body []byte) error {
+	e, err := ParseEntry(body)
+	if err != nil {
+		return err
+	}
+	m.Text, m.PeerName, m.PDU = e.Msg.Text(), e.Peer, e.Msg
+	return nil
+}
+
+// VerifyName cross-checks the fields of the entry name against
+// the entry body: the peer of the name must be a suffix of the
+// PDU address, the timestamp must be within tolerance of the
+// service centre time stamp of received messages, and the padding
+// must be zero. Timestamps are decoded as local time, so tolerance
+// should cover the time zone difference between the phone and
+// the computer. The error wraps ErrNameMismatch.
+func (m MessageInfo) VerifyName(body []byte, tolerance time.Duration) error {
+	e, err := ParseEntry(body)
+	if err != nil {
+		return err
+	}
+	return m.verifyName(e, tolerance)
+}
+
+func (m MessageInfo) verifyName(e Entry, tolerance time.Duration) error {
+	var problems []string
+	if strings.Trim(m.Pad, "0") != "" {
+		problems = append(problems, fmt.Sprintf("non-zero padding %s", m.Pad))
+	}
+	var addr string
+	switch msg := e.Msg.(type) {
+	case Deliver:
+		addr = msg.FromAddr
+		d := DosTime(m.Timestamp).Sub(msg.SMSCStamp)
+		if d < -tolerance || d > tolerance {
+			problems = append(problems, fmt.Sprintf("timestamp %s is %s away from SCTS %s",
+				DosTime(m.Timestamp).Format(time.DateTime), d, msg.SMSCStamp.Format(time.DateTime)))
+		}
+	case Submit:
+		addr = msg.ToAddr
+	case Report:
+		addr = msg.RecipAddr
+	}
+	if !namePeerMatches(m.Peer, addr) {
+		problems = append(problems, fmt.Sprintf("peer %s does not match address %q", m.Peer, addr))
+	}
+	if problems != nil {
+		return fmt.Errorf("%w: %s", ErrNameMismatch, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// namePeerMatches reports whether the peer of an entry name,
+// the end of the number padded with zeros, matches addr.
+// An all-zero peer, used for alphanumeric addresses, matches
+// any address.
+func namePeerMatches(peer, addr string) bool {
+	p := strings.TrimLeft(peer, "0")
+	if p == "" {
+		return true
+	}
+	if len(addr) > len(peer) {
+		addr = addr[len(addr)-len(peer):]
+	}
+	return strings.TrimLeft(addr, "0") == p
 }
 
 // ParseFilename decomposes the filename of messages found in NBF archives.
 // 00001DFC: sequence number of message
-// 3CEAC364: Dos timestamp (seconds since 01 Jan 1980, 32-bit integer)
+// 3CEAC364: timestamp (MS-DOS date and time, see TimeFormat)
 // 00B7: 16-bit multipart sequence number (identical for parts of the same message)
 // 2010: 1st byte 0x20 for sms, 0x10 for mms
 // 00500000:
 // 00302000: for multipart: 2 out of 3.
 // 00000000: zero
 // 00000000: zero
-// 000000000: zero (9 digits)
+// 000000000: zero (9 digits, Pad holds these 25 digits)
 // 36300XXXXXXX : 12 digit number (7 digit in old format)
-// 0000007C : a checksum ?
-func parseNBFFilename(filename string) (inf msgInfo, err error) {
+// 0000009F : checksum of the previous characters (see nameChecksum)
+func ParseFilename(filename string) (inf MessageInfo, err error) {
 	s := filename
 	if len(s) < 80 {
-		return inf, fmt.Errorf("too short")
+		return inf, fmt.Errorf("%w: too short", ErrBadFilename)
 	}
 	s, inf.Seq, err = getUint32(s)
 	if err != nil {
@@ -54,24 +138,66 @@ func parseNBFFilename(filename string) (inf msgInfo, err error) {
 	}
 	inf.MultipartSeq = uint16(n >> 16)
 	inf.Flags = uint16(n)
-	s = s[8:] // skip
+	s, inf.Reserved, err = getUint32(s)
+	if err != nil {
+		return
+	}
 	s, n, err = getUint32(s)
 	if err != nil {
 		return
 	}
 	inf.PartNo = uint8(n >> 12)
 	inf.PartTotal = uint8(n >> 20)
-	s = s[25:] // skip
+	inf.Pad, s = s[:25], s[25:]
 	if len(s) == 12+8 {
-		inf.Peer = string(s[:12])
+		inf.Peer, s = s[:12], s[12:]
 	} else {
-		inf.Peer = string(s[:7])
+		inf.Peer, s = s[:7], s[7:]
+	}
+	if len(s) >= 8 {
+		_, inf.Checksum, err = getUint32(s)
+		inf.ChecksumOK = err == nil && inf.Checksum == nameChecksum(filename[:len(filename)-len(s)])
+	}
+	return inf, err
+}
+
+// nameChecksum computes the checksum ending entry names: the sum
+// of the character codes of the rest of the name, plus 0x80,
+// modulo 256.
+func nameChecksum(s string) uint32 {
+	sum := uint32(0x80)
+	for i := 0; i < len(s); i++ {
+		sum += uint32(s[i])
+	}
+	return sum & 0xff
+}
+
+// Filename returns the entry name describing inf, in the
+// format decoded by ParseFilename. The peer is padded
+// or truncated to 12 characters, the padding defaults to
+// zeros. The checksum is computed and inf.Checksum is ignored.
+func (inf MessageInfo) Filename() string {
+	peer := inf.Peer
+	if len(peer) > 12 {
+		peer = peer[len(peer)-12:]
+	}
+	peer = strings.Repeat("0", 12-len(peer)) + peer
+	pad := inf.Pad
+	if len(pad) != 25 {
+		pad = strings.Repeat("0", 25)
 	}
-	return inf, nil
+	parts := uint32(inf.PartTotal)<<20 | uint32(inf.PartNo)<<12
+	name := fmt.Sprintf("%08X%08X%04X%04X%08X%08X%s%s",
+		inf.Seq, inf.Timestamp, inf.MultipartSeq, inf.Flags,
+		inf.Reserved, parts, pad, peer)
+	return fmt.Sprintf("%s%08X", name, nameChecksum(name))
 }
 
 func getUint32(s string) (rest string, n uint32, err error) {
 	x, err := strconv.ParseUint(s[:8], 16, 32)
+	if err != nil {
+		err = fmt.Errorf("%w: %q is not hexadecimal", ErrBadFilename, s[:8])
+	}
 	return s[8:], uint32(x), err
 }
 
@@ -80,49 +206,224 @@ const (
 	FLAGS_MMS = 0x1000
 )
 
+// Flags are the decoded flags of an entry name. Only the bits
+// giving the kind of message are known: other bits, such as
+// 0x0010 which is set in all known archives, are only kept in
+// Raw. They can be collected using Stats or Reader.KeepRaw.
+type Flags struct {
+	SMS bool
+	MMS bool
+	Raw uint16 // all bits
+}
+
+// DecodeFlags decodes the flags field of an entry name.
+func DecodeFlags(raw uint16) Flags {
+	return Flags{SMS: raw&FLAGS_SMS != 0, MMS: raw&FLAGS_MMS != 0, Raw: raw}
+}
+
+// Unknown returns the bits of f whose meaning is unknown.
+func (f Flags) Unknown() uint16 { return f.Raw &^ (FLAGS_SMS | FLAGS_MMS) }
+
+// A TimeFormat selects the interpretation of entry name timestamps.
+type TimeFormat int
+
+const (
+	// DOSTime is the MS-DOS date and time format, in local time:
+	// the high 16 bits hold the date (7 bits of year since 1980,
+	// 4 bits of month, 5 bits of day), the low 16 bits the time
+	// (5 bits of hour, 6 bits of minute, 5 bits of seconds/2).
+	DOSTime TimeFormat = iota
+	// Seconds1980 counts seconds since 1980-01-01 UTC, which
+	// was the interpretation of earlier versions of this package.
+	Seconds1980
+)
+
+var epoch1980 = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Time decodes a timestamp in local time.
+func (f TimeFormat) Time(stamp uint32) time.Time {
+	return f.TimeIn(stamp, time.Local)
+}
+
+// TimeIn decodes a timestamp of a phone whose clock was set
+// to the time zone loc.
+func (f TimeFormat) TimeIn(stamp uint32, loc *time.Location) time.Time {
+	if f == Seconds1980 {
+		return epoch1980.Add(time.Duration(stamp) * time.Second).In(loc)
+	}
+	date, tod := stamp>>16, stamp&0xffff
+	return time.Date(1980+int(date>>9), time.Month(date>>5&0xf), int(date&0x1f),
+		int(tod>>11), int(tod>>5&0x3f), 2*int(tod&0x1f), 0, loc)
+}
+
+// Stamp encodes t as a timestamp, the inverse of Time.
+func (f TimeFormat) Stamp(t time.Time) uint32 {
+	if f == Seconds1980 {
+		return uint32(t.Sub(epoch1980) / time.Second)
+	}
+	return DosStamp(t)
+}
+
+// DosTime decodes a MS-DOS date and time as a local time.
 func DosTime(stamp uint32) time.Time {
-	t := time.Unix(int64(stamp), 0)
-	// Add 10 years
-	t = t.Add(3652 * 24 * time.Hour)
-	return t
+	return DOSTime.TimeIn(stamp, time.Local)
+}
+
+// DosStamp encodes the local time t as a MS-DOS date and time,
+// with 2-second resolution. It is the inverse of DosTime for
+// times between 1980 and 2107.
+func DosStamp(t time.Time) uint32 {
+	t = t.Local()
+	date := uint32(t.Year()-1980)<<9 | uint32(t.Month())<<5 | uint32(t.Day())
+	tod := uint32(t.Hour())<<11 | uint32(t.Minute())<<5 | uint32(t.Second()/2)
+	return date<<16 | tod
+}
+
+// An Entry is a decoded message entry: a SMS PDU and
+// the data stored along with it by the phone.
+type Entry struct {
+	Peer string // peer name or number
+	Text string // text, as stored by the phone
+	SMSC string // SMS center number
+
+	// TextOrder is the byte order of the stored text,
+	// normally big-endian without a byte order mark.
+	TextOrder TextOrder
+
+	Peers []string // recipients of sent messages, as "number <name>"
+	Msg   PDU      // Deliver, Submit or Report
+
+	Layout  *Layout
+	Unknown []Span // regions of unknown meaning
+}
+
+// Clone returns a copy of e not sharing memory with the body
+// it was parsed from.
+func (e Entry) Clone() Entry {
+	e.Peers = slices.Clone(e.Peers)
+	switch msg := e.Msg.(type) {
+	case Deliver:
+		msg.UserData = msg.UserData.Clone()
+		e.Msg = msg
+	case Submit:
+		msg.UserData = msg.UserData.Clone()
+		e.Msg = msg
+	}
+	if e.Unknown != nil {
+		spans := make([]Span, len(e.Unknown))
+		for i, sp := range e.Unknown {
+			spans[i] = Span{sp.Offset, bytes.Clone(sp.Data)}
+		}
+		e.Unknown = spans
+	}
+	return e
+}
+
+// A TextOrder is the byte order of UTF-16 text stored by
+// the phone. Some firmwares store little-endian text or
+// prepend a byte order mark.
+type TextOrder int
+
+const (
+	BigEndian       TextOrder = iota
+	BigEndianBOM              // with a byte order mark
+	LittleEndian              // detected by heuristic
+	LittleEndianBOM           // with a byte order mark
+)
+
+func (o TextOrder) String() string {
+	switch o {
+	case BigEndianBOM:
+		return "big-endian with BOM"
+	case LittleEndian:
+		return "little-endian"
+	case LittleEndianBOM:
+		return "little-endian with BOM"
+	}
+	return "big-endian"
 }
 
-// A big-endian interpretation of the binary format.
-type rawMessage struct {
-	Filename string // DEBUG
+// decodeStoredText decodes NUL-terminated UTF-16 text stored by the
+// phone. Byte order marks are stripped. Without a mark, the text is
+// assumed to be little-endian if more code units have a zero high
+// byte when read as little-endian, as is the case of Latin text.
+func decodeStoredText(b []byte) (string, TextOrder) {
+	b = b[:len(b)&^1]
+	order := BigEndian
+	switch {
+	case len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff:
+		order, b = BigEndianBOM, b[2:]
+	case len(b) >= 2 && b[0] == 0xff && b[1] == 0xfe:
+		order, b = LittleEndianBOM, b[2:]
+	default:
+		be, le := 0, 0
+		for i := 0; i < len(b); i += 2 {
+			switch {
+			case b[i] == 0 && b[i+1] != 0:
+				be++
+			case b[i] != 0 && b[i+1] == 0:
+				le++
+			}
+		}
+		if le > be {
+			order = LittleEndian
+		}
+	}
+	var bo binary.ByteOrder = binary.BigEndian
+	if order == LittleEndian || order == LittleEndianBOM {
+		bo = binary.LittleEndian
+	}
+	for i := 0; i < len(b); i += 2 {
+		if bo.Uint16(b[i:]) == 0 {
+			b = b[:i]
+			break
+		}
+	}
+	return decodeUTF16(b, bo), order
+}
 
-	Peer  string
-	Text  string
-	Peers []string
-	// From PDU
-	Msg message
+// A Span is a region of an entry body.
+type Span struct {
+	Offset int
+	Data   []byte
 }
 
-type message interface {
-	UserData() string
+// A PDU is a decoded SMS PDU, of type Deliver, Submit or Report.
+type PDU interface {
+	Text() string // text of the user data
 }
 
 // SMS encoding.
 // Inspired by libgammu's libgammu/phone/nokia/dct4s40/6510/6510file.c
 
-// Structure: all integers are big-endian
+// Structure (S40Layout): all integers are big-endian
 // u16 u16 u32 u32(size)
 // [82]byte (zero)
 // [41]uint16 (NUL-terminated peer name)
 // PDU (offset is 0xb0)
 // 65 unknown bytes
 // 0001 0003 size(uint16) [size/2]uint16 (NUL-terminated text)
-// 02 size(uint16) + NUL-terminated [size]byte (SMS center)
+// 02 size(uint16) + NUL-terminated [size]byte (SMS center number)
 // 04 0001 002b size(uint16) + [size]byte (NUL-terminated UTF16BE) (peer)
 // [23]byte unknown data
 
-func parseMessage(s []byte) (m rawMessage, err error) {
-	// peer (fixed offset 0x5e)
-	var runes []uint16
-	for off := 0x5e; s[off]|s[off+1] != 0; off += 2 {
-		runes = append(runes, binary.BigEndian.Uint16(s[off:off+2]))
+// ParseEntry decodes the body of a message entry.
+// Errors are of type *EntryError.
+//
+// The entry aliases s, which must not be modified while it is in
+// use; see Entry.Clone.
+func ParseEntry(s []byte) (m Entry, err error) {
+	l := layoutOf(s)
+	if len(s) <= l.PDUOffset {
+		return m, &EntryError{Offset: len(s), Err: fmt.Errorf("%w: message of %d bytes", ErrTruncated, len(s))}
+	}
+	// peer name
+	peer, end := l.peer(s)
+	unknown := make([]Span, 1, 4) // header, peer padding, trailer, peers
+	unknown[0] = Span{0, s[:l.PeerOffset]}
+	if end >= 0 && end < l.PDUOffset {
+		unknown = append(unknown, Span{end, s[end:l.PDUOffset]})
 	}
-	peer := string(utf16.Decode(runes))
 
 	// PDU frame starts at 0xb0
 	// incoming PDU frame:
@@ -132,77 +433,101 @@ func parseMessage(s []byte) (m rawMessage, err error) {
 	// * YY MM DD HH MM SS ZZ (BCD date time, little endian)
 	// * NN <NN septets> (NN : number of packed 7-bit data)
 	// received SMS: 04 0b 91
-	pdu := s[0xb0:]
+	pdu := s[l.PDUOffset:]
 	msgType := pdu[0]
 	if msgType == 0x8c {
-		err = fmt.Errorf("MMS is not supported")
+		err = &EntryError{Offset: l.PDUOffset, Err: fmt.Errorf("%w: MMS", ErrUnsupportedPDU)}
 		return
 	}
-	var msg message
+	var msg PDU
 	switch msgType & 3 {
 	case 0: // SMS-DELIVER
 		var n int
 		var err error
-		msg, n, err = parseDeliverMessage(pdu)
+		msg, n, err = parseDeliver(pdu)
 		if err != nil {
-			return rawMessage{}, err
+			return Entry{}, &EntryError{Offset: l.PDUOffset, Err: err}
 		}
 		pdu = pdu[n:]
 	case 1: // SMS-SUBMIT
 		var n int
 		var err error
-		msg, n, err = parseSubmitMessage(pdu)
+		msg, n, err = parseSubmit(pdu)
+		if err != nil {
+			return Entry{}, &EntryError{Offset: l.PDUOffset, Err: err}
+		}
+		pdu = pdu[n:]
+	case 2: // SMS-STATUS-REPORT (SMS-COMMAND, sent by phones, is not stored)
+		var n int
+		var err error
+		msg, n, err = parseReport(pdu)
 		if err != nil {
-			return rawMessage{}, err
+			return Entry{}, &EntryError{Offset: l.PDUOffset, Err: err}
 		}
 		pdu = pdu[n:]
-	case 2: // SMS-COMMAND
-		return rawMessage{}, fmt.Errorf("unsupported message type SMS-COMMAND")
 	case 3: // reserved
-		panic("invalid message type 3")
+		return Entry{}, &EntryError{Offset: l.PDUOffset, Err: fmt.Errorf("%w: invalid message type 3", ErrCorrupt)}
 	}
 	// END of PDU.
 	if len(pdu) == 0 {
-		return rawMessage{Peer: peer, Msg: msg}, nil
+		return Entry{Peer: peer, Msg: msg, Layout: l, Unknown: unknown}, nil
 	}
-	if len(pdu) < 72 {
-		return rawMessage{}, fmt.Errorf("truncated message")
+	off := len(s) - len(pdu)
+	unknown = append(unknown, Span{off, pdu[:min(65, len(pdu))]})
+	if len(pdu) < 65+6 {
+		return Entry{}, &EntryError{Offset: len(s), Err: fmt.Errorf("%w: message trailer", ErrTruncated)}
 	}
 	pdu = pdu[65:]
-	length := int(pdu[5])
+	length := int(binary.BigEndian.Uint16(pdu[4:6]))
 	pdu = pdu[6:]
-	text := make([]rune, length/2)
-	for i := range text {
-		text[i] = rune(binary.BigEndian.Uint16(pdu[2*i : 2*i+2]))
+	if length > len(pdu) {
+		return Entry{}, &EntryError{Offset: len(s) - len(pdu), Err: fmt.Errorf("%w: message text", ErrTruncated)}
+	}
+	text, order := decodeStoredText(pdu[:length])
+	m = Entry{
+		Peer:      peer,
+		Text:      text,
+		TextOrder: order,
+		Msg:       msg,
+	}
+	data := pdu[length:]
+
+	// SMS center: 02 size(uint16) [size]byte
+	if len(data) >= 3 && data[0] == 2 {
+		n := int(binary.BigEndian.Uint16(data[1:3]))
+		if 3+n > len(data) {
+			return Entry{}, &EntryError{Offset: len(s) - len(data), Err: fmt.Errorf("%w: SMS center", ErrTruncated)}
+		}
+		m.SMSC = string(bytes.TrimRight(data[3:3+n], "\x00"))
+		data = data[3+n:]
 	}
 
-	m = rawMessage{
-		Peer: peer,
-		Text: string(text),
-		Msg:  msg,
+	// Peers and unknown data.
+	if off := len(s) - len(data); off < len(s) {
+		unknown = append(unknown, Span{off, s[off:]})
 	}
+	m.Layout, m.Unknown = l, unknown
 
 	// peers at the end.
-	if msgType&3 == 0 {
+	if msgType&3 != 1 {
 		return m, nil
 	}
-	data := pdu[length:]
 	getStringAfter := func(pattern []byte) string {
 		idx := bytes.Index(data, pattern)
-		if idx < 0 {
+		if idx < 0 || idx+len(pattern)+2 > len(data) {
 			return ""
 		}
 		length := binary.BigEndian.Uint16(data[idx+len(pattern):]) / 2
 		s := data[idx+len(pattern)+2:]
-		text := make([]rune, length)
-		for i := 0; i < int(length); i++ {
-			text[i] = rune(binary.BigEndian.Uint16(s[2*i : 2*i+2]))
+		if 2*int(length) > len(s) {
+			return ""
 		}
+		text := s[:2*length]
 		data = s[2*length:]
-		if len(text) > 0 && text[len(text)-1] == 0 {
-			text = text[:len(text)-1]
+		if n := len(text); n >= 2 && text[n-2] == 0 && text[n-1] == 0 {
+			text = text[:n-2]
 		}
-		return string(text)
+		return decodeUCS2(text)
 	}
 	idx := 0
 	for len(data) > 0 {
@@ -211,7 +536,7 @@ func parseMessage(s []byte) (m rawMessage, err error) {
 			break
 		}
 		name := getStringAfter([]byte{0x2c})
-		m.Peers = append(m.Peers, fmt.Sprintf("%s <%s>", number, name))
+		m.Peers = append(m.Peers, number+" <"+name+">")
 		idx++
 	}
 
@@ -220,294 +545,541 @@ func parseMessage(s []byte) (m rawMessage, err error) {
 
 // Parsing of DELIVER-MESSAGE
 
-// A deliverMessage represents the contents of a SMS-DELIVER message
-// as per GSM 03.40 TPDU specification.
-type deliverMessage struct {
-	MsgType  byte
-	MoreMsg  bool // true encoded as zero
-	FromAddr string
-	Protocol byte
-	// Coding byte
-	Compressed bool
-	Unicode    bool
-	SMSCStamp  time.Time
+// A Deliver is a SMS-DELIVER PDU (GSM 03.40 section 9.2.2.1),
+// the format of received messages.
+type Deliver struct {
+	MsgType      byte      // TP-MTI, 0
+	MoreMsg      bool      // TP-MMS: more messages are waiting (true encoded as zero)
+	ReplyPath    bool      // TP-RP
+	StatusReport bool      // TP-SRI: a report is returned to the originator
+	FromAddr     string    // TP-OA
+	FromTOA      TOA       // type of FromAddr
+	Protocol     PID       // TP-PID
+	Coding       Coding    // TP-DCS
+	SMSCStamp    time.Time // TP-SCTS
 
-	userData
+	UserData
 }
 
-type userData struct {
-	RawData []byte // UCS-2 encoded text, unpacked 7-bit data.
+// UserData is the user data of a PDU, without its header.
+//
+// RawData does not copy the decoded entry: UCS-2 text, 8-bit and
+// compressed data alias the buffer passed to ParseEntry, and only
+// 7-bit data, which must be unpacked, is allocated. Callers reusing
+// or modifying that buffer must Clone the user data they keep.
+type UserData struct {
+	RawData    []byte // UCS-2 encoded text, unpacked 7-bit data or 8-bit data.
+	Binary     bool   // 8-bit data
+	Compressed bool   // RawData is compressed (GSM 03.42)
 
 	// Concatenated SMS
 	Concat            bool
 	Ref, Part, NParts int
 
 	SingleShift byte
+	Port        int        // destination port (application addressing)
+	Voicemail   *Voicemail // special message indication
+
+	raw        *RawEntry      // entry, if kept
+	charset    *gsm7.Encoding // see Reader.Charset, nil for the default
+	unknownIEs []byte         // identifiers of ignored information elements
+}
+
+// Clone returns a copy of msg not sharing memory with it.
+func (msg UserData) Clone() UserData {
+	msg.RawData = bytes.Clone(msg.RawData)
+	msg.unknownIEs = bytes.Clone(msg.unknownIEs)
+	if msg.Voicemail != nil {
+		v := *msg.Voicemail
+		msg.Voicemail = &v
+	}
+	return msg
 }
 
-func (msg userData) Text(uni bool) string {
+func (msg UserData) text(uni bool) string {
+	s, _ := msg.decodeText(uni)
+	return s
+}
+
+// decodeText decodes the text of msg, handling undefined
+// septets according to msg.charset.
+func (msg UserData) decodeText(uni bool) (string, error) {
+	if msg.Binary || msg.Compressed {
+		return "", nil
+	}
 	if uni {
-		runes := make([]uint16, len(msg.RawData)/2)
-		for i := range runes {
-			hi, lo := msg.RawData[2*i], msg.RawData[2*i+1]
-			runes[i] = uint16(hi)<<8 | uint16(lo)
-		}
-		return string(utf16.Decode(runes))
-	} else {
-		if msg.SingleShift > 0 && msg.RawData[0] == 0x1b {
-			// FIXME: actually implement single shift table.
-			return translateSMS(msg.RawData[1:], &basicSMSset)
-		}
-		return translateSMS(msg.RawData, &basicSMSset)
+		return decodeUCS2(msg.RawData), nil
 	}
+	if msg.SingleShift > 0 && len(msg.RawData) > 0 && msg.RawData[0] == 0x1b {
+		// FIXME: actually implement single shift table.
+		return decodeGSM(msg.RawData[1:], msg.charset)
+	}
+	return decodeGSM(msg.RawData, msg.charset)
+}
+
+// String returns a one-line summary of msg.
+func (msg Deliver) String() string {
+	return fmt.Sprintf("SMS-DELIVER from %s at %s %q", msg.FromAddr,
+		msg.SMSCStamp.Format(time.DateTime), abbrev(msg.Text(), 40))
 }
 
-func (msg deliverMessage) UserData() string {
-	return msg.userData.Text(msg.Unicode)
+// Text returns the text of the message, or the empty
+// string for 8-bit data.
+func (msg Deliver) Text() string {
+	return msg.UserData.text(msg.Coding.Alphabet == UCS2)
 }
 
-func parseDeliverMessage(s []byte) (msg deliverMessage, size int, err error) {
+func parseDeliver(s []byte) (msg Deliver, size int, err error) {
 	p := s
-	msg.MsgType = p[0] & 3    // TP-MTI
-	msg.MoreMsg = p[0]&4 == 0 // TP-MMS
-	hasUDH := p[0]&0x40 != 0  // TP-UDHI
+	if len(p) < 3 || len(p) < 3+(int(p[1])+1)/2 {
+		return msg, 0, fmt.Errorf("%w: SMS-DELIVER address", ErrTruncated)
+	}
+	msg.MsgType = p[0] & 3            // TP-MTI
+	msg.MoreMsg = p[0]&4 == 0         // TP-MMS
+	msg.StatusReport = p[0]&0x20 != 0 // TP-SRI
+	hasUDH := p[0]&0x40 != 0          // TP-UDHI
+	msg.ReplyPath = p[0]&0x80 != 0    // TP-RP
 	addrLen := int(p[1])
-	msg.FromAddr, err = parseAddress(p[1 : 3+(addrLen+1)/2])
+	msg.FromAddr, msg.FromTOA, err = parseAddress(p[1 : 3+(addrLen+1)/2])
 	if err != nil {
 		return
 	}
 	size += 3 + (addrLen+1)/2
 	p = s[size:]
+	if len(p) < 2+7 {
+		return msg, size, fmt.Errorf("%w: SMS-DELIVER header", ErrTruncated)
+	}
 
-	// Format
-	format := p[1]
-	msg.Compressed = format&0x20 != 0
-	msg.Unicode = format&8 != 0
+	msg.Protocol = PID(p[0])
+	msg.Coding = DecodeDCS(p[1])
 
 	// Date time
-	msg.SMSCStamp = parseDateTime(p[2:9])
+	msg.SMSCStamp, err = parseDateTime(p[2:9])
+	if err != nil {
+		return
+	}
 	size += 2 + 7
 	p = s[size:]
 
 	// Payload
 	var udsize int
-	msg.userData, udsize = parseUserData(p, msg.Unicode, hasUDH)
+	msg.UserData, udsize, err = parseUserData(p, msg.Coding, hasUDH)
 	size += udsize
 	return
 }
 
-// A submitMessage represents the contents of a SMS-DELIVER message
-// as per GSM 03.40 TPDU specification.
-type submitMessage struct {
-	MsgType  byte
-	RefID    byte
-	ToAddr   string
-	Protocol byte
-	// Coding byte
-	Compressed bool
-	Unicode    bool
+// A Submit is a SMS-SUBMIT PDU (GSM 03.40 section 9.2.2.2),
+// the format of sent messages.
+type Submit struct {
+	MsgType          byte   // TP-MTI, 1
+	RefID            byte   // TP-MR
+	ReplyPath        bool   // TP-RP
+	StatusReport     bool   // TP-SRR: a status report is requested
+	RejectDuplicates bool   // TP-RD
+	ToAddr           string // TP-DA
+	ToTOA            TOA    // type of ToAddr
+	Protocol         PID    // TP-PID
+	Coding           Coding // TP-DCS
+
+	// TP-VP: validity period, either relative to submission
+	// or absolute.
+	Validity   time.Duration
+	ValidUntil time.Time
+
+	UserData
+}
 
-	userData
+// String returns a one-line summary of msg.
+func (msg Submit) String() string {
+	return fmt.Sprintf("SMS-SUBMIT to %s %q", msg.ToAddr, abbrev(msg.Text(), 40))
 }
 
-func (msg submitMessage) UserData() string {
-	return msg.userData.Text(msg.Unicode)
+// Text returns the text of the message, or the empty
+// string for 8-bit data.
+func (msg Submit) Text() string {
+	return msg.UserData.text(msg.Coding.Alphabet == UCS2)
 }
 
-func parseSubmitMessage(s []byte) (msg submitMessage, size int, err error) {
+func parseSubmit(s []byte) (msg Submit, size int, err error) {
 	p := s
-	msg.MsgType = p[0] & 3 // TP-MTI
-	hasVP := p[0] >> 2 & 3
-	hasUDH := p[0]&0x40 != 0 // TP-UDHI
+	if len(p) < 4 || len(p) < 4+(int(p[2])+1)/2 {
+		return msg, 0, fmt.Errorf("%w: SMS-SUBMIT address", ErrTruncated)
+	}
+	msg.MsgType = p[0] & 3             // TP-MTI
+	msg.RejectDuplicates = p[0]&4 != 0 // TP-RD
+	hasVP := p[0] >> 3 & 3             // TP-VPF
+	msg.StatusReport = p[0]&0x20 != 0  // TP-SRR
+	hasUDH := p[0]&0x40 != 0           // TP-UDHI
+	msg.ReplyPath = p[0]&0x80 != 0     // TP-RP
 	msg.RefID = p[1]
 	addrLen := int(p[2])
-	msg.ToAddr, err = parseAddress(p[2 : 4+(addrLen+1)/2])
+	msg.ToAddr, msg.ToTOA, err = parseAddress(p[2 : 4+(addrLen+1)/2])
 	if err != nil {
 		return
 	}
 	size += 4 + (addrLen+1)/2
 	p = s[size:]
+	if len(p) < 3 {
+		return msg, size, fmt.Errorf("%w: SMS-SUBMIT header", ErrTruncated)
+	}
+
+	msg.Protocol = PID(p[0])
+	msg.Coding = DecodeDCS(p[1])
 
-	// Format
-	format := p[1]
-	msg.Compressed = format&0x20 != 0
-	msg.Unicode = format&8 != 0
+	size += 2
+	p = s[size:]
 
 	// Validity Period
-	if hasVP != 0 {
-		panic("validity period not implemented")
+	var vpsize int
+	msg.Validity, msg.ValidUntil, vpsize, err = parseValidity(p, hasVP)
+	if err != nil {
+		return
 	}
-	size += 2 + 1 // unknown 0xff byte
+	size += vpsize
 	p = s[size:]
 
 	// Payload
 	var udsize int
-	msg.userData, udsize = parseUserData(p, msg.Unicode, hasUDH)
+	msg.UserData, udsize, err = parseUserData(p, msg.Coding, hasUDH)
 	size += udsize
 	return
 }
 
-func parseUserData(p []byte, uni, udh bool) (msg userData, size int) {
-	if uni {
+// vpSize is the size of the validity period for each
+// value of TP-VPF.
+var vpSize = [4]int{0, 7, 1, 7}
+
+// parseValidity decodes a validity period of format vpf
+// (GSM 03.40 section 9.2.3.12).
+func parseValidity(p []byte, vpf byte) (rel time.Duration, abs time.Time, size int, err error) {
+	switch vpf {
+	case 0: // not present
+		return 0, abs, 0, nil
+	case 2: // relative
+		if len(p) < 1 {
+			return 0, abs, 0, fmt.Errorf("%w: validity period", ErrTruncated)
+		}
+		return relativeValidity(p[0]), abs, 1, nil
+	}
+	if len(p) < 7 {
+		return 0, abs, 0, fmt.Errorf("%w: validity period", ErrTruncated)
+	}
+	if vpf == 3 { // absolute
+		abs, err = parseDateTime(p[:7])
+		return 0, abs, 7, err
+	}
+	// Enhanced format: functionality indicator, then the period.
+	switch p[0] & 7 {
+	case 0: // no validity period
+	case 1:
+		rel = relativeValidity(p[1])
+	case 2: // seconds
+		rel = time.Duration(p[1]) * time.Second
+	case 3: // semi-octets HH MM SS
+		var hms [3]int
+		for i, c := range p[1:4] {
+			if c&0xf > 9 || c>>4 > 9 {
+				return 0, abs, 7, fmt.Errorf("%w: invalid validity period % x", ErrCorrupt, p[:7])
+			}
+			hms[i] = int(c&0xf)*10 + int(c>>4)
+		}
+		rel = time.Duration(hms[0])*time.Hour + time.Duration(hms[1])*time.Minute +
+			time.Duration(hms[2])*time.Second
+	default:
+		return 0, abs, 7, fmt.Errorf("%w: enhanced validity period format %d", ErrUnsupportedPDU, p[0]&7)
+	}
+	return rel, abs, 7, nil
+}
+
+// relativeValidity decodes a relative validity period octet.
+func relativeValidity(vp byte) time.Duration {
+	const day = 24 * time.Hour
+	switch v := time.Duration(vp); {
+	case vp <= 143:
+		return (v + 1) * 5 * time.Minute
+	case vp <= 167:
+		return 12*time.Hour + (v-143)*30*time.Minute
+	case vp <= 196:
+		return (v - 166) * day
+	default:
+		return (v - 192) * 7 * day
+	}
+}
+
+func parseUserData(p []byte, c Coding, udh bool) (msg UserData, size int, err error) {
+	uni, binary := c.Alphabet == UCS2, c.Alphabet == Data8
+	msg.Binary = binary
+	msg.Compressed = c.Compressed
+	if len(p) == 0 {
+		return msg, 0, fmt.Errorf("%w: missing user data", ErrTruncated)
+	}
+	if uni || binary || c.Compressed {
+		// The length of compressed data is counted in octets.
 		// Unicode (70 UCS-2 characters in 140 bytes)
 		length := int(p[0]) // length in bytes
+		if 1+length > len(p) {
+			return msg, 0, fmt.Errorf("%w: user data", ErrTruncated)
+		}
 		msg.RawData = p[1 : length+1]
 		size += length + 1
 	} else {
 		// 7-bit encoded format (160 septets in 140 bytes)
 		length := int(p[0]) // length in septets
 		packedLen := length - length/8
-		msg.RawData = unpack7bit(p[1 : 1+packedLen])
+		if 1+packedLen > len(p) {
+			return msg, 0, fmt.Errorf("%w: user data", ErrTruncated)
+		}
+		msg.RawData = gsm7.Unpack(p[1 : 1+packedLen])
 		msg.RawData = msg.RawData[:length]
 		size += packedLen + 1
 	}
-	ud := p[1:]
-	switch {
-	case len(ud) >= 6 && ud[0] == 5 && ud[1] == 0 && ud[2] == 3:
-		// Concatenated SMS data starts with 0x05 0x00 0x03 Ref NPart Part
-		msg.Concat = true
-		msg.Part = int(ud[5])
-		msg.NParts = int(ud[4])
-		msg.Ref = int(ud[3])
-	case len(ud) >= 7 && ud[0] == 6 && ud[1] == 8 && ud[2] == 4:
-		// Concatenated SMS data with 16-bit ref number.
-		msg.Concat = true
-		msg.Part = int(ud[6])
-		msg.NParts = int(ud[5])
-		msg.Ref = int(ud[3])<<8 | int(ud[4])
-	}
-	// TODO: parse other UDH fields
+	ud := p[1:size]
 	// http://en.wikipedia.org/wiki/User_Data_Header
 	if udh {
-		udhLength := ud[0] + 1
-		if ud[1] == 0x24 {
+		if len(ud) == 0 || int(ud[0])+1 > len(ud) {
+			return msg, size, fmt.Errorf("%w: user data header", ErrTruncated)
+		}
+		udhLength := int(ud[0]) + 1
+		if udhLength >= 4 && ud[1] == 0x24 {
 			// single shift table
 			msg.SingleShift = ud[3]
 		}
-		if uni {
-			msg.RawData = msg.RawData[udhLength:]
-		} else {
-			n := (8*udhLength + 6) / 7 // n such that 7*n >= udhLength*8
-			msg.RawData = msg.RawData[n:]
+		for ie := ud[1:udhLength]; len(ie) >= 2 && len(ie) >= 2+int(ie[1]); ie = ie[2+int(ie[1]):] {
+			switch id, data := ie[0], ie[2:2+int(ie[1])]; {
+			case id == 0 && len(data) == 3:
+				// Concatenated SMS: Ref NParts Part
+				msg.Concat = true
+				msg.Ref, msg.NParts, msg.Part = int(data[0]), int(data[1]), int(data[2])
+			case id == 8 && len(data) == 4:
+				// Concatenated SMS with 16-bit ref number.
+				msg.Concat = true
+				msg.Ref = int(data[0])<<8 | int(data[1])
+				msg.NParts, msg.Part = int(data[2]), int(data[3])
+			case id == 1 && len(data) == 2:
+				// Special SMS message indication: type, count.
+				// Bits 0-1 of type are the basic indication type.
+				if IndicationType(data[0]&3) == VoicemailWaiting {
+					msg.Voicemail = &Voicemail{Active: data[1] > 0, Count: int(data[1])}
+				}
+			case id == 4 && len(data) == 2:
+				// 8-bit application port addressing
+				msg.Port = int(data[0])
+			case id == 5 && len(data) == 4:
+				// 16-bit application port addressing
+				msg.Port = int(data[0])<<8 | int(data[1])
+			case id == 0x24 || id == 0x25:
+				// national language shift tables
+			default:
+				msg.unknownIEs = append(msg.unknownIEs, id)
+			}
+		}
+		n := udhLength
+		if !uni && !binary && !c.Compressed {
+			n = (8*udhLength + 6) / 7 // n such that 7*n >= udhLength*8
+		}
+		if n > len(msg.RawData) {
+			return msg, size, fmt.Errorf("%w: user data header longer than user data", ErrCorrupt)
 		}
+		msg.RawData = msg.RawData[n:]
 	}
 	return
 }
 
-func parseAddress(b []byte) (string, error) {
+// A TOA is the type of address octet of a phone number
+// (GSM 03.40 section 9.1.2.5).
+type TOA byte
+
+// Types of number.
+const (
+	TONUnknown       = 0
+	TONInternational = 1
+	TONNational      = 2
+	TONNetwork       = 3
+	TONSubscriber    = 4
+	TONAlphanumeric  = 5
+	TONAbbreviated   = 6
+)
+
+// TON returns the type of number.
+func (t TOA) TON() int { return int(t>>4) & 7 }
+
+// NPI returns the numbering plan identification.
+func (t TOA) NPI() int { return int(t) & 0xf }
+
+// parseAddress decodes an address field. International numbers
+// are prefixed with '+'.
+func parseAddress(b []byte) (addr string, toa TOA, err error) {
+	if len(b) < 2 {
+		return "", 0, fmt.Errorf("%w: address", ErrTruncated)
+	}
 	length := int(b[0])
-	typ := b[1]
-	switch (typ >> 4) & 7 {
-	case 1: // international
-		num := decodeBCD(b[2:])
-		if len(num) < length {
-			return "", fmt.Errorf("BUG: num=%q when parsing %x", num, b)
+	toa = TOA(b[1])
+	switch toa.TON() {
+	case TONAlphanumeric:
+		// The length counts semi-octets of packed septets.
+		n := length * 4 / 7
+		if len(b) < 2+(length+1)/2 {
+			return "", toa, fmt.Errorf("%w: address %x", ErrTruncated, b)
 		}
-		return "+" + num[:length], nil
-	case 0, 2: // unknown, national
-		num := decodeBCD(b[2:])
-		return num[:length], nil
-	case 5: // alphanumeric
-		addr7 := unpack7bit(b[2:])
-		return translateSMS(addr7, &basicSMSset), nil
-	default:
-		return "", fmt.Errorf("unsupported address format: 0x%02x", typ)
+		var buf [16]byte // 11 characters fit in 10 octets
+		addr7 := gsm7.AppendUnpack(buf[:0], b[2:2+(length+1)/2])
+		if len(addr7) > n {
+			addr7 = addr7[:n]
+		}
+		addr, _ := decodeGSM(addr7, nil)
+		return addr, toa, nil
+	case 7: // reserved
+		return "", toa, fmt.Errorf("%w: address format 0x%02x", ErrUnsupportedPDU, byte(toa))
 	}
+	var buf [24]byte // addresses have at most 20 digits
+	num := buf[:0]
+	if toa.TON() == TONInternational {
+		num = append(num, '+')
+	}
+	prefix := len(num)
+	num = appendBCD(num, b[2:])
+	if len(num)-prefix < length {
+		return "", toa, fmt.Errorf("%w: address %x", ErrTruncated, b)
+	}
+	return string(num[:prefix+length]), toa, nil
 }
 
 // Ref: GSM 03.40 section 9.2.3.11
-func parseDateTime(b []byte) time.Time {
+// parseDateTime decodes a service centre time stamp
+// (GSM 03.40 section 9.2.3.11). Octets hold swapped BCD digits,
+// and bit 3 of the time zone octet is the sign of the zone.
+func parseDateTime(b []byte) (time.Time, error) {
 	var dt [7]int
 	for i := range dt {
-		dt[i] = int(b[i]&0xf)*10 + int(b[i]>>4)
+		c := b[i]
+		if i == 6 {
+			c &^= 0x08 // sign bit
+		}
+		if c&0xf > 9 || c>>4 > 9 {
+			return time.Time{}, fmt.Errorf("%w: invalid digits in time stamp % x", ErrCorrupt, b[:7])
+		}
+		dt[i] = int(c&0xf)*10 + int(c>>4)
+	}
+	// Time zones range from UTC-12 to UTC+14.
+	quarters := dt[6]
+	if b[6]&0x08 != 0 {
+		quarters = -quarters
+	}
+	if quarters < -48 || quarters > 56 {
+		return time.Time{}, fmt.Errorf("%w: invalid time zone in time stamp % x", ErrCorrupt, b[:7])
 	}
 	return time.Date(
 		2000+dt[0],
 		time.Month(dt[1]),
 		dt[2],
-		dt[3], dt[4], dt[5], 0, time.FixedZone("", dt[6]*3600/4))
+		dt[3], dt[4], dt[5], 0, time.FixedZone("", quarters*900)), nil
+}
+
+// bcdDigits maps semi-octets of phone numbers to characters
+// (GSM 04.08 table 10.5.118).
+const bcdDigits = "0123456789*#abc"
+
+// encodeBCD encodes the semi-octets of s, padded with 0xf.
+// It reports false if s has characters other than bcdDigits.
+func encodeBCD(s string) ([]byte, bool) {
+	b := make([]byte, (len(s)+1)/2)
+	for i := range b {
+		b[i] = 0xf0
+	}
+	for i := 0; i < len(s); i++ {
+		d := strings.IndexByte(bcdDigits, s[i])
+		if d < 0 {
+			return nil, false
+		}
+		if i%2 == 0 {
+			b[i/2] = b[i/2]&0xf0 | byte(d)
+		} else {
+			b[i/2] = b[i/2]&0x0f | byte(d)<<4
+		}
+	}
+	return b, true
 }
 
 func decodeBCD(b []byte) string {
-	s := make([]byte, 0, len(b)*2)
+	return string(appendBCD(make([]byte, 0, len(b)*2), b))
+}
+
+func appendBCD(s, b []byte) []byte {
 	for _, c := range b {
-		s = append(s, '0'+(c&0xf))
+		if c&0xf == 0xf {
+			break
+		}
+		s = append(s, bcdDigits[c&0xf])
 		if c>>4 == 0xf {
 			break
 		} else {
-			s = append(s, '0'+(c>>4))
+			s = append(s, bcdDigits[c>>4])
 		}
 	}
-	return string(s)
-}
-
-func unpack7bit(s []byte) []byte {
-	// each byte may contain a part of septet i in lower bits
-	// and septet i+1 in higher bits.
-	buf := uint16(0)
-	buflen := uint(0)
-	out := make([]byte, 0, len(s)+len(s)/7+1)
-	for len(s) > 0 {
-		buf |= uint16(s[0]) << buflen
-		buflen += 8
-		s = s[1:]
-		for buflen >= 7 {
-			out = append(out, byte(buf&0x7f))
-			buflen -= 7
-			buf >>= 7
+	return s
+}
+
+// decodeUCS2 decodes UTF-16BE text, pairing surrogates.
+// Unpaired surrogates decode as U+FFFD.
+func decodeUCS2(b []byte) string {
+	return decodeUTF16(b, binary.BigEndian)
+}
+
+// decodeUTF16 decodes UTF-16 text in byte order bo, pairing
+// surrogates. A final odd byte is ignored.
+func decodeUTF16(b []byte, bo binary.ByteOrder) string {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	out := *buf
+	for i := 0; i+1 < len(b); i += 2 {
+		r := rune(bo.Uint16(b[i:]))
+		if utf16.IsSurrogate(r) {
+			r2 := utf8.RuneError
+			if i+3 < len(b) {
+				r2 = rune(bo.Uint16(b[i+2:]))
+			}
+			if dec := utf16.DecodeRune(r, r2); dec != utf8.RuneError {
+				r = dec
+				i += 2
+			} else {
+				r = utf8.RuneError
+			}
 		}
+		out = utf8.AppendRune(out, r)
 	}
-	return out
+	*buf = out
+	return string(out)
 }
 
-// translateSMS decodes a 7-bit encoded SMS text into a standard
-// UTF-8 encoded string.
-func translateSMS(s []byte, charset *[256]rune) string {
-	r := make([]rune, 0, len(s))
-	esc := byte(0)
-	for _, b := range s {
-		if charset[b] == -1 { // escape
-			esc = 128
-		} else {
-			r = append(r, charset[esc|b])
-			esc = 0
-		}
+// decodeGSM decodes unpacked septets using charset,
+// or the GSM default alphabet if charset is nil.
+func decodeGSM(septets []byte, charset *gsm7.Encoding) (string, error) {
+	var enc gsm7.Encoding
+	if charset != nil {
+		enc = *charset
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	out, err := enc.AppendDecode(*buf, septets)
+	*buf = out
+	return string(out), err
+}
+
+// Decoding buffers are reused across messages: archives hold
+// thousands of them and decoded text is copied to strings anyway.
+var bufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 512)
+		return &b
+	},
+}
+
+func getBuffer() *[]byte { return bufferPool.Get().(*[]byte) }
+
+func putBuffer(b *[]byte) {
+	if cap(*b) > 64<<10 {
+		return // do not keep large buffers alive
 	}
-	return string(r)
-}
-
-// See http://en.wikipedia.org/wiki/GSM_03.38
-
-var basicSMSset = [256]rune{
-	// 0x00
-	'@', '£', '$', '¥', 'è', 'é', 'ù', 'ì',
-	'ò', 'Ç', '\n', 'Ø', 'ø', '\r', 'Å', 'å',
-	// 0x10
-	'Δ', '_', 'Φ', 'Γ', 'Λ', 'Ω', 'Π', 'Ψ',
-	'Σ', 'Θ', 'Ξ', -1 /* ESC */, 'Æ', 'æ', 'ß', 'É',
-	// 0x20
-	' ', '!', '"', '#', '¤', '%', '&', '\'',
-	'(', ')', '*', '+', ',', '-', '.', '/',
-	// 0x30
-	'0', '1', '2', '3', '4', '5', '6', '7',
-	'8', '9', ':', ';', '<', '=', '>', '?',
-	// 0x40
-	'¡', 'A', 'B', 'C', 'D', 'E', 'F', 'G',
-	'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O',
-	// 0x50
-	'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W',
-	'X', 'Y', 'Z', 'Ä', 'Ö', 'Ñ', 'Ü', '§',
-	// 0x60
-	'¿', 'a', 'b', 'c', 'd', 'e', 'f', 'g',
-	'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o',
-	// 0x70
-	'p', 'q', 'r', 's', 't', 'u', 'v', 'w',
-	'x', 'y', 'z', 'ä', 'ö', 'ñ', 'ü', 'à',
-	// Extensions
-	0x8A: '\f',
-	0x94: '^',
-	0xA8: '{', 0xA9: '}', 0xAF: '\\',
-	0xBC: '[', 0xBD: '~', 0xBE: ']',
-	0xC0: '|',
-	0xE5: '€',
+	*b = (*b)[:0]
+	bufferPool.Put(b)
 }
@@ -1,12 +1,17 @@
 package nbf
 
 import (
+	"bytes"
+	"errors"
 	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf/gsm7"
 )
 
 func TestMessage_ParseFilename(t *testing.T) {
 	const name = "0000186F3C52A89B0042201000500000004030000000000000000000000000000+336345632330000009F"
-	msg, err := parseNBFFilename(name)
+	msg, err := ParseFilename(name)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -24,6 +29,9 @@ func TestMessage_ParseFilename(t *testing.T) {
 	if msg.Flags != 0x2010 {
 		t.Errorf("bad flags: 0x%x", msg.Flags)
 	}
+	if f := DecodeFlags(msg.Flags); !f.SMS || f.MMS || f.Unknown() != 0x10 {
+		t.Errorf("bad decoded flags: %+v", f)
+	}
 	if msg.PartNo != 3 || msg.PartTotal != 4 {
 		t.Errorf("got part %d/%d, expected 3/4",
 			msg.PartNo, msg.PartTotal)
@@ -31,14 +39,47 @@ func TestMessage_ParseFilename(t *testing.T) {
 	if msg.Peer != "+33634563233" {
 		t.Errorf("wrong peer %s, expected +33634563233", msg.Peer)
 	}
+	if !msg.ChecksumOK {
+		t.Errorf("bad checksum 0x%x", msg.Checksum)
+	}
+	if s := msg.Filename(); s != name {
+		t.Errorf("Filename() = %s, expected %s", s, name)
+	}
+}
+
+func TestDosTime(t *testing.T) {
+	for _, c := range []struct {
+		stamp uint32
+		date  string
+	}{
+		{0x3c52a89b, "2010-02-18 21:04:54"}, // from TestMessage_ParseFilename
+		{0x00210000, "1980-01-01 00:00:00"},
+		{0x3f9fbf7d, "2011-12-31 23:59:58"},
+	} {
+		tm := DosTime(c.stamp)
+		if s := tm.Format("2006-01-02 15:04:05"); s != c.date {
+			t.Errorf("DosTime(0x%08x) = %s, expected %s", c.stamp, s, c.date)
+		}
+		if s := DosStamp(tm); s != c.stamp {
+			t.Errorf("DosStamp(%s) = 0x%08x, expected 0x%08x", c.date, s, c.stamp)
+		}
+	}
+
+	tm := Seconds1980.Time(0x3c52a89b)
+	if s := tm.UTC().Format("2006-01-02 15:04:05"); s != "2012-01-26 13:01:15" {
+		t.Errorf("Seconds1980.Time(0x3c52a89b) = %s", s)
+	}
+	if s := Seconds1980.Stamp(tm); s != 0x3c52a89b {
+		t.Errorf("Seconds1980.Stamp(%s) = 0x%08x", tm, s)
+	}
 }
 
 func TestDecode7bit(t *testing.T) {
 	var data = []byte{0xd2, 0xf7, 0xfb, 0xfd, 0x7e, 0x83, 0xe8, 0x75, 0x90, 0xbd, 0x5c, 0xc7, 0x83,
 		0xe2, 0xf5, 0x32, 0x48, 0x7d, 0x0a, 0xc3, 0xe1, 0x65, 0x36, 0xbb, 0xfc, 0x3}
-	u := unpack7bit(data)
+	u := gsm7.Unpack(data)
 	t.Logf("in: %d bytes, out: %d septets", len(data), len(u))
-	s := translateSMS(unpack7bit(data), &basicSMSset)
+	s, _ := decodeGSM(gsm7.Unpack(data), nil)
 	const ref = "Rooooo tu veux que j'appelle?"
 	if s != ref {
 		t.Errorf("got %q, expected %q", s, ref)
@@ -46,7 +87,7 @@ func TestDecode7bit(t *testing.T) {
 	t.Logf("%s", s)
 
 	data = []byte{0x9b, 0xd7, 0xfb, 0x05} // 1b 2f 6f 2f
-	s = translateSMS(unpack7bit(data), &basicSMSset)
+	s, _ = decodeGSM(gsm7.Unpack(data), nil)
 	if s != `\o/` {
 		t.Errorf(`got %q, expected \o/`, s)
 	}
@@ -54,25 +95,247 @@ func TestDecode7bit(t *testing.T) {
 
 func TestParseAddr(t *testing.T) {
 	// Examples from Wikipedia: http://en.wikipedia.org/wiki/GSM_03.40#Addresses
-	a, err := parseAddress([]byte("\x0B\x91\x51\x55\x21\x43\x65\xF7"))
+	a, toa, err := parseAddress([]byte("\x0B\x91\x51\x55\x21\x43\x65\xF7"))
 	if err != nil {
 		t.Fatal(err)
 	}
 	if a != "+15551234567" {
 		t.Errorf("got %q, expected +15551234567", a)
 	}
-	a, err = parseAddress([]byte("\x14\xD0\xC4\xF2\x3C\x7D\x76\x03\x90\xEF\x76\x19"))
+	if toa.TON() != TONInternational || toa.NPI() != 1 {
+		t.Errorf("got TON %d, NPI %d, expected 1, 1", toa.TON(), toa.NPI())
+	}
+	a, _, err = parseAddress([]byte("\x14\xD0\xC4\xF2\x3C\x7D\x76\x03\x90\xEF\x76\x19"))
 	if err != nil {
 		t.Fatal(err)
 	}
 	if a != "Design@Home" {
 		t.Errorf("got %q, expected Design@home", a)
 	}
-	a, err = parseAddress([]byte("\x03\x85\x16\xf8"))
+	for _, name := range []string{"GOOGLE", "Verkkopankki", "Bank{1}", "SNCF", "Pankki1"} {
+		a, toa, err := parseAddress(encodeAddress(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a != name || toa.TON() != TONAlphanumeric {
+			t.Errorf("got %q (TON %d), expected %q", a, toa.TON(), name)
+		}
+	}
+	a, _, err = parseAddress([]byte("\x03\x85\x16\xf8"))
 	if err != nil {
 		t.Fatal(err)
 	}
 	if a != "618" {
 		t.Errorf("got %q, expected 618", a)
 	}
+	a, toa, err = parseAddress([]byte("\x04\xa1\x2a\x1b")) // national number
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != "*2#1" || toa.TON() != TONNational {
+		t.Errorf("got %q (TON %d), expected *2#1", a, toa.TON())
+	}
+	for _, s := range []string{"*2#1", "12345", "#31#a"} {
+		b, ok := encodeBCD(s)
+		if got := decodeBCD(b); !ok || got != s {
+			t.Errorf("BCD %q: got %q, %v", s, got, ok)
+		}
+	}
+	if _, ok := encodeBCD("+33"); ok {
+		t.Errorf("BCD: encoded '+'")
+	}
+}
+
+func TestParseDateTime(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{"\x11\x20\x31\x21\x43\x65\x40", "2011-02-13 12:34:56 +0100", false},
+		{"\x11\x20\x31\x21\x43\x65\x0a", "2011-02-13 12:34:56 -0500", false}, // 20 quarters, negative
+		{"\x11\x20\x31\x21\x43\x65\x49", "2011-02-13 12:34:56 -0330", false},
+		{"\x11\x20\x31\x21\x43\x65\x07", "", true}, // +17:30
+		{"\x11\x20\x31\x21\x4a\x65\x00", "", true},
+	} {
+		tm, err := parseDateTime([]byte(c.in))
+		if (err != nil) != c.err {
+			t.Errorf("% x: got error %v", c.in, err)
+			continue
+		}
+		if s := tm.Format("2006-01-02 15:04:05 -0700"); err == nil && s != c.want {
+			t.Errorf("% x: got %s, expected %s", c.in, s, c.want)
+		}
+	}
+}
+
+func TestCompressedUserData(t *testing.T) {
+	// 5 octets of compressed data, whatever the alphabet.
+	p := []byte{5, 0x12, 0x34, 0x56, 0x78, 0x9a}
+	ud, size, err := parseUserData(p, Coding{Compressed: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 6 || len(ud.RawData) != 5 || !ud.Compressed {
+		t.Errorf("got %d bytes of compressed data, size %d", len(ud.RawData), size)
+	}
+	if s := ud.text(false); s != "" {
+		t.Errorf("compressed data decoded as %q", s)
+	}
+}
+
+func TestParseValidity(t *testing.T) {
+	const day = 24 * time.Hour
+	for _, c := range []struct {
+		vpf  byte
+		p    string
+		rel  time.Duration
+		abs  string
+		size int
+	}{
+		{0, "", 0, "", 0},
+		{2, "\x00", 5 * time.Minute, "", 1},
+		{2, "\x8f", 12 * time.Hour, "", 1},
+		{2, "\xa7", day, "", 1},
+		{2, "\xa8", 2 * day, "", 1},
+		{2, "\xff", 63 * 7 * day, "", 1},
+		{3, "\x11\x20\x31\x21\x43\x65\x40", 0, "2011-02-13 12:34:56 +0100", 7},
+		{1, "\x02\x3c\x00\x00\x00\x00\x00", time.Minute, "", 7},
+		{1, "\x03\x10\x30\x00\x00\x00\x00", 1*time.Hour + 3*time.Minute, "", 7},
+	} {
+		rel, abs, size, err := parseValidity([]byte(c.p), c.vpf)
+		if err != nil {
+			t.Errorf("VPF %d % x: %s", c.vpf, c.p, err)
+			continue
+		}
+		var s string
+		if !abs.IsZero() {
+			s = abs.Format("2006-01-02 15:04:05 -0700")
+		}
+		if rel != c.rel || s != c.abs || size != c.size {
+			t.Errorf("VPF %d % x: got %s, %q, size %d", c.vpf, c.p, rel, s, size)
+		}
+		if c.vpf == 2 {
+			if vp := encodeValidity(rel); vp != c.p[0] {
+				t.Errorf("encodeValidity(%s) = 0x%02x, expected 0x%02x", rel, vp, c.p[0])
+			}
+		}
+	}
+}
+
+func TestMessageInfo_Decode(t *testing.T) {
+	body, err := EncodeSMS(SMS{Peer: "+33612345678", Text: "Hello", When: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := MessageInfo{Flags: FLAGS_SMS, Peer: "+33612345678"}
+	info, err = ParseFilename(info.Filename())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := info.Decode(body); err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := info.PDU.(Deliver); info.Text != "Hello" || info.PeerName != "+33612345678" || !ok || d.FromAddr != info.Peer {
+		t.Errorf("got %+v", info)
+	}
+	if err := info.Decode(body[:0x40]); err == nil {
+		t.Errorf("truncated body decoded without error")
+	}
+}
+
+func TestVerifyName(t *testing.T) {
+	when := time.Date(2012, 3, 4, 15, 16, 18, 0, time.Local)
+	body, err := EncodeSMS(SMS{Peer: "+33612345678", Text: "Hello", When: when})
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := MessageInfo{Timestamp: DosStamp(when), Flags: FLAGS_SMS, Peer: "+33612345678"}
+	if err := good.VerifyName(body, time.Minute); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	for _, c := range []func(m *MessageInfo){
+		func(m *MessageInfo) { m.Peer = "+33687654321" },
+		func(m *MessageInfo) { m.Timestamp = DosStamp(when.Add(time.Hour)) },
+		func(m *MessageInfo) { m.Pad = "0000000000000000000000001" },
+	} {
+		m := good
+		c(&m)
+		m, err = ParseFilename(m.Filename())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err := m.VerifyName(body, time.Minute)
+		if !errors.Is(err, ErrNameMismatch) {
+			t.Errorf("%+v: got error %v, expected ErrNameMismatch", m, err)
+		} else {
+			t.Log(err)
+		}
+	}
+}
+
+func TestMergeSurrogates(t *testing.T) {
+	// U+1F600 is D83D DE00 in UTF-16.
+	parts := []UserData{
+		{RawData: []byte{0, 'a', 0xd8, 0x3d}, Concat: true, Part: 1, NParts: 3},
+		{RawData: []byte{0xde, 0x00, 0, 'b'}, Concat: true, Part: 2, NParts: 3},
+		{RawData: []byte{0xd8, 0x3d}, Concat: true, Part: 3, NParts: 3},
+	}
+	if s := mergeConcatSMS(parts, true); s != "a\U0001F600b�" {
+		t.Errorf("got %q", s)
+	}
+	// A missing part leaves unpaired surrogates.
+	if s := mergeConcatSMS([]UserData{parts[0], parts[2]}, true); s != "a��" {
+		t.Errorf("got %q", s)
+	}
+}
+
+func TestDecodeStoredText(t *testing.T) {
+	for _, c := range []struct {
+		data  string
+		text  string
+		order TextOrder
+	}{
+		{"\x00H\x00i\x00\x00", "Hi", BigEndian},
+		{"\xfe\xff\x00H\x00i\x00\x00", "Hi", BigEndianBOM},
+		{"H\x00i\x00\x00\x00", "Hi", LittleEndian},
+		{"\xff\xfeH\x00i\x00\x00\x00", "Hi", LittleEndianBOM},
+		{"\x04\x1f\x04\x40\x00\x00", "Пр", BigEndian},
+		{"\xd8\x3d\xde\x00\x00!", "\U0001F600!", BigEndian},
+	} {
+		text, order := decodeStoredText([]byte(c.data))
+		if text != c.text || order != c.order {
+			t.Errorf("%x: got %q (%s), expected %q (%s)", c.data, text, order, c.text, c.order)
+		}
+	}
+}
+
+func TestInvalidSeptets(t *testing.T) {
+	for _, c := range []struct {
+		policy gsm7.Policy
+		text   string
+		fail   bool
+	}{
+		{gsm7.Replace, "Hi�", false},
+		{gsm7.Skip, "Hi", false},
+		{gsm7.Fail, "", true},
+	} {
+		ud := UserData{RawData: []byte{'H', 'i', 0x1b}, charset: &gsm7.Encoding{Invalid: c.policy}}
+		s, err := ud.decodeText(false)
+		if (err != nil) != c.fail || !c.fail && s != c.text {
+			t.Errorf("policy %d: got %q, %v", c.policy, s, err)
+		}
+	}
+}
+
+func TestUnknownIE(t *testing.T) {
+	// UCS-2 user data: header with IE 0x70, then "A".
+	p := []byte{6, 3, 0x70, 1, 0xaa, 0x00, 0x41}
+	ud, _, err := parseUserData(p, Coding{Alphabet: UCS2}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ud.unknownIEs, []byte{0x70}) || ud.text(true) != "A" {
+		t.Errorf("got unknown IEs %x, text %q", ud.unknownIEs, ud.text(true))
+	}
 }
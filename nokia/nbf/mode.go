@@ -0,0 +1,82 @@
+package nbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path"
+)
+
+// A ParseMode selects how a Reader handles malformed entries.
+type ParseMode int
+
+const (
+	// SkipErrors reports undecodable entries and skips them.
+	SkipErrors ParseMode = iota
+	// Strict treats any anomaly as an error: undecodable entries,
+	// filename checksum mismatches, incomplete concatenated
+	// messages. Message lists fail on the first error.
+	Strict
+	// Lenient salvages whatever can be decoded: the text block
+	// of entries with an undecodable PDU, and available parts
+	// of incomplete concatenated messages.
+	Lenient
+)
+
+// salvage extracts the peer name and text block of a message
+// entry whose PDU could not be decoded.
+func salvage(name string, blob []byte, opts decodeOptions) (sms SMS, ok bool) {
+	l := layoutOf(blob)
+	if len(blob) <= l.PDUOffset {
+		return sms, false
+	}
+	folder, _ := entryFolder(name)
+	sms.Direction = DirectionOf(folder, nil)
+	sms.Folder = folder
+	if sms.Direction == Sent {
+		sms.Type = 1
+	}
+	sms.Peer, _ = l.peer(blob)
+	if info, err := ParseFilename(path.Base(name)); err == nil {
+		sms.Seq = info.Seq
+		if sms.Peer == "" {
+			sms.Peer = info.Peer
+		}
+		sms.When = opts.stamp(info.Timestamp)
+		sms.Stamp = sms.When
+	}
+
+	// 0001 0003 size(uint16) [size/2]uint16
+	data := blob[l.PDUOffset:]
+	idx := bytes.Index(data, []byte{0, 1, 0, 3})
+	if idx < 0 || idx+6 > len(data) {
+		return sms, false
+	}
+	length := int(binary.BigEndian.Uint16(data[idx+4:]))
+	data = data[idx+6:]
+	if length > len(data) {
+		length = len(data) // truncated: keep what remains
+	}
+	sms.Text, sms.TextOrder = decodeStoredText(data[:length])
+	return sms, sms.Text != ""
+}
+
+// checkStrict reports anomalies of a decoded entry which
+// are not errors in other modes.
+func checkStrict(f string, sms SMS) error {
+	base := path.Base(f)
+	info, err := ParseFilename(base)
+	if err != nil {
+		return entryError(base, err)
+	}
+	if !info.ChecksumOK {
+		return entryError(base, fmt.Errorf("%w: filename checksum mismatch", ErrCorrupt))
+	}
+	if sms.Peer == "" && len(sms.Peers) == 0 {
+		return entryError(base, fmt.Errorf("%w: empty peer", ErrCorrupt))
+	}
+	if sms.Undecoded != "" {
+		return entryError(base, fmt.Errorf("%w: %s", ErrUnsupportedPDU, sms.Undecoded))
+	}
+	return nil
+}
@@ -4,190 +4,890 @@ package nbf
 import (
 	"archive/zip"
 	"bytes"
-	"io/ioutil"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
 	"log"
 	"path"
+	"reflect"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf/gsm7"
+	"golang.org/x/text/unicode/norm"
 )
 
-// OpenFile opens a NBF archive for reading.
+// OpenFile opens a NBF archive for reading. Zip64 archives,
+// larger than 4 GB or with more than 65535 entries, are supported.
 func OpenFile(filename string) (*Reader, error) {
 	z, err := zip.OpenReader(filename)
 	if err != nil {
 		return nil, err
 	}
+	return &Reader{z: &z.Reader, c: z}, nil
+}
+
+// NewReader returns a Reader reading a NBF archive from r,
+// which has the given size.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
 	return &Reader{z: z}, nil
 }
 
+// A Reader reads messages and files of an archive. It is safe
+// for concurrent use, provided its options are not modified
+// while it is in use.
 type Reader struct {
-	z *zip.ReadCloser
+	z *zip.Reader
+	c io.Closer
+
+	closeOnce sync.Once
+	closeErr  error
+	storeOnce sync.Once
+	store     Store
+	cache     entryCache
+
+	// Progress, if not nil, is called during archive scans
+	// after each entry is processed. It is called concurrently
+	// by concurrent scans.
+	Progress func(done, total int)
+
+	// Workers is the number of goroutines decoding messages
+	// concurrently. If zero, runtime.GOMAXPROCS(0) is used.
+	// Messages are always returned in archive order.
+	Workers int
+
+	// Mode selects the handling of malformed entries.
+	Mode ParseMode
+
+	// KeepRaw, if set, retains the raw bodies of message
+	// entries in SMS.Raw.
+	KeepRaw bool
+
+	// Cache, if set, keeps decoded messages in memory, so that
+	// repeated scans, for example by servers, do not decode the
+	// archive again. Messages returned by different scans then
+	// share memory: they must not be modified. Entries are not
+	// cached if KeepRaw is set.
+	Cache bool
+
+	// TimeFormat selects the interpretation of timestamps
+	// of entry names.
+	TimeFormat TimeFormat
+
+	// Location is the time zone of the phone clock, used for
+	// timestamps of entry names. If nil, time.Local is used.
+	Location *time.Location
+
+	// TimeSource selects the timestamp used for SMS.When.
+	TimeSource TimeSource
+
+	// TimeOffset is added to timestamps of entry names, to
+	// correct a wrong phone clock. Service centre time stamps
+	// are not modified.
+	TimeOffset time.Duration
+
+	// InvalidSeptets selects the handling of undefined characters
+	// in 7-bit texts. With gsm7.Fail, they are decoding errors
+	// wrapping ErrCorrupt.
+	InvalidSeptets gsm7.Policy
+
+	// Charset, if not nil, replaces the GSM default alphabet
+	// for 7-bit texts, for example an encoding of gsm7.Charsets.
+	// Its Invalid policy is ignored.
+	Charset *gsm7.Encoding
+
+	// Password decrypts encrypted entries, see Encrypted.
+	Password string
+
+	// Diagnostics, if not nil, receives events of message
+	// and MMS scans.
+	Diagnostics *Diagnostics
+
+	// Logger, if not nil, receives traces of entry decoding.
+	// Entries are then decoded again rather than read from
+	// the cache of the Reader.
+	Logger Logger
+}
+
+// A Logger receives debugging traces, as key-value pairs
+// following msg. A *slog.Logger is a Logger.
+type Logger interface {
+	Debug(msg string, args ...any)
+}
+
+// A TimeSource selects the timestamp of messages.
+type TimeSource int
+
+const (
+	// PreferSCTS uses the service centre time stamp of received
+	// messages, and the time of the entry name otherwise.
+	PreferSCTS TimeSource = iota
+	// PreferStamp uses the time of the entry name, which is
+	// the time the message was stored by the phone.
+	PreferStamp
+)
+
+// decodeOptions are the Reader options used by decodeEntry.
+type decodeOptions struct {
+	mode       ParseMode
+	keepRaw    bool
+	cache      bool
+	timeFormat TimeFormat
+	loc        *time.Location
+	timeSource TimeSource
+	timeOffset time.Duration
+	charset    *gsm7.Encoding // nil for the default alphabet
+	password   string
+	logger     Logger // not part of cache keys
+
+	// Reader.Charset and Reader.InvalidSeptets, which identify
+	// charset in cache keys.
+	readerCharset *gsm7.Encoding
+	invalid       gsm7.Policy
 }
 
+func (r *Reader) decodeOptions() decodeOptions {
+	loc := r.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	var charset *gsm7.Encoding
+	if r.Charset != nil || r.InvalidSeptets != gsm7.Replace {
+		c := gsm7.Encoding{}
+		if r.Charset != nil {
+			c = *r.Charset
+		}
+		c.Invalid = r.InvalidSeptets
+		charset = &c
+	}
+	return decodeOptions{mode: r.Mode, keepRaw: r.KeepRaw, cache: r.Cache,
+		timeFormat: r.TimeFormat, loc: loc, timeSource: r.TimeSource,
+		timeOffset: r.TimeOffset, charset: charset, password: r.Password,
+		logger: r.Logger, readerCharset: r.Charset, invalid: r.InvalidSeptets}
+}
+
+// cacheKey returns the options identifying cached entries.
+// The charset is allocated by each call of decodeOptions, and
+// loggers may not be comparable.
+func (o decodeOptions) cacheKey() decodeOptions {
+	o.charset, o.logger = nil, nil
+	return o
+}
+
+func (o decodeOptions) debug(msg string, args ...any) {
+	if o.logger != nil {
+		o.logger.Debug(msg, args...)
+	}
+}
+
+// stamp decodes the timestamp of an entry name.
+func (o decodeOptions) stamp(ts uint32) time.Time {
+	return o.timeFormat.TimeIn(ts, o.loc).Add(o.timeOffset)
+}
+
+// Close closes the archive file. Scans in progress fail.
 func (r *Reader) Close() error {
-	return r.z.Close()
+	r.closeOnce.Do(func() {
+		if r.c != nil {
+			r.closeErr = r.c.Close()
+		}
+	})
+	return r.closeErr
+}
+
+// files returns an iterator over archive entries, reporting
+// progress to r.Progress.
+func (r *Reader) files() iter.Seq[*zip.File] {
+	return func(yield func(*zip.File) bool) {
+		total := len(r.z.File)
+		for i, f := range r.z.File {
+			if !yield(f) {
+				return
+			}
+			if r.Progress != nil {
+				r.Progress(i+1, total)
+			}
+		}
+	}
 }
 
 type SMS struct {
-	Type  int // 0: incoming, 1: outgoing
-	Peer  string
-	Peers []string
-	When  time.Time
-	Text  string
+	Type int // 0: incoming, 1: outgoing
+	// Direction refines Type using the folder of the entry.
+	Direction Direction
+	Folder    int    // of the entry, predefmessages/N
+	Seq       uint32 // sequence number of the entry (of a part of concatenated messages)
+	Peer      string
+	Peers     []string
+	When      time.Time
+	Text      string
+
+	// Stamp is the time of the entry name, when the message was
+	// stored by the phone. SCTS is the service centre time stamp
+	// of received messages. When is one of them, according
+	// to Reader.TimeSource.
+	Stamp time.Time
+	SCTS  time.Time
+
+	// TOA is the type of address of the sender of received
+	// messages, or of the recipient of sent messages.
+	TOA TOA `json:",omitempty"`
+	PID PID `json:",omitempty"` // protocol identifier
+
+	Coding    Coding     // data coding scheme
+	Voicemail *Voicemail `json:",omitempty"` // voicemail waiting indication
+
+	// RawStamp is the timestamp of the entry name of sent
+	// messages, as stored by the phone (see DosTime).
+	RawStamp uint32
+
+	Port   int    // destination port for application messages
+	Binary bool   `json:",omitempty"` // 8-bit data message
+	Data   []byte // payload of 8-bit messages
+
+	// Flags of the first octet of the PDU: reply path, status report
+	// indication (received messages) or request (sent messages),
+	// and rejection of duplicates by the SMSC (sent messages).
+	ReplyPath        bool `json:",omitempty"`
+	StatusReport     bool `json:",omitempty"`
+	RejectDuplicates bool `json:",omitempty"`
+
+	// SMSC is the number of the SMS center which handled
+	// the message, if known.
+	SMSC string `json:",omitempty"`
+
+	// TextOrder is the byte order of the text stored by the phone
+	// along with the PDU, which is used as the text of messages
+	// salvaged in Lenient mode.
+	TextOrder TextOrder
+
+	// Expires is the end of the validity period of sent messages
+	// at the SMSC, if any.
+	Expires time.Time
+
+	// MR holds the message reference (TP-MR) of sent messages,
+	// one per part. DeliveryStatus and DeliveredAt give their
+	// outcome according to status reports of the inbox, as set
+	// by Outbox or CorrelateReports.
+	MR             []int          `json:",omitempty"`
+	DeliveryStatus DeliveryStatus `json:",omitempty"`
+	DeliveredAt    time.Time
+
+	// Undecoded, if not empty, is the reason why the text could not
+	// be decoded. Data then holds the user data.
+	Undecoded string `json:",omitempty"`
+
+	Raw []RawEntry `json:",omitempty"` // entries, if Reader.KeepRaw is set
 }
 
-func (r *Reader) Inbox() ([]SMS, error) {
-	msgs := make([]SMS, 0, len(r.z.File)/4)
+// Flash reports whether m is a flash message, meant to be displayed
+// and not stored by the phone. Such messages are often network
+// notices or one-time codes.
+func (m SMS) Flash() bool { return m.Coding.Flash() }
+
+// NFC returns a copy of m whose text, peer names and SMS center
+// are in Unicode normalization form C. UCS-2 texts may hold
+// decomposed characters, which compare unequal to their
+// precomposed forms.
+func (m SMS) NFC() SMS {
+	m.Text = norm.NFC.String(m.Text)
+	m.Peer = norm.NFC.String(m.Peer)
+	m.SMSC = norm.NFC.String(m.SMSC)
+	if m.Peers != nil {
+		peers := make([]string, len(m.Peers))
+		for i, p := range m.Peers {
+			peers[i] = norm.NFC.String(p)
+		}
+		m.Peers = peers
+	}
+	return m
+}
 
-	type multiKey struct {
-		Peer string
-		Ref  int
+// String returns a one-line summary of m: date, direction,
+// peer and the first 40 characters of the text.
+func (m SMS) String() string {
+	text := strconv.Quote(abbrev(m.Text, 40))
+	if m.Binary {
+		text = fmt.Sprintf("[%d bytes for port %d]", len(m.Data), m.Port)
 	}
-	multiparts := make(map[multiKey][]userData)
-	baseMsg := make(map[multiKey]SMS)
-	for _, f := range r.z.File {
-		if !strings.HasPrefix(f.Name, "predefmessages/1/") {
+	return fmt.Sprintf("%s %s %s %s", m.When.Format(time.DateTime), m.Direction, m.Peer, text)
+}
+
+// GoString returns a Go expression for the non-zero fields of m.
+func (m SMS) GoString() string {
+	var b strings.Builder
+	b.WriteString("nbf.SMS{")
+	v := reflect.ValueOf(m)
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).IsZero() {
 			continue
 		}
-		base := path.Base(f.Name)
-		fr, err := f.Open()
-		if err != nil {
-			log.Printf("cannot read %s: %s", base, err)
-			continue
+		if b.Len() > len("nbf.SMS{") {
+			b.WriteString(", ")
 		}
-		blob, err := ioutil.ReadAll(fr)
+		fmt.Fprintf(&b, "%s: %#v", v.Type().Field(i).Name, v.Field(i).Interface())
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// abbrev truncates s to n characters.
+func abbrev(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
+
+// A RawEntry is the undecoded body of a message entry.
+type RawEntry struct {
+	Name    string // entry name
+	Body    []byte
+	Layout  string // name of the Layout of Body
+	Flags   Flags  // flags of the entry name
+	Unknown []Span // regions of the body of unknown meaning
+}
+
+// Inbox returns received messages, sorted by date (see ByDate).
+func (r *Reader) Inbox() ([]SMS, error) {
+	return r.InboxContext(context.Background())
+}
+
+// InboxContext is like Inbox, but stops when ctx is done.
+func (r *Reader) InboxContext(ctx context.Context) ([]SMS, error) {
+	if err := r.checkStore(); err != nil {
+		return nil, err
+	}
+	return r.collectSMS(r.messages(ctx, "predefmessages/1/"), len(r.z.File)/4)
+}
+
+// Outbox returns sent messages, sorted by date (see ByDate).
+func (r *Reader) Outbox() ([]SMS, error) {
+	return r.OutboxContext(context.Background())
+}
+
+// OutboxContext is like Outbox, but stops when ctx is done.
+func (r *Reader) OutboxContext(ctx context.Context) ([]SMS, error) {
+	if err := r.checkStore(); err != nil {
+		return nil, err
+	}
+	msgs, err := r.collectSMS(r.messages(ctx, "predefmessages/3/"), len(r.z.File)/4)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := r.ReportsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	CorrelateReports(msgs, reports)
+	return msgs, nil
+}
+
+// Messages returns an iterator over messages of the inbox and outbox,
+// in archive order. Concatenated messages are yielded after their
+// last part is read. Errors concern individual entries and do not
+// stop the iteration, except in Strict mode or if the archive
+// uses an unsupported Store.
+func (r *Reader) Messages() iter.Seq2[SMS, error] {
+	return r.MessagesContext(context.Background())
+}
+
+// MessagesContext is like Messages, but stops decoding when ctx
+// is done, yielding the error of ctx.
+func (r *Reader) MessagesContext(ctx context.Context) iter.Seq2[SMS, error] {
+	return r.messages(ctx, "predefmessages/1/", "predefmessages/3/")
+}
+
+// fatal reports whether err stops scans of r, rather than
+// concerning a single entry.
+func (r *Reader) fatal(err error) bool {
+	return r.Mode == Strict || errors.Is(err, ErrUnsupportedStore) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Walk calls fn for each message returned by Messages.
+// It stops when fn returns an error or when ctx is done,
+// and returns that error. Undecodable entries are logged and skipped,
+// unless in Strict mode where Walk returns the error.
+// Walk fails on archives using an unsupported Store.
+func (r *Reader) Walk(ctx context.Context, fn func(SMS) error) error {
+	for m, err := range r.MessagesContext(ctx) {
 		if err != nil {
-			log.Printf("cannot read %s: %s", base, err)
+			if r.fatal(err) {
+				return err
+			}
+			log.Print(err)
 			continue
 		}
-		m, err := parseMessage(blob)
-		if err != nil {
-			log.Printf("cannot parse %s: %s", base, err)
-			continue
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Reader) messages(ctx context.Context, prefixes ...string) iter.Seq2[SMS, error] {
+	return func(yield func(SMS, error) bool) {
+		if err := r.checkStore(); err != nil {
+			yield(SMS{}, err)
+			return
 		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		results := r.decodeAll(ctx, func(f *zip.File) bool {
+			if f.Mode().IsDir() {
+				return false
+			}
+			for _, p := range prefixes {
+				if strings.HasPrefix(f.Name, p) {
+					return true
+				}
+			}
+			return false
+		})
 
-		msg := m.Msg.(deliverMessage)
-		sms := SMS{
-			Type:  int(msg.MsgType),
-			Peer:  msg.FromAddr,
-			Peers: m.Peers,
-			When:  msg.SMSCStamp,
-			Text:  msg.UserData(),
+		a := newAssembler()
+		total := len(r.z.File)
+		i := 0
+		for c := range results {
+			var d decoded
+			select {
+			case d = <-c:
+			case <-ctx.Done():
+			}
+			if err := ctx.Err(); err != nil {
+				yield(SMS{}, err)
+				return
+			}
+			i++
+			if r.Progress != nil {
+				r.Progress(i, total)
+			}
+			if d.skip {
+				continue
+			}
+			for _, e := range d.events {
+				r.Diagnostics.report(e)
+			}
+			if d.err != nil {
+				var e *EntryError
+				if errors.As(d.err, &e) {
+					r.Diagnostics.report(Event{Kind: EntrySkipped, Entry: e.Entry, Detail: d.err.Error()})
+				}
+				if !yield(SMS{}, d.err) || r.Mode == Strict {
+					return
+				}
+				continue
+			}
+			if sms, ok := a.add(d); ok && !yield(sms, nil) {
+				return
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			yield(SMS{}, err)
+			return
 		}
+		for _, sms := range a.incomplete() {
+			switch r.Mode {
+			case Strict:
+				yield(SMS{}, fmt.Errorf("%w: incomplete concatenated message from %s at %s",
+					ErrCorrupt, sms.Peer, sms.When.Format("2006-01-02 15:04")))
+				return
+			case Lenient:
+				if !yield(sms, nil) {
+					return
+				}
+			}
+		}
+	}
+}
 
-		if msg.Concat {
-			key := multiKey{Peer: sms.Peer, Ref: msg.Ref}
-			parts := append(multiparts[key], msg.userData)
-			if msg.Part == 1 {
-				baseMsg[key] = sms
+// decodeAll decodes archive entries selected by match using
+// a pool of r.Workers goroutines. It returns a channel delivering,
+// in archive order, one channel per entry holding its result.
+// Decoding stops early when ctx is done.
+func (r *Reader) decodeAll(ctx context.Context, match func(*zip.File) bool) <-chan chan decoded {
+	done := ctx.Done()
+	opts := r.decodeOptions()
+	workers := r.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	type job struct {
+		f   *zip.File
+		out chan decoded
+	}
+	jobs := make(chan job)
+	results := make(chan chan decoded, 2*workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range jobs {
+				d := decodeEntry(j.f, opts)
+				r.cache.put(j.f, opts, d)
+				j.out <- d
 			}
-			if len(parts) == msg.NParts {
-				delete(multiparts, key)
-				sms := baseMsg[key]
-				delete(baseMsg, key)
-				sms.Text = mergeConcatSMS(parts, msg.Unicode)
-				msgs = append(msgs, sms)
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		defer close(results)
+		for _, f := range r.z.File {
+			c := make(chan decoded, 1)
+			if !match(f) {
+				c <- decoded{skip: true}
+			} else if d, ok := r.cache.get(f, opts); ok {
+				c <- d
 			} else {
-				multiparts[key] = parts
+				select {
+				case jobs <- job{f, c}:
+				case <-done:
+					return
+				}
+			}
+			select {
+			case results <- c:
+			case <-done:
+				return
 			}
-		} else {
-			msgs = append(msgs, sms)
 		}
+	}()
+	return results
+}
+
+func (r *Reader) collectSMS(seq iter.Seq2[SMS, error], n int) ([]SMS, error) {
+	msgs := make([]SMS, 0, n)
+	for m, err := range seq {
+		if err != nil {
+			if r.fatal(err) {
+				return nil, err
+			}
+			log.Print(err)
+			continue
+		}
+		msgs = append(msgs, m)
 	}
-	sort.Sort(smsByDate(msgs))
+	sort.Stable(smsByDate(msgs))
 	return msgs, nil
 }
 
-func (r *Reader) Outbox() ([]SMS, error) {
-	msgs := make([]SMS, 0, len(r.z.File)/4)
+// An assembler reassembles concatenated messages from
+// decoded entries, in archive order.
+type assembler struct {
+	multiparts map[multiKey][]UserData
+	baseMsg    map[multiKey]SMS // first part
+	unicode    map[multiKey]bool
+	refs       map[multiKey][]int // TP-MR of parts
+}
+
+type multiKey struct {
+	Type int
+	Peer string
+	Ref  int
+}
 
-	type multiKey struct {
-		Peer string
-		Ref  int
+func newAssembler() *assembler {
+	return &assembler{
+		multiparts: make(map[multiKey][]UserData),
+		baseMsg:    make(map[multiKey]SMS),
+		unicode:    make(map[multiKey]bool),
+		refs:       make(map[multiKey][]int),
 	}
-	multiparts := make(map[multiKey][]userData)
-	baseMsg := make(map[multiKey]SMS)
+}
 
-	for _, f := range r.z.File {
-		if !strings.HasPrefix(f.Name, "predefmessages/3/") {
-			continue
+// A decoded is a single decoded message entry.
+type decoded struct {
+	sms    SMS
+	ud     UserData
+	uni    bool
+	key    multiKey
+	err    error
+	skip   bool    // entry is not a message
+	report *Report // status report, with skip set
+	events []Event // see Diagnostics
+}
+
+func (d *decoded) event(kind EventKind, entry, format string, args ...any) {
+	d.events = append(d.events, Event{Kind: kind, Entry: entry, Detail: fmt.Sprintf(format, args...)})
+}
+
+// decodeEntry reads and decodes entry f. It does not depend on
+// other entries and can be called concurrently.
+func decodeEntry(f *zip.File, opts decodeOptions) (d decoded) {
+	base := path.Base(f.Name)
+	if f.UncompressedSize64 > maxMessageEntry {
+		d.err = entryError(base, largeEntryError(f, opts.password))
+		return
+	}
+	blob, err := readEntry(f, opts.password)
+	if err != nil {
+		if errors.Is(err, zip.ErrChecksum) {
+			d.event(ChecksumMismatch, base, "zip CRC mismatch")
 		}
-		base := path.Base(f.Name)
-		info, err := parseNBFFilename(base)
-		if err != nil {
-			log.Printf("invalid entry name %q: %s", base, err)
-			continue
+		d.err = entryError(base, err)
+		return
+	}
+	m, err := ParseEntry(blob)
+	if err != nil {
+		opts.debug("cannot parse entry", "entry", base, "size", len(blob), "err", err)
+		if opts.mode == Lenient {
+			if sms, ok := salvage(f.Name, blob, opts); ok {
+				d.sms = sms
+				if opts.keepRaw {
+					d.sms.Raw = []RawEntry{{Name: f.Name, Body: blob}}
+					if info, err := ParseFilename(base); err == nil {
+						d.sms.Raw[0].Flags = DecodeFlags(info.Flags)
+					}
+				}
+				return d
+			}
 		}
-		fr, err := f.Open()
-		if err != nil {
-			log.Printf("cannot read %s: %s", base, err)
-			continue
+		d.err = entryError(base, err)
+		return
+	}
+
+	opts.debug("decoding entry", "entry", base, "size", len(blob),
+		"layout", m.Layout.Name, "pdu", fmt.Sprintf("%T", m.Msg))
+	info, infoErr := ParseFilename(base)
+	if infoErr == nil && !info.ChecksumOK {
+		d.event(ChecksumMismatch, base, "filename checksum mismatch")
+	}
+	switch msg := m.Msg.(type) {
+	case Report:
+		d.skip, d.report = true, &msg
+		return
+	case Deliver:
+		d.ud, d.uni = msg.UserData, msg.Coding.Alphabet == UCS2
+		d.sms = SMS{
+			Type:         int(msg.MsgType),
+			Peer:         msg.FromAddr,
+			Peers:        m.Peers,
+			When:         msg.SMSCStamp,
+			SCTS:         msg.SMSCStamp,
+			TOA:          msg.FromTOA,
+			ReplyPath:    msg.ReplyPath,
+			StatusReport: msg.StatusReport,
+			PID:          msg.Protocol,
+			Coding:       msg.Coding,
+			Text:         msg.Text(),
 		}
-		blob, err := ioutil.ReadAll(fr)
-		if err != nil {
-			log.Printf("cannot read %s: %s", base, err)
-			continue
+		if infoErr == nil {
+			d.sms.Stamp = opts.stamp(info.Timestamp)
+			if opts.timeSource == PreferStamp {
+				d.sms.When = d.sms.Stamp
+			}
 		}
-		m, err := parseMessage(blob)
-		if err != nil {
-			log.Printf("cannot parse %s: %s", base, err)
-			continue
+		d.key = multiKey{Type: d.sms.Type, Peer: d.sms.Peer, Ref: msg.Ref}
+	case Submit:
+		if infoErr != nil {
+			d.err = entryError(base, infoErr)
+			return
 		}
-
-		msg := m.Msg.(submitMessage)
 		if m.Peer == "" && len(m.Peers) == 0 {
 			log.Printf("WARN: empty peer in %s", base)
 		}
-		sms := SMS{
-			Type:  int(msg.MsgType),
-			Peer:  m.Peer,
-			Peers: m.Peers,
-			When:  DosTime(info.Timestamp).Local(),
-			Text:  msg.UserData(),
+		d.ud, d.uni = msg.UserData, msg.Coding.Alphabet == UCS2
+		d.sms = SMS{
+			Type:             int(msg.MsgType),
+			Peer:             m.Peer,
+			Peers:            m.Peers,
+			When:             opts.stamp(info.Timestamp),
+			TOA:              msg.ToTOA,
+			ReplyPath:        msg.ReplyPath,
+			StatusReport:     msg.StatusReport,
+			RejectDuplicates: msg.RejectDuplicates,
+			PID:              msg.Protocol,
+			Coding:           msg.Coding,
+			Text:             msg.Text(),
+			MR:               []int{int(msg.RefID)},
+
+			RawStamp: info.Timestamp,
+		}
+		d.sms.Stamp = d.sms.When
+		switch {
+		case !msg.ValidUntil.IsZero():
+			d.sms.Expires = msg.ValidUntil
+		case msg.Validity != 0:
+			d.sms.Expires = d.sms.When.Add(msg.Validity)
 		}
+		d.key = multiKey{Type: d.sms.Type, Peer: d.sms.Peer, Ref: int(msg.RefID)<<16 | msg.Ref}
+	}
+	if opts.charset != nil {
+		d.ud.charset = opts.charset
+		if d.sms.Text, err = d.ud.decodeText(d.uni); err != nil {
+			d.err = entryError(base, fmt.Errorf("%w: %s", ErrCorrupt, err))
+			return
+		}
+	}
+	for _, id := range d.ud.unknownIEs {
+		d.event(UnknownIE, base, "information element 0x%02x", id)
+	}
+	if !d.uni && !d.ud.Binary && !d.ud.Compressed {
+		if d.ud.SingleShift > 0 {
+			d.event(CharsetFallback, base, "national language table %d decoded with the default extension table", d.ud.SingleShift)
+		}
+		if strings.ContainsRune(d.sms.Text, utf8.RuneError) {
+			d.event(CharsetFallback, base, "undefined septets replaced")
+		}
+	}
+	d.sms.SMSC = m.SMSC
+	d.sms.TextOrder = m.TextOrder
+	folder, _ := entryFolder(f.Name)
+	d.sms.Direction = DirectionOf(folder, m.Msg)
+	d.sms.Folder = folder
+	if infoErr == nil {
+		d.sms.Seq = info.Seq
+	}
+	d.sms.Port = d.ud.Port
+	d.sms.Voicemail = d.ud.Voicemail
+	if c := d.sms.Coding; d.sms.Voicemail == nil && c.Waiting && c.Indication == VoicemailWaiting {
+		d.sms.Voicemail = &Voicemail{Active: c.Active}
+	}
+	if d.ud.Binary {
+		d.sms.Binary = true
+		d.sms.Data = d.ud.RawData
+	}
+	if d.ud.Compressed {
+		// GSM 03.42 compression is not implemented.
+		d.sms.Undecoded = "compressed user data"
+		d.sms.Data = d.ud.RawData
+	}
+	if opts.keepRaw {
+		d.ud.raw = &RawEntry{Name: f.Name, Body: blob, Layout: m.Layout.Name, Unknown: m.Unknown}
+		if infoErr == nil {
+			d.ud.raw.Flags = DecodeFlags(info.Flags)
+		}
+		d.sms.Raw = []RawEntry{*d.ud.raw}
+	}
+	if opts.mode == Strict {
+		d.err = checkStrict(f.Name, d.sms)
+	}
+	return d
+}
 
-		if msg.Concat {
-			key := multiKey{Peer: sms.Peer, Ref: int(msg.RefID)<<16 | msg.Ref}
-			if msg.Part == 1 {
-				baseMsg[key] = sms
-			}
-			parts := append(multiparts[key], msg.userData)
-			if len(parts) == msg.NParts {
-				delete(multiparts, key)
-				sms := baseMsg[key]
-				delete(baseMsg, key)
-				sms.Text = mergeConcatSMS(parts, msg.Unicode)
-				msgs = append(msgs, sms)
-			} else {
-				multiparts[key] = parts
-			}
-		} else {
-			msgs = append(msgs, sms)
+// add records a decoded entry. It returns ok == false if it is part
+// of an incomplete concatenated message.
+func (a *assembler) add(d decoded) (sms SMS, ok bool) {
+	ud := d.ud
+	if !ud.Concat {
+		return d.sms, true
+	}
+
+	if _, ok := a.baseMsg[d.key]; !ok || ud.Part == 1 {
+		a.baseMsg[d.key] = d.sms
+	}
+	a.unicode[d.key] = d.uni
+	a.refs[d.key] = append(a.refs[d.key], d.sms.MR...)
+	parts := append(a.multiparts[d.key], ud)
+	if len(parts) < ud.NParts {
+		a.multiparts[d.key] = parts
+		return SMS{}, false
+	}
+	delete(a.multiparts, d.key)
+	sms = a.baseMsg[d.key]
+	sms.MR = a.refs[d.key]
+	delete(a.baseMsg, d.key)
+	delete(a.unicode, d.key)
+	delete(a.refs, d.key)
+	sms.Text = mergeConcatSMS(parts, d.uni)
+	if ud.Binary || ud.Compressed {
+		sms.Data = mergeConcatData(parts)
+	}
+	if ud.raw != nil {
+		sms.Raw = mergeConcatRaw(parts)
+	}
+	return sms, true
+}
+
+// incomplete returns messages whose parts were not all found,
+// sorted by date. Missing parts are omitted from the text.
+func (a *assembler) incomplete() []SMS {
+	var msgs []SMS
+	for key, parts := range a.multiparts {
+		sms := a.baseMsg[key]
+		sms.MR = a.refs[key]
+		sms.Text = mergeConcatSMS(parts, a.unicode[key])
+		if parts[0].Binary || parts[0].Compressed {
+			sms.Data = mergeConcatData(parts)
+		}
+		if parts[0].raw != nil {
+			sms.Raw = mergeConcatRaw(parts)
 		}
+		msgs = append(msgs, sms)
 	}
-	sort.Sort(smsByDate(msgs))
-	return msgs, nil
+	sort.Stable(smsByDate(msgs))
+	return msgs
 }
 
+// smsByDate sorts messages in the default order (see ByDate).
 type smsByDate []SMS
 
 func (s smsByDate) Len() int           { return len(s) }
 func (s smsByDate) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-func (s smsByDate) Less(i, j int) bool { return s[i].When.Before(s[j].When) }
+func (s smsByDate) Less(i, j int) bool { return ByDate(s[i], s[j]) < 0 }
+
+// mergeConcatSMS returns the text of a concatenated message.
+// UCS-2 parts are joined before decoding, since a surrogate
+// pair may be split across parts.
+func mergeConcatSMS(parts []UserData, uni bool) string {
+	p := make(map[int]UserData)
+	nparts := 0
+	for _, part := range parts {
+		p[part.Part] = part
+		nparts = part.NParts
+	}
+	var t strings.Builder
+	var units []byte // UCS-2 text of consecutive parts
+	for i := 1; i <= nparts; i++ {
+		part, ok := p[i]
+		if uni && ok && !part.Binary && !part.Compressed {
+			units = append(units, part.RawData[:len(part.RawData)&^1]...)
+			continue
+		}
+		t.WriteString(decodeUCS2(units))
+		units = units[:0]
+		if ok {
+			t.WriteString(part.text(uni))
+		}
+	}
+	t.WriteString(decodeUCS2(units))
+	return t.String()
+}
 
-func mergeConcatSMS(parts []userData, uni bool) string {
-	p := make(map[int]string)
+func mergeConcatData(parts []UserData) []byte {
+	p := make(map[int][]byte)
 	nparts := 0
 	for _, part := range parts {
-		p[part.Part] = part.Text(uni)
+		p[part.Part] = part.RawData
 		nparts = part.NParts
 	}
-	t := ""
+	var data []byte
 	for i := 1; i <= nparts; i++ {
-		t += p[i]
+		data = append(data, p[i]...)
 	}
-	return t
+	return data
+}
+
+// mergeConcatRaw returns raw entries of parts, in part order.
+func mergeConcatRaw(parts []UserData) []RawEntry {
+	sorted := make([]UserData, len(parts))
+	copy(sorted, parts)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Part < sorted[j].Part })
+	raws := make([]RawEntry, len(sorted))
+	for i, p := range sorted {
+		raws[i] = *p.raw
+	}
+	return raws
 }
 
 type Image struct {
@@ -200,7 +900,8 @@ type Image struct {
 
 func (r *Reader) Images() (images []Image, err error) {
 	// convenience method to extract JPEG images
-	for _, f := range r.z.File {
+	opts := r.decodeOptions()
+	for f := range r.files() {
 		if !strings.HasPrefix(f.Name, "predefmessages/") {
 			continue
 		}
@@ -208,17 +909,12 @@ func (r *Reader) Images() (images []Image, err error) {
 			continue
 		}
 		base := path.Base(f.Name)
-		info, err := parseNBFFilename(base)
+		info, err := ParseFilename(base)
 		if err != nil {
 			log.Printf("invalid entry name %q: %s", base, err)
 			continue
 		}
-		fr, err := f.Open()
-		if err != nil {
-			log.Printf("cannot read %s: %s", base, err)
-			continue
-		}
-		blob, err := ioutil.ReadAll(fr)
+		blob, err := readEntry(f, r.Password)
 		if err != nil {
 			log.Printf("cannot read %s: %s", base, err)
 			continue
@@ -236,7 +932,7 @@ func (r *Reader) Images() (images []Image, err error) {
 				img := Image{
 					NBFFile: base,
 					Type:    "png",
-					Stamp:   DosTime(info.Timestamp).Local(),
+					Stamp:   opts.stamp(info.Timestamp),
 					Peer:    info.Peer,
 					Data:    blob[idx : idx+idx2+12],
 				}
@@ -257,13 +953,13 @@ func (r *Reader) Images() (images []Image, err error) {
 				break
 			}
 
-			//log.Printf("analyzing %s at offset %d", base, idx)
+			opts.debug("analyzing image", "entry", base, "offset", idx)
 			jpg, ok := findJpeg(blob[idx:])
 			if ok {
 				img := Image{
 					NBFFile: base,
 					Type:    "jpg",
-					Stamp:   DosTime(info.Timestamp).Local(),
+					Stamp:   opts.stamp(info.Timestamp),
 					Peer:    info.Peer,
 					Data:    jpg,
 				}
@@ -0,0 +1,1023 @@
+package nbf_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/mms"
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/nbf/gsm7"
+	"github.com/remyoudompheng/go-misc/nokia/nbf/nbftest"
+)
+
+var testArchive = nbftest.Archive{
+	Messages: []nbftest.Message{
+		{Peer: "+33612345678", Text: "Hello there"},
+		{Peer: "+33612345678", When: nbftest.Epoch.Add(time.Hour),
+			Parts: []string{"This message is ", "split in ", "three parts"}},
+		{Sent: true, Peer: "+33612345678", Name: "Bob", When: nbftest.Epoch.Add(2 * time.Hour),
+			Text: "Thanks, Bob ☺"},
+	},
+	MMS: []nbftest.MMS{{
+		Peer: "+33612345678",
+		Parts: []nbftest.Part{
+			{ContentType: "text/plain", Name: "hello.txt", Data: []byte("Hello")},
+			{ContentType: "image/jpeg", Name: "pic.jpg", Data: []byte{0xff, 0xd8, 0xff, 0xd9}},
+		},
+	}},
+}
+
+func TestReader(t *testing.T) {
+	r, err := testArchive.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	inbox, err := r.Inbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inbox) != 2 {
+		t.Fatalf("got %d received messages, expected 2", len(inbox))
+	}
+	if inbox[0].Text != "Hello there" || inbox[0].Peer != "+33612345678" {
+		t.Errorf("bad message %+v", inbox[0])
+	}
+	if inbox[1].Text != "This message is split in three parts" {
+		t.Errorf("bad concatenated message %q", inbox[1].Text)
+	}
+	outbox, err := r.Outbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outbox) != 1 || outbox[0].Text != "Thanks, Bob ☺" || outbox[0].Peer != "Bob" {
+		t.Errorf("bad outbox %+v", outbox)
+	}
+	if !outbox[0].When.Equal(nbftest.Epoch.Add(2 * time.Hour)) {
+		t.Errorf("bad timestamp %s", outbox[0].When)
+	}
+
+	mms, err := r.MMS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mms) != 1 || len(mms[0].Parts) != 2 || string(mms[0].Parts[0].Data) != "Hello" {
+		t.Errorf("bad MMS %+v", mms)
+	}
+}
+
+func TestTimeZones(t *testing.T) {
+	r, err := testArchive.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Entry names hold wall clock times of the phone.
+	loc := time.FixedZone("UTC-5", -5*3600)
+	wall := nbftest.Epoch.Local()
+	stored := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, loc)
+	r.Location = loc
+	inbox, err := r.Inbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := inbox[0]
+	if !m.When.Equal(nbftest.Epoch) || !m.SCTS.Equal(nbftest.Epoch) || !m.Stamp.Equal(stored) {
+		t.Errorf("got When=%s SCTS=%s Stamp=%s", m.When, m.SCTS, m.Stamp)
+	}
+	r.TimeSource = nbf.PreferStamp
+	if inbox, err = r.Inbox(); err != nil {
+		t.Fatal(err)
+	}
+	if m := inbox[0]; !m.When.Equal(stored) || m.When.Location() != loc {
+		t.Errorf("got When=%s, expected %s", m.When, stored)
+	}
+
+	r.TimeOffset = 90 * time.Minute
+	if inbox, err = r.Inbox(); err != nil {
+		t.Fatal(err)
+	}
+	if m := inbox[0]; !m.Stamp.Equal(stored.Add(r.TimeOffset)) || !m.SCTS.Equal(nbftest.Epoch) {
+		t.Errorf("got Stamp=%s SCTS=%s with offset %s", m.Stamp, m.SCTS, r.TimeOffset)
+	}
+}
+
+func TestMessagesOrder(t *testing.T) {
+	var a nbftest.Archive
+	for i := 0; i < 100; i++ {
+		a.Messages = append(a.Messages, nbftest.Message{
+			Peer: "+33612345678",
+			When: nbftest.Epoch.Add(time.Duration(i) * time.Minute),
+			Text: string(rune('A' + i%26)),
+		})
+	}
+	r, err := a.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{1, 4, 16} {
+		r.Workers = workers
+		i := 0
+		for m, err := range r.Messages() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Text != a.Messages[i].Text {
+				t.Fatalf("workers=%d: message %d is %q, expected %q", workers, i, m.Text, a.Messages[i].Text)
+			}
+			i++
+		}
+		if i != len(a.Messages) {
+			t.Errorf("workers=%d: got %d messages", workers, i)
+		}
+	}
+}
+
+func TestParseModes(t *testing.T) {
+	// A message with an undecodable PDU but a valid text block.
+	body, err := nbf.EncodeSMS(nbf.SMS{Type: 1, Peer: "Bob", Peers: []string{"+33612345678 <Bob>"}, Text: "Salvaged"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body[0xb0] = 0x03 // reserved message type
+	lonely, err := nbf.EncodePart(nbf.SMS{Type: 1, Peer: "Bob", Peers: []string{"+33612345678 <Bob>"}, Text: "Lonely part"}, 7, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := nbf.MessageInfo{Seq: 100, Flags: nbf.FLAGS_SMS, Peer: "+33612345678"}
+	info2 := info
+	info2.Seq = 101
+	a := nbftest.Archive{
+		Messages: []nbftest.Message{
+			{Sent: true, Peer: "+33612345678", Name: "Bob", Text: "Hello"},
+			{Sent: true, Peer: "+33612345678", Name: "Bob", Parts: []string{"Part 1, ", "part 2"}},
+		},
+		Files: map[string][]byte{
+			"predefmessages/3/" + info.Filename():  body,
+			"predefmessages/3/" + info2.Filename(): lonely,
+		},
+	}
+	r, err := a.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		mode  nbf.ParseMode
+		texts []string
+		fail  bool
+	}{
+		{nbf.SkipErrors, []string{"Hello", "Part 1, part 2"}, false},
+		{nbf.Strict, nil, true},
+		{nbf.Lenient, []string{"Hello", "Lonely part", "Part 1, part 2", "Salvaged"}, false},
+	} {
+		r.Mode = c.mode
+		msgs, err := r.Outbox()
+		if (err != nil) != c.fail {
+			t.Errorf("mode %d: got error %v", c.mode, err)
+		}
+		var got []string
+		for _, m := range msgs {
+			got = append(got, m.Text)
+		}
+		sort.Strings(got)
+		if strings.Join(got, "|") != strings.Join(c.texts, "|") {
+			t.Errorf("mode %d: got %q, expected %q", c.mode, got, c.texts)
+		}
+	}
+}
+
+func TestKeepRaw(t *testing.T) {
+	r, err := testArchive.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.KeepRaw = true
+	inbox, err := r.Inbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inbox[0].Raw) != 1 || len(inbox[1].Raw) != 3 {
+		t.Fatalf("got %d and %d raw entries, expected 1 and 3", len(inbox[0].Raw), len(inbox[1].Raw))
+	}
+	for _, raw := range inbox[1].Raw {
+		if len(raw.Body) <= 0xb0 || len(raw.Unknown) == 0 {
+			t.Errorf("bad raw entry %s", raw.Name)
+		}
+		for _, sp := range raw.Unknown {
+			if !bytes.Equal(raw.Body[sp.Offset:sp.Offset+len(sp.Data)], sp.Data) {
+				t.Errorf("span at offset 0x%x does not match entry body", sp.Offset)
+			}
+		}
+	}
+	if inbox[1].Raw[0].Name > inbox[1].Raw[1].Name {
+		t.Errorf("raw entries not in part order: %s, %s", inbox[1].Raw[0].Name, inbox[1].Raw[1].Name)
+	}
+}
+
+func TestStore(t *testing.T) {
+	r, err := testArchive.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := r.Store(); s != nbf.StoreS40 {
+		t.Errorf("got store %s, expected S40", s)
+	}
+
+	a := nbftest.Archive{Files: map[string][]byte{
+		"C/Private/1000484b/Mail2/00001001_S/0/00100000": {0},
+	}}
+	r, err = a.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := r.Store(); s != nbf.StoreS60 {
+		t.Errorf("got store %s, expected S60", s)
+	}
+	if _, err := r.Inbox(); !errors.Is(err, nbf.ErrUnsupportedStore) {
+		t.Errorf("got error %v, expected ErrUnsupportedStore", err)
+	}
+}
+
+func TestDeliveryReports(t *testing.T) {
+	t0 := nbftest.Epoch
+	a := nbftest.Archive{
+		Messages: []nbftest.Message{
+			{Sent: true, Peer: "+33612345678", When: t0, Text: "delivered", MR: 5},
+			{Sent: true, Peer: "+33612345678", When: t0.Add(time.Hour), Text: "failed", MR: 6},
+			{Sent: true, Peer: "+33698765432", When: t0, Text: "other recipient", MR: 5},
+			{Sent: true, Peer: "+33612345678", When: t0.Add(48 * time.Hour), Text: "no report", MR: 5},
+			{Peer: "+33612345678", Text: "received"},
+		},
+		Reports: []nbf.Report{
+			{RefID: 5, RecipAddr: "+33612345678", SMSCStamp: t0.Add(time.Minute),
+				Discharge: t0.Add(2 * time.Minute), Status: 0},
+			{RefID: 6, RecipAddr: "+33612345678", SMSCStamp: t0.Add(time.Hour),
+				Discharge: t0.Add(time.Hour), Status: 0x30},
+			{RefID: 6, RecipAddr: "+33612345678", SMSCStamp: t0.Add(time.Hour),
+				Discharge: t0.Add(3 * time.Hour), Status: 0x41},
+			{RefID: 7, RecipAddr: "+33612345678", SMSCStamp: t0, Discharge: t0, Status: 0},
+		},
+	}
+	r, err := a.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports, err := r.Reports()
+	if err != nil || len(reports) != 4 {
+		t.Fatalf("got %d reports, %v", len(reports), err)
+	}
+	if got := reports[1].Delivery(); got != nbf.DeliveryPending {
+		t.Errorf("report with status 0x30: got %s", got)
+	}
+	inbox, err := r.Inbox()
+	if err != nil || len(inbox) != 1 {
+		t.Fatalf("got inbox %v, %v", inbox, err)
+	}
+	outbox, err := r.Outbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]nbf.DeliveryStatus{
+		"delivered":       nbf.Delivered,
+		"failed":          nbf.DeliveryFailed,
+		"other recipient": nbf.NoReport,
+		"no report":       nbf.NoReport,
+	}
+	for _, m := range outbox {
+		if m.DeliveryStatus != want[m.Text] {
+			t.Errorf("%q: got status %s, want %s", m.Text, m.DeliveryStatus, want[m.Text])
+		}
+		if delivered := !m.DeliveredAt.IsZero(); delivered != (m.DeliveryStatus == nbf.Delivered) {
+			t.Errorf("%q: status %s delivered at %s", m.Text, m.DeliveryStatus, m.DeliveredAt)
+		}
+	}
+}
+
+func TestReadReports(t *testing.T) {
+	t0 := nbftest.Epoch
+	text := []nbftest.Part{{ContentType: "text/plain", Data: []byte("Hello")}}
+	a := nbftest.Archive{
+		MMS: []nbftest.MMS{
+			{Sent: true, Peer: "+33612345678", When: t0, MessageID: "id1", Parts: text},
+			{Sent: true, Peer: "+33612345678", When: t0.Add(time.Hour), Parts: text},
+			{Sent: true, Peer: "+33612345678", When: t0.Add(2 * time.Hour), Parts: text},
+			{Sent: true, Peer: "+33698765432", When: t0, Parts: text},
+			{Peer: "+33612345678", When: t0, Parts: text},
+		},
+		Read: []nbftest.ReadReport{
+			{MessageID: "id1", Peer: "+33612345678", When: t0.Add(3 * time.Hour)},
+			{Peer: "+33612345678", When: t0.Add(90 * time.Minute), Deleted: true},
+		},
+	}
+	r, err := a.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports, err := r.ReadReports()
+	if err != nil || len(reports) != 2 {
+		t.Fatalf("got %d reports, %v", len(reports), err)
+	}
+	if rep := reports[0]; rep.MessageID != "id1" || rep.Peer != "+33612345678" ||
+		!rep.Date.Equal(t0.Add(3*time.Hour)) || rep.Status != nbf.Read {
+		t.Errorf("bad read report %+v", rep)
+	}
+	msgs, err := r.MMS()
+	if err != nil || len(msgs) != 5 {
+		t.Fatalf("got %d MMS, %v", len(msgs), err)
+	}
+	want := []nbf.ReadStatus{nbf.Read, nbf.DeletedUnread, nbf.NoReadReport, nbf.NoReadReport, nbf.NoReadReport}
+	for i, m := range msgs {
+		if m.ReadStatus != want[i] {
+			t.Errorf("MMS %d: got %s, want %s", i, m.ReadStatus, want[i])
+		}
+	}
+	if !msgs[0].ReadAt.Equal(t0.Add(3*time.Hour)) || msgs[4].Direction != nbf.Received {
+		t.Errorf("got read time %s, direction %s", msgs[0].ReadAt, msgs[4].Direction)
+	}
+}
+
+func TestFolders(t *testing.T) {
+	a := nbftest.Archive{
+		Messages: []nbftest.Message{
+			{Peer: "+33612345678", Text: "inbox"},
+			{Sent: true, Peer: "+33612345678", Text: "sent"},
+			{Sent: true, Peer: "+33612345678", Text: "draft", Folder: nbf.FolderDrafts},
+			{Sent: true, Text: "template", Folder: nbf.FolderTemplates},
+			{Peer: "+33612345678", Text: "kept", Folder: 7},
+		},
+		Folders: []int{7, 8},
+	}
+	r, err := a.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []nbf.Folder{
+		{ID: nbf.FolderInbox, Name: "Inbox", Entries: 1},
+		{ID: nbf.FolderOutbox, Name: "Sent items", Entries: 1},
+		{ID: nbf.FolderDrafts, Name: "Drafts", Entries: 1},
+		{ID: nbf.FolderTemplates, Name: "Templates", Entries: 1},
+		{ID: 7, Name: "Folder 7", User: true, Entries: 1},
+		{ID: 8, Name: "Folder 8", User: true},
+	}
+	if got := r.Folders(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got folders %+v", got)
+	}
+	for _, f := range want {
+		msgs, err := r.FolderMessages(f.ID)
+		if err != nil || len(msgs) != f.Entries || len(msgs) > 0 && msgs[0].Folder != f.ID {
+			t.Errorf("folder %d: got %v, %v", f.ID, msgs, err)
+		}
+	}
+	if msgs, _ := r.FolderMessages(nbf.FolderDrafts); len(msgs) == 1 && msgs[0].Direction != nbf.Draft {
+		t.Errorf("draft has direction %s", msgs[0].Direction)
+	}
+}
+
+func TestBodyText(t *testing.T) {
+	smil := `<smil><body>
+<par><img src="pic.jpg"/><text src="cid:second"/></par>
+<par><text src="first.txt"/></par>
+</body></smil>`
+	m := nbf.MMS{MMS: mms.MMS{Parts: []mms.Part{
+		{ContentType: "application/smil", Data: []byte(smil)},
+		{ContentType: "text/plain", Headers: map[string]string{"Content-Location": "first.txt"}, Data: []byte("un")},
+		{ContentType: "image/jpeg", Headers: map[string]string{"Content-Location": "pic.jpg"}},
+		{ContentType: "text/plain", Headers: map[string]string{"Content-ID": "<second>"},
+			Params: map[string]string{"charset": "utf-16"}, Data: []byte{0xff, 0xfe, 'd', 0, 'e', 0, 'u', 0, 'x', 0}},
+		{ContentType: "text/plain", Params: map[string]string{"charset": "iso-8859-1"}, Data: []byte("trois \xe9t\xe9")},
+	}}}
+	if got, want := m.BodyText(), "deux\nun\ntrois été"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := (nbf.SMS{Text: "hello"}).BodyText(); got != "hello" {
+		t.Errorf("got SMS text %q", got)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	vcard := []byte("BEGIN:VCARD\r\nVERSION:2.1\r\nN:Bob\r\nEND:VCARD\r\n")
+	a := nbftest.Archive{Messages: []nbftest.Message{
+		{Peer: "+33612345678", Port: nbf.PortVCard, Data: vcard},
+	}}
+	r, err := a.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox, err := r.Inbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inbox) != 1 {
+		t.Fatalf("got %d messages", len(inbox))
+	}
+	m := inbox[0]
+	if !m.Binary || m.Port != nbf.PortVCard || !bytes.Equal(m.Data, vcard) || m.Text != "" {
+		t.Errorf("got %+v", m)
+	}
+}
+
+func TestDirection(t *testing.T) {
+	draft, err := nbf.EncodeSMS(nbf.SMS{Type: 1, Peer: "Bob", Peers: []string{"+33612345678 <Bob>"}, Text: "Draft"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := nbf.MessageInfo{Seq: 100, Flags: nbf.FLAGS_SMS, Peer: "+33612345678"}
+	a := testArchive
+	a.Files = map[string][]byte{"predefmessages/5/" + info.Filename(): draft}
+	r, err := a.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdrs, err := r.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := make(map[nbf.Direction]int)
+	for _, h := range hdrs {
+		if h.IsMMS() {
+			continue
+		}
+		m, err := h.SMS()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Folder != 5 && m.Direction != h.Direction() {
+			t.Errorf("%s: direction %s, expected %s from folder", h.Name, m.Direction, h.Direction())
+		}
+		count[m.Direction]++
+	}
+	if count[nbf.Received] != 4 || count[nbf.Sent] != 1 || count[nbf.Draft] != 1 {
+		t.Errorf("got directions %v", count)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	m := nbf.SMS{
+		Direction: nbf.Received,
+		Peer:      "+33612345678",
+		When:      nbftest.Epoch,
+		SCTS:      nbftest.Epoch,
+		Text:      "Hello",
+		Coding:    nbf.Coding{Class: nbf.Class0},
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"direction":"received","peer":"+33612345678","date":"2010-01-01T12:00:00Z",` +
+		`"scts":"2010-01-01T12:00:00Z","text":"Hello","coding":{"alphabet":"GSM-7","class":0}}`
+	if string(b) != want {
+		t.Errorf("got %s\nexpected %s", b, want)
+	}
+
+	body, err := nbf.EncodePart(m, 7, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := nbf.ParseEntry(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = json.Marshal(e.Msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const wantPDU = `{"type":"deliver","from":"+33612345678","toa":145,"pid":0,` +
+		`"coding":{"alphabet":"GSM-7","class":0},"scts":"2010-01-01T12:00:00Z",` +
+		`"text":"Hello","ref":7,"part":1,"parts":2}`
+	if string(b) != wantPDU {
+		t.Errorf("got %s\nexpected %s", b, wantPDU)
+	}
+
+	var info nbf.MessageInfo
+	const name = "0000186F3C52A89B0042201000500000004030000000000000000000000000000+336345632330000009F"
+	if err := json.Unmarshal([]byte(`"`+name+`"`), &info); err != nil || info.Seq != 0x186f {
+		t.Errorf("got %+v, %v", info, err)
+	}
+	if b, _ := json.Marshal(info); string(b) != `"`+name+`"` {
+		t.Errorf("got %s", b)
+	}
+}
+
+func TestSMSString(t *testing.T) {
+	m := nbf.SMS{
+		Direction: nbf.Received,
+		Peer:      "+33612345678",
+		When:      nbftest.Epoch,
+		Text:      "This is a rather long message\nwhich spans two lines",
+	}
+	const want = `2010-01-01 12:00:00 received +33612345678 "This is a rather long message\nwhich span…"`
+	if s := m.String(); s != want {
+		t.Errorf("got %s\nexpected %s", s, want)
+	}
+	const wantGo = `nbf.SMS{Direction: nbf.Received, Peer: "+33612345678", ` +
+		`When: time.Date(2010, time.January, 1, 12, 0, 0, 0, time.UTC), ` +
+		`Text: "This is a rather long message\nwhich spans two lines"}`
+	if s := fmt.Sprintf("%#v", m); s != wantGo {
+		t.Errorf("got %s\nexpected %s", s, wantGo)
+	}
+}
+
+func TestCharset(t *testing.T) {
+	r, err := nbftest.Archive{Messages: []nbftest.Message{{Peer: "+33612345678", Text: "¿Qué?"}}}.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := gsm7.Encoding{}.With(gsm7.Override{Septet: 0x60, Rune: 'ç'})
+	r.Charset = &cs
+	inbox, err := r.Inbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inbox) != 1 || inbox[0].Text != "çQué?" {
+		t.Errorf("got %v", inbox)
+	}
+}
+
+func TestNFC(t *testing.T) {
+	m := nbf.SMS{Text: "Cafe\u0301", Peers: []string{"+33612345678 <Ame\u0301lie>"}}
+	n := m.NFC()
+	if n.Text != "Café" || n.Peers[0] != "+33612345678 <Amélie>" {
+		t.Errorf("got %q %q", n.Text, n.Peers)
+	}
+	if m.Peers[0] != "+33612345678 <Ame\u0301lie>" {
+		t.Errorf("NFC modified its receiver: %q", m.Peers)
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	for text, lang := range map[string]string{
+		"Are you coming to the party tonight?":    "en",
+		"Je suis en retard, tu peux m'attendre ?": "fr",
+		"Ich bin heute nicht zu Hause":            "de",
+		"Hola, ¿qué tal? Estoy en casa":           "es",
+		"Ciao, come stai? Io sono a casa":         "it",
+		"Привет, как дела?":                       "ru",
+		"Привіт, як справи? Їдемо":                "uk",
+		"Καλημέρα":                                "el",
+		"今日は雨です":                                  "ja",
+		"안녕하세요":                                   "ko",
+		"12345":                                   "",
+	} {
+		if l := nbf.DetectLanguage(text); l != lang {
+			t.Errorf("DetectLanguage(%q) = %q, expected %q", text, l, lang)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for _, tt := range []struct {
+		m nbf.SMS
+		s nbf.Sender
+	}{
+		{nbf.SMS{Peer: "+33612345678", Text: "On se voit demain ?"}, nbf.Person},
+		{nbf.SMS{Peer: "36173", Text: "Votre facture est disponible"}, nbf.ShortCode},
+		{nbf.SMS{Peer: "MyBank", Text: "Solde: 12 EUR"}, nbf.Alphanumeric},
+		{nbf.SMS{Peer: "+33612345678", Text: "Your verification code: 482913"}, nbf.Notification},
+		{nbf.SMS{Peer: "+33612345678", Text: "Promo ! STOP au 36111"}, nbf.Notification},
+		{nbf.SMS{Type: 1, Peer: "36173", Text: "STOP"}, nbf.Person},
+	} {
+		if s := nbf.Classify(tt.m); s != tt.s {
+			t.Errorf("Classify(%v) = %s, expected %s", tt.m, s, tt.s)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	msgs := []nbf.SMS{
+		{Peer: "+33612345678", Text: "Rendez-vous à 18h, puis 20h"},
+		{Type: 1, Peers: []string{"+33698765432 <Bob>"}, Text: "ok"},
+	}
+	contacts := []nbf.Contact{{Name: "Alice Martin", Phones: []nbf.Phone{{Number: "06 12 34 56 78"}}}}
+
+	m := nbf.Search(msgs, regexp.MustCompile(`\d+h`), nbf.SearchOptions{})
+	if len(m) != 1 || m[0].Index != 0 || !reflect.DeepEqual(m[0].Offsets, [][]int{{15, 18}, {25, 28}}) {
+		t.Errorf("got %+v", m)
+	}
+	m = nbf.Search(msgs, regexp.MustCompile(`(?i)alice|bob`), nbf.SearchOptions{Names: true, Contacts: contacts})
+	if len(m) != 2 || m[0].Value != "Alice Martin" || m[1].Index != 1 || m[1].Field != nbf.FieldName {
+		t.Errorf("got %+v", m)
+	}
+	if m := nbf.Search(msgs, regexp.MustCompile(`o`), nbf.SearchOptions{Limit: 1}); len(m) != 1 {
+		t.Errorf("got %d matches, expected 1", len(m))
+	}
+}
+
+func TestMessagesPage(t *testing.T) {
+	r, err := testArchive.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var all []nbf.SMS
+	for m, err := range r.Messages() {
+		if err == nil { // the MMS entry is an error
+			all = append(all, m)
+		}
+	}
+	if len(all) != 3 {
+		t.Fatalf("got %d messages, expected 3", len(all))
+	}
+
+	page, next, err := r.MessagesPage(nbf.Page{Limit: 2})
+	if err != nil || len(page) != 2 || page[1].ID() != all[1].ID() || next == "" {
+		t.Fatalf("first page: %v %q %v", page, next, err)
+	}
+	page, next, err = r.MessagesPage(nbf.Page{Cursor: next, Limit: 2})
+	if err != nil || len(page) != 1 || page[0].ID() != all[2].ID() || next != "" {
+		t.Fatalf("second page: %v %q %v", page, next, err)
+	}
+	if _, _, err := r.MessagesPage(nbf.Page{Cursor: "1.bogus"}); err != nbf.ErrCursor {
+		t.Errorf("got error %v for a bad cursor", err)
+	}
+	received := func(m nbf.SMS) bool { return m.Direction == nbf.Received }
+	page, next, err = r.MessagesPageContext(context.Background(), nbf.Page{Limit: 1}, received)
+	if err != nil || len(page) != 1 || page[0].ID() != all[0].ID() || next == "" {
+		t.Fatalf("first filtered page: %v %q %v", page, next, err)
+	}
+	page, next, err = r.MessagesPageContext(context.Background(), nbf.Page{Cursor: next}, received)
+	if err != nil || len(page) != 1 || page[0].Direction != nbf.Received || next != "" {
+		t.Fatalf("second filtered page: %v %q %v", page, next, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := r.MessagesPageContext(ctx, nbf.Page{}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v with a cancelled context", err)
+	}
+
+	// Paginate finds cursors in modified lists.
+	_, next, _ = nbf.Paginate(all, nbf.Page{Limit: 1}, nbf.SMS.ID)
+	moved := append([]nbf.SMS{{Text: "new"}}, all...)
+	page, _, err = nbf.Paginate(moved, nbf.Page{Cursor: next, Offset: 1}, nbf.SMS.ID)
+	if err != nil || len(page) != 1 || page[0].ID() != all[2].ID() {
+		t.Errorf("Paginate: %v %v", page, err)
+	}
+	// Large offsets and limits do not overflow.
+	page, next, err = nbf.Paginate(moved, nbf.Page{Cursor: next, Offset: math.MaxInt}, nbf.SMS.ID)
+	if err != nil || len(page) != 0 || next != "" {
+		t.Errorf("Paginate with offset MaxInt: %v %q %v", page, next, err)
+	}
+	page, _, err = nbf.Paginate(moved, nbf.Page{Offset: 1, Limit: math.MaxInt}, nbf.SMS.ID)
+	if err != nil || len(page) != len(moved)-1 {
+		t.Errorf("Paginate with limit MaxInt: %v %v", page, err)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	msgs := []nbf.SMS{
+		{Direction: nbf.Received, Folder: 1, When: time.Date(2009, 12, 31, 23, 0, 0, 0, time.UTC)},
+		{Direction: nbf.Sent, Folder: 3, When: time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Direction: nbf.Draft, Folder: 4, When: time.Date(2010, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	ff := nbf.FilterFlags{Since: "2010", Until: "2010-06", Location: time.UTC}
+	f, err := ff.Filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Slice(msgs); len(got) != 1 || got[0].Folder != 3 {
+		t.Errorf("since/until: got %v", got)
+	}
+	f = nbf.Any(nbf.InFolder(4), nbf.WithDirection(nbf.Received))
+	if got := f.Slice(msgs); len(got) != 2 || got[0].Folder != 1 || got[1].Folder != 4 {
+		t.Errorf("any: got %v", got)
+	}
+	if got := nbf.Not(f).Slice(msgs); len(got) != 1 || got[0].Folder != 3 {
+		t.Errorf("not: got %v", got)
+	}
+	ff = nbf.FilterFlags{Direction: "sideways"}
+	if _, err := ff.Filter(); err == nil {
+		t.Errorf("invalid direction accepted")
+	}
+}
+
+func TestWithPeer(t *testing.T) {
+	msgs := []nbf.SMS{
+		{Peer: "+33612345678", Text: "a"},
+		{Peer: "MyBank", Text: "b"},
+		{Type: 1, Peer: "Alice", Peers: []string{"0612345678 <Alice>", "+33698765432 <Bob>"}, Text: "c"},
+		{Peer: "+4915112345678", Text: "d"},
+	}
+	texts := func(f nbf.Filter) (s string) {
+		for _, m := range f.Slice(msgs) {
+			s += m.Text
+		}
+		return s
+	}
+	for _, tt := range []struct {
+		peers []string
+		texts string
+	}{
+		{[]string{"06 12 34 56 78"}, "ac"},
+		{[]string{"0033612345678"}, "ac"},
+		{[]string{"mybank"}, "b"},
+		{[]string{"bob"}, "c"},
+		{[]string{"+49*"}, "d"},
+		{[]string{"*bank*", "+3369*"}, "bc"},
+	} {
+		if s := texts(nbf.WithPeer(tt.peers...)); s != tt.texts {
+			t.Errorf("WithPeer(%q) selects %q, expected %q", tt.peers, s, tt.texts)
+		}
+	}
+	c := nbf.Contact{Name: "Bob", Phones: []nbf.Phone{{Number: "06 98 76 54 32"}}}
+	if s := texts(nbf.WithContact(c)); s != "c" {
+		t.Errorf("WithContact selects %q", s)
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	t0 := time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+	msgs := []nbf.SMS{
+		{Seq: 3, When: t0, Peer: "+33612345678", Text: "ccc", Direction: nbf.Received},
+		{Seq: 1, When: t0.Add(time.Hour), Peer: "0612345678", Text: "a", Direction: nbf.Unknown},
+		{Seq: 2, When: t0, Peer: "Bob", Text: "bb", Direction: nbf.Sent},
+	}
+	seqs := func() (s []uint32) {
+		for _, m := range msgs {
+			s = append(s, m.Seq)
+		}
+		return s
+	}
+	for _, tt := range []struct {
+		spec string
+		seqs []uint32
+	}{
+		{"", []uint32{2, 3, 1}},
+		{"-date", []uint32{1, 3, 2}},
+		{"peer", []uint32{3, 1, 2}},
+		{"length", []uint32{1, 2, 3}},
+		{"direction,-length", []uint32{3, 2, 1}},
+	} {
+		cmps, err := nbf.ParseSort(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nbf.SortBy(msgs, cmps...)
+		if s := seqs(); !reflect.DeepEqual(s, tt.seqs) {
+			t.Errorf("sort %q: got %v, expected %v", tt.spec, s, tt.seqs)
+		}
+	}
+	if _, err := nbf.ParseSort("size"); err == nil {
+		t.Errorf("unknown order accepted")
+	}
+}
+
+func TestLargeArchive(t *testing.T) {
+	if testing.Short() {
+		t.Skip("large archive")
+	}
+	// More than 65535 entries require Zip64 records.
+	a := testArchive
+	a.Files = make(map[string][]byte)
+	for i := 0; i < 70000; i++ {
+		a.Files[fmt.Sprintf("predefgallery/predefphotos/%05d.jpg", i)] = []byte{byte(i)}
+	}
+	r, err := a.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for f := range r.GalleryFiles() {
+		if n == 69999 {
+			rd, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(rd)
+			rd.Close()
+			if err != nil || f.Type != "jpg" || f.Size != 1 || !bytes.Equal(data, []byte{69999 & 0xff}) {
+				t.Errorf("got %+v, %v, %v", f, data, err)
+			}
+		}
+		n++
+	}
+	if n != 70000 {
+		t.Errorf("got %d gallery files", n)
+	}
+	if inbox, err := r.Inbox(); err != nil || len(inbox) != 2 {
+		t.Errorf("got inbox %v, %v", inbox, err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	data, err := testArchive.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Lose the central directory and the end of the last entry.
+	cd := bytes.Index(data, []byte("PK\x01\x02"))
+	damaged := data[:cd-10]
+	if _, err := nbf.NewReader(bytes.NewReader(damaged), int64(len(damaged))); err == nil {
+		t.Fatal("damaged archive opened without recovery")
+	}
+	r, err := nbf.Recover(bytes.NewReader(damaged), int64(len(damaged)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := testArchive.Open()
+	for _, box := range []func(*nbf.Reader) ([]nbf.SMS, error){(*nbf.Reader).Inbox, (*nbf.Reader).Outbox} {
+		got, err := box(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp, _ := box(want)
+		if len(got) != len(exp) {
+			t.Errorf("recovered %d messages, expected %d", len(got), len(exp))
+			continue
+		}
+		for i := range got {
+			if got[i].Text != exp[i].Text || !got[i].When.Equal(exp[i].When) {
+				t.Errorf("recovered %v, expected %v", got[i], exp[i])
+			}
+		}
+	}
+}
+
+func TestLargeMMS(t *testing.T) {
+	// Entries larger than text messages are streamed.
+	video := bytes.Repeat([]byte("3gp video data "), 1<<16)
+	a := testArchive
+	a.MMS = []nbftest.MMS{{
+		Peer:  "+33612345678",
+		Parts: []nbftest.Part{{ContentType: "video/3gpp", Name: "clip.3gp", Data: video}},
+	}}
+	r, err := a.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mms, err := r.MMS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mms) != 1 || len(mms[0].Parts) != 1 || !bytes.Equal(mms[0].Parts[0].Data, video) {
+		t.Errorf("bad large MMS")
+	}
+	if inbox, err := r.Inbox(); err != nil || len(inbox) != 2 {
+		t.Errorf("got inbox %v, %v", inbox, err)
+	}
+	problems, err := r.Verify()
+	if err != nil || len(problems) != 0 {
+		t.Errorf("got problems %v, %v", problems, err)
+	}
+}
+
+func BenchmarkMessages(b *testing.B) {
+	var a nbftest.Archive
+	for i := 0; i < 1000; i++ {
+		a.Messages = append(a.Messages,
+			nbftest.Message{Peer: "+33612345678", When: nbftest.Epoch.Add(time.Duration(i) * time.Minute),
+				Text: "See you at the station at 6, don't be late"},
+			nbftest.Message{Sent: true, Peer: "+33612345678", When: nbftest.Epoch.Add(time.Duration(i) * time.Minute),
+				Text: "Très bien ☺ à tout à l'heure"})
+	}
+	r, err := a.Open()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, err := range r.Messages() {
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	r, err := testArchive.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Cache = true
+	want, err := r.Inbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			inbox, err := r.Inbox()
+			if err == nil && !reflect.DeepEqual(inbox, want) {
+				err = fmt.Errorf("got inbox %v, expected %v", inbox, want)
+			}
+			if err == nil {
+				var mms []nbf.MMS
+				if mms, err = r.MMS(); err == nil && len(mms) != 1 {
+					err = fmt.Errorf("got %d MMS", len(mms))
+				}
+			}
+			if err == nil {
+				_, _, err = r.MessagesPage(nbf.Page{Limit: 1})
+			}
+			errc <- err
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-errc; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	r, err := testArchive.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Mode = nbf.Lenient
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := 0
+	for _, err := range r.MessagesContext(ctx) {
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("got error %v", err)
+			}
+			break
+		}
+		n++
+		cancel()
+	}
+	if n != 1 {
+		t.Errorf("got %d messages after cancellation", n)
+	}
+	if _, err := r.InboxContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("InboxContext: got error %v", err)
+	}
+	if _, err := r.VerifyContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("VerifyContext: got error %v", err)
+	}
+	if _, err := r.MMSContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("MMSContext: got error %v", err)
+	}
+	if err := r.Walk(ctx, func(nbf.SMS) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("Walk: got error %v", err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	body, err := nbf.EncodeSMS(nbf.SMS{Type: 0, Peer: "+33612345678", When: nbftest.Epoch, Text: "Bad name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := nbf.MessageInfo{Seq: 100, Flags: nbf.FLAGS_SMS, Peer: "+33612345678"}
+	name := []byte(info.Filename())
+	name[len(name)-1] ^= 1 // break the checksum
+	a := testArchive
+	a.MMS = nil
+	a.Files = map[string][]byte{
+		"predefmessages/1/" + string(name): body,
+		"predefmessages/1/garbage.bin":     {1, 2, 3},
+	}
+	r, err := a.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []nbf.Event
+	r.Diagnostics = &nbf.Diagnostics{Handler: func(e nbf.Event) { events = append(events, e) }}
+	if _, err := r.Inbox(); err != nil {
+		t.Fatal(err)
+	}
+	d := r.Diagnostics
+	if d.Count(nbf.EntrySkipped) != 1 || d.Count(nbf.ChecksumMismatch) != 1 || len(events) != 2 {
+		t.Errorf("got counts %v, events %v", d.Counts(), events)
+	}
+	// Cached entries report their events again.
+	d.Reset()
+	r.Inbox()
+	if d.Count(nbf.EntrySkipped) != 1 || d.Count(nbf.ChecksumMismatch) != 1 {
+		t.Errorf("got counts %v after second scan", d.Counts())
+	}
+}
+
+func TestLogger(t *testing.T) {
+	r, err := testArchive.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Inbox() // fill the cache
+	var buf bytes.Buffer
+	r.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if _, err := r.Inbox(); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "msg=\"decoding entry\""); n != 4 {
+		t.Errorf("got %d decoding traces:\n%s", n, buf.String())
+	}
+	if !strings.Contains(buf.String(), "pdu=nbf.Deliver") {
+		t.Errorf("missing PDU type in traces:\n%s", buf.String())
+	}
+}
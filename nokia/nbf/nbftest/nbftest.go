@@ -0,0 +1,319 @@
+// Package nbftest builds synthetic NBF archives for tests.
+//
+// Archives are described declaratively by an Archive value
+// and generated in memory, so that tests do not depend on
+// real (personal) backups.
+package nbftest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+// An Archive describes the contents of a NBF archive.
+type Archive struct {
+	Messages []Message
+	MMS      []MMS
+	Reports  []nbf.Report      // status reports, stored in the inbox
+	Read     []ReadReport      // MMS read reports, stored in the inbox
+	Folders  []int             // folders having a directory entry
+	Files    map[string][]byte // other entries (contacts/1.vcf, ...)
+}
+
+// A Message is a text message, stored in the inbox if
+// it is received and in the outbox if it is sent.
+type Message struct {
+	Sent bool
+	Peer string    // sender or recipient number
+	Name string    // contact name of the peer
+	When time.Time // defaults to Epoch
+	Text string
+
+	// Parts, if not nil, stores the message as a concatenated
+	// message made of these parts; Text is then ignored.
+	Parts []string
+
+	Port int    // application port, for binary messages
+	Data []byte // 8-bit payload
+
+	MR int // message reference of sent messages
+
+	// Folder, if not zero, is the folder of the message instead
+	// of the inbox or outbox.
+	Folder int
+}
+
+// An MMS is a multimedia message made of several parts,
+// stored in the inbox if it is received and in the outbox
+// if it is sent.
+type MMS struct {
+	Sent      bool
+	Peer      string
+	When      time.Time
+	MessageID string
+	Parts     []Part
+}
+
+// A ReadReport tells the sender of a MMS that it was read
+// (or deleted unread) by Peer.
+type ReadReport struct {
+	MessageID string
+	Peer      string
+	When      time.Time
+	Deleted   bool
+}
+
+type Part struct {
+	ContentType string // text/plain, image/jpeg...
+	Name        string
+	Data        []byte
+}
+
+// Epoch is the default timestamp of messages.
+var Epoch = time.Date(2010, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// Bytes returns the zip-encoded archive.
+func (a Archive) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	seq := uint32(0)
+	create := func(folder int, info nbf.MessageInfo, body []byte) error {
+		seq++
+		info.Seq = seq
+		info.Reserved = 0x00500000
+		name := fmt.Sprintf("predefmessages/%d/%s", folder, info.Filename())
+		w, err := z.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(body)
+		return err
+	}
+
+	for i, m := range a.Messages {
+		when := m.When
+		if when.IsZero() {
+			when = Epoch
+		}
+		sms := nbf.SMS{Peer: m.Peer, When: when, Port: m.Port, Data: m.Data}
+		folder := 1
+		if m.Sent {
+			folder = 3
+			sms.Type = 1
+			sms.Peer = m.Name
+			if m.Name == "" {
+				sms.Peer = m.Peer
+			}
+			sms.Peers = []string{fmt.Sprintf("%s <%s>", m.Peer, m.Name)}
+			sms.MR = []int{m.MR}
+		}
+		if m.Folder != 0 {
+			folder = m.Folder
+		}
+		info := nbf.MessageInfo{
+			Timestamp:    nbf.DosStamp(when),
+			MultipartSeq: uint16(i),
+			Flags:        nbf.FLAGS_SMS | 0x10,
+			Peer:         m.Peer,
+		}
+		if m.Parts == nil {
+			sms.Text = m.Text
+			body, err := nbf.EncodeSMS(sms)
+			if err != nil {
+				return nil, fmt.Errorf("message %d: %s", i, err)
+			}
+			if err := create(folder, info, body); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for j, text := range m.Parts {
+			sms.Text = text
+			body, err := nbf.EncodePart(sms, i&0xff, j+1, len(m.Parts))
+			if err != nil {
+				return nil, fmt.Errorf("message %d, part %d: %s", i, j+1, err)
+			}
+			info.PartNo, info.PartTotal = uint8(j+1), uint8(len(m.Parts))
+			if err := create(folder, info, body); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i, m := range a.MMS {
+		when := m.When
+		if when.IsZero() {
+			when = Epoch
+		}
+		info := nbf.MessageInfo{
+			Timestamp: nbf.DosStamp(when),
+			Flags:     nbf.FLAGS_MMS | 0x10,
+			Peer:      m.Peer,
+		}
+		folder := 1
+		if m.Sent {
+			folder = 3
+		}
+		if err := create(folder, info, encodeMMS(m)); err != nil {
+			return nil, fmt.Errorf("MMS %d: %s", i, err)
+		}
+	}
+
+	for i, r := range a.Read {
+		when := r.When
+		if when.IsZero() {
+			when = Epoch
+		}
+		info := nbf.MessageInfo{
+			Timestamp: nbf.DosStamp(when),
+			Flags:     nbf.FLAGS_MMS | 0x10,
+			Peer:      r.Peer,
+		}
+		if err := create(1, info, encodeReadReport(r, when)); err != nil {
+			return nil, fmt.Errorf("read report %d: %s", i, err)
+		}
+	}
+
+	for _, r := range a.Reports {
+		info := nbf.MessageInfo{
+			Timestamp: nbf.DosStamp(r.Discharge),
+			Flags:     nbf.FLAGS_SMS | 0x10,
+			Peer:      r.RecipAddr,
+		}
+		if err := create(1, info, nbf.EncodeReport(r)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, id := range a.Folders {
+		if _, err := z.Create(fmt.Sprintf("predefmessages/%d/", id)); err != nil {
+			return nil, err
+		}
+	}
+
+	var names []string
+	for name := range a.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data := a.Files[name]
+		w, err := z.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := z.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Open returns a Reader for the archive.
+func (a Archive) Open() (*nbf.Reader, error) {
+	data, err := a.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return nbf.NewReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// Well-known content types of WAP-230-WSP, table 40.
+var contentTypes = map[string]byte{
+	"text/plain": 0x03,
+	"image/gif":  0x1d,
+	"image/jpeg": 0x1e,
+	"image/png":  0x20,
+}
+
+// encodeMMS returns the body of an archive entry holding an
+// m-retrieve-conf PDU (OMA-MMS-ENC) with a multipart body, or
+// a m-send-req PDU for sent messages.
+func encodeMMS(m MMS) []byte {
+	body := make([]byte, 0xb0)
+	var pdu []byte
+	if m.Sent {
+		pdu = []byte{
+			0x8c, 0x80, // X-Mms-Message-Type: m-send-req
+			0x8d, 0x90, // X-Mms-MMS-Version: 1.0
+		}
+		pdu = append(pdu, 0x97) // To
+		pdu = append(pdu, m.Peer+"/TYPE=PLMN\x00"...)
+	} else {
+		pdu = []byte{
+			0x8c, 0x84, // X-Mms-Message-Type: m-retrieve-conf
+			0x8d, 0x90, // X-Mms-MMS-Version: 1.0
+		}
+		pdu = append(pdu, encodeFrom(m.Peer)...)
+	}
+	if m.MessageID != "" {
+		pdu = append(pdu, 0x8b) // Message-ID
+		pdu = append(pdu, m.MessageID+"\x00"...)
+	}
+	pdu = append(pdu, 0x84, 0xa3) // Content-Type: multipart/mixed
+	pdu = append(pdu, uintvar(len(m.Parts))...)
+	for _, p := range m.Parts {
+		var hdr []byte
+		if code, ok := contentTypes[p.ContentType]; ok {
+			hdr = append(hdr, code|0x80)
+		} else {
+			hdr = append(hdr, p.ContentType+"\x00"...)
+		}
+		if p.Name != "" {
+			hdr = append(hdr, 0x8e) // Content-Location
+			hdr = append(hdr, p.Name+"\x00"...)
+		}
+		pdu = append(pdu, uintvar(len(hdr))...)
+		pdu = append(pdu, uintvar(len(p.Data))...)
+		pdu = append(pdu, hdr...)
+		pdu = append(pdu, p.Data...)
+	}
+	return append(body, pdu...)
+}
+
+// encodeReadReport returns the body of an archive entry holding
+// a m-read-orig-ind PDU.
+func encodeReadReport(r ReadReport, when time.Time) []byte {
+	body := make([]byte, 0xb0)
+	pdu := []byte{
+		0x8c, 0x88, // X-Mms-Message-Type: m-read-orig-ind
+		0x8d, 0x91, // X-Mms-MMS-Version: 1.1
+	}
+	if r.MessageID != "" {
+		pdu = append(pdu, 0x8b) // Message-ID
+		pdu = append(pdu, r.MessageID+"\x00"...)
+	}
+	pdu = append(pdu, encodeFrom(r.Peer+"/TYPE=PLMN")...)
+	date := binary.BigEndian.AppendUint32(nil, uint32(when.Unix()))
+	pdu = append(pdu, 0x85, byte(len(date))) // Date
+	pdu = append(pdu, date...)
+	status := byte(0x80) // Read
+	if r.Deleted {
+		status = 0x81 // Deleted without being read
+	}
+	pdu = append(pdu, 0x9b, status) // X-Mms-Read-Status
+	return append(body, pdu...)
+}
+
+// encodeFrom returns a From header for addr.
+func encodeFrom(addr string) []byte {
+	from := append([]byte{0x80}, addr+"\x00"...) // Address-present-token
+	return append([]byte{0x89, byte(len(from))}, from...)
+}
+
+func uintvar(n int) []byte {
+	b := []byte{byte(n & 0x7f)}
+	for n >>= 7; n > 0; n >>= 7 {
+		b = append([]byte{byte(n&0x7f) | 0x80}, b...)
+	}
+	return b
+}
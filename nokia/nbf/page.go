@@ -0,0 +1,137 @@
+package nbf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// A Page selects a range of a list of messages, for user
+// interfaces showing large collections.
+type Page struct {
+	// Cursor, if not empty, is the cursor returned for the
+	// previous page: the page starts after the last item
+	// of the previous page.
+	Cursor string
+	Offset int // items skipped, after Cursor
+	Limit  int // maximal number of items, 0 for no limit
+}
+
+// ErrCursor is returned for cursors matching no item.
+var ErrCursor = errors.New("nbf: invalid page cursor")
+
+// A cursor is the position and identifier of the last item of a
+// page. The identifier locates the item if the list changed.
+func makeCursor(pos int, id string) string { return fmt.Sprintf("%d.%s", pos, id) }
+
+func parseCursor(c string) (pos int, id string, err error) {
+	i := strings.IndexByte(c, '.')
+	if i < 0 {
+		return 0, "", ErrCursor
+	}
+	pos, err = strconv.Atoi(c[:i])
+	if err != nil || pos < 0 {
+		return 0, "", ErrCursor
+	}
+	return pos, c[i+1:], nil
+}
+
+// Paginate returns the items of page p. The identifiers returned
+// by id are used in cursors and should be stable, for example
+// SMS.ID for messages. The returned cursor selects the next page,
+// it is empty after the last page.
+func Paginate[T any](items []T, p Page, id func(T) string) (page []T, next string, err error) {
+	start := 0
+	if p.Cursor != "" {
+		pos, cid, err := parseCursor(p.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if pos >= len(items) || id(items[pos]) != cid {
+			pos = -1
+			for i, it := range items {
+				if id(it) == cid {
+					pos = i
+					break
+				}
+			}
+			if pos < 0 {
+				return nil, "", ErrCursor
+			}
+		}
+		start = pos + 1
+	}
+	if p.Offset >= len(items)-start {
+		return nil, "", nil
+	}
+	start += p.Offset
+	end := len(items)
+	if p.Limit > 0 && p.Limit < end-start {
+		end = start + p.Limit
+	}
+	if end < len(items) {
+		next = makeCursor(end-1, id(items[end-1]))
+	}
+	return items[start:end], next, nil
+}
+
+// MessagesPage returns page p of the messages returned by
+// Messages, and the cursor of the next page. It stops decoding
+// the archive at the end of the page. Cursors remain valid as long
+// as the archive and the options of r are unchanged.
+// Undecodable entries are handled as by Walk.
+func (r *Reader) MessagesPage(p Page) (msgs []SMS, next string, err error) {
+	return r.MessagesPageContext(context.Background(), p, nil)
+}
+
+// MessagesPageContext is like MessagesPage, but stops when ctx
+// is done, returning the error of ctx. If keep is not nil, only
+// the messages it selects are paginated, and cursors are valid
+// for the same filter.
+func (r *Reader) MessagesPageContext(ctx context.Context, p Page, keep Filter) (msgs []SMS, next string, err error) {
+	pos, cid := -1, ""
+	if p.Cursor != "" {
+		if pos, cid, err = parseCursor(p.Cursor); err != nil {
+			return nil, "", err
+		}
+	}
+	skip := p.Offset
+	i := -1
+	for m, err := range r.MessagesContext(ctx) {
+		if err != nil {
+			if r.fatal(err) {
+				return nil, "", err
+			}
+			log.Print(err)
+			continue
+		}
+		if !keep.Match(m) {
+			continue
+		}
+		i++
+		switch {
+		case i < pos:
+			continue
+		case i == pos:
+			if m.ID() != cid {
+				return nil, "", ErrCursor
+			}
+			continue
+		case skip > 0:
+			skip--
+			continue
+		}
+		if p.Limit > 0 && len(msgs) == p.Limit {
+			last := msgs[len(msgs)-1]
+			return msgs, makeCursor(i-1, last.ID()), nil
+		}
+		msgs = append(msgs, m)
+	}
+	if i < pos {
+		return nil, "", ErrCursor
+	}
+	return msgs, "", nil
+}
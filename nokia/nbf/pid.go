@@ -0,0 +1,48 @@
+package nbf
+
+// A PID is the protocol identifier of a message
+// (GSM 03.40 section 9.2.3.9).
+type PID byte
+
+// Protocol identifiers. Telematic interworking identifiers
+// are PIDTelematic plus the type of device.
+const (
+	PIDDefault   PID = 0x00
+	PIDTelematic PID = 0x20
+
+	PIDTelex     PID = 0x21
+	PIDFaxGroup3 PID = 0x22
+	PIDFaxGroup4 PID = 0x23
+	PIDVoice     PID = 0x24
+	PIDERMES     PID = 0x25
+	PIDPaging    PID = 0x26
+	PIDVideotex  PID = 0x27
+	PIDTeletex   PID = 0x28
+	PIDX400      PID = 0x31
+	PIDEmail     PID = 0x32
+
+	PIDType0           PID = 0x40 // silent message, discarded by the phone
+	PIDReplaceType1    PID = 0x41 // up to PIDReplaceType7
+	PIDReplaceType7    PID = 0x47
+	PIDReturnCall      PID = 0x5f
+	PIDMEDownload      PID = 0x7d // ME data download
+	PIDMEDepersonalize PID = 0x7e // ME de-personalization
+	PIDSIMDownload     PID = 0x7f // SIM data download
+)
+
+// Telematic reports whether p designates telematic interworking.
+func (p PID) Telematic() bool { return p&0xe0 == PIDTelematic }
+
+// IsText reports whether messages with identifier p are meant
+// to be shown to the user, as opposed to silent messages and
+// data for the phone, its SIM card or telematic devices other
+// than e-mail.
+func (p PID) IsText() bool {
+	switch {
+	case p == PIDDefault, p == PIDEmail, p == PIDReturnCall:
+		return true
+	case p >= PIDReplaceType1 && p <= PIDReplaceType7:
+		return true
+	}
+	return false
+}
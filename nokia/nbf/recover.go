@@ -0,0 +1,200 @@
+package nbf
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// Recovery of damaged archives.
+//
+// Files pulled off dying memory cards often lose the central
+// directory at the end of the zip file. Their entries can still
+// be found by scanning for local file headers, which precede
+// the data of each entry.
+
+var (
+	sigLocalHeader = []byte("PK\x03\x04")
+	sigDescriptor  = []byte("PK\x07\x08")
+)
+
+// RecoverFile opens a NBF archive whose central directory is
+// damaged, see Recover.
+func RecoverFile(filename string) (*Reader, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r, err := Recover(f, st.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.c = f
+	return r, nil
+}
+
+// Recover returns a Reader for the entries of a damaged archive,
+// found by scanning r for local file headers instead of reading
+// the central directory. Truncated entries are dropped; corrupt
+// entries are reported as errors when decoded. The compressed
+// entries are copied in memory.
+func Recover(r io.ReaderAt, size int64) (*Reader, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	seen := make(map[string]bool)
+	count := 0
+	for off := int64(0); off < size; {
+		off = indexAt(r, off, size, sigLocalHeader)
+		if off < 0 {
+			break
+		}
+		hdr, data, end, ok := readLocalEntry(r, off, size)
+		if !ok {
+			off += int64(len(sigLocalHeader))
+			continue
+		}
+		off = end
+		if seen[hdr.Name] {
+			continue
+		}
+		seen[hdr.Name] = true
+		w, err := zw.CreateRaw(hdr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(w, io.NewSectionReader(r, data, int64(hdr.CompressedSize64))); err != nil {
+			return nil, err
+		}
+		count++
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, errors.New("nbf: no entries found in damaged archive")
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{z: z}, nil
+}
+
+// readLocalEntry parses the local file header at off, returning
+// the header of the entry, the offset of its data and the offset
+// following the entry.
+func readLocalEntry(r io.ReaderAt, off, size int64) (hdr *zip.FileHeader, data, end int64, ok bool) {
+	var b [30]byte
+	if _, err := r.ReadAt(b[:], off); err != nil {
+		return nil, 0, 0, false
+	}
+	le := binary.LittleEndian
+	flags := le.Uint16(b[6:])
+	hdr = &zip.FileHeader{
+		Flags:              flags &^ flagDescriptor,
+		Method:             le.Uint16(b[8:]),
+		ModifiedTime:       le.Uint16(b[10:]),
+		ModifiedDate:       le.Uint16(b[12:]),
+		CRC32:              le.Uint32(b[14:]),
+		CompressedSize64:   uint64(le.Uint32(b[18:])),
+		UncompressedSize64: uint64(le.Uint32(b[22:])),
+	}
+	nameLen, extraLen := int64(le.Uint16(b[26:])), int64(le.Uint16(b[28:]))
+	name := make([]byte, nameLen+extraLen)
+	if _, err := r.ReadAt(name, off+30); err != nil {
+		return nil, 0, 0, false
+	}
+	hdr.Name = string(name[:nameLen])
+	if hdr.Name == "" {
+		return nil, 0, 0, false
+	}
+	extra := name[nameLen:]
+	if z64 := findExtra(extra, 0x0001); len(z64) >= 16 {
+		hdr.UncompressedSize64 = le.Uint64(z64)
+		hdr.CompressedSize64 = le.Uint64(z64[8:])
+	}
+	hdr.Extra = removeExtra(extra, 0x0001) // written again if needed
+	data = off + 30 + nameLen + extraLen
+
+	if flags&flagDescriptor != 0 {
+		// Sizes follow the data: find a data descriptor
+		// matching the distance from the data.
+		for d := data; ; d += int64(len(sigDescriptor)) {
+			d = indexAt(r, d, size, sigDescriptor)
+			if d < 0 {
+				return nil, 0, 0, false
+			}
+			var desc [24]byte
+			n, _ := r.ReadAt(desc[:], d)
+			if n < 16 {
+				return nil, 0, 0, false
+			}
+			hdr.CRC32 = le.Uint32(desc[4:])
+			if csize := int64(le.Uint32(desc[8:])); csize == d-data {
+				hdr.CompressedSize64 = uint64(csize)
+				hdr.UncompressedSize64 = uint64(le.Uint32(desc[12:]))
+				return hdr, data, d + 16, true
+			}
+			// Zip64 descriptors have 8-byte sizes.
+			if csize := int64(le.Uint64(desc[8:])); n == 24 && csize == d-data {
+				hdr.CompressedSize64 = uint64(csize)
+				hdr.UncompressedSize64 = le.Uint64(desc[16:])
+				return hdr, data, d + 24, true
+			}
+		}
+	}
+	end = data + int64(hdr.CompressedSize64)
+	if end > size {
+		return nil, 0, 0, false
+	}
+	return hdr, data, end, true
+}
+
+// removeExtra returns extra without fields of the given id.
+func removeExtra(extra []byte, id uint16) []byte {
+	var out []byte
+	for len(extra) >= 4 {
+		size := 4 + int(binary.LittleEndian.Uint16(extra[2:]))
+		if size > len(extra) {
+			break
+		}
+		if binary.LittleEndian.Uint16(extra) != id {
+			out = append(out, extra[:size]...)
+		}
+		extra = extra[size:]
+	}
+	return out
+}
+
+// indexAt returns the offset of the first occurrence of sig
+// in r at or after off, or -1.
+func indexAt(r io.ReaderAt, off, size int64, sig []byte) int64 {
+	// Signatures are usually close: read small chunks first.
+	buf := make([]byte, 4<<10)
+	for off < size {
+		n, err := r.ReadAt(buf, off)
+		if n < len(sig) {
+			return -1
+		}
+		if i := bytes.Index(buf[:n], sig); i >= 0 {
+			return off + int64(i)
+		}
+		if err != nil {
+			return -1
+		}
+		off += int64(n - len(sig) + 1)
+		if len(buf) < 1<<20 {
+			buf = make([]byte, 2*len(buf))
+		}
+	}
+	return -1
+}
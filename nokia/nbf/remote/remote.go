@@ -0,0 +1,197 @@
+// Package remote reads files served over HTTP with range requests,
+// so that archives stored remotely can be listed and partially
+// decoded without downloading them entirely:
+//
+//	f, err := remote.Open("https://example.com/backup.nbf")
+//	...
+//	r, err := nbf.NewReader(f, f.Size())
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNoRange is returned for servers not supporting range requests.
+var ErrNoRange = errors.New("remote: server does not support range requests")
+
+// Default cache parameters.
+const (
+	DefaultBlockSize = 64 << 10
+	DefaultMaxBlocks = 256
+)
+
+// A File is a remote file implementing io.ReaderAt. Data is read
+// by blocks, which are cached; reads of missing consecutive blocks
+// are merged in a single request. It is safe for concurrent use.
+type File struct {
+	url    string
+	client *http.Client
+	size   int64
+
+	// BlockSize is the unit of reads and caching, and MaxBlocks
+	// the number of cached blocks. They must not be changed
+	// after the first read.
+	BlockSize int64
+	MaxBlocks int
+
+	mu       sync.Mutex
+	blocks   map[int64][]byte // by block index
+	lru      []int64          // block indexes, least recently used first
+	requests int
+}
+
+// Open returns the file at url, using http.DefaultClient.
+func Open(url string) (*File, error) {
+	return OpenClient(http.DefaultClient, url)
+}
+
+// OpenClient returns the file at url, using client for requests.
+func OpenClient(client *http.Client, url string) (*File, error) {
+	f := &File{url: url, client: client,
+		BlockSize: DefaultBlockSize, MaxBlocks: DefaultMaxBlocks,
+		blocks: make(map[int64][]byte)}
+	// Read the first byte, to check support of ranges and find
+	// the size in Content-Range.
+	resp, err := f.get(0, 1)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	cr := resp.Header.Get("Content-Range")
+	i := strings.LastIndexByte(cr, '/')
+	if i < 0 {
+		return nil, fmt.Errorf("remote: invalid Content-Range %q", cr)
+	}
+	if f.size, err = strconv.ParseInt(cr[i+1:], 10, 64); err != nil {
+		return nil, fmt.Errorf("remote: invalid Content-Range %q", cr)
+	}
+	return f, nil
+}
+
+// Size returns the size of the file.
+func (f *File) Size() int64 { return f.size }
+
+// Requests returns the number of HTTP requests made so far.
+func (f *File) Requests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+// get requests n bytes at offset off.
+func (f *File) get(off, n int64) (*http.Response, error) {
+	req, err := http.NewRequest("GET", f.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+n-1))
+	f.requests++
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp, nil
+	case http.StatusOK:
+		resp.Body.Close()
+		return nil, ErrNoRange
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("remote: %s: %s", f.url, resp.Status)
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("remote: negative offset")
+	}
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > f.size {
+		end = f.size
+		err = io.EOF
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	first, last := off/f.BlockSize, (end-1)/f.BlockSize
+	if ferr := f.fetch(first, last); ferr != nil {
+		return 0, ferr
+	}
+	for b := first; b <= last; b++ {
+		data := f.blocks[b]
+		f.touch(b)
+		start := int64(0)
+		if b == first {
+			start = off - b*f.BlockSize
+		}
+		n += copy(p[n:], data[start:])
+	}
+	return n, err
+}
+
+// fetch reads the missing blocks between first and last.
+func (f *File) fetch(first, last int64) error {
+	for b := first; b <= last; b++ {
+		if f.blocks[b] != nil {
+			continue
+		}
+		// Merge consecutive missing blocks.
+		e := b
+		for e < last && f.blocks[e+1] == nil {
+			e++
+		}
+		off := b * f.BlockSize
+		size := (e+1)*f.BlockSize - off
+		if off+size > f.size {
+			size = f.size - off
+		}
+		resp, err := f.get(off, size)
+		if err != nil {
+			return err
+		}
+		data := make([]byte, size)
+		_, err = io.ReadFull(resp.Body, data)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for i := b; i <= e; i++ {
+			j := (i - b) * f.BlockSize
+			f.blocks[i] = data[j:min(j+f.BlockSize, size)]
+			f.touch(i)
+		}
+		b = e
+	}
+	f.evict(last - first + 1)
+	return nil
+}
+
+// touch marks block b as recently used.
+func (f *File) touch(b int64) {
+	for i, x := range f.lru {
+		if x == b {
+			f.lru = append(f.lru[:i], f.lru[i+1:]...)
+			break
+		}
+	}
+	f.lru = append(f.lru, b)
+}
+
+// evict drops least recently used blocks, keeping at least
+// the keep most recent ones.
+func (f *File) evict(keep int64) {
+	n := max(f.MaxBlocks, int(keep))
+	for len(f.lru) > n {
+		delete(f.blocks, f.lru[0])
+		f.lru = f.lru[1:]
+	}
+}
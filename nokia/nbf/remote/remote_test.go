@@ -0,0 +1,89 @@
+package remote
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/nbf/nbftest"
+)
+
+func TestReadAt(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeContent(w, req, "f", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	f, err := Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.BlockSize, f.MaxBlocks = 100, 3
+	if f.Size() != int64(len(data)) {
+		t.Fatalf("got size %d", f.Size())
+	}
+	for _, tt := range []struct {
+		off, n   int64
+		requests int // total, including Open
+	}{
+		{150, 100, 2}, // blocks 1-2 in one request
+		{120, 200, 3}, // block 3
+		{10, 10, 4},   // block 0, evicting 1
+		{990, 20, 5},  // block 9, evicting 2, short read
+		{300, 100, 5}, // cached
+		{100, 100, 6}, // block 1 again
+		{1000, 10, 6}, // EOF
+		{0, 1000, 9},  // blocks 0, 2, 4-8
+	} {
+		p := make([]byte, tt.n)
+		n, err := f.ReadAt(p, tt.off)
+		want := data[min(tt.off, 1000):min(tt.off+tt.n, 1000)]
+		if !bytes.Equal(p[:n], want) || (err == io.EOF) != (tt.off+tt.n > 1000) {
+			t.Errorf("ReadAt at %d, %d bytes: got %d bytes, %v", tt.off, tt.n, n, err)
+		}
+		if r := f.Requests(); r != tt.requests {
+			t.Errorf("ReadAt at %d, %d bytes: %d requests, expected %d", tt.off, tt.n, r, tt.requests)
+		}
+	}
+}
+
+func TestArchive(t *testing.T) {
+	data, err := nbftest.Archive{Messages: []nbftest.Message{
+		{Peer: "+33612345678", Text: "Hello"},
+	}}.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeContent(w, req, "backup.nbf", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+	f, err := Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := nbf.NewReader(f, f.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox, err := r.Inbox()
+	if err != nil || len(inbox) != 1 || inbox[0].Text != "Hello" {
+		t.Errorf("got %v, %v", inbox, err)
+	}
+
+	noRange := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(data)
+	}))
+	defer noRange.Close()
+	if _, err := Open(noRange.URL); err != ErrNoRange {
+		t.Errorf("got error %v, expected ErrNoRange", err)
+	}
+}
@@ -0,0 +1,333 @@
+package nbf
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/mms"
+)
+
+// Delivery reports.
+//
+// Sent messages requesting a status report (TP-SRR) are followed
+// by SMS-STATUS-REPORT entries in the inbox, which phones show as
+// delivery notices. Reports only identify the message by its
+// reference number (TP-MR), which wraps after 256 messages, its
+// recipient and the time it reached the SMS center: they are
+// matched to the closest sent message with the same reference
+// and recipient.
+
+// A Report is a SMS-STATUS-REPORT PDU (GSM 03.40 section 9.2.2.3),
+// telling the sender of a message whether it was delivered.
+// Optional parameters following TP-ST are not decoded.
+type Report struct {
+	MsgType   byte      // TP-MTI, 2
+	MoreMsg   bool      // TP-MMS: more messages are waiting (true encoded as zero)
+	Qualifier bool      // TP-SRQ: report of a SMS-COMMAND
+	RefID     byte      // TP-MR of the reported message
+	RecipAddr string    // TP-RA
+	RecipTOA  TOA       // type of RecipAddr
+	SMSCStamp time.Time // TP-SCTS: time the SMS center received the message
+	Discharge time.Time // TP-DT: time of delivery, or of the last attempt
+	Status    byte      // TP-ST
+}
+
+// Text returns the empty string: reports have no text.
+func (msg Report) Text() string { return "" }
+
+// String returns a one-line summary of msg.
+func (msg Report) String() string {
+	return fmt.Sprintf("SMS-STATUS-REPORT for %s (MR %d) at %s: %s", msg.RecipAddr,
+		msg.RefID, msg.Discharge.Format(time.DateTime), msg.Delivery())
+}
+
+// Delivery returns the delivery status given by TP-ST.
+func (msg Report) Delivery() DeliveryStatus {
+	switch {
+	case msg.Status < 0x20:
+		// Received, forwarded or replaced.
+		return Delivered
+	case msg.Status < 0x40:
+		// Temporary error, the SMS center is still trying.
+		return DeliveryPending
+	}
+	// Permanent errors, temporary errors given up and
+	// reserved values.
+	return DeliveryFailed
+}
+
+func parseReport(s []byte) (msg Report, size int, err error) {
+	p := s
+	if len(p) < 4 || len(p) < 4+(int(p[2])+1)/2 {
+		return msg, 0, fmt.Errorf("%w: SMS-STATUS-REPORT address", ErrTruncated)
+	}
+	msg.MsgType = p[0] & 3         // TP-MTI
+	msg.MoreMsg = p[0]&4 == 0      // TP-MMS
+	msg.Qualifier = p[0]&0x20 != 0 // TP-SRQ
+	msg.RefID = p[1]
+	addrLen := int(p[2])
+	msg.RecipAddr, msg.RecipTOA, err = parseAddress(p[2 : 4+(addrLen+1)/2])
+	if err != nil {
+		return
+	}
+	size += 4 + (addrLen+1)/2
+	p = s[size:]
+	if len(p) < 7+7+1 {
+		return msg, size, fmt.Errorf("%w: SMS-STATUS-REPORT header", ErrTruncated)
+	}
+	if msg.SMSCStamp, err = parseDateTime(p[:7]); err != nil {
+		return
+	}
+	if msg.Discharge, err = parseDateTime(p[7:14]); err != nil {
+		return
+	}
+	msg.Status = p[14]
+	size += 7 + 7 + 1
+	return
+}
+
+// A DeliveryStatus is the outcome of a sent message, according
+// to its status reports.
+type DeliveryStatus int
+
+const (
+	NoReport        DeliveryStatus = iota // no status report was found
+	DeliveryPending                       // delivery is still attempted
+	Delivered
+	DeliveryFailed
+)
+
+func (s DeliveryStatus) String() string {
+	switch s {
+	case NoReport:
+		return "no report"
+	case DeliveryPending:
+		return "pending"
+	case Delivered:
+		return "delivered"
+	case DeliveryFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("DeliveryStatus(%d)", int(s))
+}
+
+// reportWindow is the largest difference between the time
+// of a sent message and the SMS center time stamp of its report.
+// Phone clocks may be off by hours, or use another time zone.
+const reportWindow = 24 * time.Hour
+
+// Reports returns the status reports of the inbox.
+func (r *Reader) Reports() ([]Report, error) {
+	return r.ReportsContext(context.Background())
+}
+
+// ReportsContext is like Reports, but stops when ctx is done.
+func (r *Reader) ReportsContext(ctx context.Context) ([]Report, error) {
+	if err := r.checkStore(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := r.decodeAll(ctx, func(f *zip.File) bool {
+		return !f.Mode().IsDir() && strings.HasPrefix(f.Name, "predefmessages/1/")
+	})
+	var reports []Report
+	for c := range results {
+		var d decoded
+		select {
+		case d = <-c:
+		case <-ctx.Done():
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if d.report != nil {
+			reports = append(reports, *d.report)
+		}
+	}
+	return reports, nil
+}
+
+// CorrelateReports sets the delivery status of sent messages of
+// msgs from the matching reports. Each report is matched to the
+// sent message with the same reference number (SMS.MR) and
+// recipient whose time is closest to the SMS center time stamp
+// of the report. Concatenated messages are delivered when
+// reports for all their parts say so.
+func CorrelateReports(msgs []SMS, reports []Report) {
+	type candidate struct {
+		ref  int
+		peer string
+	}
+	sent := make(map[candidate][]int)
+	for i, m := range msgs {
+		if m.Direction != Sent {
+			continue
+		}
+		peer := m.Peer
+		if len(m.Peers) > 0 {
+			peer, _ = splitPeer(m.Peers[0])
+		}
+		for _, ref := range m.MR {
+			c := candidate{ref, numberKey(peer)}
+			sent[c] = append(sent[c], i)
+		}
+	}
+	matched := make(map[int][]Report)
+	for _, rep := range reports {
+		best, bestDist := -1, reportWindow
+		for _, i := range sent[candidate{int(rep.RefID), numberKey(rep.RecipAddr)}] {
+			dist := rep.SMSCStamp.Sub(msgs[i].When).Abs()
+			if dist <= bestDist {
+				best, bestDist = i, dist
+			}
+		}
+		if best >= 0 {
+			matched[best] = append(matched[best], rep)
+		}
+	}
+	for i, reps := range matched {
+		m := &msgs[i]
+		delivered := 0
+		m.DeliveryStatus = DeliveryPending
+		for _, rep := range reps {
+			switch rep.Delivery() {
+			case Delivered:
+				delivered++
+				if rep.Discharge.After(m.DeliveredAt) {
+					m.DeliveredAt = rep.Discharge
+				}
+			case DeliveryFailed:
+				m.DeliveryStatus = DeliveryFailed
+			}
+		}
+		switch {
+		case m.DeliveryStatus == DeliveryFailed:
+			m.DeliveredAt = time.Time{}
+		case delivered >= len(m.MR):
+			m.DeliveryStatus = Delivered
+		default:
+			m.DeliveredAt = time.Time{}
+		}
+	}
+}
+
+// MMS read reports.
+//
+// Senders of multimedia messages may ask to be told when they are
+// read. Read reports identify the message by its Message-ID, which
+// phones do not always keep with sent messages: they are then
+// matched to the last message sent to the reader before the report.
+
+// A ReadStatus tells whether a multimedia message was read.
+type ReadStatus int
+
+const (
+	NoReadReport  ReadStatus = iota // no read report was found
+	Read                            // the message was read
+	DeletedUnread                   // the message was deleted without being read
+)
+
+func (s ReadStatus) String() string {
+	switch s {
+	case NoReadReport:
+		return "no report"
+	case Read:
+		return "read"
+	case DeletedUnread:
+		return "deleted unread"
+	}
+	return fmt.Sprintf("ReadStatus(%d)", int(s))
+}
+
+// A ReadReport is a MMS read report: a m-read-orig-ind PDU received
+// by the sender of a message, or a m-read-rec-ind PDU sent by its
+// recipient (OMA-MMS-ENC section 6.7).
+type ReadReport struct {
+	NBFFile   string
+	Stamp     time.Time // of the entry name
+	Direction Direction // Received for m-read-orig-ind, Sent for m-read-rec-ind
+	MessageID string    // of the reported message
+	Peer      string    // reader of a sent message, or sender of a read message
+	Date      time.Time // time of the report, or Stamp if unknown
+	Status    ReadStatus
+}
+
+// parseReadReport returns the read report of entry base,
+// holding m.
+func parseReadReport(base string, stamp time.Time, m mms.MMS) ReadReport {
+	rep := ReadReport{
+		NBFFile:   base,
+		Stamp:     stamp,
+		Direction: Received,
+		MessageID: m.Header["Message-ID"],
+		Peer:      mmsAddress(m.Header["From"]),
+		Date:      stamp,
+		Status:    Read,
+	}
+	if m.MessageType() == mms.MReadRecInd {
+		rep.Direction, rep.Peer = Sent, mmsAddress(m.Header["To"])
+	}
+	if t, err := time.Parse(time.RFC1123Z, m.Header["Date"]); err == nil {
+		rep.Date = t
+	}
+	if m.Header["Read-Status"] == strconv.Itoa(mms.StatusDeletedUnread) {
+		rep.Status = DeletedUnread
+	}
+	return rep
+}
+
+// mmsAddress strips the type suffix of MMS addresses,
+// as in +33612345678/TYPE=PLMN.
+func mmsAddress(addr string) string {
+	if i := strings.Index(addr, "/TYPE="); i >= 0 {
+		return addr[:i]
+	}
+	return addr
+}
+
+// CorrelateReadReports sets the read status of sent messages of
+// msgs from the matching received reports. A report is matched to
+// the sent message with the same Message-ID or, if there is none,
+// to the last message sent to its reader before the report.
+func CorrelateReadReports(msgs []MMS, reports []ReadReport) {
+	for _, rep := range reports {
+		if rep.Direction != Received {
+			continue
+		}
+		best := -1
+		for i, m := range msgs {
+			if m.Direction != Sent {
+				continue
+			}
+			if rep.MessageID != "" && m.Header["Message-ID"] == rep.MessageID {
+				best = i
+				break
+			}
+			to := mmsAddress(m.Header["To"])
+			if to == "" {
+				to = m.Peer
+			}
+			if numberKey(to) != numberKey(rep.Peer) || m.Stamp.After(rep.Date) {
+				continue
+			}
+			if best < 0 || m.Stamp.After(msgs[best].Stamp) {
+				best = i
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		m := &msgs[best]
+		switch {
+		case rep.Status == Read && (m.ReadStatus != Read || rep.Date.Before(m.ReadAt)):
+			m.ReadStatus, m.ReadAt = Read, rep.Date
+		case rep.Status == DeletedUnread && m.ReadStatus == NoReadReport:
+			m.ReadStatus = DeletedUnread
+		}
+	}
+}
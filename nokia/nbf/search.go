@@ -0,0 +1,120 @@
+package nbf
+
+import "regexp"
+
+// SearchOptions select the fields searched by Search
+// in addition to message texts.
+type SearchOptions struct {
+	// Names enables searching peer names: names of recipients
+	// in SMS.Peers, and names of Contacts having the number
+	// of the peer.
+	Names    bool
+	Contacts []Contact
+
+	// Limit, if positive, is the maximal number of results.
+	Limit int
+}
+
+// Fields of messages reported by Search.
+const (
+	FieldText       = "text"
+	FieldName       = "name"
+	FieldAttachment = "attachment" // filename of a MMS part
+)
+
+// A Match is a message matching a search.
+type Match struct {
+	Index int    // index of the message
+	Field string // FieldText, FieldName or FieldAttachment
+	Value string // the searched string
+
+	// Offsets are the byte offsets in Value of the start and end
+	// of successive matches, as returned by FindAllStringIndex.
+	Offsets [][]int
+}
+
+// Search returns the matches of re in the texts of msgs, which
+// should be assembled messages, and in the fields selected by opts,
+// in the order of msgs. Messages matching in several fields have
+// several results.
+func Search(msgs []SMS, re *regexp.Regexp, opts SearchOptions) []Match {
+	var names map[string][]string
+	if opts.Names {
+		names = contactNames(opts.Contacts)
+	}
+	s := searcher{re: re, limit: opts.Limit}
+	for i, m := range msgs {
+		if !s.add(i, FieldText, m.Text) {
+			break
+		}
+		if !opts.Names {
+			continue
+		}
+		seen := make(map[string]bool)
+		peers := m.Peers
+		if len(peers) == 0 {
+			peers = []string{m.Peer}
+		}
+		for _, p := range peers {
+			number, name := splitPeer(p)
+			for _, n := range append([]string{name}, names[numberKey(number)]...) {
+				if n != "" && !seen[n] {
+					seen[n] = true
+					s.add(i, FieldName, n)
+				}
+			}
+		}
+	}
+	return s.matches
+}
+
+// SearchMMS is like Search for multimedia messages, searching
+// their text parts, and filenames of their parts if opts.Names
+// is set.
+func SearchMMS(msgs []MMS, re *regexp.Regexp, opts SearchOptions) []Match {
+	s := searcher{re: re, limit: opts.Limit}
+	for i, m := range msgs {
+		for _, p := range m.Parts {
+			if isTextPart(p) && !s.add(i, FieldText, partText(p)) {
+				return s.matches
+			}
+			if name := p.Filename(); opts.Names && name != "" && !s.add(i, FieldAttachment, name) {
+				return s.matches
+			}
+		}
+	}
+	return s.matches
+}
+
+type searcher struct {
+	re      *regexp.Regexp
+	limit   int
+	matches []Match
+}
+
+// add records matches of value, reporting false if
+// the limit is reached.
+func (s *searcher) add(i int, field, value string) bool {
+	if s.limit > 0 && len(s.matches) >= s.limit {
+		return false
+	}
+	if idx := s.re.FindAllStringIndex(value, -1); idx != nil {
+		s.matches = append(s.matches, Match{Index: i, Field: field, Value: value, Offsets: idx})
+	}
+	return true
+}
+
+// contactNames maps keys of phone numbers to contact names.
+func contactNames(contacts []Contact) map[string][]string {
+	names := make(map[string][]string)
+	for _, c := range contacts {
+		if c.Name == "" {
+			continue
+		}
+		for _, p := range c.Phones {
+			n := numberKey(p.Number)
+			names[n] = append(names[n], c.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,147 @@
+package nbf
+
+import (
+	"fmt"
+	"unicode/utf16"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf/gsm7"
+)
+
+// Splitting of long texts in concatenated messages
+// (GSM 03.40 section 9.2.3.24.1).
+
+// SegmentOptions are the options of Segment.
+type SegmentOptions struct {
+	// Ref is the reference number of concatenated messages.
+	// Numbers above 255 use 16-bit references.
+	Ref int
+	// UCS2 forces the UCS-2 alphabet for texts which can be
+	// encoded using the GSM default alphabet.
+	UCS2 bool
+	// Transliterate replaces characters missing from the GSM
+	// default alphabet using gsm7.Transliterations, instead of
+	// using UCS-2. Texts of parts are the transliterated texts.
+	Transliterate bool
+	// Charset, if not nil, replaces the GSM default alphabet.
+	Charset *gsm7.Encoding
+}
+
+// A Part is a part of a text split by Segment.
+type Part struct {
+	Text     string
+	Alphabet Alphabet // GSM7 or UCS2
+	UDH      []byte   // information elements of the user data header, or nil
+	UserData []byte   // encoded user data, including the header
+	UDL      int      // user data length, in septets for GSM7
+}
+
+// Segment splits text in parts fitting in single messages, using
+// the GSM default alphabet if possible and UCS-2 otherwise. Texts
+// of at most 160 septets (70 UCS-2 characters) give a single part
+// without a header. Longer texts are split in parts of 153 septets
+// (67 UCS-2 characters), or 152 (66) for 16-bit references, with
+// a concatenation header. Escape sequences and surrogate pairs
+// are never split.
+func Segment(text string, opts SegmentOptions) ([]Part, error) {
+	sp := split(text, opts)
+	if len(sp.texts) == 1 {
+		text := sp.texts[0]
+		ud, udl := encodeText(nil, text, sp.alphabet, opts.Charset)
+		return []Part{{Text: text, Alphabet: sp.alphabet, UserData: ud, UDL: udl}}, nil
+	}
+	if len(sp.texts) > 0xff {
+		return nil, fmt.Errorf("text too long (%d parts)", len(sp.texts))
+	}
+	parts := make([]Part, len(sp.texts))
+	for i, t := range sp.texts {
+		udh := concatUDH(opts.Ref, i+1, len(sp.texts))
+		ud, udl := encodeText(udh, t, sp.alphabet, opts.Charset)
+		parts[i] = Part{Text: t, Alphabet: sp.alphabet, UDH: udh, UserData: ud, UDL: udl}
+	}
+	return parts, nil
+}
+
+// A Length is the size of a text sent as SMS, computed by Count.
+type Length struct {
+	Alphabet  Alphabet
+	Units     int // septets for GSM7, UTF-16 code units for UCS2
+	Parts     int // number of messages
+	Remaining int // units left in the last message
+}
+
+// Count returns the length of text sent as SMS, split as
+// by Segment with default options.
+func Count(text string) Length {
+	sp := split(text, SegmentOptions{})
+	l := Length{Alphabet: sp.alphabet, Parts: len(sp.texts), Remaining: sp.limit - sp.last}
+	for _, n := range sp.units {
+		l.Units += n
+	}
+	return l
+}
+
+type splitText struct {
+	alphabet Alphabet
+	texts    []string
+	units    []int // size of texts
+	limit    int   // maximal size of a part
+	last     int   // size of the last part
+}
+
+func split(text string, opts SegmentOptions) (sp splitText) {
+	sp.alphabet = UCS2
+	_, ok := encodeGSM(text, opts.Charset)
+	if !ok && opts.Transliterate && !opts.UCS2 {
+		var c gsm7.Encoding
+		if opts.Charset != nil {
+			c = *opts.Charset
+		}
+		c.Transliterate = gsm7.Transliterations
+		var septets []byte
+		if septets, ok = encodeGSM(text, &c); ok {
+			text, _ = decodeGSM(septets, opts.Charset)
+		}
+	}
+	if ok && !opts.UCS2 {
+		sp.alphabet = GSM7
+	}
+	// size returns the size of r in septets or UTF-16 units.
+	size := func(r rune) int {
+		if sp.alphabet == GSM7 {
+			septets, _ := encodeGSM(string(r), opts.Charset)
+			return len(septets)
+		}
+		return len(utf16.Encode([]rune{r}))
+	}
+	capacity := func(udh []byte) int {
+		h := len(udhBytes(udh))
+		if sp.alphabet == GSM7 {
+			return 160 - (8*h+6)/7
+		}
+		return (140 - h) / 2
+	}
+
+	runes := []rune(text)
+	total := 0
+	for _, r := range runes {
+		total += size(r)
+	}
+	if sp.limit = capacity(nil); total <= sp.limit {
+		sp.texts, sp.units, sp.last = []string{text}, []int{total}, total
+		return sp
+	}
+	sp.limit = capacity(concatUDH(opts.Ref, 1, 1))
+	start, n := 0, 0
+	for i, r := range runes {
+		if n+size(r) > sp.limit {
+			sp.texts = append(sp.texts, string(runes[start:i]))
+			sp.units = append(sp.units, n)
+			start, n = i, 0
+		}
+		n += size(r)
+	}
+	sp.texts = append(sp.texts, string(runes[start:]))
+	sp.units = append(sp.units, n)
+	sp.last = n
+	return sp
+}
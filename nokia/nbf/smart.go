@@ -0,0 +1,86 @@
+package nbf
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// Nokia Smart Messaging application ports.
+const (
+	PortRingtone     = 0x1581
+	PortOperatorLogo = 0x1582
+	PortCLIIcon      = 0x1583
+	PortPicture      = 0x158a
+	PortVCard        = 0x23f4 // also used by WAP
+	PortVCalendar    = 0x23f5
+	PortOTASettings  = 0xc34f // Nokia OTA settings
+)
+
+// WAP push ports (WAP-259-WDP).
+const (
+	PortWAPPush       = 2948 // connectionless WSP push
+	PortWAPPushSecure = 2949
+)
+
+// ParsePicture decodes a Nokia picture message (Smart Messaging
+// specification 3.0, section 3.4) into its bitmap and text.
+func ParsePicture(data []byte) (img image.Image, text string, err error) {
+	if len(data) < 1 || data[0] != '0' {
+		return nil, "", fmt.Errorf("unsupported picture message version")
+	}
+	data = data[1:]
+	for len(data) >= 3 {
+		typ := data[0]
+		length := int(data[1])<<8 | int(data[2])
+		data = data[3:]
+		if length > len(data) {
+			return img, text, fmt.Errorf("%w: picture message", ErrTruncated)
+		}
+		item := data[:length]
+		data = data[length:]
+		switch typ {
+		case 0: // ISO-8859-1 text
+			runes := make([]rune, len(item))
+			for i, c := range item {
+				runes[i] = rune(c)
+			}
+			text = string(runes)
+		case 2: // OTA bitmap
+			img, err = ParseOTABitmap(item)
+			if err != nil {
+				return img, text, err
+			}
+		}
+	}
+	if img == nil {
+		return nil, text, fmt.Errorf("no bitmap in picture message")
+	}
+	return img, text, nil
+}
+
+// ParseOTABitmap decodes a monochrome OTA bitmap.
+func ParseOTABitmap(b []byte) (image.Image, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("%w: OTA bitmap", ErrTruncated)
+	}
+	w, h, depth := int(b[1]), int(b[2]), b[3]
+	if depth != 1 {
+		return nil, fmt.Errorf("unsupported OTA bitmap depth %d", depth)
+	}
+	bits := b[4:]
+	if len(bits)*8 < w*h {
+		return nil, fmt.Errorf("%w: OTA bitmap", ErrTruncated)
+	}
+	img := image.NewPaletted(image.Rect(0, 0, w, h),
+		color.Palette{color.White, color.Black})
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			if bits[i/8]&(0x80>>uint(i%8)) != 0 {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return img, nil
+}
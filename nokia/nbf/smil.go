@@ -0,0 +1,106 @@
+package nbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"strings"
+
+	"github.com/remyoudompheng/go-misc/nokia/mms"
+)
+
+// Text of multimedia messages.
+//
+// MMS bodies usually hold a SMIL presentation (application/smil)
+// laying out the other parts in slides. Text parts are read in
+// the order of the presentation, then in the order of the body
+// for parts it does not reference.
+
+// BodyText returns the text of m, so that text and multimedia
+// messages have a common accessor. It is empty for 8-bit data.
+func (m SMS) BodyText() string { return m.Text }
+
+// BodyText returns the concatenation of the text/plain parts
+// of m, in the order of its SMIL presentation, separated by
+// newlines.
+func (m MMS) BodyText() string {
+	var texts []string
+	used := make([]bool, len(m.Parts))
+	for _, src := range m.smilSources() {
+		for i, p := range m.Parts {
+			if !used[i] && isTextPart(p) && partMatches(p, src) {
+				used[i] = true
+				texts = append(texts, partText(p))
+				break
+			}
+		}
+	}
+	for i, p := range m.Parts {
+		if !used[i] && isTextPart(p) {
+			texts = append(texts, partText(p))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// smilSources returns the src attributes of media elements
+// of the SMIL part of m, in document order.
+func (m MMS) smilSources() []string {
+	for _, p := range m.Parts {
+		if p.ContentType != "application/smil" {
+			continue
+		}
+		var srcs []string
+		d := xml.NewDecoder(bytes.NewReader(p.Data))
+		d.Strict = false
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				break
+			}
+			if el, ok := tok.(xml.StartElement); ok {
+				for _, a := range el.Attr {
+					if a.Name.Local == "src" {
+						srcs = append(srcs, a.Value)
+					}
+				}
+			}
+		}
+		return srcs
+	}
+	return nil
+}
+
+func isTextPart(p mms.Part) bool { return p.ContentType == "text/plain" }
+
+// partMatches reports whether the SMIL reference src designates
+// part p, by its Content-Location or Content-ID.
+func partMatches(p mms.Part, src string) bool {
+	if id, ok := strings.CutPrefix(src, "cid:"); ok {
+		return strings.Trim(p.Headers["Content-ID"], "<>") == id
+	}
+	return src == p.Headers["Content-Location"] || src == p.Filename()
+}
+
+// partText decodes a text part according to its charset.
+func partText(p mms.Part) string {
+	switch strings.ToLower(p.Params["charset"]) {
+	case "iso-10646-ucs-2":
+		return decodeUCS2(p.Data)
+	case "utf-16":
+		switch {
+		case bytes.HasPrefix(p.Data, []byte{0xff, 0xfe}):
+			return decodeUTF16(p.Data[2:], binary.LittleEndian)
+		case bytes.HasPrefix(p.Data, []byte{0xfe, 0xff}):
+			return decodeUCS2(p.Data[2:])
+		}
+		return decodeUCS2(p.Data)
+	case "iso-8859-1":
+		r := make([]rune, len(p.Data))
+		for i, c := range p.Data {
+			r[i] = rune(c)
+		}
+		return string(r)
+	}
+	return strings.ToValidUTF8(string(p.Data), "�")
+}
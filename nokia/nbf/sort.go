@@ -0,0 +1,106 @@
+package nbf
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Ordering of messages.
+//
+// Functions returning lists of messages (Inbox, Outbox, Dedup,
+// Threads) sort them in the default order of ByDate: by date,
+// then by sequence number of their entries, which follows the
+// order in which the phone stored them. Messages returns messages
+// in archive order, which is not significant.
+
+// A Comparator compares two messages, returning a negative number
+// if a sorts before b, a positive number if b sorts before a,
+// and zero otherwise.
+type Comparator func(a, b SMS) int
+
+// Comparators for SortBy.
+var (
+	ByDate      Comparator = compareDate      // date, then sequence number
+	ByPeer      Comparator = comparePeer      // normalized thread peer
+	ByLength    Comparator = compareLength    // number of characters of text
+	ByDirection Comparator = compareDirection // received, sent, draft, unknown
+)
+
+func compareDate(a, b SMS) int {
+	if c := a.When.Compare(b.When); c != 0 {
+		return c
+	}
+	switch {
+	case a.Seq < b.Seq:
+		return -1
+	case a.Seq > b.Seq:
+		return +1
+	}
+	return 0
+}
+
+func comparePeer(a, b SMS) int {
+	return strings.Compare(normalizePeer(ThreadPeer(a)), normalizePeer(ThreadPeer(b)))
+}
+
+func compareLength(a, b SMS) int {
+	return utf8.RuneCountInString(a.Text) - utf8.RuneCountInString(b.Text)
+}
+
+func compareDirection(a, b SMS) int {
+	// Unknown last.
+	rank := func(d Direction) int { return (int(d) + 3) % 4 }
+	return rank(a.Direction) - rank(b.Direction)
+}
+
+// Reverse returns the reverse order of c.
+func (c Comparator) Reverse() Comparator {
+	return func(a, b SMS) int { return c(b, a) }
+}
+
+// SortBy sorts msgs by the comparators, in order of
+// precedence, then in the default order.
+func SortBy(msgs []SMS, cmps ...Comparator) {
+	slices.SortStableFunc(msgs, func(a, b SMS) int {
+		for _, cmp := range cmps {
+			if c := cmp(a, b); c != 0 {
+				return c
+			}
+		}
+		return compareDate(a, b)
+	})
+}
+
+// ParseSort parses a comma-separated list of orders among "date",
+// "peer", "length" and "direction", each optionally prefixed with
+// "-" for the reverse order, as used by command-line flags.
+func ParseSort(spec string) ([]Comparator, error) {
+	var cmps []Comparator
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		name, reverse := strings.CutPrefix(s, "-")
+		var c Comparator
+		switch name {
+		case "date":
+			c = ByDate
+		case "peer":
+			c = ByPeer
+		case "length":
+			c = ByLength
+		case "direction":
+			c = ByDirection
+		default:
+			return nil, fmt.Errorf("unknown sort order %q", s)
+		}
+		if reverse {
+			c = c.Reverse()
+		}
+		cmps = append(cmps, c)
+	}
+	return cmps, nil
+}
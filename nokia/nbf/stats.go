@@ -0,0 +1,131 @@
+package nbf
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stats summarizes the contents of a NBF archive.
+type Stats struct {
+	// Entry counts from the archive directory.
+	Folders map[int]int `json:"folders"` // predefmessages/N => entries
+	SMS     int         `json:"sms"`
+	MMS     int         `json:"mms"`
+
+	// UnknownFlags counts entries by their flag bits of
+	// unknown meaning (see Flags.Unknown).
+	UnknownFlags map[uint16]int `json:"unknown_flags"`
+
+	// Counts of decoded (reassembled) text messages.
+	Inbox  int       `json:"inbox"`
+	Outbox int       `json:"outbox"`
+	First  time.Time `json:"first"`
+	Last   time.Time `json:"last"`
+
+	Peers []PeerStats `json:"peers"` // sorted by decreasing activity
+
+	// Languages counts decoded messages by language
+	// (see SMS.Language), the empty string for unknown ones.
+	Languages map[string]int `json:"languages"`
+
+	// Senders counts received messages by class of sender
+	// (see Classify), such as "person" or "shortcode".
+	Senders map[string]int `json:"senders"`
+}
+
+// PeerStats counts messages exchanged with a single peer.
+type PeerStats struct {
+	Peer     string `json:"peer"`
+	Received int    `json:"received"`
+	Sent     int    `json:"sent"`
+}
+
+// Stats computes statistics about messages in the archive.
+func (r *Reader) Stats() (st Stats, err error) {
+	return r.StatsFunc(nil)
+}
+
+// StatsFunc is like Stats, counting only decoded messages for
+// which keep returns true. Entry counts are not filtered.
+func (r *Reader) StatsFunc(keep func(SMS) bool) (st Stats, err error) {
+	return r.StatsContext(context.Background(), keep)
+}
+
+// StatsContext is like StatsFunc, but stops when ctx is done,
+// returning the error of ctx.
+func (r *Reader) StatsContext(ctx context.Context, keep func(SMS) bool) (st Stats, err error) {
+	st.Folders = make(map[int]int)
+	st.Languages = make(map[string]int)
+	st.Senders = make(map[string]int)
+	st.UnknownFlags = make(map[uint16]int)
+	// Progress is reported by the scan of messages below.
+	for _, f := range r.z.File {
+		if !strings.HasPrefix(f.Name, "predefmessages/") || f.Mode().IsDir() {
+			continue
+		}
+		dir := strings.TrimPrefix(path.Dir(f.Name), "predefmessages/")
+		if n, err := strconv.Atoi(dir); err == nil {
+			st.Folders[n]++
+		}
+		info, err := ParseFilename(path.Base(f.Name))
+		if err != nil {
+			continue
+		}
+		flags := DecodeFlags(info.Flags)
+		switch {
+		case flags.SMS:
+			st.SMS++
+		case flags.MMS:
+			st.MMS++
+		}
+		st.UnknownFlags[flags.Unknown()]++
+	}
+
+	msgs, err := r.collectSMS(r.MessagesContext(ctx), len(r.z.File)/2)
+	if err != nil {
+		return st, err
+	}
+
+	peers := make(map[string]*PeerStats)
+	for _, m := range msgs {
+		if keep != nil && !keep(m) {
+			continue
+		}
+		if st.First.IsZero() || m.When.Before(st.First) {
+			st.First = m.When
+		}
+		st.Languages[m.Language()]++
+		if m.When.After(st.Last) {
+			st.Last = m.When
+		}
+		p := peers[m.Peer]
+		if p == nil {
+			p = &PeerStats{Peer: m.Peer}
+			peers[m.Peer] = p
+		}
+		if m.Type == 0 {
+			st.Inbox++
+			st.Senders[Classify(m).String()]++
+			p.Received++
+		} else {
+			st.Outbox++
+			p.Sent++
+		}
+	}
+
+	for _, p := range peers {
+		st.Peers = append(st.Peers, *p)
+	}
+	sort.Slice(st.Peers, func(i, j int) bool {
+		pi, pj := st.Peers[i], st.Peers[j]
+		if ni, nj := pi.Received+pi.Sent, pj.Received+pj.Sent; ni != nj {
+			return ni > nj
+		}
+		return pi.Peer < pj.Peer
+	})
+	return st, nil
+}
@@ -0,0 +1,93 @@
+package nbf_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+// testdata/sample.nbf holds 2 received text messages from
+// +33612345678, the second one in 3 parts, a message sent
+// to Bob and a received MMS.
+const sampleArchive = "testdata/sample.nbf"
+
+func openSample(t *testing.T) *nbf.Reader {
+	r, err := nbf.OpenFile(sampleArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestStats(t *testing.T) {
+	r := openSample(t)
+	st, err := r.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox, err := r.Outbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"folders", st.Folders, map[int]int{1: 5, 3: 1}},
+		{"sms", st.SMS, 5},
+		{"mms", st.MMS, 1},
+		{"unknown flags", st.UnknownFlags, map[uint16]int{0x10: 6}},
+		{"inbox", st.Inbox, 2},
+		{"outbox", st.Outbox, 1},
+		{"first", st.First.UTC(), time.Date(2010, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{"last", st.Last, outbox[0].When},
+		{"peers", st.Peers, []nbf.PeerStats{{Peer: "+33612345678", Received: 2}, {Peer: "Bob", Sent: 1}}},
+		{"languages", st.Languages, map[string]int{"": 2, "en": 1}},
+		{"senders", st.Senders, map[string]int{"person": 2}},
+	} {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s: got %v, expected %v", c.name, c.got, c.want)
+		}
+	}
+
+	// Only decoded messages are filtered.
+	st, err = r.StatsFunc(func(m nbf.SMS) bool { return m.Type == 0 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Inbox != 2 || st.Outbox != 0 || st.SMS != 5 || len(st.Peers) != 1 {
+		t.Errorf("got filtered stats %+v", st)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	r := openSample(t)
+	for _, scan := range []struct {
+		name string
+		run  func() error
+	}{
+		{"Inbox", func() error { _, err := r.Inbox(); return err }},
+		{"Stats", func() error { _, err := r.Stats(); return err }},
+		{"Verify", func() error { _, err := r.Verify(); return err }},
+		{"Walk", func() error { return r.Walk(context.Background(), func(nbf.SMS) error { return nil }) }},
+	} {
+		var calls, last, total int
+		r.Progress = func(done, n int) {
+			if done <= last || done > n || total != 0 && n != total {
+				t.Errorf("%s: progress %d/%d after %d/%d", scan.name, done, n, last, total)
+			}
+			calls++
+			last, total = done, n
+		}
+		if err := scan.run(); err != nil {
+			t.Fatal(err)
+		}
+		if calls == 0 || last != total {
+			t.Errorf("%s: %d progress calls ending at %d/%d", scan.name, calls, last, total)
+		}
+	}
+}
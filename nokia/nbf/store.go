@@ -0,0 +1,64 @@
+package nbf
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A Store identifies the way messages are stored in an archive.
+type Store int
+
+const (
+	StoreNone Store = iota // no messages
+	StoreS40               // predefmessages/N entries (Series 40)
+	StoreS60               // Symbian message store (Series 60)
+)
+
+func (s Store) String() string {
+	switch s {
+	case StoreS40:
+		return "S40"
+	case StoreS60:
+		return "S60"
+	}
+	return "none"
+}
+
+// ErrUnsupportedStore is returned when reading messages from
+// a Symbian message store, whose format is not decoded yet.
+var ErrUnsupportedStore = errors.New("unsupported message store")
+
+// Symbian keeps messages in the private directory of the
+// messaging server (UID 0x1000484b), in a Mail2 folder.
+const symbianStore = "private/1000484b/mail2/"
+
+// Store reports how messages are stored in the archive.
+func (r *Reader) Store() Store {
+	r.storeOnce.Do(func() { r.store = findStore(r.z.File) })
+	return r.store
+}
+
+func findStore(files []*zip.File) Store {
+	s := StoreNone
+	for _, f := range files {
+		name := strings.ToLower(strings.ReplaceAll(f.Name, "\\", "/"))
+		switch {
+		case strings.HasPrefix(name, "predefmessages/"):
+			return StoreS40
+		case strings.Contains(name, symbianStore):
+			s = StoreS60
+		}
+	}
+	return s
+}
+
+// checkStore returns ErrUnsupportedStore if messages of the
+// archive cannot be read.
+func (r *Reader) checkStore() error {
+	if r.Store() == StoreS60 {
+		return fmt.Errorf("%w: %s", ErrUnsupportedStore, StoreS60)
+	}
+	return nil
+}
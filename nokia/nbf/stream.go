@@ -0,0 +1,91 @@
+package nbf
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+)
+
+// Entries are streamed from the archive rather than read in memory
+// when they may be large: MMS entries and media files can weigh
+// several megabytes, while text message entries are a few hundred
+// bytes.
+
+const (
+	// maxMessageEntry is the size of the largest entries read in
+	// memory to be decoded as text messages. Larger entries are
+	// MMS or corrupt.
+	maxMessageEntry = 64 << 10
+
+	// entryHeadSize is the size of entry prefixes read to find
+	// the layout and type of large entries.
+	entryHeadSize = 4 << 10
+)
+
+// An entryStream reads an entry with a bounded buffer.
+type entryStream struct {
+	*bufio.Reader
+	io.Closer
+	head   []byte // prefix of the entry, valid until the next read
+	layout *Layout
+}
+
+// openStream opens entry f and reads its head to detect its layout.
+func openStream(f *zip.File, password string) (*entryStream, error) {
+	rc, err := openEntry(f, password)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReaderSize(rc, entryHeadSize)
+	head, err := br.Peek(entryHeadSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		rc.Close()
+		return nil, err
+	}
+	return &entryStream{Reader: br, Closer: rc, head: head, layout: layoutOf(head)}, nil
+}
+
+// isMMS reports whether the entry holds an MMS PDU.
+func (s *entryStream) isMMS() bool {
+	off := s.layout.PDUOffset
+	return len(s.head) > off && s.head[off] == 0x8c
+}
+
+// skipToMMS skips the entry header, to read the MMS PDU.
+func (s *entryStream) skipToMMS() error {
+	if !s.isMMS() {
+		return fmt.Errorf("no MMS PDU at offset 0x%x", s.layout.PDUOffset)
+	}
+	_, err := s.Discard(s.layout.PDUOffset)
+	return err
+}
+
+// A ctxReader stops reading when its context is done, so that
+// cancellation interrupts the reading of large entries.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// largeEntryError returns the error for message entries too large
+// to be text messages, reading only their head.
+func largeEntryError(f *zip.File, password string) error {
+	s, err := openStream(f, password)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if s.isMMS() {
+		return &EntryError{Offset: s.layout.PDUOffset, Err: fmt.Errorf("%w: MMS", ErrUnsupportedPDU)}
+	}
+	return &EntryError{Offset: maxMessageEntry, Err: fmt.Errorf("%w: entry of %d bytes", ErrCorrupt, f.UncompressedSize64)}
+}
@@ -0,0 +1,73 @@
+package nbf
+
+import (
+	"sort"
+	"strings"
+)
+
+// A Thread is the conversation with a single peer.
+type Thread struct {
+	Peer     string
+	Messages []SMS // sorted by date
+}
+
+// Last returns the most recent message of the thread.
+func (t Thread) Last() SMS { return t.Messages[len(t.Messages)-1] }
+
+// ThreadPeer returns the peer identifying the conversation m
+// belongs to: the sender of received messages, the recipient
+// numbers for sent messages.
+func ThreadPeer(m SMS) string {
+	if m.Type == 0 || len(m.Peers) == 0 {
+		return m.Peer
+	}
+	nums := make([]string, len(m.Peers))
+	for i, p := range m.Peers {
+		// p is formatted as "number <name>"
+		if idx := strings.Index(p, " <"); idx >= 0 {
+			p = p[:idx]
+		}
+		nums[i] = p
+	}
+	return strings.Join(nums, ",")
+}
+
+// ThreadName is like ThreadPeer, using the names of recipients
+// stored with sent messages when known.
+func ThreadName(m SMS) string {
+	if m.Type == 0 || len(m.Peers) == 0 {
+		return m.Peer
+	}
+	names := make([]string, len(m.Peers))
+	for i, p := range m.Peers {
+		number, name := splitPeer(p)
+		if name == "" {
+			name = number
+		}
+		names[i] = name
+	}
+	return strings.Join(names, ",")
+}
+
+// Threads groups messages by peer, most recent thread first.
+func Threads(msgs []SMS) []Thread {
+	byPeer := make(map[string]int)
+	var threads []Thread
+	for _, m := range msgs {
+		peer := ThreadPeer(m)
+		i, ok := byPeer[peer]
+		if !ok {
+			i = len(threads)
+			byPeer[peer] = i
+			threads = append(threads, Thread{Peer: peer})
+		}
+		threads[i].Messages = append(threads[i].Messages, m)
+	}
+	for _, t := range threads {
+		sort.Stable(smsByDate(t.Messages))
+	}
+	sort.SliceStable(threads, func(i, j int) bool {
+		return threads[i].Last().When.After(threads[j].Last().When)
+	})
+	return threads
+}
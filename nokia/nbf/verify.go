@@ -0,0 +1,174 @@
+package nbf
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/mms"
+)
+
+// A Problem describes a corrupt or suspicious archive entry.
+type Problem struct {
+	Entry   string
+	Message string
+}
+
+func (p Problem) String() string { return p.Entry + ": " + p.Message }
+
+// nameTolerance is the difference between the timestamps of
+// entry names and message bodies accepted by Verify.
+const nameTolerance = 24 * time.Hour
+
+// Verify checks the integrity of archive entries: zip checksums,
+// message filenames (see MessageInfo.VerifyName), PDU structure
+// and completeness of concatenated messages.
+func (r *Reader) Verify() (problems []Problem, err error) {
+	return r.VerifyContext(context.Background())
+}
+
+// VerifyContext is like Verify, but stops when ctx is done,
+// returning the error of ctx.
+func (r *Reader) VerifyContext(ctx context.Context) (problems []Problem, err error) {
+	report := func(entry, format string, args ...interface{}) {
+		problems = append(problems, Problem{Entry: entry, Message: fmt.Sprintf(format, args...)})
+	}
+
+	type multiKey struct {
+		Folder string
+		Peer   string
+		Ref    int
+	}
+	type multiInfo struct {
+		Entry  string
+		NParts int
+		Parts  map[int]bool
+	}
+	multiparts := make(map[multiKey]*multiInfo)
+
+	for f := range r.files() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if f.Mode().IsDir() {
+			continue
+		}
+		if !strings.HasPrefix(f.Name, "predefmessages/") {
+			// Media files may be large: stream them.
+			if err := r.verifyStream(ctx, f, false); err != nil {
+				report(f.Name, "read error: %s", err)
+			}
+			continue
+		}
+		base := path.Base(f.Name)
+		info, err := ParseFilename(base)
+		if err != nil {
+			report(f.Name, "invalid filename: %s", err)
+			continue
+		}
+		if !info.ChecksumOK {
+			report(f.Name, "filename checksum mismatch")
+		}
+		if info.Flags&FLAGS_MMS != 0 {
+			if err := r.verifyStream(ctx, f, true); err != nil {
+				report(f.Name, "%s", err)
+			}
+			continue
+		}
+		blob, err := readEntry(f, r.Password)
+		if err != nil {
+			report(f.Name, "read error: %s", err)
+			continue
+		}
+
+		m, err := ParseEntry(blob)
+		if err != nil {
+			report(f.Name, "invalid message: %s", err)
+			continue
+		}
+		if err := info.verifyName(m, nameTolerance); err != nil {
+			report(f.Name, "%s", err)
+		}
+		var ud UserData
+		var peer string
+		switch msg := m.Msg.(type) {
+		case Deliver:
+			ud, peer = msg.UserData, msg.FromAddr
+		case Submit:
+			ud, peer = msg.UserData, msg.ToAddr
+		}
+		if !ud.Concat {
+			if info.PartTotal > 1 {
+				report(f.Name, "filename indicates part %d/%d of a non-concatenated message",
+					info.PartNo, info.PartTotal)
+			}
+			continue
+		}
+		if ud.Part < 1 || ud.Part > ud.NParts {
+			report(f.Name, "invalid part number %d/%d", ud.Part, ud.NParts)
+			continue
+		}
+		key := multiKey{Folder: path.Dir(f.Name), Peer: peer, Ref: ud.Ref}
+		mi := multiparts[key]
+		if mi == nil {
+			mi = &multiInfo{Entry: f.Name, NParts: ud.NParts, Parts: make(map[int]bool)}
+			multiparts[key] = mi
+		}
+		if mi.NParts != ud.NParts {
+			report(f.Name, "part count %d differs from %d in %s", ud.NParts, mi.NParts, mi.Entry)
+		}
+		if mi.Parts[ud.Part] {
+			report(f.Name, "duplicate part %d/%d", ud.Part, ud.NParts)
+		}
+		mi.Parts[ud.Part] = true
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var incomplete []Problem
+	for key, mi := range multiparts {
+		var missing []string
+		for i := 1; i <= mi.NParts; i++ {
+			if !mi.Parts[i] {
+				missing = append(missing, strconv.Itoa(i))
+			}
+		}
+		if len(missing) > 0 {
+			incomplete = append(incomplete, Problem{Entry: mi.Entry,
+				Message: fmt.Sprintf("incomplete message (ref %d, peer %s): missing parts %s of %d",
+					key.Ref, key.Peer, strings.Join(missing, ","), mi.NParts)})
+		}
+	}
+	sort.Slice(incomplete, func(i, j int) bool { return incomplete[i].Entry < incomplete[j].Entry })
+	return append(problems, incomplete...), nil
+}
+
+// verifyStream reads entry f, without keeping it in memory,
+// and checks its MMS PDU if isMMS is set.
+func (r *Reader) verifyStream(ctx context.Context, f *zip.File, isMMS bool) error {
+	s, err := openStream(f, r.Password)
+	if err != nil {
+		return fmt.Errorf("read error: %s", err)
+	}
+	defer s.Close()
+	if isMMS {
+		if err := s.skipToMMS(); err != nil {
+			return err
+		}
+		if _, err := mms.ReadMMS(bufio.NewReader(ctxReader{ctx, s})); err != nil {
+			return fmt.Errorf("invalid MMS PDU: %s", err)
+		}
+	}
+	if _, err := io.Copy(io.Discard, ctxReader{ctx, s}); err != nil {
+		return fmt.Errorf("read error: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package nbf_test
+
+import (
+	"archive/zip"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+// damageSample writes a copy of the sample archive to a temporary
+// file, passing each entry through edit, and returns its name.
+// Entries for which edit returns an empty name are dropped.
+func damageSample(t *testing.T, edit func(name string, data []byte) (string, []byte, bool)) string {
+	z, err := zip.OpenReader(sampleArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+	out := filepath.Join(t.TempDir(), "damaged.nbf")
+	f, err := os.Create(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for _, e := range z.File {
+		rd, err := e.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, data, badCRC := edit(e.Name, data)
+		if name == "" {
+			continue
+		}
+		hdr := &zip.FileHeader{Name: name, Method: zip.Store,
+			CompressedSize64: uint64(len(data)), UncompressedSize64: uint64(len(data))}
+		hdr.CRC32 = crc32.ChecksumIEEE(data)
+		if badCRC {
+			hdr.CRC32 ^= 1
+		}
+		ew, err := w.CreateRaw(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ew.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestVerify(t *testing.T) {
+	r := openSample(t)
+	if problems, err := r.Verify(); err != nil || len(problems) != 0 {
+		t.Errorf("clean archive: got problems %v, %v", problems, err)
+	}
+
+	const (
+		single = "predefmessages/1/000000013C2160000000201000500000000000000000000000000000000000000+3361234567800000043"
+		part2  = "predefmessages/1/000000033C2168000001201000500000003020000000000000000000000000000+3361234567800000053"
+	)
+	for _, tt := range []struct {
+		name    string
+		entry   string // damaged entry
+		edit    func(data []byte) (string, []byte, bool)
+		problem string
+	}{
+		{"crc", single, func(data []byte) (string, []byte, bool) {
+			return single, data, true
+		}, "read error"},
+		{"checksum", single, func(data []byte) (string, []byte, bool) {
+			return single[:len(single)-1] + "4", data, false
+		}, "filename checksum mismatch"},
+		{"truncated", single, func(data []byte) (string, []byte, bool) {
+			return single, data[:0x40], false
+		}, "invalid message"},
+		{"missing part", part2, func(data []byte) (string, []byte, bool) {
+			return "", nil, false
+		}, "missing parts 2 of 3"},
+	} {
+		name := damageSample(t, func(name string, data []byte) (string, []byte, bool) {
+			if name == tt.entry {
+				return tt.edit(data)
+			}
+			return name, data, false
+		})
+		r, err := nbf.OpenFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		problems, err := r.Verify()
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(problems) != 1 || !strings.Contains(problems[0].Message, tt.problem) {
+			t.Errorf("%s: got problems %v, expected %q", tt.name, problems, tt.problem)
+		}
+	}
+}
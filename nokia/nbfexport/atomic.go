@@ -0,0 +1,64 @@
+package nbfexport
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// BackupSuffix is appended to the names of files replaced
+// by WriteFile with backups.
+const BackupSuffix = ".bak"
+
+// WriteFile writes file name atomically: write is called with
+// a temporary file of the same directory, which is renamed
+// to name on success and removed otherwise, so that interrupted
+// writes do not leave truncated files. If backup is set, an
+// existing file is kept with BackupSuffix appended to its name.
+func WriteFile(name string, backup bool, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && backup {
+		err = backupFile(name)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// backupFile keeps a copy of an existing file name, as a hard link
+// if possible so that name is never missing.
+func backupFile(name string) error {
+	if _, err := os.Lstat(name); os.IsNotExist(err) {
+		return nil
+	}
+	bak := name + BackupSuffix
+	if err := os.Remove(bak); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if os.Link(name, bak) == nil {
+		return nil
+	}
+	return os.Rename(name, bak)
+}
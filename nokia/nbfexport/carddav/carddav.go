@@ -0,0 +1,89 @@
+// Package carddav uploads contacts to the address books of CardDAV
+// servers (RFC 6352), such as Nextcloud or Fastmail:
+//
+//	c := &carddav.Client{URL: "https://example.com/remote.php/dav/addressbooks/users/me/contacts/",
+//		User: "me", Password: "secret"}
+//	err := c.Push(ctx, contacts)
+//
+// Each contact is stored as a vCard 3.0 resource named after its
+// UID (see nbfexport.ContactUID), so that pushing a phonebook again
+// replaces the contacts pushed previously.
+package carddav
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/nbfexport"
+)
+
+// A Client uploads vCards to an address book collection.
+type Client struct {
+	URL            string // of the address book collection
+	User, Password string // for basic authentication, if User is set
+
+	HTTP *http.Client // nil for http.DefaultClient
+}
+
+// ResourceURL returns the URL of the vCard resource of c.
+func (cl *Client) ResourceURL(c nbf.Contact) (string, error) {
+	base, err := url.Parse(cl.URL)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	return base.JoinPath(nbfexport.ContactUID(c) + ".vcf").String(), nil
+}
+
+// Push uploads contacts, stopping at the first error.
+func (cl *Client) Push(ctx context.Context, contacts []nbf.Contact) error {
+	for _, c := range contacts {
+		if err := cl.Put(ctx, c); err != nil {
+			return fmt.Errorf("carddav: %s: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// Put uploads contact c, creating or replacing its resource.
+func (cl *Client) Put(ctx context.Context, c nbf.Contact) error {
+	u, err := cl.ResourceURL(c)
+	if err != nil {
+		return err
+	}
+	var card bytes.Buffer
+	if err := nbfexport.WriteVCards(&card, []nbf.Contact{c}, nbfexport.VCard30); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", u, &card)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/vcard; charset=utf-8")
+	if cl.User != "" {
+		req.SetBasicAuth(cl.User, cl.Password)
+	}
+	client := cl.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	}
+	return fmt.Errorf("PUT %s: %s", u, resp.Status)
+}
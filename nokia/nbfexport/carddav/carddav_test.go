@@ -0,0 +1,55 @@
+package carddav
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/nbfexport"
+)
+
+func TestPush(t *testing.T) {
+	cards := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if user, pw, ok := req.BasicAuth(); !ok || user != "me" || pw != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.Method != "PUT" || !strings.HasPrefix(req.Header.Get("Content-Type"), "text/vcard") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(req.Body)
+		cards[req.URL.Path] = string(data)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	contacts := []nbf.Contact{
+		{Name: "Alice", Phones: []nbf.Phone{{Number: "+33612345678"}}},
+		{Name: "Bob", Phones: []nbf.Phone{{Number: "+33687654321"}}},
+	}
+	c := &Client{URL: srv.URL + "/dav/contacts", User: "me", Password: "secret"}
+	if err := c.Push(context.Background(), contacts); err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 2 {
+		t.Fatalf("got %d cards", len(cards))
+	}
+	for _, ct := range contacts {
+		uid := nbfexport.ContactUID(ct)
+		card := cards["/dav/contacts/"+uid+".vcf"]
+		if !strings.Contains(card, "FN:"+ct.Name+"\r\n") || !strings.Contains(card, "UID:"+uid+"\r\n") {
+			t.Errorf("%s: got card %q", ct.Name, card)
+		}
+	}
+
+	c.Password = "wrong"
+	if err := c.Push(context.Background(), contacts); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("got error %v", err)
+	}
+}
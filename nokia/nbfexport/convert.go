@@ -0,0 +1,116 @@
+package nbfexport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Media conversion.
+//
+// Attachments are extracted as found in archives: AMR voice notes
+// or 3GP videos are not playable everywhere. Converters registered
+// by media type produce additional copies in other formats,
+// possibly using external programs.
+
+// A Converter converts media files.
+type Converter interface {
+	// Convert writes to w the conversion of the media read from r.
+	Convert(ctx context.Context, w io.Writer, r io.Reader) error
+	// Ext returns the extension of converted files, such as ".mp3".
+	Ext() string
+}
+
+// A Command is a converter running an external program, which
+// reads media on its standard input and writes the converted
+// media on its standard output.
+type Command struct {
+	Path      string
+	Args      []string
+	Extension string // as returned by Ext
+}
+
+// ParseCommand parses a converter description of the form
+// "type=.ext:program args...", such as
+//
+//	audio/amr=.mp3:ffmpeg -i - -f mp3 -
+//
+// Arguments are separated by spaces, without quoting.
+func ParseCommand(s string) (ctype string, c *Command, err error) {
+	ctype, rest, ok1 := strings.Cut(s, "=")
+	ext, cmd, ok2 := strings.Cut(rest, ":")
+	args := strings.Fields(cmd)
+	if !ok1 || !ok2 || ctype == "" || !strings.HasPrefix(ext, ".") || len(args) == 0 {
+		return "", nil, fmt.Errorf("invalid converter %q, expecting type=.ext:program args...", s)
+	}
+	return ctype, &Command{Path: args[0], Args: args[1:], Extension: ext}, nil
+}
+
+func (c *Command) Ext() string { return c.Extension }
+
+func (c *Command) Convert(ctx context.Context, w io.Writer, r io.Reader) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Path, c.Args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = r, w, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %w: %s", c.Path, err, msg)
+		}
+		return fmt.Errorf("%s: %w", c.Path, err)
+	}
+	return nil
+}
+
+// A ConverterRegistry maps media types to converters.
+// It is safe for concurrent use.
+type ConverterRegistry struct {
+	mu         sync.RWMutex
+	converters map[string]Converter
+}
+
+// Converters is a default registry, populated by programs
+// using this package.
+var Converters ConverterRegistry
+
+// Register registers c for media of type ctype,
+// replacing any previous converter.
+func (r *ConverterRegistry) Register(ctype string, c Converter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.converters == nil {
+		r.converters = make(map[string]Converter)
+	}
+	r.converters[ctype] = c
+}
+
+// Lookup returns the converter registered for ctype.
+func (r *ConverterRegistry) Lookup(ctype string) (Converter, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.converters[ctype]
+	return c, ok
+}
+
+// Types returns the sorted media types having converters.
+func (r *ConverterRegistry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var types []string
+	for t := range r.converters {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ConvertedName returns the name of the conversion of file name
+// by c, replacing its extension.
+func ConvertedName(name string, c Converter) string {
+	return strings.TrimSuffix(name, path.Ext(name)) + c.Ext()
+}
@@ -0,0 +1,183 @@
+package nbfexport
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+// A CSVFormat is a column layout of contact spreadsheets,
+// as imported by web services.
+type CSVFormat int
+
+const (
+	GoogleCSV  CSVFormat = iota + 1 // Google Contacts
+	OutlookCSV                      // Microsoft Outlook
+)
+
+// ParseCSVFormat parses "google" or "outlook".
+func ParseCSVFormat(s string) (CSVFormat, error) {
+	switch strings.ToLower(s) {
+	case "google":
+		return GoogleCSV, nil
+	case "outlook":
+		return OutlookCSV, nil
+	}
+	return 0, fmt.Errorf("invalid CSV format %q", s)
+}
+
+// Kinds of phone numbers, from vCard 2.1 types.
+const (
+	phoneOther = iota
+	phoneMobile
+	phoneHome
+	phoneWork
+	phoneHomeFax
+	phoneWorkFax
+	phonePager
+)
+
+func phoneKind(types []string) int {
+	has := make(map[string]bool)
+	for _, t := range types {
+		has[strings.ToUpper(t)] = true
+	}
+	switch {
+	case has["FAX"] && has["WORK"]:
+		return phoneWorkFax
+	case has["FAX"]:
+		return phoneHomeFax
+	case has["PAGER"]:
+		return phonePager
+	case has["CELL"]:
+		return phoneMobile
+	case has["WORK"]:
+		return phoneWork
+	case has["HOME"]:
+		return phoneHome
+	}
+	return phoneOther
+}
+
+// WriteContactsCSV writes contacts to w as a CSV file in format f,
+// with a header line.
+func WriteContactsCSV(w io.Writer, contacts []nbf.Contact, f CSVFormat) error {
+	cw := csv.NewWriter(w)
+	switch f {
+	case GoogleCSV:
+		writeGoogleCSV(cw, contacts)
+	case OutlookCSV:
+		cw.UseCRLF = true
+		writeOutlookCSV(cw, contacts)
+	default:
+		return fmt.Errorf("invalid CSV format %d", f)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var googlePhoneTypes = [...]string{
+	phoneOther:   "Other",
+	phoneMobile:  "Mobile",
+	phoneHome:    "Home",
+	phoneWork:    "Work",
+	phoneHomeFax: "Home Fax",
+	phoneWorkFax: "Work Fax",
+	phonePager:   "Pager",
+}
+
+// writeGoogleCSV writes the layout of Google Contacts, with as many
+// numbered e-mail and phone columns as needed.
+func writeGoogleCSV(w *csv.Writer, contacts []nbf.Contact) {
+	nemail, nphone := 0, 0
+	for _, c := range contacts {
+		nemail, nphone = max(nemail, len(c.Emails)), max(nphone, len(c.Phones))
+	}
+	header := []string{"Name", "Given Name", "Family Name", "Notes", "Group Membership"}
+	for i := 1; i <= nemail; i++ {
+		n := strconv.Itoa(i)
+		header = append(header, "E-mail "+n+" - Type", "E-mail "+n+" - Value")
+	}
+	for i := 1; i <= nphone; i++ {
+		n := strconv.Itoa(i)
+		header = append(header, "Phone "+n+" - Type", "Phone "+n+" - Value")
+	}
+	w.Write(header)
+	for _, c := range contacts {
+		row := []string{c.Name, c.Given, c.Family, c.Note, "* myContacts"}
+		for i := 0; i < nemail; i++ {
+			if i < len(c.Emails) {
+				row = append(row, "* Other", c.Emails[i])
+			} else {
+				row = append(row, "", "")
+			}
+		}
+		for i := 0; i < nphone; i++ {
+			if i < len(c.Phones) {
+				row = append(row, googlePhoneTypes[phoneKind(c.Phones[i].Types)], c.Phones[i].Number)
+			} else {
+				row = append(row, "", "")
+			}
+		}
+		w.Write(row)
+	}
+}
+
+// outlookColumns are the columns of the Outlook layout. Phone
+// numbers fill the columns of their kind, in order.
+var outlookColumns = []string{
+	"First Name", "Last Name", "E-mail Address", "E-mail 2 Address", "E-mail 3 Address",
+	"Mobile Phone", "Home Phone", "Home Phone 2", "Business Phone", "Business Phone 2",
+	"Home Fax", "Business Fax", "Pager", "Other Phone", "Notes",
+}
+
+var outlookPhoneColumns = [...][]int{
+	phoneMobile:  {5},
+	phoneHome:    {6, 7},
+	phoneWork:    {8, 9},
+	phoneHomeFax: {10},
+	phoneWorkFax: {11},
+	phonePager:   {12},
+	phoneOther:   {13},
+}
+
+// writeOutlookCSV writes the layout of Outlook. E-mail addresses
+// and phone numbers which do not fit in the fixed columns
+// are appended to notes.
+func writeOutlookCSV(w *csv.Writer, contacts []nbf.Contact) {
+	w.Write(outlookColumns)
+	for _, c := range contacts {
+		row := make([]string, len(outlookColumns))
+		row[0], row[1] = c.Given, c.Family
+		if c.Given == "" && c.Family == "" {
+			row[0] = c.Name
+		}
+		var notes []string
+		if c.Note != "" {
+			notes = append(notes, c.Note)
+		}
+		for i, e := range c.Emails {
+			if i < 3 {
+				row[2+i] = e
+			} else {
+				notes = append(notes, "E-mail: "+e)
+			}
+		}
+	phones:
+		for _, p := range c.Phones {
+			for _, col := range outlookPhoneColumns[phoneKind(p.Types)] {
+				if row[col] == "" {
+					row[col] = p.Number
+					continue phones
+				}
+			}
+			notes = append(notes, "Phone: "+p.Number)
+		}
+		row[14] = strings.Join(notes, "\n")
+		w.Write(row)
+	}
+}
@@ -0,0 +1,264 @@
+package nbfexport
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+// Calendar entries are stored as vCalendar 1.0 in archives, and
+// written as iCalendar (RFC 5545). Recurrence rules are converted
+// from the vCalendar 1.0 grammar, and alarms become reminders
+// relative to the start of events.
+
+// WriteICalendar writes entries to w as an iCalendar file.
+func WriteICalendar(w io.Writer, entries []nbf.CalendarEntry) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//remyoudompheng//go-misc nbftool//EN")
+	for _, e := range entries {
+		writeEntry(line, e)
+	}
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+func writeEntry(line func(name, value string), e nbf.CalendarEntry) {
+	comp := "VEVENT"
+	if e.Todo {
+		comp = "VTODO"
+	}
+	line("BEGIN", comp)
+	uid := e.UID
+	if uid == "" {
+		uid = hashUUID([]string{e.NBFFile, e.Summary, e.Start.String()})
+	}
+	line("UID", escapeVCard(uid))
+	stamp := e.Stamp
+	if stamp.IsZero() {
+		stamp = e.Start // DTSTAMP is mandatory
+	}
+	line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+	end := "DTEND"
+	if e.Todo {
+		end = "DUE"
+	}
+	switch {
+	case e.AllDay:
+		// The end date is exclusive.
+		last := e.End
+		if last.IsZero() || isDayStart(last) {
+			last = last.AddDate(0, 0, -1)
+		}
+		if last.Before(e.Start) {
+			last = e.Start
+		}
+		line("DTSTART;VALUE=DATE", e.Start.Format("20060102"))
+		line(end+";VALUE=DATE", last.AddDate(0, 0, 1).Format("20060102"))
+	case !e.Start.IsZero():
+		line("DTSTART", icalTime(e.Start))
+		if e.End.After(e.Start) {
+			line(end, icalTime(e.End))
+		}
+	case !e.End.IsZero():
+		line(end, icalTime(e.End))
+	}
+	if e.Summary != "" {
+		line("SUMMARY", escapeVCard(e.Summary))
+	}
+	if e.Description != "" {
+		line("DESCRIPTION", escapeVCard(e.Description))
+	}
+	if e.Location != "" {
+		line("LOCATION", escapeVCard(e.Location))
+	}
+	if len(e.Categories) > 0 {
+		cats := make([]string, len(e.Categories))
+		for i, c := range e.Categories {
+			cats[i] = escapeVCard(c)
+		}
+		line("CATEGORIES", strings.Join(cats, ","))
+	}
+	if e.Priority > 0 {
+		line("PRIORITY", strconv.Itoa(e.Priority))
+	}
+	if e.Todo && e.Completed {
+		line("STATUS", "COMPLETED")
+	}
+	if rule, ok := ICalRule(e.Rule); ok {
+		line("RRULE", rule)
+	}
+	if !e.Alarm.IsZero() {
+		line("BEGIN", "VALARM")
+		line("ACTION", "DISPLAY")
+		desc := e.Summary
+		if desc == "" {
+			desc = "Reminder"
+		}
+		line("DESCRIPTION", escapeVCard(desc))
+		if !e.Start.IsZero() {
+			line("TRIGGER", icalDuration(e.Alarm.Sub(e.Start)))
+		} else {
+			line("TRIGGER;VALUE=DATE-TIME", e.Alarm.UTC().Format("20060102T150405Z"))
+		}
+		line("END", "VALARM")
+	}
+	line("END", comp)
+}
+
+// isDayStart reports whether t is at midnight.
+func isDayStart(t time.Time) bool {
+	h, m, s := t.Clock()
+	return h == 0 && m == 0 && s == 0
+}
+
+// icalTime formats t in UTC if it is in UTC, and as a floating
+// local time otherwise.
+func icalTime(t time.Time) string {
+	if t.Location() == time.UTC {
+		return t.Format("20060102T150405Z")
+	}
+	return t.Format("20060102T150405")
+}
+
+// icalDuration formats d as "-PT15M" or "-P1DT2H".
+func icalDuration(d time.Duration) string {
+	s := "P"
+	if d < 0 {
+		s, d = "-P", -d
+	}
+	d = d.Round(time.Second)
+	days, d := d/(24*time.Hour), d%(24*time.Hour)
+	if days > 0 {
+		s += strconv.Itoa(int(days)) + "D"
+	}
+	if d == 0 && days > 0 {
+		return s
+	}
+	s += "T"
+	if h := d / time.Hour; h > 0 {
+		s += strconv.Itoa(int(h)) + "H"
+	}
+	if m := d / time.Minute % 60; m > 0 {
+		s += strconv.Itoa(int(m)) + "M"
+	}
+	if sec := d / time.Second % 60; sec > 0 || d == 0 {
+		s += strconv.Itoa(int(sec)) + "S"
+	}
+	return s
+}
+
+// vCalendar 1.0 rule frequencies, by prefix, with the
+// iCalendar property of their modifiers.
+var ruleFreqs = []struct {
+	prefix, freq, by string
+}{
+	{"MP", "MONTHLY", "BYDAY"},
+	{"MD", "MONTHLY", "BYMONTHDAY"},
+	{"YM", "YEARLY", "BYMONTH"},
+	{"YD", "YEARLY", "BYYEARDAY"},
+	{"D", "DAILY", ""},
+	{"W", "WEEKLY", "BYDAY"},
+}
+
+// ICalRule converts a vCalendar 1.0 recurrence rule, such as
+// "MP1 1+ MO #0", to an iCalendar rule, such as
+// "FREQ=MONTHLY;BYDAY=1MO". Rules without modifiers repeat on
+// the date of the start of events, as written by Nokia phones
+// for anniversaries ("YD1 #0") or fortnightly meetings ("W2 #0").
+// It reports false for invalid rules.
+func ICalRule(rule string) (string, bool) {
+	fields := strings.Fields(rule)
+	if len(fields) == 0 {
+		return "", false
+	}
+	var freq, by, occ string
+	interval := 0
+	for _, f := range ruleFreqs {
+		if n, ok := strings.CutPrefix(fields[0], f.prefix); ok {
+			var err error
+			if interval, err = strconv.Atoi(n); err != nil {
+				return "", false
+			}
+			freq, by = f.freq, f.by
+			break
+		}
+	}
+	if freq == "" || interval < 1 {
+		return "", false
+	}
+	parts := []string{"FREQ=" + freq}
+	if interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(interval))
+	}
+	var values, end []string
+	for _, m := range fields[1:] {
+		switch {
+		case strings.HasPrefix(m, "#"):
+			n, err := strconv.Atoi(m[1:])
+			if err != nil {
+				return "", false
+			}
+			if n > 0 { // #0 repeats forever
+				end = []string{"COUNT=" + strconv.Itoa(n)}
+			}
+		case len(m) >= 8 && m[0] >= '0' && m[0] <= '9' && strings.Trim(m[:8], "0123456789") == "":
+			t := nbf.ParseVCalTime(m)
+			if t.IsZero() {
+				return "", false
+			}
+			end = []string{"UNTIL=" + icalTime(t)}
+		case by == "BYDAY" && isWeekday(m):
+			values = append(values, occ+m)
+		case freq == "MONTHLY" && by == "BYDAY":
+			// Occurrence of the following weekdays: 1+, 2-.
+			n, ok := ruleNumber(m)
+			if !ok {
+				return "", false
+			}
+			occ = strconv.Itoa(n)
+		case m == "LD" && by == "BYMONTHDAY":
+			values = append(values, "-1")
+		case by != "" && by != "BYDAY":
+			n, ok := ruleNumber(m)
+			if !ok {
+				return "", false
+			}
+			values = append(values, strconv.Itoa(n))
+		default:
+			return "", false
+		}
+	}
+	if len(values) > 0 {
+		parts = append(parts, by+"="+strings.Join(values, ","))
+	}
+	return strings.Join(append(parts, end...), ";"), true
+}
+
+// ruleNumber parses numbers of rules: "3", "3+" or "1-".
+func ruleNumber(s string) (int, bool) {
+	sign := 1
+	if t, ok := strings.CutSuffix(s, "-"); ok {
+		s, sign = t, -1
+	} else {
+		s = strings.TrimSuffix(s, "+")
+	}
+	n, err := strconv.Atoi(s)
+	return sign * n, err == nil && n > 0
+}
+
+func isWeekday(s string) bool {
+	switch s {
+	case "MO", "TU", "WE", "TH", "FR", "SA", "SU":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package nbfexport
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Locale formats dates and times in human-readable exports.
+// The nil Locale uses ISO 8601 dates and a 24-hour clock.
+type Locale struct {
+	Name      string
+	Months    [12]string
+	Order     string // of numeric dates: "dmy", "mdy" or "ymd"
+	Sep       string // separator of numeric dates
+	DaySuffix string // after the day of long dates, as "." in German
+	Clock12   bool   // 12-hour clock with AM/PM
+}
+
+var englishMonths = [12]string{"January", "February", "March", "April", "May", "June",
+	"July", "August", "September", "October", "November", "December"}
+
+// Locales are the known locales, by language tag.
+var Locales = map[string]*Locale{
+	"en-US": {Name: "en-US", Months: englishMonths, Order: "mdy", Sep: "/", Clock12: true},
+	"en-GB": {Name: "en-GB", Months: englishMonths, Order: "dmy", Sep: "/"},
+	"fr": {Name: "fr", Order: "dmy", Sep: "/", Months: [12]string{"janvier", "février", "mars",
+		"avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"}},
+	"de": {Name: "de", Order: "dmy", Sep: ".", DaySuffix: ".", Months: [12]string{"Januar", "Februar",
+		"März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"}},
+	"es": {Name: "es", Order: "dmy", Sep: "/", Months: [12]string{"enero", "febrero", "marzo",
+		"abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"}},
+	"it": {Name: "it", Order: "dmy", Sep: "/", Months: [12]string{"gennaio", "febbraio", "marzo",
+		"aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"}},
+	"pt": {Name: "pt", Order: "dmy", Sep: "/", Months: [12]string{"janeiro", "fevereiro", "março",
+		"abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"}},
+	"nl": {Name: "nl", Order: "dmy", Sep: "-", Months: [12]string{"januari", "februari", "maart",
+		"april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"}},
+}
+
+func init() {
+	Locales["en"] = Locales["en-US"]
+}
+
+// LookupLocale returns the locale named by a language tag such as
+// "fr" or "en-GB", or a POSIX locale name such as "fr_FR.UTF-8".
+// Unknown regions fall back to the language. The empty name and
+// "iso" return the nil Locale, "auto" the locale of the environment
+// (LC_ALL, LC_TIME or LANG).
+func LookupLocale(name string) (*Locale, error) {
+	switch name {
+	case "", "iso", "C", "POSIX":
+		return nil, nil
+	case "auto":
+		for _, v := range []string{"LC_ALL", "LC_TIME", "LANG"} {
+			if s := os.Getenv(v); s != "" {
+				if l, err := LookupLocale(s); err == nil {
+					return l, nil
+				}
+				break
+			}
+		}
+		return nil, nil
+	}
+	tag, _, _ := strings.Cut(name, ".")
+	tag, _, _ = strings.Cut(tag, "@")
+	lang, region, _ := strings.Cut(strings.ReplaceAll(tag, "_", "-"), "-")
+	lang = strings.ToLower(lang)
+	if l, ok := Locales[lang+"-"+strings.ToUpper(region)]; ok {
+		return l, nil
+	}
+	if l, ok := Locales[lang]; ok {
+		return l, nil
+	}
+	names := make([]string, 0, len(Locales))
+	for n := range Locales {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown locale %q (known: iso, auto, %s)", name, strings.Join(names, ", "))
+}
+
+// Date formats the date of t with digits, as 31/12/2010.
+func (l *Locale) Date(t time.Time) string {
+	if l == nil {
+		return t.Format("2006-01-02")
+	}
+	y, m, d := t.Date()
+	switch l.Order {
+	case "mdy":
+		return fmt.Sprintf("%02d%s%02d%s%04d", m, l.Sep, d, l.Sep, y)
+	case "ymd":
+		return fmt.Sprintf("%04d%s%02d%s%02d", y, l.Sep, m, l.Sep, d)
+	}
+	return fmt.Sprintf("%02d%s%02d%s%04d", d, l.Sep, m, l.Sep, y)
+}
+
+// LongDate formats the date of t with the name of the month,
+// as 31 December 2010.
+func (l *Locale) LongDate(t time.Time) string {
+	if l == nil {
+		return t.Format("2 January 2006")
+	}
+	y, m, d := t.Date()
+	month := l.Months[m-1]
+	switch l.Order {
+	case "mdy":
+		return fmt.Sprintf("%s %d, %d", month, d, y)
+	case "ymd":
+		return fmt.Sprintf("%d %s %d%s", y, month, d, l.DaySuffix)
+	}
+	return fmt.Sprintf("%d%s %s %d", d, l.DaySuffix, month, y)
+}
+
+// Time formats the time of day of t, to the minute.
+func (l *Locale) Time(t time.Time) string {
+	if l != nil && l.Clock12 {
+		return t.Format("3:04 PM")
+	}
+	return t.Format("15:04")
+}
+
+// DateTime formats t as Date and Time.
+func (l *Locale) DateTime(t time.Time) string {
+	return l.Date(t) + " " + l.Time(t)
+}
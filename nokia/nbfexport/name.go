@@ -0,0 +1,100 @@
+package nbfexport
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// NameData are the fields available to name templates.
+// Unsafe characters of string fields, including slashes,
+// are replaced by underscores.
+type NameData struct {
+	Peer      string    // number or name of the peer
+	PeerName  string    // name of the peer if known, Peer otherwise
+	Date      time.Time // of the (first) message
+	Year      int       // year of Date
+	Direction string    // of the message: "received", "sent"...
+	Folder    string    // name of the folder of the message
+	Index     int       // position of the file in the export
+	Filename  string    // original name of attachments
+	Ext       string    // usual extension of the file type, with a dot
+}
+
+// A NameTemplate generates file names, for example
+//
+//	{{.PeerName}}-{{.Year}}.txt
+//	{{.Year}}/{{.Date.Format "2006-01-02"}}-{{.Peer}}.txt
+//
+// Slashes in the template separate directories.
+type NameTemplate struct {
+	t *template.Template
+}
+
+// ParseNameTemplate parses a name template.
+func ParseNameTemplate(s string) (*NameTemplate, error) {
+	t, err := template.New("name").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return &NameTemplate{t}, nil
+}
+
+// MustParseNameTemplate is like ParseNameTemplate, panicking
+// on errors.
+func MustParseNameTemplate(s string) *NameTemplate {
+	t, err := ParseNameTemplate(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Name returns the file name for d: a relative slash-separated
+// path whose elements are sanitized.
+func (t *NameTemplate) Name(d NameData) (string, error) {
+	v := reflect.ValueOf(&d).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Field(i); f.Kind() == reflect.String {
+			f.SetString(replaceUnsafe(f.String()))
+		}
+	}
+	var b strings.Builder
+	if err := t.t.Execute(&b, d); err != nil {
+		return "", err
+	}
+	var elems []string
+	for _, e := range strings.Split(b.String(), "/") {
+		switch e = strings.TrimSpace(e); e {
+		case "", ".", "..":
+			continue
+		}
+		elems = append(elems, SanitizeName(e))
+	}
+	if len(elems) == 0 {
+		return "", fmt.Errorf("name template %q produces an empty name", t.t.Root.String())
+	}
+	return path.Join(elems...), nil
+}
+
+// SanitizeName makes s safe as a file name on common systems:
+// path separators, characters reserved on Windows and control
+// characters are replaced by underscores, and leading dots and
+// spaces are removed.
+func SanitizeName(s string) string {
+	return replaceUnsafe(strings.TrimLeft(s, ". "))
+}
+
+func replaceUnsafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case strings.ContainsRune(`/\:*?"<>|`, r), unicode.IsControl(r):
+			return '_'
+		}
+		return r
+	}, s)
+}
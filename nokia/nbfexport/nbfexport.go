@@ -0,0 +1,312 @@
+// Package nbfexport writes transcripts of text messages,
+// possibly split in several files by conversation, by year
+// and by folder. It also converts contacts and calendars
+// to the formats of current address books and calendars.
+package nbfexport
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+// A Split selects how messages are split in files.
+type Split int
+
+const (
+	SplitThread Split = 1 << iota // one file per conversation
+	SplitYear                     // one file per calendar year
+	SplitFolder                   // one file per folder
+)
+
+// ParseSplit parses a comma-separated list of "thread", "year"
+// and "folder".
+func ParseSplit(s string) (Split, error) {
+	var split Split
+	for _, f := range strings.Split(s, ",") {
+		switch strings.TrimSpace(f) {
+		case "":
+		case "thread":
+			split |= SplitThread
+		case "year":
+			split |= SplitYear
+		case "folder":
+			split |= SplitFolder
+		default:
+			return 0, fmt.Errorf("invalid split %q", f)
+		}
+	}
+	return split, nil
+}
+
+// Options control exports.
+type Options struct {
+	Split Split
+	Name  *NameTemplate // nil for the default names, see Plan
+
+	// Template, if not nil, formats transcripts instead of
+	// WriteTranscript (see ParseTemplate).
+	Template *template.Template
+
+	Locale *Locale // formatting dates, nil for ISO 8601
+
+	// DryRun makes Write return the files it would write
+	// without writing anything.
+	DryRun bool
+
+	// Backup keeps replaced files, see WriteFile.
+	Backup bool
+}
+
+// A File is a transcript file.
+type File struct {
+	Name     string // relative to the output directory, slash-separated
+	Peer     string // thread peer, if split by thread
+	PeerName string // see nbf.ThreadName
+	Exists   bool   // the file exists and is overwritten (set by Write)
+	Year     int    // if split by year
+	Folder   string // folder name, if split by folder
+	Messages []nbf.SMS
+}
+
+// IndexName is the name of the index file written by Write
+// when messages are split in several files.
+const IndexName = "index.txt"
+
+// Plan returns the files holding msgs, sorted by name. Messages
+// of each file are in the default order (see nbf.ByDate).
+//
+// Files are named by opts.Name, with extension ".txt", or by
+// default "messages.txt", "peer.txt", "year.txt" or "peer-year.txt"
+// depending on opts.Split, in a directory named after the folder
+// if split by folder. A number is appended to duplicate names.
+func Plan(msgs []nbf.SMS, opts Options) ([]File, error) {
+	type key struct {
+		peer   string
+		year   int
+		folder int
+	}
+	files := make(map[key]*File)
+	for _, m := range msgs {
+		var k key
+		if opts.Split&SplitThread != 0 {
+			k.peer = nbf.ThreadPeer(m)
+		}
+		if opts.Split&SplitYear != 0 {
+			k.year = m.When.Year()
+		}
+		if opts.Split&SplitFolder != 0 {
+			k.folder = m.Folder
+		}
+		f := files[k]
+		if f == nil {
+			f = &File{Peer: k.peer, Year: k.year}
+			if opts.Split&SplitFolder != 0 {
+				f.Folder = nbf.FolderName(k.folder)
+			}
+			files[k] = f
+		}
+		if f.PeerName == "" || f.PeerName == f.Peer {
+			f.PeerName = nbf.ThreadName(m)
+		}
+		f.Messages = append(f.Messages, m)
+	}
+	list := make([]File, 0, len(files))
+	for _, f := range files {
+		nbf.SortBy(f.Messages)
+		list = append(list, *f)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Folder != list[j].Folder {
+			return list[i].Folder < list[j].Folder
+		}
+		if list[i].Peer != list[j].Peer {
+			return list[i].Peer < list[j].Peer
+		}
+		return list[i].Year < list[j].Year
+	})
+	// Distinct peers may have the same file name.
+	seen := make(map[string]bool)
+	for i := range list {
+		f := &list[i]
+		if opts.Name == nil {
+			f.Name = fileName(f.Peer, f.Year, opts.Split)
+			if opts.Split&SplitFolder != 0 {
+				f.Name = SanitizeName(f.Folder) + "/" + f.Name
+			}
+		} else {
+			name, err := opts.Name.Name(NameData{
+				Peer:     orUnknown(f.Peer),
+				PeerName: orUnknown(f.PeerName),
+				Date:     f.Messages[0].When,
+				Year:     f.Messages[0].When.Year(),
+				Folder:   nbf.FolderName(f.Messages[0].Folder),
+				Index:    i,
+				Ext:      ".txt",
+			})
+			if err != nil {
+				return nil, err
+			}
+			f.Name = name
+		}
+		name := f.Name
+		ext := path.Ext(name)
+		for n := 2; seen[name]; n++ {
+			name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(f.Name, ext), n, ext)
+		}
+		f.Name = name
+		seen[name] = true
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func fileName(peer string, year int, split Split) string {
+	var parts []string
+	if split&SplitThread != 0 {
+		parts = append(parts, SanitizeName(orUnknown(peer)))
+	}
+	if split&SplitYear != 0 {
+		parts = append(parts, strconv.Itoa(year))
+	}
+	if len(parts) == 0 {
+		return "messages.txt"
+	}
+	return strings.Join(parts, "-") + ".txt"
+}
+
+func orUnknown(peer string) string {
+	if peer == "" {
+		return "unknown"
+	}
+	return peer
+}
+
+// Write writes transcripts of msgs in directory dir, as planned
+// by Plan, and an index file IndexName if opts.Split is not zero.
+// It returns the transcript files.
+func Write(dir string, msgs []nbf.SMS, opts Options) ([]File, error) {
+	return WriteContext(context.Background(), dir, msgs, opts)
+}
+
+// WriteContext is like Write, but stops when ctx is done, returning
+// the error of ctx. Files written so far are kept, the file being
+// written is left unmodified.
+func WriteContext(ctx context.Context, dir string, msgs []nbf.SMS, opts Options) ([]File, error) {
+	files, err := Plan(msgs, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(files[i].Name)))
+		files[i].Exists = err == nil
+	}
+	if opts.DryRun {
+		return files, nil
+	}
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		name := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return nil, err
+		}
+		if err := WriteFile(name, opts.Backup, func(w io.Writer) error {
+			w = ctxWriter{ctx, w}
+			if opts.Template != nil {
+				return WriteTemplate(w, opts.Template, f, opts.Locale)
+			}
+			return WriteTranscript(w, f.Messages, opts.Locale)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Split == 0 {
+		return files, nil
+	}
+	return files, WriteFile(filepath.Join(dir, IndexName), opts.Backup, func(w io.Writer) error {
+		return WriteIndex(w, files)
+	})
+}
+
+// A ctxWriter fails when its context is done, interrupting
+// the writing of large transcripts.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// WriteTranscript writes msgs as text, one message per line:
+//
+//	2006-01-02 15:04  < +33612345678: received text
+//	2006-01-02 15:05  > +33612345678: sent text [delivered 2006-01-02 15:06]
+//
+// Dates are formatted by loc. Continuation lines of texts are
+// indented. Sent messages are marked with their delivery status,
+// if known.
+func WriteTranscript(w io.Writer, msgs []nbf.SMS, loc *Locale) error {
+	for _, m := range msgs {
+		dir := "<"
+		if m.Direction != nbf.Received {
+			dir = ">"
+		}
+		date := loc.DateTime(m.When)
+		text := indent(utf8.RuneCountInString(date)+4, m.Text)
+		if _, err := fmt.Fprintf(w, "%s  %s %s: %s%s\n",
+			date, dir, nbf.ThreadPeer(m), text, deliveryMark(m, loc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliveryMark returns the delivery status of m
+// for transcripts.
+func deliveryMark(m nbf.SMS, loc *Locale) string {
+	switch m.DeliveryStatus {
+	case nbf.Delivered:
+		if !m.DeliveredAt.IsZero() {
+			return " [delivered " + loc.DateTime(m.DeliveredAt) + "]"
+		}
+		return " [delivered]"
+	case nbf.DeliveryPending, nbf.DeliveryFailed:
+		return " [" + m.DeliveryStatus.String() + "]"
+	}
+	return ""
+}
+
+// WriteIndex writes a table of files: name, peer, year, number
+// of messages and dates of the first and last message.
+func WriteIndex(w io.Writer, files []File) error {
+	tw := bufio.NewWriter(w)
+	fmt.Fprintf(tw, "FILE\tPEER\tYEAR\tMESSAGES\tFIRST\tLAST\n")
+	for _, f := range files {
+		year := ""
+		if f.Year != 0 {
+			year = strconv.Itoa(f.Year)
+		}
+		first, last := f.Messages[0].When, f.Messages[len(f.Messages)-1].When
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", f.Name, f.Peer, year, len(f.Messages),
+			first.Format("2006-01-02"), last.Format("2006-01-02"))
+	}
+	return tw.Flush()
+}
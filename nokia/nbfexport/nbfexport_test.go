@@ -0,0 +1,499 @@
+package nbfexport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+func TestPlan(t *testing.T) {
+	t0 := time.Date(2010, 12, 31, 23, 0, 0, 0, time.UTC)
+	msgs := []nbf.SMS{
+		{Direction: nbf.Received, Peer: "+33612345678", When: t0.Add(2 * time.Hour), Text: "Bonne année"},
+		{Direction: nbf.Received, Peer: "+33612345678", When: t0, Text: "Bientôt minuit"},
+		{Direction: nbf.Received, Peer: "a/b", When: t0, Text: "x"},
+		{Direction: nbf.Received, Peer: "a_b", When: t0, Text: "y"},
+	}
+	var names []string
+	files, err := Plan(msgs, Options{Split: SplitThread | SplitYear})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	want := []string{"+33612345678-2010.txt", "+33612345678-2011.txt", "a_b-2010-2.txt", "a_b-2010.txt"}
+	if len(names) != len(want) {
+		t.Fatalf("got files %q, expected %q", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("got files %q, expected %q", names, want)
+			break
+		}
+	}
+
+	folders := []nbf.SMS{
+		{Direction: nbf.Received, Folder: nbf.FolderInbox, Peer: "+33612345678", When: t0, Text: "a"},
+		{Direction: nbf.Draft, Folder: nbf.FolderDrafts, Peer: "+33612345678", When: t0, Text: "b"},
+		{Direction: nbf.Received, Folder: 8, Peer: "+33612345678", When: t0, Text: "c"},
+	}
+	files, err = Plan(folders, Options{Split: SplitFolder})
+	if err != nil || len(files) != 3 {
+		t.Fatalf("got %+v, %v", files, err)
+	}
+	for i, want := range []string{"Drafts/messages.txt", "Folder 8/messages.txt", "Inbox/messages.txt"} {
+		if files[i].Name != want {
+			t.Errorf("file %d: got %q, want %q", i, files[i].Name, want)
+		}
+	}
+
+	files, err = Plan(msgs[:2], Options{})
+	if err != nil || len(files) != 1 || files[0].Name != "messages.txt" {
+		t.Fatalf("got %+v", files)
+	}
+	var buf bytes.Buffer
+	if err := WriteTranscript(&buf, files[0].Messages, nil); err != nil {
+		t.Fatal(err)
+	}
+	const transcript = "2010-12-31 23:00  < +33612345678: Bientôt minuit\n" +
+		"2011-01-01 01:00  < +33612345678: Bonne année\n"
+	if buf.String() != transcript {
+		t.Errorf("got transcript:\n%s", buf.String())
+	}
+}
+
+func TestNameTemplate(t *testing.T) {
+	t0 := time.Date(2010, 12, 31, 23, 0, 0, 0, time.UTC)
+	msgs := []nbf.SMS{
+		{Direction: nbf.Sent, Type: 1, Peers: []string{"+33612345678 <Jean: \"JD\">"}, When: t0, Text: "a"},
+		{Direction: nbf.Received, Peer: "+33612345678", When: t0.Add(time.Hour), Text: "b"},
+		{Direction: nbf.Received, Peer: "../x", When: t0, Text: "c"},
+	}
+	tmpl := MustParseNameTemplate(`{{.Year}}/{{.PeerName}}{{.Ext}}`)
+	files, err := Plan(msgs, Options{Split: SplitThread, Name: tmpl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Name != "2010/Jean_ _JD_.txt" || files[1].Name != "2010/_x.txt" {
+		t.Errorf("got files %+v", files)
+	}
+
+	for _, tt := range []struct{ tmpl, name string }{
+		{"{{.Peer}}-{{.Index}}", "_x-1"},
+		{"/../{{.Peer}}/./", "_x"},
+		{" .hidden:{{.Year}}", "hidden_2010"},
+	} {
+		name, err := MustParseNameTemplate(tt.tmpl).Name(NameData{Peer: "../x", Year: 2010, Index: 1})
+		if err != nil || name != tt.name {
+			t.Errorf("%q: got %q, %v, expected %q", tt.tmpl, name, err, tt.name)
+		}
+	}
+	if _, err := MustParseNameTemplate("{{.Missing}}").Name(NameData{}); err == nil {
+		t.Errorf("expected error for missing field")
+	}
+	if _, err := MustParseNameTemplate("/").Name(NameData{}); err == nil {
+		t.Errorf("expected error for empty name")
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	t0 := time.Date(2010, 12, 31, 23, 0, 0, 0, time.UTC)
+	msgs := []nbf.SMS{
+		{Direction: nbf.Received, Peer: "+33612345678", When: t0.Add(time.Hour), Text: "b\nc"},
+		{Direction: nbf.Sent, Type: 1, Peers: []string{"+33612345678 <Jean>"}, When: t0, Text: "a"},
+	}
+	name := filepath.Join(t.TempDir(), "t.tmpl")
+	const tmpl = `{{.File.Name}}: {{len .Threads}} thread(s)
+{{range .Messages}}{{date "15:04" .When}} {{.Direction}} {{peerName .}}: {{indent 2 .Text}}
+{{end}}`
+	if err := os.WriteFile(name, []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tm, err := ParseTemplate(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if _, err := Write(dir, msgs, Options{Template: tm}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(filepath.Join(dir, "messages.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "messages.txt: 1 thread(s)\n" +
+		"23:00 sent Jean: a\n" +
+		"00:00 received +33612345678: b\n  c\n"
+	if string(out) != want {
+		t.Errorf("got:\n%s", out)
+	}
+}
+
+func TestLocale(t *testing.T) {
+	t0 := time.Date(2010, 12, 31, 23, 5, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name           string
+		date, long, dt string
+	}{
+		{"", "2010-12-31", "31 December 2010", "2010-12-31 23:05"},
+		{"en_US.UTF-8", "12/31/2010", "December 31, 2010", "12/31/2010 11:05 PM"},
+		{"en-GB", "31/12/2010", "31 December 2010", "31/12/2010 23:05"},
+		{"fr_CA", "31/12/2010", "31 décembre 2010", "31/12/2010 23:05"},
+		{"de_DE@euro", "31.12.2010", "31. Dezember 2010", "31.12.2010 23:05"},
+	} {
+		loc, err := LookupLocale(tt.name)
+		if err != nil {
+			t.Errorf("%q: %s", tt.name, err)
+			continue
+		}
+		if d, l, dt := loc.Date(t0), loc.LongDate(t0), loc.DateTime(t0); d != tt.date || l != tt.long || dt != tt.dt {
+			t.Errorf("%q: got %q, %q, %q", tt.name, d, l, dt)
+		}
+	}
+	if _, err := LookupLocale("xx"); err == nil {
+		t.Errorf("expected error for unknown locale")
+	}
+
+	var buf bytes.Buffer
+	msgs := []nbf.SMS{
+		{Direction: nbf.Sent, Peer: "+33612345678", When: t0, Text: "a\nb"},
+		{Direction: nbf.Sent, Peer: "+33612345678", When: t0, Text: "c",
+			DeliveryStatus: nbf.Delivered, DeliveredAt: t0.Add(time.Minute)},
+		{Direction: nbf.Sent, Peer: "+33612345678", When: t0, Text: "d", DeliveryStatus: nbf.DeliveryFailed},
+	}
+	if err := WriteTranscript(&buf, msgs, Locales["en-US"]); err != nil {
+		t.Fatal(err)
+	}
+	want := "12/31/2010 11:05 PM  > +33612345678: a\n" + strings.Repeat(" ", 23) + "b\n" +
+		"12/31/2010 11:05 PM  > +33612345678: c [delivered 12/31/2010 11:06 PM]\n" +
+		"12/31/2010 11:05 PM  > +33612345678: d [failed]\n"
+	if buf.String() != want {
+		t.Errorf("got transcript:\n%q", buf.String())
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	t0 := time.Date(2010, 12, 31, 23, 0, 0, 0, time.UTC)
+	msgs := []nbf.SMS{
+		{Direction: nbf.Received, Peer: "+33612345678", When: t0, Text: "a"},
+		{Direction: nbf.Received, Peer: "+33687654321", When: t0, Text: "b"},
+		{Direction: nbf.Received, Peer: "+33687654321", When: t0, Text: "c"},
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "+33612345678.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := Write(dir, msgs, Options{Split: SplitThread, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || !files[0].Exists || files[1].Exists {
+		t.Errorf("got files %+v", files)
+	}
+	if ents, _ := os.ReadDir(dir); len(ents) != 1 {
+		t.Errorf("dry run wrote %d files", len(ents)-1)
+	}
+
+	var buf bytes.Buffer
+	r := Report{W: &buf}
+	for _, f := range files {
+		r.Add(filepath.Join(dir, f.Name), len(f.Messages))
+	}
+	r.Summary()
+	want := "overwrite  " + filepath.Join(dir, "+33612345678.txt") + " (1 messages)\n" +
+		"create     " + filepath.Join(dir, "+33687654321.txt") + " (2 messages)\n" +
+		"dry run: 1 files to create, 1 to overwrite, 3 messages\n"
+	if buf.String() != want {
+		t.Errorf("got report:\n%s", buf.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := WriteContext(ctx, dir, msgs, Options{Split: SplitThread}); !errors.Is(err, context.Canceled) {
+		t.Errorf("WriteContext: got error %v", err)
+	}
+	if ents, _ := os.ReadDir(dir); len(ents) != 1 {
+		t.Errorf("canceled export wrote %d files", len(ents)-1)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.txt")
+	write := func(s string) func(io.Writer) error {
+		return func(w io.Writer) error {
+			io.WriteString(w, s)
+			if s == "" {
+				return errors.New("interrupted")
+			}
+			return nil
+		}
+	}
+	if err := WriteFile(name, true, write("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(name, true, write("v2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(name, true, write("")); err == nil {
+		t.Fatal("expected error")
+	}
+	for file, want := range map[string]string{"a.txt": "v2", "a.txt.bak": "v1"} {
+		if data, err := os.ReadFile(filepath.Join(dir, file)); err != nil || string(data) != want {
+			t.Errorf("%s: got %q, %v, expected %q", file, data, err, want)
+		}
+	}
+	if ents, _ := os.ReadDir(dir); len(ents) != 2 {
+		t.Errorf("got %d files, expected 2", len(ents))
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 100))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	var src, dst bytes.Buffer
+	png.Encode(&src, img)
+	if err := WriteThumbnail(&dst, &src, 80); err != nil {
+		t.Fatal(err)
+	}
+	cfg, format, err := image.DecodeConfig(&dst)
+	if err != nil || format != "jpeg" || cfg.Width != 80 || cfg.Height != 20 {
+		t.Errorf("got %s image %dx%d, %v", format, cfg.Width, cfg.Height, err)
+	}
+	if name := ThumbnailName("peer/2010/pic.gif"); name != "peer/2010/thumbs/pic.jpg" {
+		t.Errorf("got thumbnail name %q", name)
+	}
+}
+
+func TestConverters(t *testing.T) {
+	ctype, c, err := ParseCommand("audio/amr=.txt:tr a-z A-Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctype != "audio/amr" || c.Path != "tr" || len(c.Args) != 2 {
+		t.Errorf("got %q, %+v", ctype, c)
+	}
+	for _, s := range []string{"audio/amr", "audio/amr=mp3:ffmpeg", "audio/amr=.mp3:", "=.mp3:ffmpeg"} {
+		if _, _, err := ParseCommand(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+
+	var r ConverterRegistry
+	r.Register(ctype, c)
+	if _, ok := r.Lookup("video/3gpp"); ok {
+		t.Errorf("found unregistered converter")
+	}
+	conv, ok := r.Lookup("audio/amr")
+	if !ok {
+		t.Fatal("converter not registered")
+	}
+	if name := ConvertedName("dir/voice.amr", conv); name != "dir/voice.txt" {
+		t.Errorf("got converted name %q", name)
+	}
+	if _, err := exec.LookPath("tr"); err != nil {
+		t.Skip("no tr command")
+	}
+	var out bytes.Buffer
+	if err := conv.Convert(context.Background(), &out, strings.NewReader("hello")); err != nil || out.String() != "HELLO" {
+		t.Errorf("got %q, %v", out.String(), err)
+	}
+	bad := &Command{Path: "false"}
+	if err := bad.Convert(context.Background(), &out, strings.NewReader("")); err == nil {
+		t.Errorf("failing command: no error")
+	}
+}
+
+func TestVCard(t *testing.T) {
+	contacts := []nbf.Contact{{
+		Name: "Dupont, Jean", Family: "Dupont", Given: "Jean",
+		Phones: []nbf.Phone{
+			{Types: []string{"CELL", "PREF"}, Number: "+33612345678"},
+			{Types: []string{"WORK", "VOICE"}, Number: "+33123456789"},
+			{Types: []string{"MODEM"}, Number: "+33198765432"},
+		},
+		Emails: []string{"jean@example.com"},
+		Note:   "Code: 1234; étage 2\nporte gauche, " + strings.Repeat("très long ", 8),
+	}, {
+		Phones: []nbf.Phone{{Number: "123"}},
+	}}
+	var buf bytes.Buffer
+	if err := WriteVCards(&buf, contacts, VCard40); err != nil {
+		t.Fatal(err)
+	}
+	want := "BEGIN:VCARD\r\n" +
+		"VERSION:4.0\r\n" +
+		"FN:Dupont\\, Jean\r\n" +
+		"N:Dupont;Jean;;;\r\n" +
+		"UID:urn:uuid:8cdc72c1-db0a-5059-9cab-b529fc4b244b\r\n" +
+		"TEL;TYPE=cell;PREF=1:+33612345678\r\n" +
+		"TEL;TYPE=work,voice:+33123456789\r\n" +
+		"TEL:+33198765432\r\n" +
+		"EMAIL:jean@example.com\r\n" +
+		"NOTE:Code: 1234\\; étage 2\\nporte gauche\\, très long très long très long\r\n" +
+		"  très long très long très long très long très long \r\n" +
+		"END:VCARD\r\n" +
+		"BEGIN:VCARD\r\n" +
+		"VERSION:4.0\r\n" +
+		"FN:123\r\n" +
+		"N:;;;;\r\n" +
+		"UID:urn:uuid:f042aefc-fdaf-569b-a432-da9f980b442c\r\n" +
+		"TEL:123\r\n" +
+		"END:VCARD\r\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	WriteVCards(&buf, contacts[:1], VCard30)
+	for _, line := range []string{
+		"VERSION:3.0\r\n",
+		"UID:8cdc72c1-db0a-5059-9cab-b529fc4b244b\r\n",
+		"TEL;TYPE=CELL,PREF:+33612345678\r\n",
+		"TEL;TYPE=MODEM:+33198765432\r\n",
+		"EMAIL;TYPE=INTERNET:jean@example.com\r\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("vCard 3.0: missing %q", line)
+		}
+	}
+	if err := WriteVCards(&buf, nil, "2.1"); err == nil {
+		t.Errorf("vCard 2.1: no error")
+	}
+
+	names := ContactFileNames([]nbf.Contact{{Name: "A/B"}, {Name: "a/b"}, {Phones: []nbf.Phone{{Number: "+1"}}}, {}})
+	if got := strings.Join(names, " "); got != "A_B.vcf a_b-2.vcf +1.vcf contact.vcf" {
+		t.Errorf("got file names %s", got)
+	}
+}
+
+func TestContactsCSV(t *testing.T) {
+	contacts := []nbf.Contact{{
+		Name: "Jean Dupont", Family: "Dupont", Given: "Jean",
+		Phones: []nbf.Phone{
+			{Types: []string{"CELL"}, Number: "+33612345678"},
+			{Types: []string{"WORK", "FAX"}, Number: "+33123456789"},
+			{Types: []string{"CELL"}, Number: "+33687654321"},
+		},
+		Emails: []string{"jean@example.com"},
+		Note:   "a, b",
+	}, {
+		Name:   "Taxi",
+		Phones: []nbf.Phone{{Number: "3607"}},
+	}}
+	var buf bytes.Buffer
+	if err := WriteContactsCSV(&buf, contacts, GoogleCSV); err != nil {
+		t.Fatal(err)
+	}
+	want := "Name,Given Name,Family Name,Notes,Group Membership," +
+		"E-mail 1 - Type,E-mail 1 - Value," +
+		"Phone 1 - Type,Phone 1 - Value,Phone 2 - Type,Phone 2 - Value,Phone 3 - Type,Phone 3 - Value\n" +
+		`Jean Dupont,Jean,Dupont,"a, b",* myContacts,* Other,jean@example.com,` +
+		"Mobile,+33612345678,Work Fax,+33123456789,Mobile,+33687654321\n" +
+		"Taxi,,,,* myContacts,,,Other,3607,,,,\n"
+	if buf.String() != want {
+		t.Errorf("Google: got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteContactsCSV(&buf, contacts, OutlookCSV); err != nil {
+		t.Fatal(err)
+	}
+	want = "First Name,Last Name,E-mail Address,E-mail 2 Address,E-mail 3 Address," +
+		"Mobile Phone,Home Phone,Home Phone 2,Business Phone,Business Phone 2," +
+		"Home Fax,Business Fax,Pager,Other Phone,Notes\r\n" +
+		`Jean,Dupont,jean@example.com,,,+33612345678,,,,,,+33123456789,,,"a, b` + "\r\n" +
+		`Phone: +33687654321"` + "\r\n" +
+		"Taxi,,,,,,,,,,,,,3607,\r\n"
+	if buf.String() != want {
+		t.Errorf("Outlook: got\n%q\nwant\n%q", buf.String(), want)
+	}
+}
+
+func TestICalendar(t *testing.T) {
+	start := time.Date(2010, 1, 4, 9, 0, 0, 0, time.UTC)
+	entries := []nbf.CalendarEntry{{
+		UID: "1", Stamp: start.AddDate(0, 0, -1),
+		Summary: "Réunion; salle 2", Categories: []string{"MEETING"},
+		Start: start, End: start.Add(time.Hour),
+		Rule: "W1 MO #10", Alarm: start.Add(-10 * time.Minute),
+	}, {
+		UID: "2", Stamp: start, Summary: "Anniversaire",
+		Start: time.Date(2010, 3, 15, 0, 0, 0, 0, time.Local), AllDay: true,
+		Rule: "YD1 #0",
+	}}
+	var buf bytes.Buffer
+	if err := WriteICalendar(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	want := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"PRODID:-//remyoudompheng//go-misc nbftool//EN\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:1\r\n" +
+		"DTSTAMP:20100103T090000Z\r\n" +
+		"DTSTART:20100104T090000Z\r\n" +
+		"DTEND:20100104T100000Z\r\n" +
+		"SUMMARY:Réunion\\; salle 2\r\n" +
+		"CATEGORIES:MEETING\r\n" +
+		"RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=10\r\n" +
+		"BEGIN:VALARM\r\n" +
+		"ACTION:DISPLAY\r\n" +
+		"DESCRIPTION:Réunion\\; salle 2\r\n" +
+		"TRIGGER:-PT10M\r\n" +
+		"END:VALARM\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:2\r\n" +
+		"DTSTAMP:20100104T090000Z\r\n" +
+		"DTSTART;VALUE=DATE:20100315\r\n" +
+		"DTEND;VALUE=DATE:20100316\r\n" +
+		"SUMMARY:Anniversaire\r\n" +
+		"RRULE:FREQ=YEARLY\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	for _, tt := range []struct{ in, out string }{
+		{"D1 #0", "FREQ=DAILY"},
+		{"W2 #0", "FREQ=WEEKLY;INTERVAL=2"},
+		{"W1 MO WE FR 20101231T000000Z", "FREQ=WEEKLY;BYDAY=MO,WE,FR;UNTIL=20101231T000000Z"},
+		{"MP1 1+ MO 1- FR #6", "FREQ=MONTHLY;BYDAY=1MO,-1FR;COUNT=6"},
+		{"MD1 15 LD #0", "FREQ=MONTHLY;BYMONTHDAY=15,-1"},
+		{"YM1 6 12 #0", "FREQ=YEARLY;BYMONTH=6,12"},
+		{"", ""},
+		{"X1 #0", ""},
+		{"W1 XX #0", ""},
+	} {
+		got, ok := ICalRule(tt.in)
+		if got != tt.out || ok != (tt.out != "") {
+			t.Errorf("ICalRule(%q) = %q, %v, want %q", tt.in, got, ok, tt.out)
+		}
+	}
+	for d, want := range map[time.Duration]string{
+		-10 * time.Minute:             "-PT10M",
+		-(26*time.Hour + time.Second): "-P1DT2H1S",
+		-24 * time.Hour:               "-P1D",
+		0:                             "PT0S",
+	} {
+		if got := icalDuration(d); got != want {
+			t.Errorf("icalDuration(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package nbfexport
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// A Report lists the files a writer would create or overwrite,
+// for dry runs of conversions.
+type Report struct {
+	W                    io.Writer
+	Created, Overwritten int // numbers of files
+	Messages             int // total number of messages
+}
+
+// Add reports that file name would be written with n messages,
+// or n < 0 if it does not hold messages.
+func (r *Report) Add(name string, n int) {
+	action := "create"
+	if _, err := os.Stat(name); err == nil {
+		action = "overwrite"
+		r.Overwritten++
+	} else {
+		r.Created++
+	}
+	if n < 0 {
+		fmt.Fprintf(r.W, "%-9s  %s\n", action, name)
+		return
+	}
+	r.Messages += n
+	fmt.Fprintf(r.W, "%-9s  %s (%d messages)\n", action, name, n)
+}
+
+// Summary prints the totals of the report.
+func (r *Report) Summary() {
+	fmt.Fprintf(r.W, "dry run: %d files to create, %d to overwrite, %d messages\n",
+		r.Created, r.Overwritten, r.Messages)
+}
@@ -0,0 +1,74 @@
+package nbfexport
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+// TemplateData is the data of transcript templates.
+type TemplateData struct {
+	File     File
+	Messages []nbf.SMS    // File.Messages
+	Threads  []nbf.Thread // messages grouped by conversation, most recent first
+	Locale   *Locale      // as {{.Locale.DateTime .When}}
+}
+
+// TemplateFuncs are the functions available to transcript
+// templates, in addition to the text/template builtins:
+//
+//	peer      the thread peer of a message (nbf.ThreadPeer)
+//	peerName  the name of the thread peer, if known (nbf.ThreadName)
+//	date      formats a time with a layout: {{date "2006-01-02" .When}}
+//	indent    indents continuation lines of a text by n spaces
+//	lines     splits a text in lines
+var TemplateFuncs = template.FuncMap{
+	"peer":     nbf.ThreadPeer,
+	"peerName": nbf.ThreadName,
+	"date":     formatDate,
+	"indent":   indent,
+	"lines":    lines,
+}
+
+// ParseTemplate parses the transcript template in file name.
+// Templates are executed for each transcript file with
+// a TemplateData, for example
+//
+//	{{range .Messages}}{{$.Locale.DateTime .When}} {{.Direction}} {{peer .}}
+//	{{indent 2 .Text}}
+//	{{end}}
+func ParseTemplate(name string) (*template.Template, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(filepath.Base(name)).Funcs(TemplateFuncs).Parse(string(data))
+}
+
+// WriteTemplate writes the transcript of f using t and loc.
+func WriteTemplate(w io.Writer, t *template.Template, f File, loc *Locale) error {
+	return t.Execute(w, TemplateData{
+		File:     f,
+		Messages: f.Messages,
+		Threads:  nbf.Threads(f.Messages),
+		Locale:   loc,
+	})
+}
+
+func formatDate(layout string, t time.Time) string {
+	return t.Format(layout)
+}
+
+func indent(n int, text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.ReplaceAll(text, "\n", "\n"+strings.Repeat(" ", n))
+}
+
+func lines(text string) []string {
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
@@ -0,0 +1,71 @@
+package nbfexport
+
+import (
+	"image"
+	_ "image/gif" // decoding gallery and MMS images
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"path"
+	"strings"
+)
+
+// Thumbnails are small JPEG copies of images, for HTML transcripts
+// and galleries linking to the original files.
+
+// ThumbnailDir is the directory of thumbnails, relative to the
+// directory of their images.
+const ThumbnailDir = "thumbs"
+
+// ThumbnailName returns the name of the thumbnail of the image
+// file name, slash-separated.
+func ThumbnailName(name string) string {
+	dir, base := path.Split(name)
+	return dir + ThumbnailDir + "/" + strings.TrimSuffix(base, path.Ext(base)) + ".jpg"
+}
+
+// WriteThumbnail decodes a JPEG, GIF or PNG image from r and writes
+// it to w as a JPEG image at most size pixels wide and high.
+// Smaller images are not enlarged.
+func WriteThumbnail(w io.Writer, r io.Reader, size int) error {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return err
+	}
+	return jpeg.Encode(w, scaleDown(img, size), &jpeg.Options{Quality: 80})
+}
+
+// scaleDown shrinks img to fit in a size×size square, averaging
+// the pixels of the source covered by each pixel of the result.
+func scaleDown(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw <= size && sh <= size {
+		return img
+	}
+	w, h := size, sh*size/sw
+	if sh > sw {
+		w, h = sw*size/sh, size
+	}
+	w, h = max(w, 1), max(h, 1)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*sh/h, b.Min.Y+(y+1)*sh/h
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*sw/w, b.Min.X+(x+1)*sw/w
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(bl / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,180 @@
+package nbfexport
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+// Contacts are stored as vCard 2.1 in archives, which current
+// phones and address books import poorly. They are written
+// as vCard 3.0 (RFC 2426) or 4.0 (RFC 6350).
+
+// vCard versions.
+const (
+	VCard30 = "3.0"
+	VCard40 = "4.0"
+)
+
+// WriteVCards writes contacts to w as vCards of the given version.
+func WriteVCards(w io.Writer, contacts []nbf.Contact, version string) error {
+	if version != VCard30 && version != VCard40 {
+		return fmt.Errorf("unsupported vCard version %q", version)
+	}
+	bw := bufio.NewWriter(w)
+	for _, c := range contacts {
+		writeVCard(bw, c, version)
+	}
+	return bw.Flush()
+}
+
+func writeVCard(w *bufio.Writer, c nbf.Contact, version string) {
+	line := func(name, value string) {
+		writeFolded(w, name+":"+value)
+	}
+	line("BEGIN", "VCARD")
+	line("VERSION", version)
+	fn := c.Name
+	if fn == "" && len(c.Phones) > 0 {
+		fn = c.Phones[0].Number // FN is mandatory
+	}
+	line("FN", escapeVCard(fn))
+	line("N", escapeVCard(c.Family)+";"+escapeVCard(c.Given)+";;;")
+	if version == VCard30 {
+		line("UID", ContactUID(c))
+	} else {
+		line("UID", "urn:uuid:"+ContactUID(c))
+	}
+	for _, p := range c.Phones {
+		line("TEL"+telParams(p.Types, version), escapeVCard(p.Number))
+	}
+	for _, e := range c.Emails {
+		if version == VCard30 {
+			line("EMAIL;TYPE=INTERNET", escapeVCard(e))
+		} else {
+			line("EMAIL", escapeVCard(e))
+		}
+	}
+	if c.Note != "" {
+		line("NOTE", escapeVCard(c.Note))
+	}
+	line("END", "VCARD")
+}
+
+// ContactUID returns a UUID identifying c, derived from its
+// contents, so that contacts exported again replace their
+// previous copies in address books.
+func ContactUID(c nbf.Contact) string {
+	fields := []string{c.NBFFile, c.Name, c.Family, c.Given}
+	for _, p := range c.Phones {
+		fields = append(fields, p.Number)
+	}
+	return hashUUID(fields)
+}
+
+// hashUUID returns a name-based UUID derived from fields.
+func hashUUID(fields []string) string {
+	u := sha1.Sum([]byte(strings.Join(fields, "\x00")))
+	u[6] = u[6]&0x0f | 0x50 // version 5
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// telTypes maps vCard 2.1 telephone types to vCard 4.0 types.
+// vCard 3.0 keeps the types of vCard 2.1.
+var telTypes = map[string]string{
+	"CELL":  "cell",
+	"HOME":  "home",
+	"WORK":  "work",
+	"VOICE": "voice",
+	"FAX":   "fax",
+	"PAGER": "pager",
+	"VIDEO": "video",
+	"MSG":   "text",
+}
+
+// telParams returns the parameters of a TEL property having
+// the given vCard 2.1 types.
+func telParams(types []string, version string) string {
+	var out []string
+	pref := false
+	for _, t := range types {
+		t = strings.ToUpper(t)
+		switch {
+		case t == "PREF":
+			pref = true
+		case version == VCard30:
+			out = append(out, t)
+		case telTypes[t] != "":
+			out = append(out, telTypes[t])
+		}
+	}
+	if pref && version == VCard30 {
+		out = append(out, "PREF")
+	}
+	s := ""
+	if len(out) > 0 {
+		s = ";TYPE=" + strings.Join(out, ",")
+	}
+	if pref && version == VCard40 {
+		s += ";PREF=1"
+	}
+	return s
+}
+
+// escapeVCard escapes a text value.
+func escapeVCard(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\n", `\n`).Replace(s)
+}
+
+// writeFolded writes a content line, folded at 75 octets
+// without splitting UTF-8 sequences.
+func writeFolded(w *bufio.Writer, line string) {
+	const max = 75
+	for first := true; ; first = false {
+		n := max
+		if !first {
+			n = max - 1 // after the leading space
+			w.WriteByte(' ')
+		}
+		if len(line) <= n {
+			w.WriteString(line + "\r\n")
+			return
+		}
+		for n > 0 && !utf8.RuneStart(line[n]) {
+			n--
+		}
+		w.WriteString(line[:n] + "\r\n")
+		line = line[n:]
+	}
+}
+
+// ContactFileNames returns names of files holding contacts
+// separately, such as "Alice.vcf", adding numbers to
+// duplicate names.
+func ContactFileNames(contacts []nbf.Contact) []string {
+	names := make([]string, len(contacts))
+	seen := make(map[string]bool)
+	for i, c := range contacts {
+		base := SanitizeName(c.Name)
+		if base == "" && len(c.Phones) > 0 {
+			base = SanitizeName(c.Phones[0].Number)
+		}
+		if base == "" {
+			base = "contact"
+		}
+		name := base + ".vcf"
+		for n := 2; seen[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s-%d.vcf", base, n)
+		}
+		seen[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
@@ -3,83 +3,239 @@
 package main
 
 import (
+	"archive/zip"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"time"
 
 	//"github.com/remyoudompheng/go-misc/nokia/mms"
 	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/nbf/gsm7"
+	"github.com/remyoudompheng/go-misc/nokia/nbfexport"
 )
 
+var (
+	tz      = flag.String("tz", "", "time zone of the phone clock (default: local time zone)")
+	stamp   = flag.Bool("stamp", false, "date received messages by phone clock rather than SMSC time stamp")
+	offset  = flag.Duration("offset", 0, "correction added to the phone clock")
+	noflash = flag.Bool("noflash", false, "skip flash (class 0) messages")
+	emoji   = flag.Bool("emoji", false, "render text smileys as emoji")
+	nfc     = flag.Bool("nfc", false, "normalize texts to Unicode NFC")
+	noauto  = flag.Bool("noauto", false, "skip messages from automated senders (short codes, companies, notifications)")
+	sortBy  = flag.String("sort", "", "order of messages: comma-separated list of date, peer, length, direction, prefixed with - to reverse")
+	passwd  = flag.String("password", "", "password of encrypted archives (default: $NBFPASSWORD)")
+	backup  = flag.Bool("backup", false, "keep replaced files with a .bak suffix")
+	dryRun  = flag.Bool("dry-run", false, "report files which would be created or overwritten, without writing anything")
+	name    = flag.String("name", "", "template of message file names, such as {{.PeerName}}/{{.Date.Format \"20060102-150405\"}}{{.Ext}}")
+
+	filterFlags nbf.FilterFlags
+)
+
+func init() { filterFlags.Register(flag.CommandLine) }
+
 func main() {
-	if len(os.Args) != 3 {
-		fmt.Fprintf(os.Stderr, "Usage: %s input.nbf destdir/", os.Args[0])
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] input.nbf destdir/\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
 		os.Exit(1)
 	}
-	input := os.Args[1]
-	destdir := os.Args[2]
+	input := flag.Arg(0)
+	destdir := flag.Arg(1)
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 	log.Printf("dumping %s to %s", input, destdir)
 	f, err := nbf.OpenFile(input)
+	if errors.Is(err, zip.ErrFormat) {
+		log.Printf("%s: %s, scanning for entries", input, err)
+		f, err = nbf.RecoverFile(input)
+	}
 	if err != nil {
 		log.Fatalf("could not open %s: %s", input, err)
 	}
 	defer f.Close()
+	if *passwd == "" {
+		*passwd = os.Getenv("NBFPASSWORD")
+	}
+	if f.Encrypted() && *passwd == "" {
+		log.Fatalf("%s is encrypted, use -password", input)
+	}
+	f.Password = *passwd
+	if *tz != "" {
+		loc, err := time.LoadLocation(*tz)
+		if err != nil {
+			log.Fatal(err)
+		}
+		f.Location = loc
+		filterFlags.Location = loc
+	}
+	filter, err := filterFlags.Filter()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *noflash {
+		filter = nbf.All(filter, nbf.Not(nbf.SMS.Flash))
+	}
+	if *noauto {
+		filter = nbf.All(filter, nbf.Not(nbf.SMS.Automated))
+	}
+	order, err := nbf.ParseSort(*sortBy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var tmpl *nbfexport.NameTemplate
+	if *name != "" {
+		if tmpl, err = nbfexport.ParseNameTemplate(*name); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var report *nbfexport.Report
+	if *dryRun {
+		report = &nbfexport.Report{W: os.Stdout}
+		defer report.Summary()
+	}
+	// msgPath returns the path of the i-th message of box.
+	msgPath := func(m nbf.SMS, i int, box string) string {
+		peer := m.Peer
+		if peer == "" && len(m.Peers) > 0 {
+			peer = "multiple"
+		}
+		if tmpl == nil {
+			return filepath.Join(destdir, m.When.Format("20060102-150405")+
+				fmt.Sprintf("-%04d-%s-%s.msg", i, nbfexport.SanitizeName(peer), box))
+		}
+		name, err := tmpl.Name(nbfexport.NameData{
+			Peer:      peer,
+			PeerName:  nbf.ThreadName(m),
+			Date:      m.When,
+			Year:      m.When.Year(),
+			Direction: m.Direction.String(),
+			Index:     i,
+			Ext:       ".msg",
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		p := filepath.Join(destdir, filepath.FromSlash(name))
+		if report != nil {
+			return p
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			log.Fatal(err)
+		}
+		return p
+	}
+	if *stamp {
+		f.TimeSource = nbf.PreferStamp
+	}
+	f.TimeOffset = *offset
+	if st, err := os.Stderr.Stat(); err == nil && st.Mode()&os.ModeCharDevice != 0 {
+		f.Progress = func(done, total int) {
+			fmt.Fprintf(os.Stderr, "\r%d/%d entries", done, total)
+			if done == total {
+				fmt.Fprintln(os.Stderr)
+			}
+		}
+	}
 
-	inbox, err := f.Inbox()
+	inbox, err := f.InboxContext(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
+	nbf.SortBy(inbox, order...)
 
 	dumpMessage := func(m nbf.SMS, p string) {
-		mout, err := os.Create(p)
-		if err != nil {
-			log.Fatalf("cannot create %s/inbox: %s", destdir, err)
+		if report != nil {
+			report.Add(p, 1)
+			return
 		}
-		fmt.Fprintf(mout, "Date: %s\n", m.When.Format("02 Jan 2006 15:04:05 -0700"))
-		if m.Type == 0 {
-			fmt.Fprintf(mout, "From: %s\n", m.Peer)
-		} else {
-			for _, p := range m.Peers {
-				fmt.Fprintf(mout, "To: %s\n", p)
-			}
+		if *nfc {
+			m = m.NFC()
 		}
-		fmt.Fprintf(mout, "\n%s\n\n", m.Text)
-		err = mout.Close()
+		err := nbfexport.WriteFile(p, *backup, func(mout io.Writer) error {
+			const rfc822 = "02 Jan 2006 15:04:05 -0700"
+			fmt.Fprintf(mout, "Date: %s\n", m.When.Format(rfc822))
+			if !m.Stamp.IsZero() {
+				fmt.Fprintf(mout, "X-Phone-Date: %s\n", m.Stamp.Format(rfc822))
+			}
+			if !m.SCTS.IsZero() {
+				fmt.Fprintf(mout, "X-SMSC-Date: %s\n", m.SCTS.Format(rfc822))
+			}
+			if v := m.Voicemail; v != nil {
+				fmt.Fprintf(mout, "X-Voicemail: active=%t count=%d\n", v.Active, v.Count)
+			}
+			if m.Coding.Class != nbf.NoClass {
+				fmt.Fprintf(mout, "X-Message-Class: %d\n", m.Coding.Class-nbf.Class0)
+			}
+			if m.Direction == nbf.Received {
+				if s := nbf.Classify(m); s != nbf.Person {
+					fmt.Fprintf(mout, "X-Sender-Class: %s\n", s)
+				}
+				fmt.Fprintf(mout, "From: %s\n", m.Peer)
+			} else {
+				for _, p := range m.Peers {
+					fmt.Fprintf(mout, "To: %s\n", p)
+				}
+			}
+			text := m.Text
+			if *emoji {
+				text = gsm7.Emojify(text)
+			}
+			_, err := fmt.Fprintf(mout, "\n%s\n\n", text)
+			return err
+		})
 		if err != nil {
-			log.Fatal(err)
+			log.Fatalf("cannot write %s: %s", p, err)
 		}
 	}
 	for i, m := range inbox {
-		p := filepath.Join(destdir, m.When.Format("20060102-150405")+
-			fmt.Sprintf("-%04d-%s-inbox.msg", i, m.Peer))
-		dumpMessage(m, p)
+		if !filter.Match(m) {
+			continue
+		}
+		dumpMessage(m, msgPath(m, i, "inbox"))
 	}
 
-	outbox, err := f.Outbox()
+	outbox, err := f.OutboxContext(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
+	nbf.SortBy(outbox, order...)
 	for i, m := range outbox {
-		if m.Peer == "" && len(m.Peers) > 0 {
-			m.Peer = "multiple"
+		if !filter.Match(m) {
+			continue
 		}
-		p := filepath.Join(destdir, m.When.Format("20060102-150405")+
-			fmt.Sprintf("-%04d-%s-outbox.msg", i, m.Peer))
-		dumpMessage(m, p)
+		dumpMessage(m, msgPath(m, i, "outbox"))
 	}
 
 	images, err := f.Images()
 	if err != nil {
 		log.Fatal("cannot extract images:", err)
 	}
-	log.Printf("dumping %d images to %s", len(images), destdir)
+	if report == nil {
+		log.Printf("dumping %d images to %s", len(images), destdir)
+	}
 	for i, img := range images {
 		stamp := img.Stamp.Format("20060102-150405")
-		out := filepath.Join(destdir, fmt.Sprintf("%s-%s-%03d.%s", stamp, img.Peer, i, img.Type))
-		err := ioutil.WriteFile(out, img.Data, 0644)
+		out := filepath.Join(destdir, fmt.Sprintf("%s-%s-%03d.%s", stamp, nbfexport.SanitizeName(img.Peer), i, img.Type))
+		if report != nil {
+			report.Add(out, -1)
+			continue
+		}
+		err := nbfexport.WriteFile(out, *backup, func(w io.Writer) error {
+			_, err := w.Write(img.Data)
+			return err
+		})
 		if err != nil {
 			log.Printf("error writing image to %s: %s", out, err)
 		}
@@ -0,0 +1,385 @@
+// Package nbfindex maintains an on-disk index of messages found
+// in a collection of NBF archives, so that queries do not need
+// to parse archives again.
+package nbfindex
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha1"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+// An Index is a directory holding one file per indexed archive,
+// and an inverted index of their messages (see TextIndex).
+type Index struct {
+	dir      string
+	archives map[string]*Archive // by path
+	text     *textFile           // nil until needed
+
+	// Progress, if not nil, is called by Update after
+	// each archive is indexed.
+	Progress func(done, total int)
+
+	// Password decrypts encrypted archives (see nbf.Reader.Password).
+	Password string
+}
+
+// An Archive is the indexed contents of a NBF file.
+type Archive struct {
+	Version  int // of the decoder, see version
+	Path     string
+	Size     int64
+	ModTime  time.Time
+	Messages []nbf.SMS
+}
+
+// version is incremented when decoded messages change, so that
+// archives indexed by older versions are parsed again.
+// Version 1 decodes timestamps of entry names as DOS times,
+// version 2 records both timestamps of messages, version 3
+// their direction, version 4 the byte order of stored texts,
+// version 5 their folder, version 6 their sequence number,
+// version 7 their delivery status.
+const version = 7
+
+// Open opens the index stored in dir, creating it if necessary.
+func Open(dir string) (*Index, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	idx := &Index{dir: dir, archives: make(map[string]*Archive)}
+	files, err := filepath.Glob(filepath.Join(dir, "*.gob"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range files {
+		a, err := readArchive(name)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt index file %s: %s", name, err)
+		}
+		idx.archives[a.Path] = a
+	}
+	return idx, nil
+}
+
+func readArchive(name string) (*Archive, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	a := new(Archive)
+	err = gob.NewDecoder(f).Decode(a)
+	return a, err
+}
+
+func (idx *Index) filename(path string) string {
+	return archiveFile(idx.dir, path)
+}
+
+func archiveFile(dir, path string) string {
+	return filepath.Join(dir, fmt.Sprintf("%x.gob", sha1.Sum([]byte(path))))
+}
+
+func (a *Archive) upToDate(info os.FileInfo) bool {
+	return a.Version == version && a.Size == info.Size() && a.ModTime.Equal(info.ModTime())
+}
+
+// Load returns the messages of the archive at path. They are read
+// from the index in dir if it is up to date with the archive size and
+// modification time; otherwise the archive is parsed and
+// the index updated.
+func Load(dir, path string) ([]nbf.SMS, error) {
+	return LoadContext(context.Background(), dir, path)
+}
+
+// LoadContext is like Load, but stops parsing the archive
+// when ctx is done.
+func LoadContext(ctx context.Context, dir, path string) ([]nbf.SMS, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if a, err := readArchive(archiveFile(dir, path)); err == nil && a.Path == path && a.upToDate(info) {
+		return a.Messages, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	a, err := parseArchive(ctx, path, info, "")
+	if err != nil {
+		return nil, err
+	}
+	return a.Messages, writeArchive(dir, a)
+}
+
+// Update indexes new and modified .nbf files under root, and
+// forgets about archives that no longer exist.
+func (idx *Index) Update(root string) (added, removed int, err error) {
+	return idx.UpdateContext(context.Background(), root)
+}
+
+// UpdateContext is like Update, but stops when ctx is done,
+// returning the error of ctx. Archives indexed so far are kept.
+func (idx *Index) UpdateContext(ctx context.Context, root string) (added, removed int, err error) {
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return
+	}
+	var todo []string
+	infos := make(map[string]os.FileInfo)
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.EqualFold(filepath.Ext(path), ".nbf") {
+			return nil
+		}
+		infos[path] = info
+		if a := idx.archives[path]; a == nil || !a.upToDate(info) {
+			todo = append(todo, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	for i, path := range todo {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if err = idx.add(ctx, path, infos[path]); err != nil {
+			if ctx.Err() != nil {
+				return added, removed, ctx.Err()
+			}
+			return added, removed, fmt.Errorf("%s: %s", path, err)
+		}
+		added++
+		if idx.Progress != nil {
+			idx.Progress(i+1, len(todo))
+		}
+	}
+	for path := range idx.archives {
+		if strings.HasPrefix(path, root+string(filepath.Separator)) && infos[path] == nil {
+			if err = os.Remove(idx.filename(path)); err != nil && !os.IsNotExist(err) {
+				return
+			}
+			delete(idx.archives, path)
+			removed++
+		}
+	}
+	_, err = idx.textIndex()
+	return added, removed, err
+}
+
+func (idx *Index) add(ctx context.Context, path string, info os.FileInfo) error {
+	a, err := parseArchive(ctx, path, info, idx.Password)
+	if err != nil {
+		return err
+	}
+	if err := writeArchive(idx.dir, a); err != nil {
+		return err
+	}
+	idx.archives[path] = a
+	return nil
+}
+
+func parseArchive(ctx context.Context, path string, info os.FileInfo, password string) (*Archive, error) {
+	r, err := nbf.OpenFile(path)
+	if errors.Is(err, zip.ErrFormat) {
+		r, err = nbf.RecoverFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if r.Encrypted() && password == "" {
+		return nil, nbf.ErrPassword
+	}
+	r.Password = password
+	inbox, err := r.InboxContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	outbox, err := r.OutboxContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Archive{
+		Version:  version,
+		Path:     path,
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Messages: append(inbox, outbox...),
+	}, nil
+}
+
+// writeArchive stores a in dir atomically.
+func writeArchive(dir string, a *Archive) error {
+	return writeGob(archiveFile(dir, a.Path), a)
+}
+
+// writeGob stores the gob encoding of v in file name atomically.
+func writeGob(name string, v interface{}) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "tmp")
+	if err != nil {
+		return err
+	}
+	if err = gob.NewEncoder(tmp).Encode(v); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Archives returns indexed archives sorted by path.
+func (idx *Index) Archives() []*Archive {
+	list := make([]*Archive, 0, len(idx.archives))
+	for _, a := range idx.archives {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list
+}
+
+// textName is the file holding the inverted index. Its
+// extension differs from archive files.
+const textName = "text.index"
+
+// A textFile is the inverted index of the messages of archives,
+// in the order of Archives.
+type textFile struct {
+	Version  int
+	Archives []archiveStamp
+	Index    *TextIndex
+}
+
+type archiveStamp struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+func (idx *Index) stamps() []archiveStamp {
+	var stamps []archiveStamp
+	for _, a := range idx.Archives() {
+		stamps = append(stamps, archiveStamp{a.Path, a.Size, a.ModTime})
+	}
+	return stamps
+}
+
+func sameStamps(a, b []archiveStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Path != b[i].Path || a[i].Size != b[i].Size || !a[i].ModTime.Equal(b[i].ModTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// textIndex returns the inverted index of indexed archives,
+// reading it from disk or building it if it is out of date.
+func (idx *Index) textIndex() (*TextIndex, error) {
+	stamps := idx.stamps()
+	if t := idx.text; t != nil && sameStamps(t.Archives, stamps) {
+		return t.Index, nil
+	}
+	name := filepath.Join(idx.dir, textName)
+	if f, err := os.Open(name); err == nil {
+		t := new(textFile)
+		err = gob.NewDecoder(f).Decode(t)
+		f.Close()
+		if err == nil && t.Version == version && t.Index != nil && sameStamps(t.Archives, stamps) {
+			t.Index.sortTerms()
+			idx.text = t
+			return t.Index, nil
+		}
+	}
+	var msgs []nbf.SMS
+	for _, a := range idx.Archives() {
+		msgs = append(msgs, a.Messages...)
+	}
+	t := &textFile{Version: version, Archives: stamps, Index: NewTextIndex(msgs)}
+	idx.text = t
+	return t.Index, writeGob(name, t)
+}
+
+// Query returns messages matching query, using the inverted
+// index, sorted by date. See TextIndex.Query for the syntax.
+func (idx *Index) Query(query string) ([]Hit, error) {
+	t, err := idx.textIndex()
+	if t == nil {
+		return nil, err
+	}
+	docs, err := t.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	var hits []Hit
+	archives := idx.Archives()
+	a, base := 0, 0
+	for _, doc := range docs {
+		for doc-base >= len(archives[a].Messages) {
+			base += len(archives[a].Messages)
+			a++
+		}
+		hits = append(hits, Hit{Archive: archives[a].Path, SMS: archives[a].Messages[doc-base]})
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return nbf.ByDate(hits[i].SMS, hits[j].SMS) < 0 })
+	return hits, nil
+}
+
+// A Hit is a message matching a query.
+type Hit struct {
+	Archive string
+	nbf.SMS
+}
+
+// Search returns messages whose text or peer contain all words of query,
+// ignoring case, sorted by date (see nbf.ByDate), then by archive path.
+func (idx *Index) Search(query string) []Hit {
+	words := strings.Fields(strings.ToLower(query))
+	var hits []Hit
+	for _, a := range idx.Archives() {
+	search:
+		for _, m := range a.Messages {
+			text := strings.ToLower(m.Text + "\x00" + m.Peer)
+			for _, w := range words {
+				if !strings.Contains(text, w) {
+					continue search
+				}
+			}
+			hits = append(hits, Hit{Archive: a.Path, SMS: m})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return nbf.ByDate(hits[i].SMS, hits[j].SMS) < 0 })
+	return hits
+}
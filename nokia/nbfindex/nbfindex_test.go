@@ -0,0 +1,124 @@
+package nbfindex
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeSample writes to path the entries of the sample archive
+// of package nbf whose name has none of the given prefixes.
+func writeSample(t *testing.T, path string, skip ...string) {
+	t.Helper()
+	z, err := zip.OpenReader("../nbf/testdata/sample.nbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(out)
+entries:
+	for _, f := range z.File {
+		for _, prefix := range skip {
+			if strings.HasPrefix(f.Name, prefix) {
+				continue entries
+			}
+		}
+		rd, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw, err := w.Create(f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(fw, rd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(t.TempDir(), "backup.nbf")
+	writeSample(t, path)
+
+	load := func(step string, want int) []string {
+		t.Helper()
+		msgs, err := Load(dir, path)
+		if err != nil {
+			t.Fatalf("%s: %s", step, err)
+		}
+		if len(msgs) != want {
+			t.Fatalf("%s: got %d messages, expected %d", step, len(msgs), want)
+		}
+		texts := make([]string, len(msgs))
+		for i, m := range msgs {
+			texts[i] = m.Text
+		}
+		return texts
+	}
+	// mark replaces the texts of the cached messages, to tell
+	// whether Load reads the cache.
+	cache := archiveFile(dir, path)
+	mark := func() {
+		t.Helper()
+		c, err := readArchive(cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range c.Messages {
+			c.Messages[i].Text = "cached"
+		}
+		if err := writeArchive(dir, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	load("first load", 3)
+	mark()
+	if texts := load("cache hit", 3); texts[0] != "cached" {
+		t.Errorf("cache hit: got texts %q", texts)
+	}
+
+	// Modification time changes.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if texts := load("touched archive", 3); texts[0] != "Hello there" {
+		t.Errorf("touched archive: got texts %q", texts)
+	}
+
+	// Size changes, with the same modification time.
+	mark()
+	writeSample(t, path, "predefmessages/3/")
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if texts := load("modified archive", 2); texts[0] != "Hello there" {
+		t.Errorf("modified archive: got texts %q", texts)
+	}
+
+	// A corrupt cache file is replaced.
+	if err := os.WriteFile(cache, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	load("corrupt cache", 2)
+	if c, err := readArchive(cache); err != nil || len(c.Messages) != 2 {
+		t.Errorf("cache not rewritten: %v", err)
+	}
+}
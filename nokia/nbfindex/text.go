@@ -0,0 +1,256 @@
+package nbfindex
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+// A TextIndex is an inverted index of a list of messages,
+// mapping terms to the messages containing them.
+//
+// Texts are split in words, folding case and diacritics. Peers
+// are indexed as terms "peer:word" and dates as terms "date:2006",
+// "date:2006-01" and "date:2006-01-02".
+type TextIndex struct {
+	Docs  int                  // number of messages
+	Terms map[string][]Posting // by term, sorted by message
+
+	sorted []string // terms in order, for prefix queries
+}
+
+// A Posting lists the positions of a term in a message.
+type Posting struct {
+	Doc int32
+	Pos []int32 // word positions in the text, nil for peer and date terms
+}
+
+// ErrSyntax is returned for malformed queries.
+var ErrSyntax = errors.New("nbfindex: query syntax error")
+
+// Tokenize splits s in words, folding case and removing
+// diacritics.
+func Tokenize(s string) []string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, norm.NFD.String(s))
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// NewTextIndex indexes msgs. Query results are indices in msgs.
+func NewTextIndex(msgs []nbf.SMS) *TextIndex {
+	t := &TextIndex{Docs: len(msgs), Terms: make(map[string][]Posting)}
+	for i, m := range msgs {
+		doc := int32(i)
+		words := make(map[string]int) // index of posting
+		for pos, w := range Tokenize(m.Text) {
+			n, ok := words[w]
+			if !ok {
+				n = len(t.Terms[w])
+				words[w] = n
+				t.Terms[w] = append(t.Terms[w], Posting{Doc: doc})
+			}
+			t.Terms[w][n].Pos = append(t.Terms[w][n].Pos, int32(pos))
+		}
+		other := make(map[string]bool)
+		for _, w := range Tokenize(nbf.ThreadPeer(m) + " " + strings.Join(m.Peers, " ")) {
+			other["peer:"+w] = true
+		}
+		if !m.When.IsZero() {
+			for _, layout := range []string{"2006", "2006-01", "2006-01-02"} {
+				other["date:"+m.When.Format(layout)] = true
+			}
+		}
+		for term := range other {
+			t.Terms[term] = append(t.Terms[term], Posting{Doc: doc})
+		}
+	}
+	t.sortTerms()
+	return t
+}
+
+func (t *TextIndex) sortTerms() {
+	t.sorted = make([]string, 0, len(t.Terms))
+	for w := range t.Terms {
+		t.sorted = append(t.sorted, w)
+	}
+	sort.Strings(t.sorted)
+}
+
+// Query returns the indices of messages matching q, in
+// increasing order. A query is a list of terms, all of which must
+// match, possibly separated by OR:
+//
+//	word       messages containing word in their text or peer
+//	pre*       messages containing a word starting with pre
+//	"a b c"    messages containing the phrase "a b c"
+//	peer:word  messages whose peer contains word
+//	date:2010-05
+//	           messages of May 2010 (also date:2010, date:2010-05-13)
+//
+// OR has a lower precedence than the implicit AND.
+func (t *TextIndex) Query(q string) ([]int, error) {
+	clauses, err := parseQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	var result map[int32]bool
+	for _, clause := range clauses {
+		var docs map[int32]bool
+		for _, term := range clause {
+			d := t.match(term)
+			if docs == nil {
+				docs = d
+				continue
+			}
+			for doc := range docs {
+				if !d[doc] {
+					delete(docs, doc)
+				}
+			}
+		}
+		if result == nil {
+			result = docs
+			continue
+		}
+		for doc := range docs {
+			result[doc] = true
+		}
+	}
+	list := make([]int, 0, len(result))
+	for doc := range result {
+		list = append(list, int(doc))
+	}
+	sort.Ints(list)
+	return list, nil
+}
+
+// A queryTerm is a word, a prefix or a phrase.
+type queryTerm struct {
+	words  []string
+	prefix bool
+}
+
+// parseQuery splits q in clauses separated by OR.
+func parseQuery(q string) (clauses [][]queryTerm, err error) {
+	var clause []queryTerm
+	for q = strings.TrimSpace(q); q != ""; q = strings.TrimSpace(q) {
+		var tok string
+		if q[0] == '"' {
+			end := strings.IndexByte(q[1:], '"')
+			if end < 0 {
+				return nil, ErrSyntax
+			}
+			tok, q = q[1:end+1], q[end+2:]
+			if words := Tokenize(tok); len(words) > 0 {
+				clause = append(clause, queryTerm{words: words})
+			}
+			continue
+		}
+		if end := strings.IndexAny(q, " \t\""); end >= 0 {
+			tok, q = q[:end], q[end:]
+		} else {
+			tok, q = q, ""
+		}
+		if tok == "OR" {
+			if len(clause) == 0 {
+				return nil, ErrSyntax
+			}
+			clauses, clause = append(clauses, clause), nil
+			continue
+		}
+		prefix := strings.HasSuffix(tok, "*")
+		tok = strings.TrimSuffix(tok, "*")
+		if strings.HasPrefix(tok, "date:") {
+			clause = append(clause, queryTerm{words: []string{tok}, prefix: prefix})
+			continue
+		}
+		field := ""
+		if strings.HasPrefix(tok, "peer:") {
+			field, tok = "peer:", tok[len("peer:"):]
+		}
+		words := Tokenize(tok)
+		for i, w := range words {
+			// Only the last word of "jean-pi*" is a prefix.
+			clause = append(clause, queryTerm{words: []string{field + w}, prefix: prefix && i == len(words)-1})
+		}
+	}
+	if len(clause) == 0 {
+		if len(clauses) > 0 {
+			return nil, ErrSyntax // dangling OR
+		}
+		return nil, nil
+	}
+	return append(clauses, clause), nil
+}
+
+// match returns the messages matching term.
+func (t *TextIndex) match(term queryTerm) map[int32]bool {
+	docs := make(map[int32]bool)
+	switch {
+	case len(term.words) > 1:
+		t.matchPhrase(term.words, docs)
+	case term.prefix:
+		for _, prefix := range t.variants(term.words[0]) {
+			i := sort.SearchStrings(t.sorted, prefix)
+			for ; i < len(t.sorted) && strings.HasPrefix(t.sorted[i], prefix); i++ {
+				for _, p := range t.Terms[t.sorted[i]] {
+					docs[p.Doc] = true
+				}
+			}
+		}
+	default:
+		for _, w := range t.variants(term.words[0]) {
+			for _, p := range t.Terms[w] {
+				docs[p.Doc] = true
+			}
+		}
+	}
+	return docs
+}
+
+// variants returns the terms matched by a query word:
+// plain words also match peers.
+func (t *TextIndex) variants(w string) []string {
+	if strings.HasPrefix(w, "peer:") || strings.HasPrefix(w, "date:") {
+		return []string{w}
+	}
+	return []string{w, "peer:" + w}
+}
+
+func (t *TextIndex) matchPhrase(words []string, docs map[int32]bool) {
+	// positions of the phrase start, by message
+	starts := make(map[int32][]int32)
+	for _, p := range t.Terms[words[0]] {
+		starts[p.Doc] = p.Pos
+	}
+	for i, w := range words[1:] {
+		next := make(map[int32][]int32)
+		for _, p := range t.Terms[w] {
+			var kept []int32
+			for _, s := range starts[p.Doc] {
+				j := sort.Search(len(p.Pos), func(j int) bool { return p.Pos[j] >= s+int32(i+1) })
+				if j < len(p.Pos) && p.Pos[j] == s+int32(i+1) {
+					kept = append(kept, s)
+				}
+			}
+			if kept != nil {
+				next[p.Doc] = kept
+			}
+		}
+		starts = next
+	}
+	for doc := range starts {
+		docs[doc] = true
+	}
+}
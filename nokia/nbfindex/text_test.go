@@ -0,0 +1,48 @@
+package nbfindex
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+func TestTextIndex(t *testing.T) {
+	msgs := []nbf.SMS{
+		{Peer: "+33612345678", When: time.Date(2010, 5, 13, 18, 0, 0, 0, time.UTC), Text: "Rendez-vous au café à 18h"},
+		{Peer: "Alice", When: time.Date(2010, 6, 1, 9, 0, 0, 0, time.UTC), Text: "Le café est fermé, au revoir"},
+		{Type: 1, Peers: []string{"+33698765432 <Bob Martin>"}, When: time.Date(2011, 1, 2, 9, 0, 0, 0, time.UTC), Text: "Café ?"},
+	}
+	idx := NewTextIndex(msgs)
+	for _, tt := range []struct {
+		q    string
+		docs []int
+	}{
+		{"cafe", []int{0, 1, 2}},
+		{"café au", []int{0, 1}},
+		{`"au cafe"`, []int{0}},
+		{`"cafe au"`, nil},
+		{"fermé OR rendez", []int{0, 1}},
+		{"alice", []int{1}},
+		{"peer:martin", []int{2}},
+		{"peer:cafe", nil},
+		{"date:2010", []int{0, 1}},
+		{"date:2010-06 OR date:2011", []int{1, 2}},
+		{"rev*", []int{1}},
+		{"+336*", []int{0, 2}},
+		{"", nil},
+	} {
+		docs, err := idx.Query(tt.q)
+		if err != nil {
+			t.Errorf("%q: %s", tt.q, err)
+		} else if len(docs) != len(tt.docs) || len(docs) > 0 && !reflect.DeepEqual(docs, tt.docs) {
+			t.Errorf("%q: got %v, expected %v", tt.q, docs, tt.docs)
+		}
+	}
+	for _, q := range []string{`"unterminated`, "OR cafe", "cafe OR"} {
+		if _, err := idx.Query(q); err != ErrSyntax {
+			t.Errorf("%q: got error %v, expected ErrSyntax", q, err)
+		}
+	}
+}
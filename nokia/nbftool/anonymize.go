@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbfexport"
+)
+
+var cmdAnonymize = newCommand("anonymize", "in.nbf out.nbf",
+	"replace personal data by pseudonyms, for sharing sample archives")
+
+var (
+	anonKey    = cmdAnonymize.Flags.String("key", "nbf", "secret seeding the pseudonyms")
+	anonDryRun = cmdAnonymize.dryRunFlag()
+	anonBackup = cmdAnonymize.backupFlag()
+)
+
+func init() { cmdAnonymize.Run = runAnonymize }
+
+func runAnonymize(ctx context.Context, args []string) error {
+	args = cmdAnonymize.parse(args)
+	if len(args) != 2 {
+		cmdAnonymize.Flags.Usage()
+		os.Exit(2)
+	}
+	f, err := openArchive(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if *anonDryRun {
+		r := nbfexport.Report{W: os.Stdout}
+		r.Add(args[1], -1)
+		r.Summary()
+		return nil
+	}
+	return nbfexport.WriteFile(args[1], *anonBackup, func(w io.Writer) error {
+		return f.AnonymizeContext(ctx, w, *anonKey)
+	})
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+// The serve command exposes a JSON API along the HTML viewer:
+//
+//	GET /threads                  list of threads, most recent first
+//	GET /threads/{peer}/messages  messages of a thread, by date
+//	GET /search?q=query           messages matching query, see the query command
+//	GET /messages                 all messages, in archive order
+//
+// Threads are objects {"peer", "count", "last"} and messages are
+// objects {"date", "stored", "smsc", "direction", "peer", "peers", "text"}
+// where direction is "in" or "out" and dates use RFC 3339. The "stored"
+// date is the time the phone stored the message, "smsc" is the service
+// centre time stamp of received messages.
+//
+// Lists are paginated by parameters limit, offset and cursor
+// (see nbf.Page). Responses hold the total number of items in
+// header X-Total-Count and, if there are more items, the cursor
+// of the next page in X-Next-Cursor and a Link header. Pages of
+// /messages are decoded from the archive on request, and have
+// no X-Total-Count.
+
+type apiThread struct {
+	Peer  string    `json:"peer"`
+	Count int       `json:"count"`
+	Last  time.Time `json:"last"`
+}
+
+type apiMessage struct {
+	Date      time.Time  `json:"date"`
+	Stored    time.Time  `json:"stored"`
+	SMSC      *time.Time `json:"smsc,omitempty"`
+	Direction string     `json:"direction"`
+	Peer      string     `json:"peer"`
+	Peers     []string   `json:"peers,omitempty"`
+	Text      string     `json:"text"`
+}
+
+func toAPIMessages(msgs []nbf.SMS) []apiMessage {
+	out := make([]apiMessage, 0, len(msgs))
+	for _, m := range msgs {
+		dir := "in"
+		if m.Direction != nbf.Received {
+			dir = "out"
+		}
+		am := apiMessage{Date: m.When, Stored: m.Stamp, Direction: dir,
+			Peer: m.Peer, Peers: m.Peers, Text: m.Text}
+		if !m.SCTS.IsZero() {
+			scts := m.SCTS
+			am.SMSC = &scts
+		}
+		out = append(out, am)
+	}
+	return out
+}
+
+func (v *viewer) registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/threads", v.apiThreads)
+	mux.HandleFunc("/threads/", v.apiThreadMessages)
+	mux.HandleFunc("/search", v.apiSearch)
+	mux.HandleFunc("/messages", v.apiMessages)
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// pageOf returns the page requested by req, or false after
+// writing an error.
+func pageOf(w http.ResponseWriter, req *http.Request) (nbf.Page, bool) {
+	p := nbf.Page{Cursor: req.FormValue("cursor")}
+	var err error
+	if s := req.FormValue("offset"); s != "" {
+		p.Offset, err = strconv.Atoi(s)
+	}
+	if s := req.FormValue("limit"); s != "" && err == nil {
+		p.Limit, err = strconv.Atoi(s)
+	}
+	if err != nil || p.Offset < 0 || p.Limit < 0 {
+		http.Error(w, "invalid offset or limit", http.StatusBadRequest)
+		return p, false
+	}
+	return p, true
+}
+
+// setNext writes the headers locating the page after cursor next.
+func setNext(w http.ResponseWriter, req *http.Request, next string) {
+	if next == "" {
+		return
+	}
+	w.Header().Set("X-Next-Cursor", next)
+	u := *req.URL
+	q := u.Query()
+	q.Set("cursor", next)
+	q.Del("offset")
+	u.RawQuery = q.Encode()
+	w.Header().Set("Link", "<"+u.RequestURI()+`>; rel="next"`)
+}
+
+// paginate writes pagination headers and returns the requested
+// page of items, or nil after writing an error.
+func paginate[T any](w http.ResponseWriter, req *http.Request, items []T, id func(T) string) []T {
+	p, ok := pageOf(w, req)
+	if !ok {
+		return nil
+	}
+	page, next, err := nbf.Paginate(items, p, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(items)))
+	setNext(w, req, next)
+	if page == nil {
+		page = []T{}
+	}
+	return page
+}
+
+func (v *viewer) apiThreads(w http.ResponseWriter, req *http.Request) {
+	page := paginate(w, req, v.Threads, func(t nbf.Thread) string { return t.Peer })
+	if page == nil {
+		return
+	}
+	threads := make([]apiThread, 0, len(page))
+	for _, t := range page {
+		threads = append(threads, apiThread{Peer: t.Peer, Count: len(t.Messages), Last: t.Last().When})
+	}
+	writeJSON(w, threads)
+}
+
+func (v *viewer) apiThreadMessages(w http.ResponseWriter, req *http.Request) {
+	// path is /threads/{peer}/messages
+	p := strings.TrimPrefix(req.URL.EscapedPath(), "/threads/")
+	if !strings.HasSuffix(p, "/messages") {
+		http.NotFound(w, req)
+		return
+	}
+	peer, err := url.PathUnescape(strings.TrimSuffix(p, "/messages"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, t := range v.Threads {
+		if t.Peer == peer {
+			if page := paginate(w, req, t.Messages, nbf.SMS.ID); page != nil {
+				writeJSON(w, toAPIMessages(page))
+			}
+			return
+		}
+	}
+	http.NotFound(w, req)
+}
+
+func (v *viewer) apiSearch(w http.ResponseWriter, req *http.Request) {
+	results, err := v.find(req.FormValue("q"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if page := paginate(w, req, results, nbf.SMS.ID); page != nil {
+		writeJSON(w, toAPIMessages(page))
+	}
+}
+
+func (v *viewer) apiMessages(w http.ResponseWriter, req *http.Request) {
+	p, ok := pageOf(w, req)
+	if !ok {
+		return
+	}
+	// Decoding stops if the client goes away.
+	page, next, err := v.archive.MessagesPageContext(req.Context(), p, v.filter)
+	switch {
+	case errors.Is(err, nbf.ErrCursor):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setNext(w, req, next)
+	writeJSON(w, toAPIMessages(page))
+}
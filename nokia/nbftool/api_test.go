@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestAPI(t *testing.T) {
+	h := testServer(t)
+
+	var threads []apiThread
+	w := get(h, "/threads")
+	if err := json.Unmarshal(w.Body.Bytes(), &threads); err != nil || w.Code != 200 {
+		t.Fatalf("threads: status %d, %v", w.Code, err)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("threads: got content type %q", ct)
+	}
+	if len(threads) != 1 || threads[0].Peer != "+33612345678" || threads[0].Count != 3 {
+		t.Errorf("got threads %+v", threads)
+	}
+
+	var msgs []apiMessage
+	w = get(h, "/threads/%2B33612345678/messages")
+	if err := json.Unmarshal(w.Body.Bytes(), &msgs); err != nil || w.Code != 200 {
+		t.Fatalf("messages: status %d, %v", w.Code, err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("got %d messages, expected 3", len(msgs))
+	}
+	if m := msgs[0]; m.Direction != "in" || m.Text != "Hello there" || m.SMSC == nil || !m.SMSC.Equal(m.Date) {
+		t.Errorf("bad received message %+v", m)
+	}
+	if m := msgs[2]; m.Direction != "out" || m.Text != "Thanks, Bob ☺" || len(m.Peers) != 1 || m.SMSC != nil {
+		t.Errorf("bad sent message %+v", m)
+	}
+
+	// Pagination.
+	w = get(h, "/threads/%2B33612345678/messages?limit=2")
+	if err := json.Unmarshal(w.Body.Bytes(), &msgs); err != nil || len(msgs) != 2 {
+		t.Fatalf("first page: got %+v, %v", msgs, err)
+	}
+	next := w.Header().Get("X-Next-Cursor")
+	if total := w.Header().Get("X-Total-Count"); total != "3" || next == "" {
+		t.Errorf("first page: got total %q, cursor %q", total, next)
+	}
+	w = get(h, "/threads/%2B33612345678/messages?limit=2&cursor="+url.QueryEscape(next))
+	if err := json.Unmarshal(w.Body.Bytes(), &msgs); err != nil || len(msgs) != 1 ||
+		msgs[0].Text != "Thanks, Bob ☺" || w.Header().Get("X-Next-Cursor") != "" {
+		t.Errorf("second page: got %+v, %v", msgs, err)
+	}
+
+	// Pages of the archive.
+	w = get(h, "/messages?limit=2")
+	if err := json.Unmarshal(w.Body.Bytes(), &msgs); err != nil || len(msgs) != 2 || msgs[0].Text != "Hello there" {
+		t.Fatalf("first archive page: got %+v, %v", msgs, err)
+	}
+	if next = w.Header().Get("X-Next-Cursor"); next == "" {
+		t.Fatal("first archive page: no cursor")
+	}
+	w = get(h, "/messages?cursor="+url.QueryEscape(next))
+	if err := json.Unmarshal(w.Body.Bytes(), &msgs); err != nil || len(msgs) != 1 ||
+		msgs[0].Text != "Thanks, Bob ☺" || w.Header().Get("X-Next-Cursor") != "" {
+		t.Errorf("second archive page: got %+v, %v", msgs, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/messages", nil).WithContext(ctx))
+	if w.Code != 500 {
+		t.Errorf("cancelled request: got status %d", w.Code)
+	}
+
+	w = get(h, "/search?q=split")
+	if err := json.Unmarshal(w.Body.Bytes(), &msgs); err != nil || len(msgs) != 1 ||
+		msgs[0].Text != "This message is split in three parts" {
+		t.Errorf("search: got %+v, %v", msgs, err)
+	}
+
+	for _, tt := range []struct {
+		url    string
+		status int
+	}{
+		{"/threads/nobody/messages", 404},
+		{"/threads/%2B33612345678", 404},
+		{"/search?q=%22unterminated", 400},
+		{"/threads?offset=-1", 400},
+		{"/threads?limit=x", 400},
+		{"/threads?cursor=bogus", 400},
+		{"/messages?cursor=0.bogus", 400},
+	} {
+		if w := get(h, tt.url); w.Code != tt.status {
+			t.Errorf("GET %s: got status %d, expected %d", tt.url, w.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/mms"
+	"github.com/remyoudompheng/go-misc/nokia/nbfexport"
+)
+
+var cmdAttachments = newCommand("attachments", "backup.nbf",
+	"extract MMS parts, gallery media and picture messages")
+
+var (
+	attachDir    = cmdAttachments.Flags.String("o", ".", "output directory")
+	attachDryRun = cmdAttachments.dryRunFlag()
+	attachBackup = cmdAttachments.backupFlag()
+	attachName   = cmdAttachments.Flags.String("name", "", "template of names of MMS parts and picture messages, such as {{.PeerName}}/{{.Filename}}")
+	attachThumbs = cmdAttachments.Flags.Int("thumbs", 0, "also write JPEG thumbnails of images, at most `size` pixels wide and high, in thumbs/ directories")
+)
+
+func init() {
+	cmdAttachments.Run = runAttachments
+	cmdAttachments.Flags.Func("convert", "also convert media of a type with an external `converter`, such as 'audio/amr=.mp3:ffmpeg -i - -f mp3 -' (repeatable)",
+		func(s string) error {
+			ctype, c, err := nbfexport.ParseCommand(s)
+			if err != nil {
+				return err
+			}
+			nbfexport.Converters.Register(ctype, c)
+			return nil
+		})
+}
+
+func runAttachments(ctx context.Context, args []string) error {
+	args = cmdAttachments.parse(args)
+	if len(args) != 1 {
+		cmdAttachments.Flags.Usage()
+		os.Exit(2)
+	}
+	var tmpl *nbfexport.NameTemplate
+	if *attachName != "" {
+		var err error
+		if tmpl, err = nbfexport.ParseNameTemplate(*attachName); err != nil {
+			return err
+		}
+	}
+	f, err := openArchive(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if *attachDryRun {
+		attachReport = &nbfexport.Report{W: os.Stdout}
+		defer attachReport.Summary()
+	} else if err := os.MkdirAll(*attachDir, 0755); err != nil {
+		return err
+	}
+
+	msgs, err := f.MMSContext(ctx)
+	if err != nil {
+		return err
+	}
+	count := 0
+	for i, m := range msgs {
+		prefix := fmt.Sprintf("%s-%s-mms%03d", m.Stamp.Format("20060102-150405"), peerName(m.Peer), i)
+		for j, p := range m.Parts {
+			ext := extension(p.MediaType())
+			name := nbfexport.SanitizeName(p.Filename())
+			if name == "" {
+				name = fmt.Sprintf("part%d%s", j, ext)
+			} else if path.Ext(name) == "" {
+				name += ext
+			}
+			name = prefix + "-" + name
+			if tmpl != nil {
+				name, err = tmpl.Name(nbfexport.NameData{
+					Peer: peerName(m.Peer), PeerName: peerName(m.Peer),
+					Date: m.Stamp, Year: m.Stamp.Year(), Index: count,
+					Filename: p.Filename(), Ext: ext,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			if err := writeFile(name, p.Data, m.Stamp); err != nil {
+				return err
+			}
+			if strings.HasPrefix(p.MediaType(), "image/") {
+				if err := writeThumbnail(name, bytes.NewReader(p.Data), m.Stamp); err != nil {
+					return err
+				}
+			}
+			if err := convert(ctx, name, p.MediaType(), bytes.NewReader(p.Data), m.Stamp); err != nil {
+				return err
+			}
+			count++
+		}
+	}
+	log.Printf("extracted %d parts from %d MMS", count, len(msgs))
+
+	// Gallery files may be large: copy them one at a time.
+	ngallery := 0
+	for g := range f.GalleryFiles() {
+		name := nbfexport.SanitizeName(filepath.Base(g.NBFFile))
+		err := writeFileFunc(name, g.Stamp, func(w io.Writer) error {
+			rd, err := g.Open()
+			if err != nil {
+				return err
+			}
+			defer rd.Close()
+			_, err = io.Copy(w, rd)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		switch g.Type {
+		case "jpg", "jpeg", "gif", "png":
+			rd, err := g.Open()
+			if err != nil {
+				return err
+			}
+			err = writeThumbnail(name, rd, g.Stamp)
+			rd.Close()
+			if err != nil {
+				return err
+			}
+		}
+		if len(nbfexport.Converters.Types()) > 0 {
+			rd, err := g.Open()
+			if err != nil {
+				return err
+			}
+			br := bufio.NewReader(rd)
+			head, _ := br.Peek(16)
+			err = convert(ctx, name, mms.SniffType(head), br, g.Stamp)
+			rd.Close()
+			if err != nil {
+				return err
+			}
+		}
+		ngallery++
+	}
+	log.Printf("extracted %d gallery files", ngallery)
+
+	pics, err := f.Pictures()
+	if err != nil {
+		return err
+	}
+	for i, img := range pics {
+		name := fmt.Sprintf("%s-%s-picture%03d.%s",
+			img.Stamp.Format("20060102-150405"), peerName(img.Peer), i, img.Type)
+		if tmpl != nil {
+			name, err = tmpl.Name(nbfexport.NameData{
+				Peer: peerName(img.Peer), PeerName: peerName(img.Peer),
+				Date: img.Stamp, Year: img.Stamp.Year(), Index: i,
+				Ext: "." + img.Type,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := writeFile(name, img.Data, img.Stamp); err != nil {
+			return err
+		}
+		if err := writeThumbnail(name, bytes.NewReader(img.Data), img.Stamp); err != nil {
+			return err
+		}
+	}
+	log.Printf("extracted %d picture messages", len(pics))
+	return nil
+}
+
+// attachReport, if not nil, records files instead of writing them.
+var attachReport *nbfexport.Report
+
+// writeFile writes data to the output directory, setting
+// its modification time to stamp. Name is slash-separated.
+func writeFile(name string, data []byte, stamp time.Time) error {
+	return writeFileFunc(name, stamp, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeFileFunc is like writeFile, with contents written by write.
+func writeFileFunc(name string, stamp time.Time, write func(io.Writer) error) error {
+	p := filepath.Join(*attachDir, filepath.FromSlash(name))
+	if attachReport != nil {
+		attachReport.Add(p, -1)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	if err := nbfexport.WriteFile(p, *attachBackup, write); err != nil {
+		return err
+	}
+	if !stamp.IsZero() {
+		return os.Chtimes(p, stamp, stamp)
+	}
+	return nil
+}
+
+// writeThumbnail writes the thumbnail of image file name, read
+// from r, if thumbnails are enabled. Undecodable images are
+// logged and skipped.
+func writeThumbnail(name string, r io.Reader, stamp time.Time) error {
+	if *attachThumbs <= 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if attachReport == nil {
+		if err := nbfexport.WriteThumbnail(&buf, r, *attachThumbs); err != nil {
+			log.Printf("no thumbnail for %s: %s", name, err)
+			return nil
+		}
+	}
+	return writeFile(nbfexport.ThumbnailName(name), buf.Bytes(), stamp)
+}
+
+// convert writes the conversion of file name, of media type ctype
+// and read from r, if a converter is registered for ctype. Failed
+// conversions are logged and skipped.
+func convert(ctx context.Context, name, ctype string, r io.Reader, stamp time.Time) error {
+	c, ok := nbfexport.Converters.Lookup(ctype)
+	if !ok {
+		return nil
+	}
+	err := writeFileFunc(nbfexport.ConvertedName(name, c), stamp, func(w io.Writer) error {
+		return c.Convert(ctx, w, r)
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("cannot convert %s: %s", name, err)
+		return nil
+	}
+	return err
+}
+
+func peerName(peer string) string {
+	if peer == "" {
+		return "unknown"
+	}
+	return nbfexport.SanitizeName(peer)
+}
+
+var extensions = map[string]string{
+	"application/smil":   ".smil",
+	"audio/amr":          ".amr",
+	"audio/midi":         ".mid",
+	"audio/mid":          ".mid",
+	"audio/sp-midi":      ".mid",
+	"image/gif":          ".gif",
+	"image/jpeg":         ".jpg",
+	"image/png":          ".png",
+	"image/vnd.wap.wbmp": ".wbmp",
+	"text/plain":         ".txt",
+	"text/x-vCalendar":   ".vcs",
+	"text/x-vCard":       ".vcf",
+	"video/3gpp":         ".3gp",
+}
+
+func extension(ctype string) string {
+	if ext, ok := extensions[ctype]; ok {
+		return ext
+	}
+	if exts, _ := mime.ExtensionsByType(ctype); len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
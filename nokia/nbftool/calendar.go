@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbfexport"
+)
+
+var cmdCalendar = newCommand("calendar", "backup.nbf calendar.ics",
+	"export calendar entries and to-do items as iCalendar")
+
+var (
+	calendarDryRun = cmdCalendar.dryRunFlag()
+	calendarBackup = cmdCalendar.backupFlag()
+)
+
+func init() { cmdCalendar.Run = runCalendar }
+
+func runCalendar(ctx context.Context, args []string) error {
+	args = cmdCalendar.parse(args)
+	if len(args) != 2 {
+		cmdCalendar.Flags.Usage()
+		os.Exit(2)
+	}
+	f, err := openArchive(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	entries, err := f.Calendar()
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if *calendarDryRun {
+		r := nbfexport.Report{W: os.Stdout}
+		r.Add(args[1], -1)
+		r.Summary()
+		return nil
+	}
+	if err := nbfexport.WriteFile(args[1], *calendarBackup, func(w io.Writer) error {
+		return nbfexport.WriteICalendar(w, entries)
+	}); err != nil {
+		return err
+	}
+	log.Printf("%d calendar entries written to %s", len(entries), args[1])
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/nbfexport"
+	"github.com/remyoudompheng/go-misc/nokia/nbfexport/carddav"
+)
+
+var cmdContacts = newCommand("contacts", "backup.nbf contacts.vcf|contacts.csv|outdir/",
+	"export the phonebook as vCard 3.0 or 4.0, or CSV")
+
+var (
+	contactsVersion = cmdContacts.Flags.String("version", nbfexport.VCard30, "vCard version, 3.0 or 4.0")
+	contactsCSV     = cmdContacts.Flags.String("csv", "", "write a CSV file for import in `google` or `outlook` instead of vCards")
+	contactsSplit   = cmdContacts.Flags.Bool("split", false, "write one file per contact in the output directory")
+	contactsDryRun  = cmdContacts.dryRunFlag()
+	contactsBackup  = cmdContacts.backupFlag()
+)
+
+var cmdContactsPush = newCommand("contacts push", "backup.nbf",
+	"upload the phonebook to a CardDAV address book")
+
+var (
+	pushURL  = cmdContactsPush.Flags.String("url", "", "URL of the address book collection")
+	pushUser = cmdContactsPush.Flags.String("user", "", "user name")
+)
+
+func init() {
+	cmdContacts.Run = runContacts
+	cmdContactsPush.Run = runContactsPush
+}
+
+func runContacts(ctx context.Context, args []string) error {
+	if len(args) > 0 && args[0] == "push" {
+		return runContactsPush(ctx, args[1:])
+	}
+	args = cmdContacts.parse(args)
+	if len(args) != 2 {
+		cmdContacts.Flags.Usage()
+		os.Exit(2)
+	}
+	f, err := openArchive(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	contacts, err := f.Contacts()
+	f.Close()
+	if err != nil {
+		return err
+	}
+	write := func(w io.Writer, contacts []nbf.Contact) error {
+		return nbfexport.WriteVCards(w, contacts, *contactsVersion)
+	}
+	if *contactsCSV != "" {
+		format, err := nbfexport.ParseCSVFormat(*contactsCSV)
+		if err != nil {
+			return err
+		}
+		if *contactsSplit {
+			return errors.New("CSV files cannot be split by contact")
+		}
+		write = func(w io.Writer, contacts []nbf.Contact) error {
+			return nbfexport.WriteContactsCSV(w, contacts, format)
+		}
+	}
+	// Check the vCard version before writing anything.
+	if err := write(io.Discard, nil); err != nil {
+		return err
+	}
+
+	type file struct {
+		name     string
+		contacts []nbf.Contact
+	}
+	files := []file{{args[1], contacts}}
+	if *contactsSplit {
+		files = files[:0]
+		for i, name := range nbfexport.ContactFileNames(contacts) {
+			files = append(files, file{filepath.Join(args[1], name), contacts[i : i+1]})
+		}
+	}
+	if *contactsDryRun {
+		r := nbfexport.Report{W: os.Stdout}
+		for _, fi := range files {
+			r.Add(fi.name, -1)
+		}
+		r.Summary()
+		return nil
+	}
+	if *contactsSplit {
+		if err := os.MkdirAll(args[1], 0755); err != nil {
+			return err
+		}
+	}
+	for _, fi := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := nbfexport.WriteFile(fi.name, *contactsBackup, func(w io.Writer) error {
+			return write(w, fi.contacts)
+		}); err != nil {
+			return err
+		}
+	}
+	log.Printf("%d contacts written to %d files", len(contacts), len(files))
+	return nil
+}
+
+func runContactsPush(ctx context.Context, args []string) error {
+	args = cmdContactsPush.parse(args)
+	if len(args) != 1 || *pushURL == "" {
+		cmdContactsPush.Flags.Usage()
+		os.Exit(2)
+	}
+	f, err := openArchive(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	contacts, err := f.Contacts()
+	f.Close()
+	if err != nil {
+		return err
+	}
+	c := &carddav.Client{URL: *pushURL, User: *pushUser}
+	if c.User != "" {
+		if c.Password = os.Getenv("NBFDAVPASSWORD"); c.Password == "" {
+			if c.Password, err = readPassword(ctx, "Password for "+c.User); err != nil {
+				return errors.New("no password, set NBFDAVPASSWORD")
+			}
+		}
+	}
+	if err := c.Push(ctx, contacts); err != nil {
+		return err
+	}
+	log.Printf("%d contacts pushed to %s", len(contacts), *pushURL)
+	return nil
+}
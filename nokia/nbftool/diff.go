@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+var cmdDiff = newCommand("diff", "old.nbf new.nbf",
+	"list messages and contacts present in only one archive")
+
+func init() { cmdDiff.Run = runDiff }
+
+// An item is a message or contact identified by a content hash.
+type item struct {
+	Hash string
+	Desc string
+}
+
+func runDiff(ctx context.Context, args []string) error {
+	args = cmdDiff.parse(args)
+	if len(args) != 2 {
+		cmdDiff.Flags.Usage()
+		os.Exit(2)
+	}
+	var items [2]map[string]item
+	for i, name := range args {
+		f, err := openArchive(ctx, name)
+		if err != nil {
+			return err
+		}
+		items[i], err = archiveItems(ctx, name, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+
+	var removed, added []item
+	for h, it := range items[0] {
+		if _, ok := items[1][h]; !ok {
+			removed = append(removed, it)
+		}
+	}
+	for h, it := range items[1] {
+		if _, ok := items[0][h]; !ok {
+			added = append(added, it)
+		}
+	}
+	byDesc := func(s []item) {
+		sort.Slice(s, func(i, j int) bool { return s[i].Desc < s[j].Desc })
+	}
+	byDesc(removed)
+	byDesc(added)
+	for _, it := range removed {
+		fmt.Printf("- %s %s\n", it.Hash[:8], it.Desc)
+	}
+	for _, it := range added {
+		fmt.Printf("+ %s %s\n", it.Hash[:8], it.Desc)
+	}
+	fmt.Printf("%d items only in %s, %d items only in %s\n",
+		len(removed), args[0], len(added), args[1])
+	if len(removed)+len(added) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func archiveItems(ctx context.Context, name string, f *nbf.Reader) (map[string]item, error) {
+	items := make(map[string]item)
+	msgs, err := readMessages(ctx, name, f)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range msgs {
+		h := m.ID()
+		dir := "from"
+		if m.Direction != nbf.Received {
+			dir = "to"
+		}
+		items[h] = item{Hash: h, Desc: fmt.Sprintf("message %s %s %s: %q",
+			m.When.Format("2006-01-02 15:04"), dir, m.Peer, abbrev(m.Text, 40))}
+	}
+	contacts, err := f.Contacts()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range contacts {
+		var phones []string
+		for _, p := range c.Phones {
+			phones = append(phones, p.Number)
+		}
+		sort.Strings(phones)
+		h := contentHash("contact", c.Name, strings.Join(phones, ","),
+			strings.Join(c.Emails, ","))
+		items[h] = item{Hash: h, Desc: fmt.Sprintf("contact %s %v", c.Name, phones)}
+	}
+	return items, nil
+}
+
+func contentHash(fields ...string) string {
+	h := sha1.New()
+	for _, s := range fields {
+		fmt.Fprintf(h, "%d:%s;", len(s), s)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func abbrev(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
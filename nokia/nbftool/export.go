@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/nbfexport"
+)
+
+var cmdExport = newCommand("export", "backup.nbf outdir/",
+	"write transcripts of messages, possibly one per thread or year")
+
+var (
+	exportSplit   = cmdExport.Flags.String("split", "", "split transcripts by thread, year, folder or a combination such as thread,year")
+	exportFolders = cmdExport.Flags.Bool("folders", false, "export messages of all folders, not only the inbox and sent items")
+	exportName    = cmdExport.Flags.String("name", "", "template of file names, such as {{.PeerName}}-{{.Year}}{{.Ext}}")
+	exportTmpl    = cmdExport.Flags.String("template", "", "text/template file formatting transcripts")
+	exportLocale  = cmdExport.Flags.String("locale", "", "locale of dates, such as fr or en-US, or auto (default: ISO 8601)")
+	exportFilter  = cmdExport.filterFlags()
+	exportDryRun  = cmdExport.dryRunFlag()
+	exportBackup  = cmdExport.backupFlag()
+)
+
+func init() { cmdExport.Run = runExport }
+
+func runExport(ctx context.Context, args []string) error {
+	args = cmdExport.parse(args)
+	if len(args) != 2 {
+		cmdExport.Flags.Usage()
+		os.Exit(2)
+	}
+	split, err := nbfexport.ParseSplit(*exportSplit)
+	if err != nil {
+		return err
+	}
+	opts := nbfexport.Options{Split: split, DryRun: *exportDryRun, Backup: *exportBackup}
+	if *exportName != "" {
+		if opts.Name, err = nbfexport.ParseNameTemplate(*exportName); err != nil {
+			return err
+		}
+	}
+	if opts.Locale, err = nbfexport.LookupLocale(*exportLocale); err != nil {
+		return err
+	}
+	if *exportTmpl != "" {
+		if opts.Template, err = nbfexport.ParseTemplate(*exportTmpl); err != nil {
+			return err
+		}
+	}
+	filter, err := exportFilter.Filter()
+	if err != nil {
+		return err
+	}
+	f, err := openArchive(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	msgs, err := readMessages(ctx, args[0], f)
+	if err == nil && *exportFolders {
+		msgs, err = readFolders(ctx, f, msgs)
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+	msgs = filter.Slice(msgs)
+	if opts.DryRun {
+		files, err := nbfexport.Plan(msgs, opts)
+		if err != nil {
+			return err
+		}
+		r := nbfexport.Report{W: os.Stdout}
+		for _, f := range files {
+			r.Add(filepath.Join(args[1], filepath.FromSlash(f.Name)), len(f.Messages))
+		}
+		if split != 0 {
+			r.Add(filepath.Join(args[1], nbfexport.IndexName), -1)
+		}
+		r.Summary()
+		return nil
+	}
+	if err := os.MkdirAll(args[1], 0755); err != nil {
+		return err
+	}
+	files, err := nbfexport.WriteContext(ctx, args[1], msgs, opts)
+	if err != nil {
+		return err
+	}
+	log.Printf("%d messages written to %d files in %s", len(msgs), len(files), args[1])
+	return nil
+}
+
+// readFolders appends to msgs the messages of folders other
+// than the inbox and outbox.
+func readFolders(ctx context.Context, f *nbf.Reader, msgs []nbf.SMS) ([]nbf.SMS, error) {
+	for _, fo := range f.Folders() {
+		if fo.ID == nbf.FolderInbox || fo.ID == nbf.FolderOutbox {
+			continue
+		}
+		m, err := f.FolderMessagesContext(ctx, fo.ID)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m...)
+	}
+	return msgs, nil
+}
@@ -0,0 +1,42 @@
+//go:build gammu
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf/gammu"
+)
+
+var cmdGammu = newCommand("gammu-diff", "backup.nbf",
+	"compare decoded messages with libgammu")
+
+func init() { cmdGammu.Run = runGammu }
+
+func runGammu(ctx context.Context, args []string) error {
+	args = cmdGammu.parse(args)
+	if len(args) != 1 {
+		cmdGammu.Flags.Usage()
+		os.Exit(2)
+	}
+	f, err := openArchive(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	diffs, err := gammu.Compare(ctx, f, gammu.Decode)
+	if err != nil {
+		return err
+	}
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		fmt.Printf("%d mismatches found\n", len(diffs))
+		os.Exit(1)
+	}
+	fmt.Println("no mismatches found")
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbfindex"
+)
+
+var cmdIndex = newCommand("index", "backups/",
+	"index a directory of archives, optionally watching for new ones")
+
+var (
+	indexDB       = cmdIndex.Flags.String("db", defaultIndexDir(), "index directory")
+	indexWatch    = cmdIndex.Flags.Bool("watch", false, "keep running and index new archives")
+	indexInterval = cmdIndex.Flags.Duration("interval", time.Minute, "polling interval in watch mode")
+)
+
+var cmdQuery = newCommand("query", "words...",
+	`search indexed messages: words, "phrases", prefix*, peer:x, date:2010-05, OR`)
+
+var queryDB = cmdQuery.Flags.String("db", defaultIndexDir(), "index directory")
+
+func init() {
+	cmdIndex.Run = runIndex
+	cmdQuery.Run = runQuery
+}
+
+func defaultIndexDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ".nbfindex"
+	}
+	return filepath.Join(dir, "nbfindex")
+}
+
+func runIndex(ctx context.Context, args []string) error {
+	args = cmdIndex.parse(args)
+	if len(args) != 1 {
+		cmdIndex.Flags.Usage()
+		os.Exit(2)
+	}
+	idx, err := nbfindex.Open(*indexDB)
+	if err != nil {
+		return err
+	}
+	idx.Password = os.Getenv("NBFPASSWORD")
+	if isTerminal(os.Stderr) {
+		idx.Progress = progressBar
+	}
+	for {
+		added, removed, err := idx.UpdateContext(ctx, args[0])
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if !*indexWatch {
+				return err
+			}
+			log.Print(err)
+		}
+		if added+removed > 0 || !*indexWatch {
+			log.Printf("%d archives indexed, %d removed, %d total",
+				added, removed, len(idx.Archives()))
+		}
+		if !*indexWatch {
+			return nil
+		}
+		t := time.NewTimer(*indexInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func runQuery(ctx context.Context, args []string) error {
+	args = cmdQuery.parse(args)
+	idx, err := nbfindex.Open(*queryDB)
+	if err != nil {
+		return err
+	}
+	hits, err := idx.Query(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	for _, h := range hits {
+		dir := "<"
+		if h.Type != 0 {
+			dir = ">"
+		}
+		fmt.Printf("%s %s %s %s\n", h.When.Format("2006-01-02 15:04"), dir, h.Peer, h.Text)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbfindex"
+)
+
+// copySample copies the sample archive of package nbf to path.
+func copySample(t *testing.T, path string) {
+	t.Helper()
+	data, err := ioutil.ReadFile("../nbf/testdata/sample.nbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// indexed returns the base names of archives of the index
+// in db, and their total number of messages.
+func indexed(t *testing.T, db string) (names []string, messages int) {
+	t.Helper()
+	idx, err := nbfindex.Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range idx.Archives() {
+		names = append(names, filepath.Base(a.Path))
+		messages += len(a.Messages)
+	}
+	return names, messages
+}
+
+func TestRunIndex(t *testing.T) {
+	root, db := t.TempDir(), t.TempDir()
+	copySample(t, filepath.Join(root, "a.nbf"))
+	if err := runIndex(context.Background(), []string{"-db", db, root}); err != nil {
+		t.Fatal(err)
+	}
+	if names, n := indexed(t, db); !reflect.DeepEqual(names, []string{"a.nbf"}) || n != 3 {
+		t.Fatalf("got archives %q with %d messages", names, n)
+	}
+
+	// Archives are added and removed incrementally.
+	copySample(t, filepath.Join(root, "b.nbf"))
+	if err := os.Remove(filepath.Join(root, "a.nbf")); err != nil {
+		t.Fatal(err)
+	}
+	if err := runIndex(context.Background(), []string{"-db", db, root}); err != nil {
+		t.Fatal(err)
+	}
+	if names, n := indexed(t, db); !reflect.DeepEqual(names, []string{"b.nbf"}) || n != 3 {
+		t.Fatalf("got archives %q with %d messages after update", names, n)
+	}
+
+	// Watch mode indexes new archives until cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- runIndex(ctx, []string{"-db", db, "-watch", "-interval", "10ms", root})
+	}()
+	copySample(t, filepath.Join(root, "c.nbf"))
+	deadline := time.Now().Add(5 * time.Second)
+	for names, _ := indexed(t, db); len(names) != 2; names, _ = indexed(t, db) {
+		if time.Now().After(deadline) {
+			t.Fatalf("new archive not indexed: got %q", names)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("watch returned %v, expected context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not stop when cancelled")
+	}
+	*indexWatch = false
+}
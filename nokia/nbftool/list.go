@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+var cmdList = newCommand("list", "backup.nbf",
+	"list message entries without decoding them")
+
+var (
+	listDecode = cmdList.Flags.Bool("text", false, "decode messages and print their text")
+	listLang   = cmdList.Flags.String("lang", "", "list only text messages in this language (ISO 639-1 code)")
+)
+
+func init() { cmdList.Run = runList }
+
+func runList(ctx context.Context, args []string) error {
+	args = cmdList.parse(args)
+	if len(args) != 1 {
+		cmdList.Flags.Usage()
+		os.Exit(2)
+	}
+	f, err := openArchive(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hdrs, err := f.List()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SEQ\tFOLDER\tDATE\tPEER\tKIND\tPART")
+	for _, h := range hdrs {
+		kind := "sms"
+		if h.IsMMS() {
+			kind = "mms"
+		}
+		var m nbf.SMS
+		var err error
+		if (*listDecode || *listLang != "") && !h.IsMMS() {
+			m, err = h.SMS()
+		}
+		if *listLang != "" && (h.IsMMS() || err != nil || m.Language() != *listLang) {
+			continue
+		}
+		part := ""
+		if h.PartTotal > 1 {
+			part = fmt.Sprintf("%d/%d", h.PartNo, h.PartTotal)
+		}
+		fmt.Fprintf(w, "%x\t%d\t%s\t%s\t%s\t%s",
+			h.Seq, h.Folder, h.When.Format("2006-01-02 15:04"), h.Peer, kind, part)
+		if *listDecode && !h.IsMMS() {
+			if err != nil {
+				fmt.Fprintf(w, "\terror: %s", err)
+			} else {
+				fmt.Fprintf(w, "\t%q", m.Text)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,264 @@
+// nbftool is a utility to inspect and manipulate NBF archives.
+//
+// Usage:
+//
+//	nbftool command [flags] arguments...
+//
+// Run nbftool without arguments for the list of commands.
+//
+// If the NBFCACHE environment variable names a directory, decoded
+// messages are cached there, so that later invocations on an
+// unmodified archive do not need to parse it again.
+//
+// Archives may be given as http:// or https:// URLs of servers
+// supporting range requests: only the needed parts are downloaded.
+//
+// Encrypted archives are decrypted with the password in the
+// NBFPASSWORD environment variable, or a password typed on the
+// terminal. They are not cached in NBFCACHE.
+//
+// If NBFDEBUG is set, the decoding of entries is traced on
+// standard error, bypassing NBFCACHE.
+//
+// The contacts push command uploads the phonebook to a CardDAV
+// server, with the password in the NBFDAVPASSWORD environment
+// variable or typed on the terminal.
+//
+// Built with the gammu tag, nbftool has a gammu-diff command
+// comparing decoded messages with libgammu.
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/nbf/remote"
+	"github.com/remyoudompheng/go-misc/nokia/nbfindex"
+)
+
+type command struct {
+	Name  string
+	Args  string
+	Short string
+	Flags *flag.FlagSet
+	Run   func(ctx context.Context, args []string) error
+}
+
+var commands []*command
+
+func newCommand(name, args, short string) *command {
+	c := &command{Name: name, Args: args, Short: short}
+	c.Flags = flag.NewFlagSet(name, flag.ExitOnError)
+	c.Flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s [flags] %s\n", os.Args[0], c.Name, c.Args)
+		c.Flags.PrintDefaults()
+	}
+	commands = append(commands, c)
+	return c
+}
+
+// parse parses command-line flags, allowing them to appear
+// after positional arguments.
+func (c *command) parse(args []string) (pos []string) {
+	for {
+		c.Flags.Parse(args)
+		args = c.Flags.Args()
+		if len(args) == 0 {
+			return pos
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+}
+
+// dryRunFlag registers the -dry-run flag for c.
+func (c *command) dryRunFlag() *bool {
+	return c.Flags.Bool("dry-run", false, "report files which would be created or overwritten, without writing anything")
+}
+
+// backupFlag registers the -backup flag for c.
+func (c *command) backupFlag() *bool {
+	return c.Flags.Bool("backup", false, "keep replaced files with a .bak suffix")
+}
+
+// filterFlags registers flags selecting messages for c.
+func (c *command) filterFlags() *nbf.FilterFlags {
+	ff := new(nbf.FilterFlags)
+	ff.Register(c.Flags)
+	return ff
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s command [flags] arguments...\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "\t%-12s %s\n", c.Name, c.Short)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("nbftool: ")
+	if len(os.Args) < 2 {
+		usage()
+	}
+	// Interrupting long scans and exports leaves written
+	// files complete.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		// A second interrupt kills the program.
+		<-ctx.Done()
+		stop()
+	}()
+	for _, c := range commands {
+		if c.Name == os.Args[1] {
+			if err := c.Run(ctx, os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+	usage()
+}
+
+// readMessages returns received and sent messages of f,
+// opened from file name.
+func readMessages(ctx context.Context, name string, f *nbf.Reader) ([]nbf.SMS, error) {
+	if dir := os.Getenv("NBFCACHE"); dir != "" && !f.Encrypted() && !isURL(name) && f.Logger == nil {
+		return nbfindex.LoadContext(ctx, dir, name)
+	}
+	inbox, err := f.InboxContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	outbox, err := f.OutboxContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(inbox, outbox...), nil
+}
+
+// openArchive opens a NBF file, or a http:// or https:// URL,
+// showing scan progress if standard error is a terminal.
+func openArchive(ctx context.Context, name string) (*nbf.Reader, error) {
+	var f *nbf.Reader
+	var err error
+	if isURL(name) {
+		var rf *remote.File
+		if rf, err = remote.Open(name); err == nil {
+			f, err = nbf.NewReader(rf, rf.Size())
+		}
+	} else {
+		f, err = nbf.OpenFile(name)
+	}
+	if errors.Is(err, zip.ErrFormat) && !isURL(name) {
+		log.Printf("%s: %s, scanning for entries", name, err)
+		f, err = nbf.RecoverFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.Encrypted() {
+		if f.Password, err = archivePassword(ctx, name); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if os.Getenv("NBFDEBUG") != "" {
+		f.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	} else if isTerminal(os.Stderr) {
+		f.Progress = progressBar
+	}
+	return f, nil
+}
+
+func isURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// archivePassword returns the password of an encrypted archive,
+// from the environment or typed on the terminal.
+func archivePassword(ctx context.Context, name string) (string, error) {
+	if pw := os.Getenv("NBFPASSWORD"); pw != "" {
+		return pw, nil
+	}
+	pw, err := readPassword(ctx, "Password for "+name)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s is encrypted, set NBFPASSWORD", name)
+	}
+	return pw, nil
+}
+
+// readPassword reads a password typed on the terminal.
+// Interrupting the program aborts the prompt, returning
+// the error of ctx.
+func readPassword(ctx context.Context, prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	defer tty.Close()
+	stty := func(arg string) {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = tty
+		cmd.Run()
+	}
+	fmt.Fprintf(tty, "%s: ", prompt)
+	stty("-echo")
+	defer func() {
+		stty("echo")
+		fmt.Fprintln(tty)
+	}()
+	type result struct {
+		line string
+		err  error
+	}
+	c := make(chan result, 1)
+	go func() {
+		line, err := bufio.NewReader(tty).ReadString('\n')
+		c <- result{line, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case r := <-c:
+		if r.err != nil {
+			return "", r.err
+		}
+		return strings.TrimRight(r.line, "\r\n"), nil
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+// progressBar draws a progress bar on standard error.
+func progressBar(done, total int) {
+	const width = 40
+	n := width
+	if total > 0 {
+		n = done * width / total
+	}
+	fmt.Fprintf(os.Stderr, "\r[%s%s] %d/%d", strings.Repeat("#", n), strings.Repeat(" ", width-n), done, total)
+	if done >= total {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+	}
+}
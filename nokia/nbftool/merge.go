@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/nbfexport"
+)
+
+var cmdMerge = newCommand("merge", "backup.nbf...",
+	"merge messages of several archives, removing duplicates")
+
+var (
+	mergeOutput = cmdMerge.Flags.String("o", "", "output file (default: standard output)")
+	mergeDryRun = cmdMerge.dryRunFlag()
+	mergeBackup = cmdMerge.backupFlag()
+)
+
+func init() { cmdMerge.Run = runMerge }
+
+func runMerge(ctx context.Context, args []string) error {
+	args = cmdMerge.parse(args)
+	if len(args) == 0 {
+		cmdMerge.Flags.Usage()
+		os.Exit(2)
+	}
+	var m nbf.Merger
+	for _, name := range args {
+		f, err := openArchive(ctx, name)
+		if err != nil {
+			return err
+		}
+		err = m.AddArchiveContext(ctx, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+
+	msgs := m.Messages()
+	if *mergeDryRun {
+		r := nbfexport.Report{W: os.Stdout}
+		if *mergeOutput != "" {
+			r.Add(*mergeOutput, len(msgs))
+		}
+		r.Summary()
+		return nil
+	}
+
+	var err error
+	if *mergeOutput != "" {
+		err = nbfexport.WriteFile(*mergeOutput, *mergeBackup, m.WriteJSON)
+	} else {
+		err = m.WriteJSON(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+	for _, f := range m.Folders() {
+		log.Printf("%s: %d messages after merge", f.Name, f.Entries)
+	}
+	return nil
+}
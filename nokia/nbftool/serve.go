@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/mms"
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/nbfexport"
+	"github.com/remyoudompheng/go-misc/nokia/nbfindex"
+)
+
+var cmdServe = newCommand("serve", "backup.nbf",
+	"browse an archive in a web browser")
+
+var (
+	serveAddr   = cmdServe.Flags.String("http", "localhost:8080", "listen address")
+	serveFilter = cmdServe.filterFlags()
+	serveLocale = cmdServe.Flags.String("locale", "", "locale of dates, such as fr or en-US, or auto (default: ISO 8601)")
+
+	// locale formats dates of pages.
+	locale *nbfexport.Locale
+)
+
+func init() { cmdServe.Run = runServe }
+
+// A viewer holds the decoded contents of an archive.
+type viewer struct {
+	Name    string
+	Threads []nbf.Thread
+	MMS     []nbf.MMS
+
+	msgs []nbf.SMS           // messages of Threads, in order
+	text *nbfindex.TextIndex // of msgs
+
+	archive *nbf.Reader // read by pages of the API
+	filter  nbf.Filter
+}
+
+func loadViewer(ctx context.Context, name string, filter nbf.Filter) (*viewer, error) {
+	f, err := openArchive(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := readMessages(ctx, name, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	msgs = filter.Slice(msgs)
+	mms, err := f.MMSContext(ctx)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// The archive stays open for the API, which reads the same
+	// pages repeatedly and must not draw progress bars.
+	f.Progress, f.Cache = nil, true
+	v := &viewer{Name: name, Threads: nbf.Threads(msgs), MMS: mms,
+		archive: f, filter: filter}
+	for _, t := range v.Threads {
+		v.msgs = append(v.msgs, t.Messages...)
+	}
+	v.text = nbfindex.NewTextIndex(v.msgs)
+	return v, nil
+}
+
+func runServe(ctx context.Context, args []string) error {
+	args = cmdServe.parse(args)
+	if len(args) != 1 {
+		cmdServe.Flags.Usage()
+		os.Exit(2)
+	}
+	filter, err := serveFilter.Filter()
+	if err != nil {
+		return err
+	}
+	if locale, err = nbfexport.LookupLocale(*serveLocale); err != nil {
+		return err
+	}
+	v, err := loadViewer(ctx, args[0], filter)
+	if err != nil {
+		return err
+	}
+	defer v.archive.Close()
+	mux := http.NewServeMux()
+	v.register(mux)
+	log.Printf("serving %s on http://%s/", args[0], *serveAddr)
+	srv := &http.Server{Addr: *serveAddr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return ctx.Err()
+}
+
+func (v *viewer) register(mux *http.ServeMux) {
+	mux.HandleFunc("/", v.index)
+	mux.HandleFunc("/thread", v.thread)
+	mux.HandleFunc("/find", v.search)
+	mux.HandleFunc("/mms", v.mmsList)
+	mux.HandleFunc("/mms/part", v.mmsPart)
+	v.registerAPI(mux)
+}
+
+func (v *viewer) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := viewerTpl.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("template %s: %s", name, err)
+	}
+}
+
+func (v *viewer) index(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	v.render(w, "index", v)
+}
+
+func (v *viewer) thread(w http.ResponseWriter, req *http.Request) {
+	peer := req.FormValue("peer")
+	for _, t := range v.Threads {
+		if t.Peer == peer {
+			v.render(w, "thread", t)
+			return
+		}
+	}
+	http.NotFound(w, req)
+}
+
+func (v *viewer) search(w http.ResponseWriter, req *http.Request) {
+	q := req.FormValue("q")
+	results, err := v.find(q)
+	v.render(w, "search", struct {
+		Query   string
+		Results []nbf.SMS
+		Err     error
+	}{q, results, err})
+}
+
+// find returns messages matching query q (see
+// nbfindex.TextIndex.Query), by thread.
+func (v *viewer) find(q string) (results []nbf.SMS, err error) {
+	docs, err := v.text.Query(q)
+	for _, i := range docs {
+		results = append(results, v.msgs[i])
+	}
+	return results, err
+}
+
+func (v *viewer) mmsList(w http.ResponseWriter, req *http.Request) {
+	v.render(w, "mms", v.MMS)
+}
+
+func (v *viewer) mmsPart(w http.ResponseWriter, req *http.Request) {
+	i, err1 := strconv.Atoi(req.FormValue("m"))
+	j, err2 := strconv.Atoi(req.FormValue("p"))
+	if err1 != nil || err2 != nil || i < 0 || i >= len(v.MMS) ||
+		j < 0 || j >= len(v.MMS[i].Parts) {
+		http.NotFound(w, req)
+		return
+	}
+	p := v.MMS[i].Parts[j]
+	w.Header().Set("Content-Type", p.MediaType())
+	w.Write(p.Data)
+}
+
+var viewerTpl = template.Must(template.New("viewer").Funcs(template.FuncMap{
+	"date":    func(t time.Time) string { return locale.DateTime(t) },
+	"snippet": func(s string) string { return abbrev(s, 60) },
+	"isImage": func(ctype string) bool { return strings.HasPrefix(ctype, "image/") },
+	"isText":  func(ctype string) bool { return ctype == "text/plain" },
+	"str":     func(b []byte) string { return string(b) },
+	"media":   mediaInfo,
+}).Parse(viewerTplString))
+
+const viewerTplString = `
+{{ define "header" }}<!DOCTYPE html>
+<html>
+<head>
+	<title>NBF viewer</title>
+	<meta http-equiv="Content-Type" content="text/html; charset=utf-8" />
+	<style>
+	body { font-family: sans-serif; max-width: 50em; margin: auto; }
+	.msg { margin: 0.5em 0; padding: 0.3em 0.6em; border-radius: 0.5em; }
+	.in { background: #eee; margin-right: 20%; }
+	.out { background: #cde; margin-left: 20%; }
+	.date { color: #666; font-size: small; }
+	</style>
+</head>
+<body>
+	<p><a href="/">Threads</a> | <a href="/mms">MMS</a> |
+	<form style="display: inline" action="/find"><input name="q" placeholder="Search"/></form></p>
+{{ end }}
+
+{{ define "footer" }}</body>
+</html>{{ end }}
+
+{{ define "message" }}
+	<div class="msg {{ if eq .Type 0 }}in{{ else }}out{{ end }}">
+	<div class="date">{{ date .When }} {{ if eq .Type 0 }}from{{ else }}to{{ end }} {{ .Peer }}</div>
+	{{ .Text }}
+	</div>
+{{ end }}
+
+{{ define "index" }}{{ template "header" }}
+	<h1>{{ .Name }}</h1>
+	<table>
+	{{ range .Threads }}
+	<tr>
+		<td><a href="/thread?peer={{ .Peer }}">{{ if .Peer }}{{ .Peer }}{{ else }}(unknown){{ end }}</a></td>
+		<td>{{ len .Messages }}</td>
+		<td>{{ date .Last.When }}</td>
+		<td>{{ snippet .Last.Text }}</td>
+	</tr>
+	{{ end }}
+	</table>
+{{ template "footer" }}{{ end }}
+
+{{ define "thread" }}{{ template "header" }}
+	<h1>{{ .Peer }}</h1>
+	{{ range .Messages }}{{ template "message" . }}{{ end }}
+{{ template "footer" }}{{ end }}
+
+{{ define "search" }}{{ template "header" }}
+	<h1>Search: {{ .Query }}</h1>
+	{{ if .Err }}<p>{{ .Err }}</p>{{ else }}<p>{{ len .Results }} results</p>{{ end }}
+	{{ range .Results }}{{ template "message" . }}{{ end }}
+{{ template "footer" }}{{ end }}
+
+{{ define "mms" }}{{ template "header" }}
+	<h1>MMS</h1>
+	{{ range $i, $m := . }}
+	<div class="msg in">
+	<div class="date">{{ date $m.Stamp }} {{ $m.Peer }} {{ index $m.Header "Subject" }}</div>
+	{{ range $j, $p := $m.Parts }}
+		{{ if isImage $p.MediaType }}<img src="/mms/part?m={{ $i }}&amp;p={{ $j }}" style="max-width: 100%"/>
+		{{ else if isText $p.ContentType }}<p>{{ str $p.Data }}</p>
+		{{ else }}<p><a href="/mms/part?m={{ $i }}&amp;p={{ $j }}">{{ $p.Filename }} ({{ with media $p }}{{ . }}{{ else }}{{ $p.MediaType }}{{ end }})</a></p>{{ end }}
+	{{ end }}
+	</div>
+	{{ end }}
+{{ template "footer" }}{{ end }}
+`
+
+// mediaInfo describes audio and video parts, as "0:42 voice message".
+func mediaInfo(p mms.Part) string {
+	info, err := mms.ParseMedia(p.Data)
+	if err != nil {
+		return ""
+	}
+	return info.String()
+}
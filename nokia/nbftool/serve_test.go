@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testServer returns the handler of the serve command
+// for the sample archive of package nbf.
+func testServer(t *testing.T) http.Handler {
+	t.Helper()
+	v, err := loadViewer(context.Background(), "../nbf/testdata/sample.nbf", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { v.archive.Close() })
+	mux := http.NewServeMux()
+	v.register(mux)
+	return mux
+}
+
+func get(h http.Handler, url string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	return w
+}
+
+func TestServe(t *testing.T) {
+	h := testServer(t)
+	for _, tt := range []struct {
+		url      string
+		status   int
+		contains []string
+	}{
+		{"/", 200, []string{"sample.nbf", "peer=%2b33612345678", "Thanks, Bob ☺"}},
+		{"/missing", 404, nil},
+		{"/thread?peer=%2B33612345678", 200, []string{"Hello there", "This message is split in three parts",
+			`class="msg out"`}},
+		{"/thread?peer=nobody", 404, nil},
+		{"/find?q=split", 200, []string{"1 results", "three parts"}},
+		{"/mms", 200, []string{"Hello", `src="/mms/part?m=0&amp;p=1"`}},
+		{"/mms/part?m=1&p=0", 404, nil},
+		{"/mms/part?m=0&p=x", 404, nil},
+	} {
+		w := get(h, tt.url)
+		if w.Code != tt.status {
+			t.Errorf("GET %s: got status %d, expected %d", tt.url, w.Code, tt.status)
+			continue
+		}
+		for _, s := range tt.contains {
+			if !strings.Contains(w.Body.String(), s) {
+				t.Errorf("GET %s: missing %q in\n%s", tt.url, s, w.Body)
+			}
+		}
+	}
+
+	w := get(h, "/mms/part?m=0&p=1")
+	if ct := w.Header().Get("Content-Type"); w.Code != 200 || ct != "image/jpeg" ||
+		!bytes.Equal(w.Body.Bytes(), []byte{0xff, 0xd8, 0xff, 0xd9}) {
+		t.Errorf("MMS part: got status %d, type %q, data %x", w.Code, ct, w.Body.Bytes())
+	}
+}
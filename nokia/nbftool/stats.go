@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+var cmdStats = newCommand("stats", "backup.nbf",
+	"print message statistics")
+
+var (
+	statsJSON = cmdStats.Flags.Bool("json", false, "output statistics as JSON")
+	statsLang = cmdStats.Flags.String("lang", "", "count only messages in this language (ISO 639-1 code)")
+	statsAuto = cmdStats.Flags.Bool("noauto", false, "skip messages from automated senders")
+
+	statsFilter = cmdStats.filterFlags()
+)
+
+func init() { cmdStats.Run = runStats }
+
+func runStats(ctx context.Context, args []string) error {
+	args = cmdStats.parse(args)
+	if len(args) != 1 {
+		cmdStats.Flags.Usage()
+		os.Exit(2)
+	}
+	f, err := openArchive(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	filter, err := statsFilter.Filter()
+	if err != nil {
+		return err
+	}
+	if *statsLang != "" {
+		filter = nbf.All(filter, func(m nbf.SMS) bool { return m.Language() == *statsLang })
+	}
+	if *statsAuto {
+		filter = nbf.All(filter, nbf.Not(nbf.SMS.Automated))
+	}
+	diag := new(nbf.Diagnostics)
+	f.Diagnostics = diag
+	st, err := f.StatsContext(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if *statsJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(st)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "SMS entries:\t%d\n", st.SMS)
+	fmt.Fprintf(w, "MMS entries:\t%d\n", st.MMS)
+	var unknown []int
+	for bits := range st.UnknownFlags {
+		unknown = append(unknown, int(bits))
+	}
+	sort.Ints(unknown)
+	for _, bits := range unknown {
+		fmt.Fprintf(w, "Unknown flags 0x%04x:\t%d\n", bits, st.UnknownFlags[uint16(bits)])
+	}
+	var folders []int
+	for n := range st.Folders {
+		folders = append(folders, n)
+	}
+	sort.Ints(folders)
+	for _, n := range folders {
+		fmt.Fprintf(w, "Folder %d (%s):\t%d\n", n, nbf.FolderName(n), st.Folders[n])
+	}
+	counts := diag.Counts()
+	for _, k := range slices.Sorted(maps.Keys(counts)) {
+		fmt.Fprintf(w, "Diagnostics, %s:\t%d\n", k, counts[k])
+	}
+	fmt.Fprintf(w, "Received:\t%d\n", st.Inbox)
+	fmt.Fprintf(w, "Sent:\t%d\n", st.Outbox)
+	if !st.First.IsZero() {
+		fmt.Fprintf(w, "First message:\t%s\n", st.First.Format("2006-01-02 15:04"))
+		fmt.Fprintf(w, "Last message:\t%s\n", st.Last.Format("2006-01-02 15:04"))
+	}
+	var langs []string
+	for lang := range st.Languages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	for _, lang := range langs {
+		name := lang
+		if name == "" {
+			name = "unknown"
+		}
+		fmt.Fprintf(w, "Language %s:\t%d\n", name, st.Languages[lang])
+	}
+	var senders []string
+	for s := range st.Senders {
+		senders = append(senders, s)
+	}
+	sort.Strings(senders)
+	for _, s := range senders {
+		fmt.Fprintf(w, "Sender %s:\t%d\n", s, st.Senders[s])
+	}
+	fmt.Fprintf(w, "\nPEER\tRECEIVED\tSENT\n")
+	for _, p := range st.Peers {
+		peer := p.Peer
+		if peer == "" {
+			peer = "(unknown)"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\n", peer, p.Received, p.Sent)
+	}
+	return w.Flush()
+}
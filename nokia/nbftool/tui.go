@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/nbfindex"
+)
+
+var cmdTUI = newCommand("tui", "backup.nbf",
+	"browse an archive in the terminal")
+
+var tuiFilter = cmdTUI.filterFlags()
+
+func init() { cmdTUI.Run = runTUI }
+
+// The terminal UI is drawn with plain ANSI escape sequences,
+// the terminal being put in raw mode using stty(1).
+//
+// Keys:
+//	j/k, arrows    move in thread list (or scroll messages)
+//	tab            switch between thread list and messages
+//	/              incremental search, enter to validate, esc to clear
+//
+// Searches use the syntax of the query command, the last word
+// being a prefix while it is typed.
+//	q              quit
+
+type tui struct {
+	all      []nbf.Thread
+	threads  []nbf.Thread // filtered by search
+	sel      int          // selected thread
+	top      int          // first visible thread
+	scroll   int          // message pane scroll offset (lines from bottom)
+	focusMsg bool
+	search   string
+	editing  bool
+
+	text   *nbfindex.TextIndex // of messages of all threads
+	thread []int               // thread of indexed messages
+
+	width, height int
+	out           *bufio.Writer
+}
+
+func runTUI(ctx context.Context, args []string) error {
+	args = cmdTUI.parse(args)
+	if len(args) != 1 {
+		cmdTUI.Flags.Usage()
+		os.Exit(2)
+	}
+	filter, err := tuiFilter.Filter()
+	if err != nil {
+		return err
+	}
+	f, err := openArchive(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	msgs, err := readMessages(ctx, args[0], f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	msgs = filter.Slice(msgs)
+	t := &tui{all: nbf.Threads(msgs), out: bufio.NewWriter(os.Stdout)}
+	t.threads = t.all
+	var indexed []nbf.SMS
+	for i, th := range t.all {
+		indexed = append(indexed, th.Messages...)
+		for range th.Messages {
+			t.thread = append(t.thread, i)
+		}
+	}
+	t.text = nbfindex.NewTextIndex(indexed)
+	t.height, t.width = terminalSize()
+
+	if err := stty("raw", "-echo"); err != nil {
+		return err
+	}
+	defer func() {
+		stty("sane")
+		fmt.Print("\x1b[?1049l\x1b[?25h")
+	}()
+	fmt.Print("\x1b[?1049h\x1b[?25l") // alternate screen, hide cursor
+	buf := make([]byte, 16)
+	for {
+		t.draw()
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return err
+		}
+		if !t.key(string(buf[:n])) {
+			return nil
+		}
+	}
+}
+
+func stty(args ...string) error {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+func terminalSize() (rows, cols int) {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err == nil {
+		fmt.Sscan(string(out), &rows, &cols)
+	}
+	if rows <= 0 || cols <= 0 {
+		return 24, 80
+	}
+	return rows, cols
+}
+
+// key handles a key press and reports whether to continue.
+func (t *tui) key(k string) bool {
+	if t.editing {
+		switch k {
+		case "\r", "\n":
+			t.editing = false
+		case "\x1b":
+			t.editing = false
+			t.search = ""
+		case "\x7f", "\b":
+			if len(t.search) > 0 {
+				_, size := utf8.DecodeLastRuneInString(t.search)
+				t.search = t.search[:len(t.search)-size]
+			}
+		default:
+			if k[0] >= ' ' {
+				t.search += k
+			}
+		}
+		t.filter()
+		return true
+	}
+	switch k {
+	case "q", "\x03":
+		return false
+	case "/":
+		t.editing = true
+	case "\x1b":
+		t.search = ""
+		t.filter()
+	case "\t":
+		t.focusMsg = !t.focusMsg
+	case "j", "\x1b[B":
+		if t.focusMsg {
+			if t.scroll > 0 {
+				t.scroll--
+			}
+		} else if t.sel+1 < len(t.threads) {
+			t.sel++
+			t.scroll = 0
+		}
+	case "k", "\x1b[A":
+		if t.focusMsg {
+			t.scroll++
+		} else if t.sel > 0 {
+			t.sel--
+			t.scroll = 0
+		}
+	}
+	return true
+}
+
+// filter restricts the thread list to threads matching the search.
+func (t *tui) filter() {
+	t.sel, t.top, t.scroll = 0, 0, 0
+	if t.search == "" {
+		t.threads = t.all
+		return
+	}
+	q := t.search
+	if r, _ := utf8.DecodeLastRuneInString(q); unicode.IsLetter(r) || unicode.IsDigit(r) {
+		q += "*"
+	}
+	docs, err := t.text.Query(q)
+	if err != nil {
+		return // incomplete query, keep previous results
+	}
+	t.threads = nil
+	last := -1
+	for _, doc := range docs {
+		// docs are sorted, hence grouped by thread.
+		if i := t.thread[doc]; i != last {
+			t.threads = append(t.threads, t.all[i])
+			last = i
+		}
+	}
+}
+
+const listWidth = 24
+
+func (t *tui) draw() {
+	w := t.out
+	w.WriteString("\x1b[H\x1b[2J")
+	rows := t.height - 1
+
+	// thread list
+	if t.sel < t.top {
+		t.top = t.sel
+	}
+	if t.sel >= t.top+rows {
+		t.top = t.sel - rows + 1
+	}
+	for i := 0; i < rows && t.top+i < len(t.threads); i++ {
+		th := t.threads[t.top+i]
+		peer := th.Peer
+		if peer == "" {
+			peer = "(unknown)"
+		}
+		line := fit(fmt.Sprintf("%s (%d)", peer, len(th.Messages)), listWidth-1)
+		fmt.Fprintf(w, "\x1b[%d;1H", i+1)
+		if t.top+i == t.sel {
+			if t.focusMsg {
+				w.WriteString("\x1b[4m")
+			} else {
+				w.WriteString("\x1b[7m")
+			}
+			w.WriteString(line + "\x1b[0m")
+		} else {
+			w.WriteString(line)
+		}
+	}
+
+	// message pane
+	if t.sel < len(t.threads) {
+		var lines []string
+		width := t.width - listWidth - 1
+		for _, m := range t.threads[t.sel].Messages {
+			dir := "<"
+			if m.Direction != nbf.Received {
+				dir = ">"
+			}
+			lines = append(lines, fmt.Sprintf("\x1b[2m%s %s\x1b[0m", dir, m.When.Format("2006-01-02 15:04")))
+			for _, l := range strings.Split(m.Text, "\n") {
+				lines = append(lines, wrap(l, width)...)
+			}
+			lines = append(lines, "")
+		}
+		if max := len(lines) - rows; t.scroll > max {
+			t.scroll = max
+		}
+		if t.scroll < 0 {
+			t.scroll = 0
+		}
+		start := len(lines) - rows - t.scroll
+		if start < 0 {
+			start = 0
+		}
+		for i := 0; i < rows && start+i < len(lines); i++ {
+			fmt.Fprintf(w, "\x1b[%d;%dH%s", i+1, listWidth+2, lines[start+i])
+		}
+	}
+
+	// status line
+	fmt.Fprintf(w, "\x1b[%d;1H\x1b[7m", t.height)
+	var status string
+	switch {
+	case t.editing:
+		status = "/" + t.search
+	case t.search != "":
+		status = fmt.Sprintf("%d threads matching %q (esc to clear)", len(t.threads), t.search)
+	default:
+		status = fmt.Sprintf("%d threads  j/k: move  tab: focus  /: search  q: quit", len(t.threads))
+	}
+	w.WriteString(fit(status, t.width) + "\x1b[0m")
+	w.Flush()
+}
+
+// fit pads or truncates s to n runes.
+func fit(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s + strings.Repeat(" ", n-len(r))
+}
+
+// wrap splits s into lines of at most n runes.
+func wrap(s string, n int) (lines []string) {
+	r := []rune(s)
+	for len(r) > n && n > 0 {
+		lines = append(lines, string(r[:n]))
+		r = r[n:]
+	}
+	return append(lines, string(r))
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+var cmdVerify = newCommand("verify", "backup.nbf",
+	"check archive integrity and report corrupt entries")
+
+func init() { cmdVerify.Run = runVerify }
+
+func runVerify(ctx context.Context, args []string) error {
+	args = cmdVerify.parse(args)
+	if len(args) != 1 {
+		cmdVerify.Flags.Usage()
+		os.Exit(2)
+	}
+	f, err := openArchive(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	problems, err := f.VerifyContext(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d problems found\n", len(problems))
+		os.Exit(1)
+	}
+	fmt.Println("no problems found")
+	return nil
+}